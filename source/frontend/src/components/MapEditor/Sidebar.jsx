@@ -205,6 +205,12 @@ function Sidebar({ onGoto, onToggleDraw, onGenerateRandomObstacles, isMapReady,
                 <option value="antpath">Ant Path</option>
                 <option value="rrt">RRT</option>
                 <option value="rrtstar">RRT*</option>
+                <option value="rrtconnect">RRT-Connect</option>
+                <option value="prm">PRM</option>
+                <option value="visgraph">Visibility Graph</option>
+                <option value="astar">A*</option>
+                <option value="thetastar">Theta*</option>
+                <option value="portfolio">Portfolio</option>
               </select>
             </div>
             <div className="mb-3">
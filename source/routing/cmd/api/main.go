@@ -93,7 +93,7 @@ func Run() error {
 			fmt.Printf("✅ Valid RoutingRequest %s with %d wps and %d constraints (topic=%s, partition=%d, offset=%d)\n", req.RequestID, len(req.Waypoints), len(req.Constraints), r.Topic, r.Partition, r.Offset)
 
 			// 2. Run RoutingService
-			myResp, found := rs.HandleRoutingRequest(req, v)
+			myResp, found := rs.HandleRoutingRequest(k.Ctx, req, v)
 			if found {
 				fmt.Printf("✅ ROUTE FOUND\n")
 			} else {
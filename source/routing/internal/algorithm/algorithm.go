@@ -1,13 +1,18 @@
 package algorithm
 
 import (
+	"context"
 	"fmt"
 	"geopathplanner/routing/internal/models"
+	"geopathplanner/routing/internal/utils"
+	"slices"
 )
 
 type Algorithm interface {
-	Compute(searchVolume *models.Feature3D, waypoints []*models.Waypoint, constraints []*models.Feature3D, parameters map[string]any, storage models.StorageType) ([]*models.Waypoint, float64, error)
-	ComputeConcurrently(searchVolume *models.Feature3D, waypoints []*models.Waypoint, constraints []*models.Feature3D, parameters map[string]any, storage models.StorageType, maxWorkers int) ([]*models.Waypoint, float64, error)
+	Compute(ctx context.Context, searchVolume *models.Feature3D, waypoints []*models.Waypoint, constraints []*models.Feature3D, parameters map[string]any, storage models.StorageType) ([]*models.Waypoint, float64, error)
+	// ComputeConcurrently plans the legs between consecutive waypoints at once, on up to maxWorkers goroutines (one per CPU if 0).
+	// Legs that depend on the previous one are still planned one after the other, see computeLegsConcurrently.
+	ComputeConcurrently(ctx context.Context, searchVolume *models.Feature3D, waypoints []*models.Waypoint, constraints []*models.Feature3D, parameters map[string]any, storage models.StorageType, maxWorkers int) ([]*models.Waypoint, float64, error)
 
 }
 
@@ -19,9 +24,131 @@ func NewAlgorithm(algorithmType models.AlgorithmType) (Algorithm, error) {
 		return NewAntPathAlgorithm()
 	case models.RRTStar:
 		return NewRRTStarAlgorithm()
+	case models.RRTConnect:
+		return NewRRTConnectAlgorithm()
+	case models.PRM:
+		return NewPRMAlgorithm()
+	case models.VisGraph:
+		return NewVisGraphAlgorithm()
+	case models.AStar:
+		return NewAStarAlgorithm()
+	case models.ThetaStar:
+		return NewThetaStarAlgorithm()
+	case models.Portfolio:
+		return NewPortfolioAlgorithm()
 	default:
 		// return nil, fmt.Errorf("algorithm currently not implemented: %s", algorithmType)
 		return nil, fmt.Errorf("algorithm not recognized: %s", algorithmType)
 
 	}
-}
\ No newline at end of file
+}
+
+// CheckAcceptanceRadius returns an error if a wp has an acceptance radius and one of the algorithms that may plan its legs would ignore it:
+// algorithmType, the ones in parameters.fallback_algorithms and the candidates of a portfolio.
+// Acceptance radii don't go with parameters.optimize_order either: a leg starts where the previous one entered the radius,
+// which is not known when every pair of wps is planned on its own.
+func CheckAcceptanceRadius(algorithmType models.AlgorithmType, parameters map[string]any, waypoints []*models.Waypoint) error {
+	i := slices.IndexFunc(waypoints, func(wp *models.Waypoint) bool { return wp.AcceptanceRadiusMt() > 0 })
+	if i < 0 {
+		return nil
+	}
+	if utils.GetOrDefault(parameters, "optimize_order", "") != "" {
+		return fmt.Errorf("acceptance_radius_mt of waypoint %d is not supported with optimize_order", i)
+	}
+
+	for _, a := range legAlgorithms(algorithmType, parameters) {
+		if a != models.Portfolio && !a.HonoursAcceptanceRadius() {
+			return fmt.Errorf("acceptance_radius_mt of waypoint %d is only supported by %s and %s, not by %s", i, models.RRT, models.RRTStar, a)
+		}
+	}
+	return nil
+}
+
+// CheckSpaceParameters returns an error if parameters.planning_3d or parameters.max_gradient are set and one of the algorithms
+// that may plan the legs would ignore them, like CheckAcceptanceRadius. Portfolio candidates may set them on their own as well.
+func CheckSpaceParameters(algorithmType models.AlgorithmType, parameters map[string]any) error {
+	isSet := func(parameters map[string]any) bool {
+		return utils.GetOrDefault(parameters, "planning_3d", false) || utils.GetOrDefault(parameters, "max_gradient", 0.0) > 0
+	}
+	unsupported := func(a models.AlgorithmType) error {
+		return fmt.Errorf("planning_3d and max_gradient are only supported by %s and %s, not by %s", models.RRT, models.RRTStar, a)
+	}
+
+	if isSet(parameters) {
+		for _, a := range legAlgorithms(algorithmType, parameters) {
+			if a != models.Portfolio && !a.HonoursSpaceParameters() {
+				return unsupported(a)
+			}
+		}
+	}
+	for _, config := range portfolioConfigs(algorithmType, parameters) {
+		if a := models.AlgorithmType(utils.GetOrDefault(config, "algorithm", "")); isSet(config) && !a.HonoursSpaceParameters() {
+			return unsupported(a)
+		}
+	}
+	return nil
+}
+
+// CheckSoftConstraints returns an error if one of constraints is soft and algorithmType or one of parameters.fallback_algorithms
+// would fly straight through it without weighing the way around. Portfolio candidates are not checked:
+// the cheapest of their routes is kept, and the soft constraints are part of its cost.
+func CheckSoftConstraints(algorithmType models.AlgorithmType, parameters map[string]any, constraints []*models.Feature3D) error {
+	i := slices.IndexFunc(constraints, (*models.Feature3D).IsSoft)
+	if i < 0 {
+		return nil
+	}
+
+	for _, a := range fallbackAlgorithms(algorithmType, parameters) {
+		if !a.HonoursSoftConstraints() {
+			return fmt.Errorf("constraint %d is soft, which is not supported by %s", i, a)
+		}
+	}
+	return nil
+}
+
+// CheckSchedule returns an error if algorithmType or one of parameters.fallback_algorithms would plan the legs of a scheduled route,
+// one with a departure time or several vehicles, without checking the constraints as they are when the vehicle gets there.
+// Portfolio candidates are not checked: their routes are checked as they are flown before one is kept.
+func CheckSchedule(algorithmType models.AlgorithmType, parameters map[string]any) error {
+	for _, a := range fallbackAlgorithms(algorithmType, parameters) {
+		if !a.HonoursSchedule() {
+			return fmt.Errorf("scheduled routes (departure_time, vehicles or moving constraints) are not supported by %s, which ignores when and where the constraints are", a)
+		}
+	}
+	return nil
+}
+
+// legAlgorithms are the algorithms that may plan a leg: algorithmType, the ones in parameters.fallback_algorithms and the candidates of a portfolio
+func legAlgorithms(algorithmType models.AlgorithmType, parameters map[string]any) []models.AlgorithmType {
+	algorithms := fallbackAlgorithms(algorithmType, parameters)
+	for _, config := range portfolioConfigs(algorithmType, parameters) {
+		algorithms = append(algorithms, models.AlgorithmType(utils.GetOrDefault(config, "algorithm", "")))
+	}
+	return algorithms
+}
+
+// fallbackAlgorithms are algorithmType and the ones in parameters.fallback_algorithms, tried in this order
+func fallbackAlgorithms(algorithmType models.AlgorithmType, parameters map[string]any) []models.AlgorithmType {
+	algorithms := []models.AlgorithmType{algorithmType}
+	for _, name := range utils.GetOrDefault(parameters, "fallback_algorithms", []any{}) {
+		if s, ok := name.(string); ok {
+			algorithms = append(algorithms, models.AlgorithmType(s))
+		}
+	}
+	return algorithms
+}
+
+// portfolioConfigs are the candidates in parameters.portfolio, if algorithmType or one of parameters.fallback_algorithms is a portfolio
+func portfolioConfigs(algorithmType models.AlgorithmType, parameters map[string]any) []map[string]any {
+	isPortfolio := algorithmType == models.Portfolio || slices.Contains(utils.GetOrDefault(parameters, "fallback_algorithms", []any{}), any(string(models.Portfolio)))
+	if !isPortfolio {
+		return nil
+	}
+	configs := make([]map[string]any, 0)
+	for _, entry := range utils.GetOrDefault(parameters, "portfolio", DEFAULT_PORTFOLIO) {
+		if config, ok := entry.(map[string]any); ok {
+			configs = append(configs, config)
+		}
+	}
+	return configs
+}
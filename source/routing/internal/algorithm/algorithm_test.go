@@ -0,0 +1,119 @@
+package algorithm_test
+
+import (
+	"geopathplanner/routing/internal/algorithm"
+	"geopathplanner/routing/internal/models"
+	"testing"
+)
+
+func TestCheckAcceptanceRadius(t *testing.T) {
+	a, _ := models.NewAltitude(100, models.MT)
+	start := models.MustNewWaypoint(0, 50.0, 4.0, a)
+	exact := models.MustNewWaypoint(1, 50.0, 4.01, a)
+	sphere := models.MustNewWaypoint(1, 50.0, 4.01, a)
+	sphere.Feature.Properties["acceptance_radius_mt"] = 25.0
+
+	tests := []struct {
+		name          string // description of this test case
+		algorithmType models.AlgorithmType
+		parameters    map[string]any
+		waypoints     []*models.Waypoint
+		wantErr       bool
+	}{
+		{name: "No radius", algorithmType: models.VisGraph, waypoints: []*models.Waypoint{start, exact}},
+		{name: "RRT*", algorithmType: models.RRTStar, waypoints: []*models.Waypoint{start, sphere}},
+		{name: "RRT-Connect", algorithmType: models.RRTConnect, waypoints: []*models.Waypoint{start, sphere}, wantErr: true},
+		{name: "RRT falling back to A*", algorithmType: models.RRT, parameters: map[string]any{"fallback_algorithms": []any{"astar"}}, waypoints: []*models.Waypoint{start, sphere}, wantErr: true},
+		{name: "Default portfolio", algorithmType: models.Portfolio, waypoints: []*models.Waypoint{start, sphere}, wantErr: true},
+		{name: "Portfolio of RRTs", algorithmType: models.Portfolio, parameters: map[string]any{"portfolio": []any{map[string]any{"algorithm": "rrt"}, map[string]any{"algorithm": "rrtstar"}}}, waypoints: []*models.Waypoint{start, sphere}},
+		{name: "RRT* optimizing the order", algorithmType: models.RRTStar, parameters: map[string]any{"optimize_order": "open"}, waypoints: []*models.Waypoint{start, sphere}, wantErr: true},
+		{name: "No radius optimizing the order", algorithmType: models.VisGraph, parameters: map[string]any{"optimize_order": "open"}, waypoints: []*models.Waypoint{start, exact}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotErr := algorithm.CheckAcceptanceRadius(tt.algorithmType, tt.parameters, tt.waypoints)
+			if (gotErr != nil) != tt.wantErr {
+				t.Errorf("CheckAcceptanceRadius() = %v, want error: %t", gotErr, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckSpaceParameters(t *testing.T) {
+	tests := []struct {
+		name          string // description of this test case
+		algorithmType models.AlgorithmType
+		parameters    map[string]any
+		wantErr       bool
+	}{
+		{name: "2D", algorithmType: models.VisGraph},
+		{name: "RRT 3D", algorithmType: models.RRT, parameters: map[string]any{"planning_3d": true, "max_gradient": 0.3}},
+		{name: "RRT* gradient", algorithmType: models.RRTStar, parameters: map[string]any{"max_gradient": 0.3}},
+		{name: "RRT-Connect 3D", algorithmType: models.RRTConnect, parameters: map[string]any{"planning_3d": true}, wantErr: true},
+		{name: "PRM gradient", algorithmType: models.PRM, parameters: map[string]any{"max_gradient": 0.3}, wantErr: true},
+		{name: "RRT falling back to Theta*", algorithmType: models.RRT, parameters: map[string]any{"planning_3d": true, "fallback_algorithms": []any{"thetastar"}}, wantErr: true},
+		{name: "Default portfolio", algorithmType: models.Portfolio, parameters: map[string]any{"max_gradient": 0.3}, wantErr: true},
+		{name: "Portfolio of RRTs", algorithmType: models.Portfolio, parameters: map[string]any{"planning_3d": true, "portfolio": []any{map[string]any{"algorithm": "rrt"}, map[string]any{"algorithm": "rrtstar"}}}},
+		{name: "Portfolio candidate in 3D", algorithmType: models.Portfolio, parameters: map[string]any{"portfolio": []any{map[string]any{"algorithm": "rrt", "planning_3d": true}, map[string]any{"algorithm": "astar"}}}},
+		{name: "Portfolio A* candidate in 3D", algorithmType: models.Portfolio, parameters: map[string]any{"portfolio": []any{map[string]any{"algorithm": "rrt"}, map[string]any{"algorithm": "astar", "planning_3d": true}}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotErr := algorithm.CheckSpaceParameters(tt.algorithmType, tt.parameters)
+			if (gotErr != nil) != tt.wantErr {
+				t.Errorf("CheckSpaceParameters() = %v, want error: %t", gotErr, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckSoftConstraints(t *testing.T) {
+	hard := models.MustNewFeatureFromGeojson(`{"type": "Feature", "properties": {}, "geometry": {"type": "Polygon", "coordinates": [[[4.0, 49.999], [4.002, 49.999], [4.002, 50.001], [4.0, 50.001], [4.0, 49.999]]]}}`)
+	soft := models.MustNewFeatureFromGeojson(`{"type": "Feature", "properties": {"constraint_type": "soft", "cost_multiplier": 3}, "geometry": {"type": "Polygon", "coordinates": [[[4.003, 49.999], [4.005, 49.999], [4.005, 50.001], [4.003, 50.001], [4.003, 49.999]]]}}`)
+
+	tests := []struct {
+		name          string // description of this test case
+		algorithmType models.AlgorithmType
+		parameters    map[string]any
+		constraints   []*models.Feature3D
+		wantErr       bool
+	}{
+		{name: "AntPath among hard constraints", algorithmType: models.AntPath, constraints: []*models.Feature3D{hard}},
+		{name: "AntPath", algorithmType: models.AntPath, constraints: []*models.Feature3D{hard, soft}, wantErr: true},
+		{name: "VisGraph", algorithmType: models.VisGraph, constraints: []*models.Feature3D{hard, soft}},
+		{name: "RRT falling back to AntPath", algorithmType: models.RRT, parameters: map[string]any{"fallback_algorithms": []any{"antpath"}}, constraints: []*models.Feature3D{soft}, wantErr: true},
+		{name: "Default portfolio", algorithmType: models.Portfolio, constraints: []*models.Feature3D{soft}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotErr := algorithm.CheckSoftConstraints(tt.algorithmType, tt.parameters, tt.constraints)
+			if (gotErr != nil) != tt.wantErr {
+				t.Errorf("CheckSoftConstraints() = %v, want error: %t", gotErr, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckSchedule(t *testing.T) {
+	tests := []struct {
+		name          string // description of this test case
+		algorithmType models.AlgorithmType
+		parameters    map[string]any
+		wantErr       bool
+	}{
+		{name: "VisGraph", algorithmType: models.VisGraph},
+		{name: "A*", algorithmType: models.AStar, wantErr: true},
+		{name: "Theta*", algorithmType: models.ThetaStar, wantErr: true},
+		{name: "AntPath", algorithmType: models.AntPath, wantErr: true},
+		{name: "RRT falling back to Theta*", algorithmType: models.RRT, parameters: map[string]any{"fallback_algorithms": []any{"thetastar"}}, wantErr: true},
+		{name: "Portfolio with A*", algorithmType: models.Portfolio, parameters: map[string]any{"portfolio": []any{map[string]any{"algorithm": "rrt"}, map[string]any{"algorithm": "astar"}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotErr := algorithm.CheckSchedule(tt.algorithmType, tt.parameters)
+			if (gotErr != nil) != tt.wantErr {
+				t.Errorf("CheckSchedule() = %v, want error: %t", gotErr, tt.wantErr)
+			}
+		})
+	}
+}
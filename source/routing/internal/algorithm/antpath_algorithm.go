@@ -1,12 +1,11 @@
 package algorithm
 
 import (
+	"context"
 	"fmt"
 	"geopathplanner/routing/internal/models"
 	"geopathplanner/routing/internal/storage"
 	"geopathplanner/routing/internal/utils"
-	"runtime"
-	"sync"
 )
 
 type AntPathAlgorithm struct {}
@@ -16,165 +15,16 @@ func NewAntPathAlgorithm() (*AntPathAlgorithm, error) {
 }
 
 // Concurrency version of Compute function, where every pair of wps is processed in a separate goroutine.
-// TODO: Still in testing
-func (a *AntPathAlgorithm) ComputeConcurrently(searchVolume *models.Feature3D, waypoints []*models.Waypoint, constraints []*models.Feature3D, parameters map[string]any, storageType models.StorageType, maxWorkers int) ([]*models.Waypoint, float64, error) {
-	// Check if waypoints are at least 2
-	numPairs := len(waypoints) - 1
-	if numPairs <= 0 {
-		return nil, 0.0, fmt.Errorf("less than 2 waypoints submitted (%d): abort", len(waypoints))
-	}
-	
-	maxCPU := runtime.NumCPU()
-	if maxWorkers <= 0 {
-		maxWorkers = min(maxCPU, numPairs)
-	} else {
-		// fmt.Printf("[WARN] Requested %d workers exceeds %d cores, limiting to %d",
-		maxWorkers = min(maxWorkers, maxCPU, numPairs)
-	}
-
-	// If just 1 worker, use the normal version
-	if maxWorkers == 1 {
-		return a.Compute(searchVolume, waypoints, constraints, parameters, storageType)
-	}
-
-	// TODO: Buffer constraints
-	// TODO: Think about creating and adding constraints in Run function so to parallelize that function
-	// Create storage and load constraint into it
-	storage, err := storage.NewEmptyStorage(storageType)
-	if err != nil {
-		return nil, 0.0, err
-	}
-	err = storage.AddConstraints(constraints)
-	if err != nil {
-		return nil, 0.0, err
-	}
-
-	// === Channels and synchronization structures ===
-	jobs := make(chan job, numPairs)       // channel for distributing work
-	results := make(chan result, numPairs) // channel to collect computed results
-	var wg sync.WaitGroup // ensures all workers complete before closing results
-
-	// 1. Create and start the workers
-	for w := 0; w < maxWorkers; w++ {
-		wg.Add(1)
-		go func(workerID int) {
-			defer wg.Done()
-
-			for j := range jobs {
-				// Run RRT for this pair of waypoints
-				tmpRoute, tmpCost, err := a.Run(j.startWP, j.endWP, parameters, storage.Clone())
-				if err != nil {
-					results <- result{i: j.i, err: fmt.Errorf("worker %d: run AntPath: %w", workerID, err)}
-					continue
-				}
-
-				results <- result{
-					i:     j.i,
-					route: tmpRoute,
-					cost:  tmpCost,
-					err:   nil,
-				}
-			}
-		}(w)
-	}
-
-	// 2. Send jobs to workers
-	for i := 0; i < numPairs; i++ {
-		jobs <- job{
-			i:       i,
-			startWP: waypoints[i],
-			endWP:   waypoints[i+1],
-		}
-	}
-	close(jobs) // no more jobs to send
-
-	// 3. Collect results
-	go func() {
-		wg.Wait()      // wait for all workers to finish
-		close(results) // then close result channel
-	}()
-
-	// Store results in correct order
-	routeSegments := make([][]*models.Waypoint, numPairs)
-	costs := make([]float64, numPairs)
-	var firstErr error
-
-	for res := range results {
-		if res.err != nil && firstErr == nil {
-			firstErr = res.err
-		}
-		routeSegments[res.i] = res.route
-		costs[res.i] = res.cost
-	}
-
-	if firstErr != nil {
-		return nil, 0, firstErr
-	}
-
-	// 4. Merge results
-	finalRoute := make([]*models.Waypoint, 0)
-	totalCost := 0.0
-
-	// Start from first waypoint
-	if len(routeSegments) > 0 && len(routeSegments[0]) > 0 {
-		finalRoute = append(finalRoute, routeSegments[0][0])
-	}
-
-	for i, seg := range routeSegments {
-		if len(seg) == 0 {
-			continue
-		}
-		totalCost += costs[i]
-		// Skip first element to avoid duplicates
-		finalRoute = append(finalRoute, seg[1:]...)
-	}
-
-	return finalRoute, totalCost, nil
+func (a *AntPathAlgorithm) ComputeConcurrently(ctx context.Context, searchVolume *models.Feature3D, waypoints []*models.Waypoint, constraints []*models.Feature3D, parameters map[string]any, storageType models.StorageType, maxWorkers int) ([]*models.Waypoint, float64, error) {
+	return computeLegsConcurrently(ctx, "antpath", waypoints, constraints, parameters, storageType, maxWorkers, func(ctx context.Context, start, end *models.Waypoint, parameters map[string]any, s storage.Storage) ([]*models.Waypoint, float64, error) {
+		return a.Run(start, end, parameters, s)
+	})
 }
 
-func (a *AntPathAlgorithm) Compute(searchVolume *models.Feature3D, waypoints []*models.Waypoint, constraints []*models.Feature3D, parameters map[string]any, storageType models.StorageType) ([]*models.Waypoint, float64, error) {	
-	// Check if waypoints are at least 2
-	numPairs := len(waypoints) - 1
-	if numPairs <= 0 {
-		return nil, 0.0, fmt.Errorf("less than 2 waypoints submitted (%d): abort", len(waypoints))
-	}
-	
-	// Create empty list of wps
-	route := make([]*models.Waypoint, 0)
-	cost := 0.0
-
-	// 0. Load first wp
-	route = append(route, waypoints[0])
-	
-	// TODO: Buffer constraints
-	// TODO: Think about creating and adding constraints in Run function so to parallelize that function
-	// 1. Create storage and load constraint into it
-	storage, err := storage.NewEmptyStorage(storageType)
-	if err != nil {
-		return nil, 0.0, err
-	}
-	err = storage.AddConstraints(constraints)
-	if err != nil {
-		return nil, 0.0, err
-	}
-
-	// 2. For each pair of wp -> run antpath
-	for i := 0; i < len(waypoints)-1; i++ {
-		tmpRoute, tmpCost, err := a.Run(waypoints[i], waypoints[i+1], parameters, storage)
-		if err != nil {
-			// Return route until now
-			return route, cost, fmt.Errorf("interrupted antpath for error between wp[%d] and wp[%d]: %w", i, i+1, err)
-		}
-		// Append new route but removing the first one
-		route = append(route, tmpRoute[1:]...)
-		cost += tmpCost
-	}
-
-	// TODO: Think if this is the correct place
-	storage.Clear()
-	
-	// 3. Return everything
-	return route, cost, nil
+func (a *AntPathAlgorithm) Compute(ctx context.Context, searchVolume *models.Feature3D, waypoints []*models.Waypoint, constraints []*models.Feature3D, parameters map[string]any, storageType models.StorageType) ([]*models.Waypoint, float64, error) {
+	return computeLegs(ctx, "antpath", waypoints, constraints, parameters, storageType, func(ctx context.Context, start, end *models.Waypoint, parameters map[string]any, s storage.Storage) ([]*models.Waypoint, float64, error) {
+		return a.Run(start, end, parameters, s)
+	})
 }
 
 func (a *AntPathAlgorithm) Run(start, end *models.Waypoint, parameters map[string]any, storage storage.Storage) ([]*models.Waypoint, float64, error) {
@@ -221,6 +71,6 @@ func (a *AntPathAlgorithm) Run(start, end *models.Waypoint, parameters map[strin
 	// ------------------------------------------------------------------------------------------------------
 
 	route = append(route, end)
-	cost := utils.TotalHaversineDistance(route)
+	cost := utils.TotalCost(storage.GetCostFunction(), route)
 	return route, cost, nil
 }
@@ -1,6 +1,7 @@
 package algorithm_test
 
 import (
+	"context"
 	"geopathplanner/routing/internal/algorithm"
 	"geopathplanner/routing/internal/models"
 	"geopathplanner/routing/internal/storage"
@@ -91,7 +92,7 @@ func TestAntPathAlgorithm_Compute(t *testing.T) {
 				t.Fatalf("could not construct receiver type: %v", err)
       }
 
-			got, _, gotErr := a.Compute(nil, tt.waypoints, tt.constraints, nil, tt.storageType)
+			got, _, gotErr := a.Compute(context.Background(), nil, tt.waypoints, tt.constraints, nil, tt.storageType)
 
 			// TODO: For visually testing, export results in geojson
 			// utils.ExportToGeoJSON("algorithm", got, tt.constraints, tt.name, true)
@@ -138,7 +139,7 @@ func TestAntPathAlgorithm_ComputeConcurrently(t *testing.T) {
 				t.Fatalf("could not construct receiver type: %v", err)
 			}
 
-			got, _, gotErr := a.ComputeConcurrently(nil, tt.waypoints, tt.constraints, nil, tt.storageType, tt.maxWorkers)
+			got, _, gotErr := a.ComputeConcurrently(context.Background(), nil, tt.waypoints, tt.constraints, nil, tt.storageType, tt.maxWorkers)
 
 			// TODO: For visually testing, export results in geojson
       		utils.MarkWaypointsAsOriginal(tt.waypoints...)
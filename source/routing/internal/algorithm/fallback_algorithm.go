@@ -0,0 +1,158 @@
+package algorithm
+
+import (
+	"context"
+	"fmt"
+	"geopathplanner/routing/internal/models"
+	"geopathplanner/routing/internal/storage"
+	"geopathplanner/routing/internal/utils"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+// FallbackAlgorithm plans every leg with the first algorithm of the chain, and when it fails or runs out of time it tries the next ones in turn.
+// It remembers which algorithm solved every pair of wps, so that the response can tell.
+type FallbackAlgorithm struct {
+	Chain      []models.AlgorithmType
+	algorithms []Algorithm
+	timeout    time.Duration // of every attempt, no limit if 0
+
+	mu   sync.Mutex
+	legs map[[2]*models.Waypoint]models.AlgorithmType
+}
+
+// NewFallbackAlgorithmFromParameters reads parameters.fallback_algorithms, e.g. ["rrtstar", "rrt", "antpath"], and fallback_timeout_ms.
+// The chain starts with primary, the algorithm of the request, followed by the fallback algorithms not already in it.
+// Returns nil if parameters.fallback_algorithms is not set.
+func NewFallbackAlgorithmFromParameters(primary models.AlgorithmType, parameters map[string]any) (*FallbackAlgorithm, error) {
+	var names []any
+	switch v := parameters["fallback_algorithms"].(type) {
+	case nil:
+		return nil, nil
+	case []any:
+		names = v
+	default:
+		return nil, fmt.Errorf("fallback_algorithms must be a list of algorithms, got %T", v)
+	}
+
+	chain := []models.AlgorithmType{primary}
+	for _, name := range names {
+		s, ok := name.(string)
+		if !ok {
+			return nil, fmt.Errorf("fallback_algorithms must be a list of algorithms, got %v", name)
+		}
+		algorithmType := models.AlgorithmType(s)
+		if err := algorithmType.Validate(); err != nil {
+			return nil, err
+		}
+		if !slices.Contains(chain, algorithmType) {
+			chain = append(chain, algorithmType)
+		}
+	}
+
+	TIMEOUT_MS := utils.GetOrDefault(parameters, "fallback_timeout_ms", 0.0)
+	if TIMEOUT_MS < 0 {
+		return nil, fmt.Errorf("fallback_timeout_ms can't be negative, got %f", TIMEOUT_MS)
+	}
+
+	a := &FallbackAlgorithm{
+		Chain:   chain,
+		timeout: time.Duration(TIMEOUT_MS * float64(time.Millisecond)),
+		legs:    make(map[[2]*models.Waypoint]models.AlgorithmType),
+	}
+	for _, algorithmType := range chain {
+		algo, err := NewAlgorithm(algorithmType)
+		if err != nil {
+			return nil, err
+		}
+		a.algorithms = append(a.algorithms, algo)
+	}
+
+	fmt.Printf("FALLBACK\n")
+	fmt.Printf("chain: %v\n", chain)
+	fmt.Printf("fallback_timeout_ms: %f\n", TIMEOUT_MS)
+	fmt.Printf("--------------------------------------------------------\n")
+
+	return a, nil
+}
+
+// Concurrency version of Compute function, where every pair of wps is processed in a separate goroutine.
+func (a *FallbackAlgorithm) ComputeConcurrently(ctx context.Context, searchVolume *models.Feature3D, waypoints []*models.Waypoint, constraints []*models.Feature3D, parameters map[string]any, storageType models.StorageType, maxWorkers int) ([]*models.Waypoint, float64, error) {
+	return computeLegsConcurrently(ctx, "Fallback", waypoints, constraints, a.withoutLegRetries(parameters), storageType, maxWorkers, func(ctx context.Context, start, end *models.Waypoint, legParameters map[string]any, s storage.Storage) ([]*models.Waypoint, float64, error) {
+		return a.Run(ctx, searchVolume, start, end, constraints, a.withLegRetries(legParameters, parameters), storageType)
+	})
+}
+
+func (a *FallbackAlgorithm) Compute(ctx context.Context, searchVolume *models.Feature3D, waypoints []*models.Waypoint, constraints []*models.Feature3D, parameters map[string]any, storageType models.StorageType) ([]*models.Waypoint, float64, error) {
+	return computeLegs(ctx, "Fallback", waypoints, constraints, a.withoutLegRetries(parameters), storageType, func(ctx context.Context, start, end *models.Waypoint, legParameters map[string]any, s storage.Storage) ([]*models.Waypoint, float64, error) {
+		return a.Run(ctx, searchVolume, start, end, constraints, a.withLegRetries(legParameters, parameters), storageType)
+	})
+}
+
+// Run plans start -> end with the algorithms of the chain in turn, until one of them succeeds.
+// Every algorithm retries the leg on its own, as set by parameters.max_leg_retries, before the next one is tried.
+func (a *FallbackAlgorithm) Run(ctx context.Context, searchVolume *models.Feature3D, start, end *models.Waypoint, constraints []*models.Feature3D, parameters map[string]any, storageType models.StorageType) ([]*models.Waypoint, float64, error) {
+	var err error
+	for i, algo := range a.algorithms {
+		if ctx.Err() != nil {
+			break
+		}
+
+		attemptCtx, cancel := ctx, context.CancelFunc(func() {})
+		if a.timeout > 0 {
+			attemptCtx, cancel = context.WithTimeout(ctx, a.timeout)
+		}
+		var route []*models.Waypoint
+		var cost float64
+		route, cost, err = algo.Compute(attemptCtx, searchVolume, []*models.Waypoint{start, end}, constraints, parameters, storageType)
+		cancel()
+
+		if err == nil {
+			a.mu.Lock()
+			a.legs[[2]*models.Waypoint{start.Reached(), end}] = a.Chain[i]
+			a.mu.Unlock()
+			return route, cost, nil
+		}
+		fmt.Printf("Fallback: %s failed between %v and %v: %v\n", a.Chain[i], start, end, err)
+	}
+	if ctx.Err() != nil {
+		return nil, 0.0, fmt.Errorf("fallback stopped: %w", ctx.Err())
+	}
+	return nil, 0.0, fmt.Errorf("all of %v failed, last error: %w", a.Chain, err)
+}
+
+// LegAlgorithms returns the algorithm that planned every pair of consecutive wps, the last time it was planned.
+// Pairs never planned, e.g. because the route was computed by someone else, have an empty algorithm.
+func (a *FallbackAlgorithm) LegAlgorithms(waypoints []*models.Waypoint) []models.AlgorithmType {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	legs := make([]models.AlgorithmType, 0, len(waypoints)-1)
+	for i := 1; i < len(waypoints); i++ {
+		legs = append(legs, a.legs[[2]*models.Waypoint{waypoints[i-1], waypoints[i]}])
+	}
+	return legs
+}
+
+// withoutLegRetries is for the legs of the chain, which are retried by every algorithm in it
+func (a *FallbackAlgorithm) withoutLegRetries(parameters map[string]any) map[string]any {
+	chainParameters := maps.Clone(parameters)
+	if chainParameters == nil {
+		chainParameters = map[string]any{}
+	}
+	chainParameters["max_leg_retries"] = 0.0
+	return chainParameters
+}
+
+// withLegRetries gives back to legParameters the retries of the request parameters, for the algorithms of the chain
+func (a *FallbackAlgorithm) withLegRetries(legParameters map[string]any, parameters map[string]any) map[string]any {
+	algorithmParameters := maps.Clone(legParameters)
+	if retries, ok := parameters["max_leg_retries"]; ok {
+		algorithmParameters["max_leg_retries"] = retries
+	} else {
+		delete(algorithmParameters, "max_leg_retries")
+	}
+	return algorithmParameters
+}
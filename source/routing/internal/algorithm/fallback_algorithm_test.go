@@ -0,0 +1,87 @@
+package algorithm_test
+
+import (
+	"context"
+	"geopathplanner/routing/internal/algorithm"
+	"geopathplanner/routing/internal/models"
+	"geopathplanner/routing/internal/utils"
+	"slices"
+	"testing"
+)
+
+func TestNewFallbackAlgorithmFromParameters(t *testing.T) {
+	tests := []struct {
+		name       string // description of this test case
+		primary    models.AlgorithmType
+		parameters map[string]any
+		want       []models.AlgorithmType
+		wantErr    bool
+	}{
+		{name: "Not set", primary: models.RRTStar, parameters: nil, want: nil},
+		{name: "Primary first", primary: models.RRTStar, parameters: map[string]any{"fallback_algorithms": []any{"rrt", "antpath"}}, want: []models.AlgorithmType{models.RRTStar, models.RRT, models.AntPath}},
+		{name: "Primary in the list", primary: models.RRTStar, parameters: map[string]any{"fallback_algorithms": []any{"rrtstar", "rrt", "rrt", "antpath"}}, want: []models.AlgorithmType{models.RRTStar, models.RRT, models.AntPath}},
+		{name: "Unknown algorithm", primary: models.RRTStar, parameters: map[string]any{"fallback_algorithms": []any{"dijkstra"}}, wantErr: true},
+		{name: "Not a list", primary: models.RRTStar, parameters: map[string]any{"fallback_algorithms": "rrt"}, wantErr: true},
+		{name: "Negative timeout", primary: models.RRTStar, parameters: map[string]any{"fallback_algorithms": []any{"rrt"}, "fallback_timeout_ms": -1.0}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, gotErr := algorithm.NewFallbackAlgorithmFromParameters(tt.primary, tt.parameters)
+			if gotErr != nil {
+				if !tt.wantErr {
+					t.Errorf("NewFallbackAlgorithmFromParameters() failed: %v", gotErr)
+				}
+				return
+			}
+			if tt.wantErr {
+				t.Fatal("NewFallbackAlgorithmFromParameters() succeeded unexpectedly")
+			}
+			if got == nil {
+				if tt.want != nil {
+					t.Errorf("NewFallbackAlgorithmFromParameters() = nil, want chain %v", tt.want)
+				}
+				return
+			}
+			if !slices.Equal(got.Chain, tt.want) {
+				t.Errorf("NewFallbackAlgorithmFromParameters() chain = %v, want %v", got.Chain, tt.want)
+			}
+		})
+	}
+}
+
+func TestFallbackAlgorithm_Compute(t *testing.T) {
+	sv, w_list, c_list, _ := utils.SetupTestScenario()
+	waypoints := []*models.Waypoint{w_list[0], w_list[1]}
+
+	tests := []struct {
+		name       string // description of this test case
+		parameters map[string]any
+		want       []models.AlgorithmType
+	}{
+		{name: "Fallback RRT solving the leg - RTREE", parameters: map[string]any{"fallback_algorithms": []any{"antpath"}}, want: []models.AlgorithmType{models.RRT}},
+		{name: "Fallback RRT out of iterations - RTREE", parameters: map[string]any{"fallback_algorithms": []any{"antpath"}, "max_iterations": 20.0, "max_leg_retries": 0.0}, want: []models.AlgorithmType{models.AntPath}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fallback, err := algorithm.NewFallbackAlgorithmFromParameters(models.RRT, tt.parameters)
+			if err != nil {
+				t.Fatalf("could not construct receiver type: %v", err)
+			}
+
+			got, _, gotErr := fallback.Compute(context.Background(), sv, waypoints, c_list, tt.parameters, models.RTree)
+			if gotErr != nil {
+				t.Fatalf("Compute() failed: %v", gotErr)
+			}
+
+			utils.MarkWaypointsAsOriginal(waypoints...)
+			utils.ExportToGeoJSONRoute("algorithm", got, c_list, sv, tt.name, true)
+
+			if got[0] != waypoints[0] || got[len(got)-1] != waypoints[1] {
+				t.Errorf("Compute() = %v, want a route from wp[0] to wp[1]", got)
+			}
+			if legs := fallback.LegAlgorithms(waypoints); !slices.Equal(legs, tt.want) {
+				t.Errorf("LegAlgorithms() = %v, want %v", legs, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package algorithm
+
+import (
+	"container/heap"
+	"fmt"
+	"geopathplanner/routing/internal/models"
+	"geopathplanner/routing/internal/storage"
+	"geopathplanner/routing/internal/utils"
+	"slices"
+)
+
+// roadmap is an undirected graph whose edges are collision-free connections between waypoints, weighted by their cost in each direction.
+type roadmap struct {
+	edges map[*models.Waypoint]map[*models.Waypoint]float64
+	cost  utils.CostFunction
+}
+
+func newRoadmap(cost utils.CostFunction) *roadmap {
+	return &roadmap{
+		edges: make(map[*models.Waypoint]map[*models.Waypoint]float64),
+		cost:  cost,
+	}
+}
+
+func (r *roadmap) AddNode(w *models.Waypoint) {
+	if _, ok := r.edges[w]; !ok {
+		r.edges[w] = make(map[*models.Waypoint]float64)
+	}
+}
+
+// AddEdge links w1 and w2 both ways, as climbing and descending may cost differently
+func (r *roadmap) AddEdge(w1, w2 *models.Waypoint) {
+	r.AddNode(w1)
+	r.AddNode(w2)
+	r.edges[w1][w2] = r.cost.Cost(w1, w2)
+	r.edges[w2][w1] = r.cost.Cost(w2, w1)
+}
+
+func (r *roadmap) HasEdge(w1, w2 *models.Waypoint) bool {
+	_, ok := r.edges[w1][w2]
+	return ok
+}
+
+func (r *roadmap) Degree(w *models.Waypoint) int {
+	return len(r.edges[w])
+}
+
+func (r *roadmap) NodesLen() int {
+	return len(r.edges)
+}
+
+// ShortestPath runs A* from start to goal, using the heuristic of the cost function.
+// With a clock, every edge is also checked against the constraints of s active while flying it, from the eta of the node it leaves.
+// The roadmap is only read, so it's safe to call it from multiple goroutines, each one with its own clock.
+func (r *roadmap) ShortestPath(start, goal *models.Waypoint, clock *legClock, s storage.Storage) ([]*models.Waypoint, float64, error) {
+	if _, ok := r.edges[start]; !ok {
+		return nil, 0.0, fmt.Errorf("start %v not in roadmap", start)
+	}
+	if _, ok := r.edges[goal]; !ok {
+		return nil, 0.0, fmt.Errorf("goal %v not in roadmap", goal)
+	}
+
+	costs := map[*models.Waypoint]float64{start: 0.0}
+	previous := make(map[*models.Waypoint]*models.Waypoint)
+	closed := make(map[*models.Waypoint]bool)
+
+	open := &nodeQueue{}
+	heap.Push(open, &queueItem{wp: start, priority: r.cost.Heuristic(start, goal)})
+
+	for open.Len() > 0 {
+		current := heap.Pop(open).(*queueItem).wp
+		if closed[current] {
+			continue
+		}
+		if current == goal {
+			return r.buildPath(previous, goal), costs[goal], nil
+		}
+		closed[current] = true
+
+		for next, edgeCost := range r.edges[current] {
+			if closed[next] {
+				continue
+			}
+			newCost := costs[current] + edgeCost
+			if oldCost, ok := costs[next]; ok && oldCost <= newCost {
+				continue
+			}
+			if clock != nil {
+				if blocked, err := clock.isLineBlocked(s, current, next); err != nil {
+					return nil, 0.0, err
+				} else if blocked {
+					continue
+				}
+			}
+			costs[next] = newCost
+			previous[next] = current
+			clock.connect(current, next)
+			heap.Push(open, &queueItem{wp: next, priority: newCost + r.cost.Heuristic(next, goal)})
+		}
+	}
+
+	return nil, 0.0, fmt.Errorf("goal not reachable in roadmap with %d nodes", r.NodesLen())
+}
+
+func (r *roadmap) buildPath(previous map[*models.Waypoint]*models.Waypoint, goal *models.Waypoint) []*models.Waypoint {
+	path := []*models.Waypoint{goal}
+	for current, ok := previous[goal]; ok; current, ok = previous[current] {
+		path = append(path, current)
+	}
+	slices.Reverse(path)
+	return path
+}
+
+// ---------------------------------------------------------------- PRIORITY QUEUE
+
+type queueItem struct {
+	wp       *models.Waypoint
+	priority float64
+}
+
+// nodeQueue implements heap.Interface as a min-heap on priority
+type nodeQueue []*queueItem
+
+func (q nodeQueue) Len() int           { return len(q) }
+func (q nodeQueue) Less(i, j int) bool { return q[i].priority < q[j].priority }
+func (q nodeQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+
+func (q *nodeQueue) Push(x any) {
+	*q = append(*q, x.(*queueItem))
+}
+
+func (q *nodeQueue) Pop() any {
+	old := *q
+	n := len(old)
+	item := old[n-1]
+	*q = old[:n-1]
+	return item
+}
@@ -0,0 +1,365 @@
+package algorithm
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"geopathplanner/routing/internal/models"
+	"geopathplanner/routing/internal/storage"
+	"geopathplanner/routing/internal/utils"
+	"math"
+	"slices"
+)
+
+// GridAlgorithm splits the search volume into a grid of cells and searches it with A*.
+// With anyAngle set, it behaves like Theta*: a node can take the parent of its parent whenever they are in line of sight.
+// Since no sampling is involved, the same request always gives the same route.
+type GridAlgorithm struct {
+	name     string
+	anyAngle bool
+}
+
+func NewAStarAlgorithm() (*GridAlgorithm, error) {
+	return &GridAlgorithm{
+		name:     "A*",
+		anyAngle: false,
+	}, nil
+}
+
+func NewThetaStarAlgorithm() (*GridAlgorithm, error) {
+	return &GridAlgorithm{
+		name:     "Theta*",
+		anyAngle: true,
+	}, nil
+}
+
+// Concurrency version of Compute function, where every pair of wps is processed in a separate goroutine.
+func (a *GridAlgorithm) ComputeConcurrently(ctx context.Context, searchVolume *models.Feature3D, waypoints []*models.Waypoint, constraints []*models.Feature3D, parameters map[string]any, storageType models.StorageType, maxWorkers int) ([]*models.Waypoint, float64, error) {
+	return computeLegsConcurrently(ctx, a.name, waypoints, constraints, parameters, storageType, maxWorkers, func(ctx context.Context, start, end *models.Waypoint, parameters map[string]any, s storage.Storage) ([]*models.Waypoint, float64, error) {
+		return a.Run(ctx, searchVolume, start, end, parameters, s)
+	})
+}
+
+func (a *GridAlgorithm) Compute(ctx context.Context, searchVolume *models.Feature3D, waypoints []*models.Waypoint, constraints []*models.Feature3D, parameters map[string]any, storageType models.StorageType) ([]*models.Waypoint, float64, error) {
+	return computeLegs(ctx, a.name, waypoints, constraints, parameters, storageType, func(ctx context.Context, start, end *models.Waypoint, parameters map[string]any, s storage.Storage) ([]*models.Waypoint, float64, error) {
+		return a.Run(ctx, searchVolume, start, end, parameters, s)
+	})
+}
+
+func (a *GridAlgorithm) Run(ctx context.Context, searchVolume *models.Feature3D, start, end *models.Waypoint, parameters map[string]any, storage storage.Storage) ([]*models.Waypoint, float64, error) {
+	fmt.Printf("wpA: %v, wpB: %v, storage starts with %d constraints.\n", start, end, storage.ConstraintsLen())
+
+	// First thing to do if to check if a straight line connection is possible
+	if isStraightLineFree(storage, nil, start, end) {
+		fmt.Printf("Goal immediately found: straight line collision-free\n\n")
+		return []*models.Waypoint{start, end}, storage.GetCostFunction().Cost(start, end), nil
+	}
+
+	cell_size_mt, layer_spacing_mt, max_layers, max_cells := a.GetParameters(parameters)
+	g, err := newGrid(searchVolume, start, end, cell_size_mt, layer_spacing_mt, max_layers, max_cells, storage)
+	if err != nil {
+		return nil, 0.0, err
+	}
+
+	route, err := a.search(ctx, g, start, end)
+	if err != nil {
+		return nil, 0.0, err
+	}
+	return route, utils.TotalCost(storage.GetCostFunction(), route), nil
+}
+
+func (a *GridAlgorithm) GetParameters(parameters map[string]any) (float64, float64, int, int) {
+	CELL_SIZE_MT := utils.GetOrDefault(parameters, "cell_size_mt", 50.0)
+	LAYER_SPACING_MT := utils.GetOrDefault(parameters, "layer_spacing_mt", 0.0)
+	MAX_LAYERS := int(utils.GetOrDefault(parameters, "max_layers", 5.0))
+	MAX_CELLS := int(utils.GetOrDefault(parameters, "max_cells", 2000000.0))
+
+	fmt.Printf("PARAMETERS\n")
+	fmt.Printf("algorithm: %s\n", a.name)
+	fmt.Printf("cell_size_mt: %f\n", CELL_SIZE_MT)
+	fmt.Printf("layer_spacing_mt: %f\n", LAYER_SPACING_MT)
+	fmt.Printf("max_layers: %d\n", MAX_LAYERS)
+	fmt.Printf("--------------------------------------------------------\n")
+
+	return CELL_SIZE_MT, LAYER_SPACING_MT, MAX_LAYERS, MAX_CELLS
+}
+
+// search runs A* (or Theta*) on the grid, going from start to the cells around it and from the cells around the goal to end.
+func (a *GridAlgorithm) search(ctx context.Context, g *grid, start, end *models.Waypoint) ([]*models.Waypoint, error) {
+	startCells, err := g.ConnectableCells(start)
+	if err != nil {
+		return nil, err
+	}
+	goalCells, err := g.ConnectableCells(end)
+	if err != nil {
+		return nil, err
+	}
+	if len(startCells) == 0 || len(goalCells) == 0 {
+		return nil, fmt.Errorf("start or goal can't be connected to any free cell of the grid")
+	}
+
+	costs := map[*models.Waypoint]float64{start: 0.0}
+	previous := make(map[*models.Waypoint]*models.Waypoint)
+	closed := make(map[*models.Waypoint]bool)
+	cost := g.storage.GetCostFunction()
+	open := &nodeQueue{}
+	heap.Push(open, &queueItem{wp: start, priority: cost.Heuristic(start, end)})
+
+	for open.Len() > 0 {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("search stopped after expanding %d cells: %w", len(closed), ctx.Err())
+		}
+
+		current := heap.Pop(open).(*queueItem).wp
+		if closed[current] {
+			continue
+		}
+		if current == end {
+			path := []*models.Waypoint{end}
+			for p, ok := previous[end]; ok; p, ok = previous[p] {
+				path = append(path, p)
+			}
+			slices.Reverse(path)
+			return path, nil
+		}
+		closed[current] = true
+
+		// Neighbors of start are the cells around it, cells around the goal can reach end
+		var neighbors []*models.Waypoint
+		if current == start {
+			neighbors = startCells
+		} else {
+			neighbors, err = g.Neighbors(current)
+			if err != nil {
+				return nil, err
+			}
+			if slices.Contains(goalCells, current) {
+				neighbors = append(neighbors, end)
+			}
+		}
+
+		for _, next := range neighbors {
+			if closed[next] {
+				continue
+			}
+
+			parent := current
+			// Theta*: try to skip current and connect directly to its parent, if it's not more expensive (e.g. through a soft constraint)
+			if a.anyAngle {
+				if grandParent, ok := previous[current]; ok {
+					blocked, _, err := g.storage.IsLineInObstacles(grandParent, next)
+					if err != nil {
+						return nil, err
+					}
+					if !blocked && costs[grandParent]+cost.Cost(grandParent, next) <= costs[current]+cost.Cost(current, next) {
+						parent = grandParent
+					}
+				}
+			}
+
+			newCost := costs[parent] + cost.Cost(parent, next)
+			if oldCost, ok := costs[next]; ok && oldCost <= newCost {
+				continue
+			}
+			costs[next] = newCost
+			previous[next] = parent
+			heap.Push(open, &queueItem{wp: next, priority: newCost + cost.Heuristic(next, end)})
+		}
+	}
+
+	return nil, fmt.Errorf("goal not reachable on a grid of %d cells", g.Size())
+}
+
+// ---------------------------------------------------------------- GRID
+
+type cellIndex [3]int
+
+// grid is a regular lat/lon/alt grid over the bounding box of the search volume, cells are created and checked lazily.
+type grid struct {
+	searchVolume *models.Feature3D
+	storage      storage.Storage
+	minLon       float64
+	minLat       float64
+	stepLon      float64
+	stepLat      float64
+	nx, ny       int
+	altitudes    []float64 // altitude (mt) of every layer
+
+	cells   map[cellIndex]*models.Waypoint
+	indexes map[*models.Waypoint]cellIndex
+	blocked map[cellIndex]bool
+}
+
+func newGrid(searchVolume *models.Feature3D, start, end *models.Waypoint, cellSizeMt, layerSpacingMt float64, maxLayers, maxCells int, storage storage.Storage) (*grid, error) {
+	if cellSizeMt <= 0 {
+		return nil, fmt.Errorf("cell_size_mt must be positive: %f", cellSizeMt)
+	}
+
+	bound := searchVolume.Bound()
+	midLat := (bound.Min.Lat() + bound.Max.Lat()) / 2
+	stepLat := cellSizeMt / models.METERS_PER_DEGREE
+	stepLon := cellSizeMt / (models.METERS_PER_DEGREE * math.Cos(midLat*math.Pi/180))
+
+	g := &grid{
+		searchVolume: searchVolume,
+		storage:      storage,
+		minLon:       bound.Min.Lon(),
+		minLat:       bound.Min.Lat(),
+		stepLon:      stepLon,
+		stepLat:      stepLat,
+		nx:           int(math.Ceil((bound.Max.Lon() - bound.Min.Lon()) / stepLon)),
+		ny:           int(math.Ceil((bound.Max.Lat() - bound.Min.Lat()) / stepLat)),
+		altitudes:    gridAltitudes(searchVolume, start, end, layerSpacingMt, maxLayers),
+		cells:        make(map[cellIndex]*models.Waypoint),
+		indexes:      make(map[*models.Waypoint]cellIndex),
+		blocked:      make(map[cellIndex]bool),
+	}
+
+	if g.Size() > maxCells {
+		return nil, fmt.Errorf("grid has %d cells, more than max_cells %d: increase cell_size_mt", g.Size(), maxCells)
+	}
+	fmt.Printf("Grid of %dx%dx%d cells\n", g.nx, g.ny, len(g.altitudes))
+	return g, nil
+}
+
+// gridAltitudes returns the altitude of every layer, aligned with start altitude.
+// Layers stay within the search volume and at most maxLayers below and above the leg.
+func gridAltitudes(searchVolume *models.Feature3D, start, end *models.Waypoint, layerSpacingMt float64, maxLayers int) []float64 {
+	startAlt := start.Alt.Normalize().Value
+	if layerSpacingMt <= 0 {
+		return []float64{startAlt}
+	}
+
+	endAlt := end.Alt.Normalize().Value
+	minAlt := math.Max(searchVolume.MinAltitude.Normalize().Value, math.Min(startAlt, endAlt)-float64(maxLayers)*layerSpacingMt)
+	maxAlt := math.Min(searchVolume.MaxAltitude.Normalize().Value, math.Max(startAlt, endAlt)+float64(maxLayers)*layerSpacingMt)
+
+	altitudes := make([]float64, 0)
+	for k := math.Ceil((minAlt - startAlt) / layerSpacingMt); startAlt+k*layerSpacingMt <= maxAlt; k++ {
+		altitudes = append(altitudes, startAlt+k*layerSpacingMt)
+	}
+	if len(altitudes) == 0 {
+		return []float64{startAlt}
+	}
+	return altitudes
+}
+
+func (g *grid) Size() int {
+	return g.nx * g.ny * len(g.altitudes)
+}
+
+func (g *grid) contains(idx cellIndex) bool {
+	return idx[0] >= 0 && idx[0] < g.nx && idx[1] >= 0 && idx[1] < g.ny && idx[2] >= 0 && idx[2] < len(g.altitudes)
+}
+
+// Cell returns the wp at the center of the cell (always the same pointer for the same cell), or nil if it's not free.
+func (g *grid) Cell(idx cellIndex) (*models.Waypoint, error) {
+	if !g.contains(idx) || g.blocked[idx] {
+		return nil, nil
+	}
+	if wp, ok := g.cells[idx]; ok {
+		return wp, nil
+	}
+
+	alt, err := models.NewAltitude(g.altitudes[idx[2]], models.MT)
+	if err != nil {
+		return nil, err
+	}
+	wp, err := models.NewWaypoint(g.minLat+(float64(idx[1])+0.5)*g.stepLat, g.minLon+(float64(idx[0])+0.5)*g.stepLon, alt)
+	if err != nil {
+		return nil, err
+	}
+
+	// Cell is blocked if its center is outside of the search volume or inside an obstacle
+	inObstacles, _, err := g.storage.IsPointInObstacles(wp)
+	if err != nil {
+		return nil, err
+	}
+	if inObstacles || !utils.PointInPolygon2D(wp.Point2D(), g.searchVolume.ToPolygon()) {
+		g.blocked[idx] = true
+		return nil, nil
+	}
+
+	g.cells[idx] = wp
+	g.indexes[wp] = idx
+	return wp, nil
+}
+
+// Index returns the cell containing wp (the nearest layer is used for altitude).
+func (g *grid) Index(wp *models.Waypoint) cellIndex {
+	alt := wp.Alt.Normalize().Value
+	k := 0
+	for i, layerAlt := range g.altitudes {
+		if math.Abs(layerAlt-alt) < math.Abs(g.altitudes[k]-alt) {
+			k = i
+		}
+	}
+	return cellIndex{
+		int(math.Floor((wp.Lon - g.minLon) / g.stepLon)),
+		int(math.Floor((wp.Lat - g.minLat) / g.stepLat)),
+		k,
+	}
+}
+
+// Neighbors returns the free adjacent cells (26-connectivity) that can be reached in a straight line.
+func (g *grid) Neighbors(wp *models.Waypoint) ([]*models.Waypoint, error) {
+	idx, ok := g.indexes[wp]
+	if !ok {
+		return nil, fmt.Errorf("waypoint %v is not a cell of the grid", wp)
+	}
+
+	neighbors := make([]*models.Waypoint, 0, 26)
+	for dk := -1; dk <= 1; dk++ {
+		for dj := -1; dj <= 1; dj++ {
+			for di := -1; di <= 1; di++ {
+				if di == 0 && dj == 0 && dk == 0 {
+					continue
+				}
+				next, err := g.Cell(cellIndex{idx[0] + di, idx[1] + dj, idx[2] + dk})
+				if err != nil {
+					return nil, err
+				}
+				if next == nil {
+					continue
+				}
+				blocked, _, err := g.storage.IsLineInObstacles(wp, next)
+				if err != nil {
+					return nil, err
+				}
+				if !blocked {
+					neighbors = append(neighbors, next)
+				}
+			}
+		}
+	}
+
+	return neighbors, nil
+}
+
+// ConnectableCells returns the free cells around wp (its own cell and the adjacent ones) that it can reach in a straight line.
+func (g *grid) ConnectableCells(wp *models.Waypoint) ([]*models.Waypoint, error) {
+	idx := g.Index(wp)
+	cells := make([]*models.Waypoint, 0, 27)
+	for dk := -1; dk <= 1; dk++ {
+		for dj := -1; dj <= 1; dj++ {
+			for di := -1; di <= 1; di++ {
+				cell, err := g.Cell(cellIndex{idx[0] + di, idx[1] + dj, idx[2] + dk})
+				if err != nil {
+					return nil, err
+				}
+				if cell == nil {
+					continue
+				}
+				blocked, _, err := g.storage.IsLineInObstacles(wp, cell)
+				if err != nil {
+					return nil, err
+				}
+				if !blocked {
+					cells = append(cells, cell)
+				}
+			}
+		}
+	}
+
+	return cells, nil
+}
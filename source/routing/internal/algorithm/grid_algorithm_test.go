@@ -0,0 +1,135 @@
+package algorithm_test
+
+import (
+	"context"
+	"geopathplanner/routing/internal/algorithm"
+	"geopathplanner/routing/internal/models"
+	"geopathplanner/routing/internal/storage"
+	"geopathplanner/routing/internal/utils"
+	"math"
+	"testing"
+)
+
+func TestGridAlgorithm_run(t *testing.T) {
+	sv, w_list, c_list, c_overlapping := utils.SetupTestScenario()
+	w1 := w_list[0]
+	w2 := w_list[1]
+
+	tests := []struct {
+		name         string // description of this test case
+		newAlgorithm func() (*algorithm.GridAlgorithm, error)
+		storageType  models.StorageType
+		// Named input parameters for target function.
+		searchVolume *models.Feature3D
+		start        *models.Waypoint
+		end          *models.Waypoint
+		constraints  []*models.Feature3D
+		parameters   map[string]any
+		wantErr      bool
+	}{
+		{name: "AStar with non-overlapping obstacles - RTREE", newAlgorithm: algorithm.NewAStarAlgorithm, storageType: models.RTree, searchVolume: sv, start: w1, end: w2, constraints: c_list, wantErr: false},
+		{name: "AStar with overlapping obstacles - RTREE", newAlgorithm: algorithm.NewAStarAlgorithm, storageType: models.RTree, searchVolume: sv, start: w1, end: w2, constraints: append(c_list, c_overlapping...), wantErr: false},
+		{name: "AStar 3D with overlapping obstacles - RTREE", newAlgorithm: algorithm.NewAStarAlgorithm, storageType: models.RTree, searchVolume: sv, start: w1, end: w2, constraints: append(c_list, c_overlapping...), parameters: map[string]any{"cell_size_mt": 100.0, "layer_spacing_mt": 50.0, "max_layers": 1.0}, wantErr: false},
+		{name: "ThetaStar with non-overlapping obstacles - RTREE", newAlgorithm: algorithm.NewThetaStarAlgorithm, storageType: models.RTree, searchVolume: sv, start: w1, end: w2, constraints: c_list, wantErr: false},
+		{name: "ThetaStar with overlapping obstacles - RTREE", newAlgorithm: algorithm.NewThetaStarAlgorithm, storageType: models.RTree, searchVolume: sv, start: w1, end: w2, constraints: append(c_list, c_overlapping...), wantErr: false},
+		{name: "AStar with too many cells - RTREE", newAlgorithm: algorithm.NewAStarAlgorithm, storageType: models.RTree, searchVolume: sv, start: w1, end: w2, constraints: c_list, parameters: map[string]any{"cell_size_mt": 1.0, "max_cells": 1000.0}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := tt.newAlgorithm()
+			if err != nil {
+				t.Fatalf("could not construct receiver type: %v", err)
+			}
+
+			s, err := storage.NewEmptyStorage(tt.storageType)
+			if err != nil {
+				t.Fatalf("could not construct storage: %v", err)
+			}
+			s.AddConstraints(tt.constraints)
+
+			got, gotCost, gotErr := a.Run(context.Background(), tt.searchVolume, tt.start, tt.end, tt.parameters, s)
+
+			// TODO: For visually testing, export results in geojson
+			utils.MarkWaypointsAsOriginal(tt.start, tt.end)
+			utils.ExportToGeoJSONRoute("algorithm", got, tt.constraints, tt.searchVolume, tt.name, true)
+
+			if gotErr != nil {
+				if !tt.wantErr {
+					t.Errorf("Run() failed: %v", gotErr)
+				}
+				return
+			}
+			if tt.wantErr {
+				t.Fatal("Run() succeeded unexpectedly")
+			}
+
+			for i := 0; i < len(got)-1; i++ {
+				if blocked, _, _ := s.IsLineInObstacles(got[i], got[i+1]); blocked {
+					t.Errorf("Run() route segment %d crosses an obstacle", i)
+				}
+			}
+
+			// Same request, same route
+			again, againCost, err := a.Run(context.Background(), tt.searchVolume, tt.start, tt.end, tt.parameters, s)
+			if err != nil {
+				t.Fatalf("second Run() failed: %v", err)
+			}
+			if len(again) != len(got) || againCost != gotCost {
+				t.Fatalf("Run() is not deterministic: %d wps (%.3f mt) vs %d wps (%.3f mt)", len(got), gotCost, len(again), againCost)
+			}
+			for i := range got {
+				if got[i].Lat != again[i].Lat || got[i].Lon != again[i].Lon || got[i].Alt != again[i].Alt {
+					t.Fatalf("Run() is not deterministic: wp[%d] differs", i)
+				}
+			}
+		})
+	}
+}
+
+func TestGridAlgorithm_costFunction(t *testing.T) {
+	sv, w_list, c_list, c_overlapping := utils.SetupTestScenario()
+	waypoints := w_list[:2]
+	constraints := append(c_list, c_overlapping...)
+	proximity := map[string]any{"cell_size_mt": 25.0, "cost": map[string]any{"proximity_weight": 5.0, "proximity_mt": 60.0}}
+
+	a, err := algorithm.NewAStarAlgorithm()
+	if err != nil {
+		t.Fatalf("could not construct receiver type: %v", err)
+	}
+
+	shortest, shortestCost, err := a.Compute(context.Background(), sv, waypoints, constraints, map[string]any{"cell_size_mt": 25.0}, models.RTree)
+	if err != nil {
+		t.Fatalf("Compute() with distance cost failed: %v", err)
+	}
+	safest, safestCost, err := a.Compute(context.Background(), sv, waypoints, constraints, proximity, models.RTree)
+	if err != nil {
+		t.Fatalf("Compute() with proximity cost failed: %v", err)
+	}
+
+	utils.MarkWaypointsAsOriginal(waypoints...)
+	utils.ExportToGeoJSONRoute("algorithm", safest, constraints, sv, "AStar with proximity cost - RTREE", true)
+
+	costFunction, err := utils.NewCostFunctionFromParameters(proximity, constraints)
+	if err != nil {
+		t.Fatalf("could not construct cost function: %v", err)
+	}
+
+	// Cost is the one of the cost function, for both routes
+	if got := utils.TotalCost(costFunction, safest); math.Abs(got-safestCost) > 1e-6 {
+		t.Errorf("Compute() cost = %.3f, want the cost of its route %.3f", safestCost, got)
+	}
+	if got := utils.TotalHaversineDistance(shortest); math.Abs(got-shortestCost) > 1e-6 {
+		t.Errorf("Compute() cost = %.3f, want the length of its route %.3f", shortestCost, got)
+	}
+
+	// Keeping away from constraints is worth some length
+	shortestClearance := utils.RouteClearance(shortest, constraints, 5)
+	safestClearance := utils.RouteClearance(safest, constraints, 5)
+	t.Logf("distance cost: %.3f mt long, clearance %.3f mt; proximity cost: %.3f mt long, clearance %.3f mt", utils.TotalHaversineDistance(shortest), shortestClearance, utils.TotalHaversineDistance(safest), safestClearance)
+	if utils.TotalCost(costFunction, safest) > utils.TotalCost(costFunction, shortest)+1e-6 {
+		t.Errorf("route with proximity cost costs more than the shortest one with the same cost function")
+	}
+	if safestClearance < shortestClearance {
+		t.Errorf("route with proximity cost is closer to constraints (%.3f mt) than the shortest one (%.3f mt)", safestClearance, shortestClearance)
+	}
+}
@@ -0,0 +1,255 @@
+package algorithm
+
+import (
+	"context"
+	"fmt"
+	"geopathplanner/routing/internal/models"
+	"geopathplanner/routing/internal/storage"
+	"geopathplanner/routing/internal/utils"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	// Wall-clock time every leg is given, when parameters.portfolio_budget_ms is not set
+	DEFAULT_PORTFOLIO_BUDGET_MS float64 = 5000.0
+)
+
+// Candidates raced when parameters.portfolio is not set
+var DEFAULT_PORTFOLIO = []any{
+	map[string]any{"algorithm": string(models.RRTStar)},
+	map[string]any{"algorithm": string(models.RRTConnect)},
+	map[string]any{"algorithm": string(models.RRT)},
+	map[string]any{"algorithm": string(models.AntPath)},
+}
+
+// PortfolioAlgorithm races several candidates on every leg, each one an algorithm with its own parameters (e.g. another seed),
+// and keeps the cheapest collision-free route found within the budget. Candidates still running when the budget expires are cancelled.
+// It remembers how every candidate did on every pair of wps, so that the response can tell.
+type PortfolioAlgorithm struct {
+	mu    sync.Mutex
+	stats map[[2]*models.Waypoint][]*models.PortfolioCandidate
+}
+
+func NewPortfolioAlgorithm() (*PortfolioAlgorithm, error) {
+	return &PortfolioAlgorithm{stats: make(map[[2]*models.Waypoint][]*models.PortfolioCandidate)}, nil
+}
+
+// portfolioCandidate is one of the entries of parameters.portfolio
+type portfolioCandidate struct {
+	name       string
+	algorithm  Algorithm
+	parameters map[string]any // added to the ones of the request
+}
+
+// Concurrency version of Compute function, where every pair of wps is processed in a separate goroutine.
+func (a *PortfolioAlgorithm) ComputeConcurrently(ctx context.Context, searchVolume *models.Feature3D, waypoints []*models.Waypoint, constraints []*models.Feature3D, parameters map[string]any, storageType models.StorageType, maxWorkers int) ([]*models.Waypoint, float64, error) {
+	candidates, budget, err := a.GetParameters(parameters)
+	if err != nil {
+		return nil, 0.0, err
+	}
+	return computeLegsConcurrently(ctx, "Portfolio", waypoints, constraints, parameters, storageType, maxWorkers, func(ctx context.Context, start, end *models.Waypoint, parameters map[string]any, s storage.Storage) ([]*models.Waypoint, float64, error) {
+		return a.Run(ctx, searchVolume, start, end, constraints, parameters, storageType, s, candidates, budget)
+	})
+}
+
+func (a *PortfolioAlgorithm) Compute(ctx context.Context, searchVolume *models.Feature3D, waypoints []*models.Waypoint, constraints []*models.Feature3D, parameters map[string]any, storageType models.StorageType) ([]*models.Waypoint, float64, error) {
+	candidates, budget, err := a.GetParameters(parameters)
+	if err != nil {
+		return nil, 0.0, err
+	}
+	return computeLegs(ctx, "Portfolio", waypoints, constraints, parameters, storageType, func(ctx context.Context, start, end *models.Waypoint, parameters map[string]any, s storage.Storage) ([]*models.Waypoint, float64, error) {
+		return a.Run(ctx, searchVolume, start, end, constraints, parameters, storageType, s, candidates, budget)
+	})
+}
+
+// Run plans start -> end with all the candidates at once, for at most budget.
+// Every candidate plans between its own copies of start and end, as planners write on the properties of the wps they are given.
+// Routes are checked against the constraints in s, as they are when flown if the leg is scheduled, and compared with the cost function of s.
+func (a *PortfolioAlgorithm) Run(ctx context.Context, searchVolume *models.Feature3D, start, end *models.Waypoint, constraints []*models.Feature3D, parameters map[string]any, storageType models.StorageType, s storage.Storage, candidates []*portfolioCandidate, budget time.Duration) ([]*models.Waypoint, float64, error) {
+	type outcome struct {
+		i        int
+		route    []*models.Waypoint
+		err      error
+		duration time.Duration
+	}
+
+	budgetCtx, cancel := context.WithTimeout(ctx, budget)
+	defer cancel()
+
+	outcomes := make(chan outcome, len(candidates))
+	for i, c := range candidates {
+		candidateStart, candidateEnd := copyWaypoint(start), copyWaypoint(end)
+		candidateParameters := maps.Clone(parameters)
+		if candidateParameters == nil {
+			candidateParameters = map[string]any{}
+		}
+		maps.Copy(candidateParameters, c.parameters)
+
+		go func() {
+			t0 := time.Now()
+			route, _, err := c.algorithm.Compute(budgetCtx, searchVolume, []*models.Waypoint{candidateStart, candidateEnd}, constraints, candidateParameters, storageType)
+			outcomes <- outcome{i: i, route: withEndpoints(route, start, end, candidateStart, candidateEnd), err: err, duration: time.Since(t0)}
+		}()
+	}
+
+	// Wait for every candidate, the ones still running at the end of the budget stop on their own
+	stats := make([]*models.PortfolioCandidate, len(candidates))
+	var best []*models.Waypoint
+	bestCost, selected := 0.0, -1
+	for range candidates {
+		o := <-outcomes
+		stat := &models.PortfolioCandidate{Candidate: candidates[o.i].name, DurationMs: float64(o.duration) / float64(time.Millisecond)}
+		stats[o.i] = stat
+
+		err := o.err
+		if err == nil {
+			err = a.checkRoute(s, o.route, start, parameters)
+		}
+		if err != nil {
+			stat.Error = err.Error()
+			continue
+		}
+
+		stat.Found = true
+		stat.CostKm = utils.TotalCost(s.GetCostFunction(), o.route)
+		if selected < 0 || stat.CostKm < bestCost {
+			best, bestCost, selected = o.route, stat.CostKm, o.i
+		}
+	}
+	if selected >= 0 {
+		stats[selected].Selected = true
+	}
+
+	a.mu.Lock()
+	a.stats[[2]*models.Waypoint{start.Reached(), end}] = stats
+	a.mu.Unlock()
+
+	if selected < 0 {
+		if ctx.Err() != nil {
+			return nil, 0.0, fmt.Errorf("portfolio stopped: %w", ctx.Err())
+		}
+		return nil, 0.0, fmt.Errorf("none of the %d candidates found a route within %v", len(candidates), budget)
+	}
+	fmt.Printf("Portfolio: %s found the cheapest route (%.3f)\n", stats[selected].Candidate, bestCost)
+	return best, bestCost, nil
+}
+
+// copyWaypoint returns a copy of wp with its own properties
+func copyWaypoint(wp *models.Waypoint) *models.Waypoint {
+	cp, _ := models.NewWaypoint(wp.Lat, wp.Lon, wp.Alt)
+	cp.ID = wp.ID
+	maps.Copy(cp.Feature.Properties, wp.Feature.Properties)
+	return cp
+}
+
+// withEndpoints returns route with the copies of the endpoints given to a candidate replaced by start and end.
+// A route entering the acceptance radius of the copy of end gets an entry point standing for end.
+func withEndpoints(route []*models.Waypoint, start, end, candidateStart, candidateEnd *models.Waypoint) []*models.Waypoint {
+	if len(route) < 2 {
+		return route
+	}
+	route = slices.Clone(route)
+	if route[0] == candidateStart {
+		route[0] = start
+	}
+	last := len(route) - 1
+	switch {
+	case route[last] == candidateEnd:
+		route[last] = end
+	case route[last].Reaches(candidateEnd):
+		route[last] = models.NewEntryPoint(route[last], end)
+	}
+	return route
+}
+
+// checkRoute makes sure that a candidate route goes from start to the end of the leg without meeting any obstacle
+func (a *PortfolioAlgorithm) checkRoute(s storage.Storage, route []*models.Waypoint, start *models.Waypoint, parameters map[string]any) error {
+	if len(route) < 2 || route[0] != start {
+		return fmt.Errorf("route doesn't start from the leg")
+	}
+	clock, err := newLegClock(start, parameters)
+	if err != nil {
+		return err
+	}
+	for i := 1; i < len(route); i++ {
+		blocked, err := clock.isLineBlocked(s, route[i-1], route[i])
+		if err != nil {
+			return err
+		}
+		if blocked {
+			return fmt.Errorf("segment %d of the route meets an obstacle", i-1)
+		}
+		clock.connect(route[i-1], route[i])
+	}
+	return nil
+}
+
+// Stats returns how every candidate did on every pair of consecutive wps, the last time it was planned
+func (a *PortfolioAlgorithm) Stats(waypoints []*models.Waypoint) []*models.PortfolioCandidate {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	stats := make([]*models.PortfolioCandidate, 0)
+	for i := 1; i < len(waypoints); i++ {
+		for _, stat := range a.stats[[2]*models.Waypoint{waypoints[i-1], waypoints[i]}] {
+			legStat := *stat
+			legStat.Leg = i - 1
+			stats = append(stats, &legStat)
+		}
+	}
+	return stats
+}
+
+// GetParameters reads parameters.portfolio, a list of candidates like
+//
+//	{"name": "rrt-seed-1", "algorithm": "rrt", "seed": 1}
+//
+// where everything but name and algorithm overrides the parameters of the request, and parameters.portfolio_budget_ms.
+func (a *PortfolioAlgorithm) GetParameters(parameters map[string]any) ([]*portfolioCandidate, time.Duration, error) {
+	PORTFOLIO := utils.GetOrDefault(parameters, "portfolio", DEFAULT_PORTFOLIO)
+	BUDGET_MS := utils.GetOrDefault(parameters, "portfolio_budget_ms", DEFAULT_PORTFOLIO_BUDGET_MS)
+
+	if BUDGET_MS <= 0 {
+		return nil, 0, fmt.Errorf("portfolio_budget_ms must be positive, got %f", BUDGET_MS)
+	}
+	if len(PORTFOLIO) == 0 {
+		return nil, 0, fmt.Errorf("portfolio must have at least one candidate")
+	}
+
+	candidates := make([]*portfolioCandidate, 0, len(PORTFOLIO))
+	for i, entry := range PORTFOLIO {
+		config, ok := entry.(map[string]any)
+		if !ok {
+			return nil, 0, fmt.Errorf("portfolio[%d] must be an object, got %T", i, entry)
+		}
+		algorithmType := models.AlgorithmType(utils.GetOrDefault(config, "algorithm", ""))
+		if algorithmType == models.Portfolio {
+			return nil, 0, fmt.Errorf("portfolio[%d] can't be a portfolio", i)
+		}
+		algo, err := NewAlgorithm(algorithmType)
+		if err != nil {
+			return nil, 0, fmt.Errorf("portfolio[%d]: %w", i, err)
+		}
+
+		candidateParameters := maps.Clone(config)
+		delete(candidateParameters, "name")
+		delete(candidateParameters, "algorithm")
+		candidates = append(candidates, &portfolioCandidate{
+			name:       utils.GetOrDefault(config, "name", fmt.Sprintf("%s#%d", algorithmType, i)),
+			algorithm:  algo,
+			parameters: candidateParameters,
+		})
+	}
+
+	fmt.Printf("PORTFOLIO\n")
+	for _, c := range candidates {
+		fmt.Printf("candidate %s: %v\n", c.name, c.parameters)
+	}
+	fmt.Printf("portfolio_budget_ms: %f\n", BUDGET_MS)
+	fmt.Printf("--------------------------------------------------------\n")
+
+	return candidates, time.Duration(BUDGET_MS * float64(time.Millisecond)), nil
+}
@@ -0,0 +1,109 @@
+package algorithm_test
+
+import (
+	"context"
+	"geopathplanner/routing/internal/algorithm"
+	"geopathplanner/routing/internal/models"
+	"geopathplanner/routing/internal/utils"
+	"testing"
+)
+
+func TestPortfolioAlgorithm_GetParameters(t *testing.T) {
+	tests := []struct {
+		name           string // description of this test case
+		parameters     map[string]any
+		wantCandidates int
+		wantErr        bool
+	}{
+		{name: "Defaults", parameters: nil, wantCandidates: len(algorithm.DEFAULT_PORTFOLIO)},
+		{name: "Seeds", parameters: map[string]any{"portfolio": []any{map[string]any{"algorithm": "rrt", "seed": 1.0}, map[string]any{"algorithm": "rrt", "seed": 2.0}}}, wantCandidates: 2},
+		{name: "Unknown algorithm", parameters: map[string]any{"portfolio": []any{map[string]any{"algorithm": "dijkstra"}}}, wantErr: true},
+		{name: "Nested portfolio", parameters: map[string]any{"portfolio": []any{map[string]any{"algorithm": "portfolio"}}}, wantErr: true},
+		{name: "Not an object", parameters: map[string]any{"portfolio": []any{"rrt"}}, wantErr: true},
+		{name: "Non-positive budget", parameters: map[string]any{"portfolio_budget_ms": 0.0}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := algorithm.NewPortfolioAlgorithm()
+			if err != nil {
+				t.Fatalf("could not construct receiver type: %v", err)
+			}
+			got, _, gotErr := a.GetParameters(tt.parameters)
+			if gotErr != nil {
+				if !tt.wantErr {
+					t.Errorf("GetParameters() failed: %v", gotErr)
+				}
+				return
+			}
+			if tt.wantErr {
+				t.Fatal("GetParameters() succeeded unexpectedly")
+			}
+			if len(got) != tt.wantCandidates {
+				t.Errorf("GetParameters() returned %d candidates, want %d", len(got), tt.wantCandidates)
+			}
+		})
+	}
+}
+
+func TestPortfolioAlgorithm_Compute(t *testing.T) {
+	sv, w_list, c_list, _ := utils.SetupTestScenario()
+	waypoints := []*models.Waypoint{w_list[0], w_list[1]}
+	portfolio := []any{
+		map[string]any{"name": "rrt-1", "algorithm": "rrt", "seed": 1.0},
+		map[string]any{"name": "rrt-2", "algorithm": "rrt", "seed": 2.0},
+		map[string]any{"name": "rrt-starved", "algorithm": "rrt", "max_iterations": 1.0, "max_leg_retries": 0.0},
+		map[string]any{"name": "antpath", "algorithm": "antpath"},
+	}
+
+	tests := []struct {
+		name        string // description of this test case
+		storageType models.StorageType
+		concurrent  bool
+	}{
+		{name: "Portfolio - RTREE", storageType: models.RTree},
+		{name: "Portfolio concurrently - LIST", storageType: models.List, concurrent: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := algorithm.NewPortfolioAlgorithm()
+			if err != nil {
+				t.Fatalf("could not construct receiver type: %v", err)
+			}
+
+			parameters := map[string]any{"portfolio": portfolio, "portfolio_budget_ms": 30000.0}
+			var got []*models.Waypoint
+			var gotCost float64
+			var gotErr error
+			if tt.concurrent {
+				got, gotCost, gotErr = a.ComputeConcurrently(context.Background(), sv, waypoints, c_list, parameters, tt.storageType, 0)
+			} else {
+				got, gotCost, gotErr = a.Compute(context.Background(), sv, waypoints, c_list, parameters, tt.storageType)
+			}
+			if gotErr != nil {
+				t.Fatalf("Compute() failed: %v", gotErr)
+			}
+			// Candidates plan between copies of the wps, the route must go through the wps of the request
+			if got[0] != waypoints[0] || got[len(got)-1] != waypoints[1] {
+				t.Errorf("Compute() = %v -> %v, want the route from %v to %v", got[0], got[len(got)-1], waypoints[0], waypoints[1])
+			}
+
+			utils.MarkWaypointsAsOriginal(waypoints...)
+			utils.ExportToGeoJSONRoute("algorithm", got, c_list, sv, tt.name, true)
+
+			stats := a.Stats(waypoints)
+			if len(stats) != len(portfolio) {
+				t.Fatalf("Stats() returned %d candidates, want %d", len(stats), len(portfolio))
+			}
+			for _, stat := range stats {
+				switch {
+				case stat.Candidate == "rrt-starved" && (stat.Found || stat.Error == ""):
+					t.Errorf("Stats() = %+v, want the starved candidate to fail", stat)
+				case stat.Selected && stat.CostKm != gotCost:
+					t.Errorf("Stats() selected %+v, want the cost of the route %.3f", stat, gotCost)
+				case stat.Found && stat.CostKm < gotCost:
+					t.Errorf("Stats() = %+v, cheaper than the route %.3f", stat, gotCost)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package algorithm
+
+import (
+	"context"
+	"fmt"
+	"geopathplanner/routing/internal/models"
+	"geopathplanner/routing/internal/storage"
+	"geopathplanner/routing/internal/utils"
+	"math"
+)
+
+// PRMAlgorithm samples one collision-free roadmap for the whole request, and then answers every leg with a graph search on it.
+type PRMAlgorithm struct {
+}
+
+func NewPRMAlgorithm() (*PRMAlgorithm, error) {
+	return &PRMAlgorithm{}, nil
+}
+
+// Concurrency version of Compute function: the roadmap is built once, then every pair of wps is searched in a separate goroutine.
+func (a *PRMAlgorithm) ComputeConcurrently(ctx context.Context, searchVolume *models.Feature3D, waypoints []*models.Waypoint, constraints []*models.Feature3D, parameters map[string]any, storageType models.StorageType, maxWorkers int) ([]*models.Waypoint, float64, error) {
+	if len(waypoints) < 2 {
+		return nil, 0.0, fmt.Errorf("less than 2 waypoints submitted (%d): abort", len(waypoints))
+	}
+
+	graph, temporary, err := a.BuildRoadmap(ctx, searchVolume, waypoints, constraints, parameters, storageType)
+	if err != nil {
+		return nil, 0.0, err
+	}
+
+	// The roadmap is read-only from now on, the storage of the workers only needs the time-dependent constraints left out of it
+	return computeLegsConcurrently(ctx, "PRM", waypoints, temporary, parameters, storageType, maxWorkers, func(ctx context.Context, start, end *models.Waypoint, parameters map[string]any, s storage.Storage) ([]*models.Waypoint, float64, error) {
+		return a.searchLeg(graph, start, end, parameters, s)
+	})
+}
+
+func (a *PRMAlgorithm) Compute(ctx context.Context, searchVolume *models.Feature3D, waypoints []*models.Waypoint, constraints []*models.Feature3D, parameters map[string]any, storageType models.StorageType) ([]*models.Waypoint, float64, error) {
+	if len(waypoints) < 2 {
+		return nil, 0.0, fmt.Errorf("less than 2 waypoints submitted (%d): abort", len(waypoints))
+	}
+
+	graph, temporary, err := a.BuildRoadmap(ctx, searchVolume, waypoints, constraints, parameters, storageType)
+	if err != nil {
+		return nil, 0.0, err
+	}
+
+	return computeLegs(ctx, "PRM", waypoints, temporary, parameters, storageType, func(ctx context.Context, start, end *models.Waypoint, parameters map[string]any, s storage.Storage) ([]*models.Waypoint, float64, error) {
+		return a.searchLeg(graph, start, end, parameters, s)
+	})
+}
+
+// BuildRoadmap samples num_samples free wps in the search volume and links each one to its k nearest ones when the connection is collision-free.
+// Then the waypoints of the request are linked to the roadmap as well.
+// With a departure time, the roadmap avoids the static constraints only: the temporary and moving ones are returned, to be checked by the search of every leg.
+func (a *PRMAlgorithm) BuildRoadmap(ctx context.Context, searchVolume *models.Feature3D, waypoints []*models.Waypoint, constraints []*models.Feature3D, parameters map[string]any, storageType models.StorageType) (*roadmap, []*models.Feature3D, error) {
+	sampler, num_samples, k_neighbors := a.GetParameters(parameters)
+
+	var temporary []*models.Feature3D
+	roadmapConstraints := constraints
+	if !departureTime(parameters).IsZero() {
+		roadmapConstraints, temporary = models.SplitTimeDependentConstraints(constraints)
+	}
+
+	// Create storage and load constraint into it, it's used as spatial index for the roadmap nodes
+	s, err := storage.NewEmptyStorage(storageType)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := s.AddConstraints(roadmapConstraints); err != nil {
+		return nil, nil, err
+	}
+	defer s.Clear()
+
+	costFunction, err := utils.NewCostFunctionFromParameters(parameters, constraints)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Roadmap nodes are sampled between min and max altitude of the waypoints
+	minAlt, maxAlt := math.Inf(1), math.Inf(-1)
+	for _, wp := range waypoints {
+		minAlt = math.Min(minAlt, wp.Alt.Normalize().Value)
+		maxAlt = math.Max(maxAlt, wp.Alt.Normalize().Value)
+	}
+
+	graph := newRoadmap(costFunction)
+
+	// 1. Sample free nodes
+	for range num_samples {
+		if ctx.Err() != nil {
+			return nil, nil, fmt.Errorf("roadmap not completed: %w", ctx.Err())
+		}
+
+		alt, err := models.NewAltitude(sampler.SampleZ(minAlt, maxAlt), models.MT)
+		if err != nil {
+			return nil, nil, err
+		}
+		sampled, err := s.SampleFree(sampler, searchVolume, alt)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := s.AddWaypoint(sampled); err != nil {
+			return nil, nil, err
+		}
+		graph.AddNode(sampled)
+	}
+
+	// 2. Link every node to its k nearest ones
+	for _, node := range s.MustGetWaypoints() {
+		if ctx.Err() != nil {
+			return nil, nil, fmt.Errorf("roadmap not completed: %w", ctx.Err())
+		}
+		if _, err := a.connectNode(graph, s, node, k_neighbors); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// 3. Link waypoints to the roadmap, widening the neighborhood if they end up isolated
+	for i, wp := range waypoints {
+		if err := s.AddWaypoint(wp); err != nil {
+			return nil, nil, err
+		}
+		graph.AddNode(wp)
+
+		for k := k_neighbors; k <= 4*k_neighbors; k *= 2 {
+			linked, err := a.connectNode(graph, s, wp, k)
+			if err != nil {
+				return nil, nil, err
+			}
+			if linked > 0 {
+				break
+			}
+		}
+
+		// Consecutive waypoints in line of sight don't need the roadmap at all
+		if i > 0 {
+			blocked, _, err := s.IsLineInObstacles(waypoints[i-1], wp)
+			if err != nil {
+				return nil, nil, err
+			}
+			if !blocked {
+				graph.AddEdge(waypoints[i-1], wp)
+			}
+		}
+	}
+
+	fmt.Printf("PRM roadmap built with %d nodes\n", graph.NodesLen())
+	return graph, temporary, nil
+}
+
+// searchLeg searches the roadmap from start to end, checking the time-dependent constraints in s when the leg is scheduled
+func (a *PRMAlgorithm) searchLeg(graph *roadmap, start, end *models.Waypoint, parameters map[string]any, s storage.Storage) ([]*models.Waypoint, float64, error) {
+	clock, err := newLegClock(start, parameters)
+	if err != nil {
+		return nil, 0.0, err
+	}
+	return graph.ShortestPath(start, end, clock, s)
+}
+
+// connectNode links node to its k nearest wps in storage, returns how many edges were added.
+func (a *PRMAlgorithm) connectNode(graph *roadmap, s storage.Storage, node *models.Waypoint, k int) (int, error) {
+	// Ask for one more, as node itself is in the storage
+	neighbors, _, err := s.KNearestPoints(node, k+1)
+	if err != nil {
+		return 0, err
+	}
+
+	linked := 0
+	for _, near := range neighbors {
+		if near == node || graph.HasEdge(node, near) {
+			continue
+		}
+		blocked, _, err := s.IsLineInObstacles(node, near)
+		if err != nil {
+			return linked, err
+		}
+		if blocked {
+			continue
+		}
+		graph.AddEdge(node, near)
+		linked++
+	}
+
+	return linked, nil
+}
+
+func (a *PRMAlgorithm) GetParameters(parameters map[string]any) (utils.Sampler, int, int) {
+	NUM_SAMPLES := int(utils.GetOrDefault(parameters, "num_samples", 1000.0))
+	K_NEIGHBORS := int(utils.GetOrDefault(parameters, "k_neighbors", 10.0))
+	SAMPLER_TYPE := utils.GetOrDefault(parameters, "sampler_type", models.Uniform)
+	SEED := utils.GetOrDefault(parameters, "seed", 945.0)
+
+	SAMPLER, err := utils.NewSampler(SAMPLER_TYPE, int64(SEED))
+	if err != nil {
+		SAMPLER = utils.NewUniformSampler(int64(SEED))
+	}
+
+	fmt.Printf("PARAMETERS\n")
+	fmt.Printf("num_samples: %d\n", NUM_SAMPLES)
+	fmt.Printf("k_neighbors: %d\n", K_NEIGHBORS)
+	fmt.Printf("sampler: %+v\n", SAMPLER)
+	fmt.Printf("--------------------------------------------------------\n")
+
+	return SAMPLER, NUM_SAMPLES, K_NEIGHBORS
+}
@@ -0,0 +1,116 @@
+package algorithm_test
+
+import (
+	"context"
+	"geopathplanner/routing/internal/algorithm"
+	"geopathplanner/routing/internal/models"
+	"geopathplanner/routing/internal/storage"
+	"geopathplanner/routing/internal/utils"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestPRMAlgorithm_ComputeConcurrently(t *testing.T) {
+	sv, w_list, c_list, c_overlapping := utils.SetupTestScenario()
+	parameters := map[string]any{"num_samples": 500.0, "k_neighbors": 10.0}
+
+	tests := []struct {
+		name        string // description of this test case
+		storageType models.StorageType
+		// Named input parameters for target function.
+		searchVolume *models.Feature3D
+		waypoints    []*models.Waypoint
+		constraints  []*models.Feature3D
+		maxWorkers   int
+		wantErr      bool
+	}{
+		{name: "ConcurrentPRMFull 1 with no obstacles - RTREE", storageType: models.RTree, searchVolume: sv, waypoints: w_list, constraints: []*models.Feature3D{}, maxWorkers: 1, wantErr: false},
+		{name: "ConcurrentPRMFull 1 with non-overlapping obstacles - RTREE", storageType: models.RTree, searchVolume: sv, waypoints: w_list, constraints: c_list, maxWorkers: 1, wantErr: false},
+		{name: "ConcurrentPRMFull 3 with overlapping obstacles - RTREE", storageType: models.RTree, searchVolume: sv, waypoints: w_list, constraints: append(c_list, c_overlapping...), maxWorkers: 3, wantErr: false},
+		{name: "ConcurrentPRMFull 3 with overlapping obstacles - LIST", storageType: models.List, searchVolume: sv, waypoints: w_list, constraints: append(c_list, c_overlapping...), maxWorkers: 3, wantErr: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := algorithm.NewPRMAlgorithm()
+			if err != nil {
+				t.Fatalf("could not construct receiver type: %v", err)
+			}
+
+			got, _, gotErr := a.ComputeConcurrently(context.Background(), tt.searchVolume, tt.waypoints, tt.constraints, parameters, tt.storageType, tt.maxWorkers)
+
+			// TODO: For visually testing, export results in geojson
+			utils.MarkWaypointsAsOriginal(tt.waypoints...)
+			utils.ExportToGeoJSONRoute("algorithm", got, tt.constraints, tt.searchVolume, tt.name, true)
+
+			if gotErr != nil {
+				if !tt.wantErr {
+					t.Errorf("ComputeConcurrently() failed: %v", gotErr)
+				}
+				return
+			}
+			if tt.wantErr {
+				t.Fatal("ComputeConcurrently() succeeded unexpectedly")
+			}
+
+			// Every waypoint must be visited in order, and no segment can cross an obstacle
+			s, _ := storage.NewStorage(nil, tt.constraints, tt.storageType)
+			last := -1
+			for _, wp := range tt.waypoints {
+				idx := slices.Index(got, wp)
+				if idx <= last {
+					t.Fatalf("ComputeConcurrently() route does not visit waypoints in order")
+				}
+				last = idx
+			}
+			for i := 0; i < len(got)-1; i++ {
+				if blocked, _, _ := s.IsLineInObstacles(got[i], got[i+1]); blocked {
+					t.Errorf("ComputeConcurrently() route segment %d crosses an obstacle", i)
+				}
+			}
+		})
+	}
+}
+
+func TestPRMAlgorithm_temporaryConstraints(t *testing.T) {
+	a, _ := models.NewAltitude(100, models.MT)
+	searchVolume := models.MustNewFeatureFromGeojson(`{"type": "Feature", "properties": {}, "geometry": {"type": "Polygon", "coordinates": [[[3.996, 49.997], [4.007, 49.997], [4.007, 50.003], [3.996, 50.003], [3.996, 49.997]]]}}`)
+	// There and back again through the middle of a zone closing 40 s after departure: ~29 s each leg at 15 m/s
+	waypoints := []*models.Waypoint{
+		models.MustNewWaypoint(0, 50.0, 3.9985, a),
+		models.MustNewWaypoint(1, 50.0, 4.0045, a),
+		models.MustNewWaypoint(2, 50.0, 3.9986, a),
+	}
+	constraints := []*models.Feature3D{
+		models.MustNewFeatureFromGeojson(`{"type": "Feature", "properties": {"active_from": "2026-10-17T09:00:40Z"}, "geometry": {"type": "Polygon", "coordinates": [[[4.0, 49.999], [4.002, 49.999], [4.002, 50.001], [4.0, 50.001], [4.0, 49.999]]]}}`),
+	}
+	departure, _ := time.Parse(time.RFC3339, "2026-10-17T09:00:00Z")
+	parameters := map[string]any{"num_samples": 500.0, "k_neighbors": 10.0, models.DEPARTURE_TIME_PARAMETER: departure}
+
+	for _, storageType := range []models.StorageType{models.RTree, models.List} {
+		t.Run(string(storageType), func(t *testing.T) {
+			prm, err := algorithm.NewPRMAlgorithm()
+			if err != nil {
+				t.Fatalf("could not construct receiver type: %v", err)
+			}
+
+			// Legs of a scheduled route can't run concurrently, as the second one departs when the first one arrives
+			got, _, gotErr := prm.ComputeConcurrently(context.Background(), searchVolume, waypoints, constraints, parameters, storageType, 2)
+			if gotErr != nil {
+				t.Fatalf("ComputeConcurrently() failed: %v", gotErr)
+			}
+
+			utils.MarkWaypointsAsOriginal(waypoints...)
+			utils.ExportToGeoJSONRoute("algorithm", got, constraints, searchVolume, "PRM with a zone closing during the route - "+string(storageType), true)
+
+			// The first leg goes straight through the zone, still open, the second one around it
+			if got[1] != waypoints[1] {
+				t.Errorf("ComputeConcurrently() first leg = %v, want the straight line", got[:slices.Index(got, waypoints[1])+1])
+			}
+			if got[2] == waypoints[2] {
+				t.Errorf("ComputeConcurrently() second leg is the straight line through the closed zone")
+			}
+			assertScheduleFree(t, got, departure, constraints)
+		})
+	}
+}
@@ -1,12 +1,11 @@
 package algorithm
 
 import (
+	"context"
 	"fmt"
 	"geopathplanner/routing/internal/models"
 	"geopathplanner/routing/internal/storage"
 	"geopathplanner/routing/internal/utils"
-	"runtime"
-	"sync"
 )
 
 type RRTAlgorithm struct {
@@ -17,178 +16,43 @@ func NewRRTAlgorithm() (*RRTAlgorithm, error) {
 }
 
 // Concurrency version of Compute function, where every pair of wps is processed in a separate goroutine.
-// TODO: Still in testing
-func (a *RRTAlgorithm) ComputeConcurrently(searchVolume *models.Feature3D, waypoints []*models.Waypoint, constraints []*models.Feature3D, parameters map[string]any, storageType models.StorageType, maxWorkers int) ([]*models.Waypoint, float64, error) {
-	// Check if waypoints are at least 2
-	numPairs := len(waypoints) - 1
-	if numPairs <= 0 {
-		return nil, 0.0, fmt.Errorf("less than 2 waypoints submitted (%d): abort", len(waypoints))
-	}
-	
-	maxCPU := runtime.NumCPU()
-	fmt.Printf("[WARN] Requested %d workers (%d cores, %d wpsPairs)\n", maxWorkers, maxCPU, numPairs)
-	if maxWorkers <= 0 {
-		maxWorkers = min(maxCPU, numPairs)
-	} else {
-		maxWorkers = min(maxWorkers, maxCPU, numPairs)
-	}
-	fmt.Printf("[WARN] Assigned %d workers (%d cores, %d wpsPairs)\n", maxWorkers, maxCPU, numPairs)
-
-	// If just 1 worker, use the normal version
-	if maxWorkers == 1 {
-		return a.Compute(searchVolume, waypoints, constraints, parameters, storageType)
-	}
-
-	// TODO: Buffer constraints
-	// TODO: Think about creating and adding constraints in Run function so to parallelize that function
-	// Create storage and load constraint into it
-	storage, err := storage.NewEmptyStorage(storageType)
-	if err != nil {
-		return nil, 0.0, err
-	}
-	err = storage.AddConstraints(constraints)
-	if err != nil {
-		return nil, 0.0, err
-	}
-
-	// === Channels and synchronization structures ===
-	jobs := make(chan job, numPairs)       // channel for distributing work
-	results := make(chan result, numPairs) // channel to collect computed results
-	var wg sync.WaitGroup // ensures all workers complete before closing results
-
-	// 1. Create and start the workers
-	for w := 0; w < maxWorkers; w++ {
-		wg.Add(1)
-		go func(workerID int) {
-			defer wg.Done()
-
-			for j := range jobs {
-				// Run RRT for this pair of waypoints
-				tmpRoute, tmpCost, err := a.Run(searchVolume, j.startWP, j.endWP, parameters, storage.Clone())
-				if err != nil {
-					results <- result{i: j.i, err: fmt.Errorf("worker %d: run RRT: %w", workerID, err)}
-					continue
-				}
-
-				results <- result{
-					i:     j.i,
-					route: tmpRoute,
-					cost:  tmpCost,
-					err:   nil,
-				}
-			}
-		}(w)
-	}
-
-	// 2. Send jobs to workers
-	for i := 0; i < numPairs; i++ {
-		jobs <- job{
-			i:       i,
-			startWP: waypoints[i],
-			endWP:   waypoints[i+1],
-		}
-	}
-	close(jobs) // no more jobs to send
-
-	// 3. Collect results
-	go func() {
-		wg.Wait()      // wait for all workers to finish
-		close(results) // then close result channel
-	}()
-
-	// Store results in correct order
-	routeSegments := make([][]*models.Waypoint, numPairs)
-	costs := make([]float64, numPairs)
-	var firstErr error
-
-	for res := range results {
-		if res.err != nil && firstErr == nil {
-			firstErr = res.err
-		}
-		routeSegments[res.i] = res.route
-		costs[res.i] = res.cost
-	}
-
-	// TODO: Since here we know what pair had an error, we could think about rerunning just that portion.
-	if firstErr != nil {
-		return nil, 0, firstErr
-	}
-
-	// 4. Merge results
-	finalRoute := make([]*models.Waypoint, 0)
-	totalCost := 0.0
-
-	// Start from first waypoint
-	if len(routeSegments) > 0 && len(routeSegments[0]) > 0 {
-		finalRoute = append(finalRoute, routeSegments[0][0])
-	}
-
-	for i, seg := range routeSegments {
-		if len(seg) == 0 {
-			continue
-		}
-		totalCost += costs[i]
-		// Skip first element to avoid duplicates
-		finalRoute = append(finalRoute, seg[1:]...)
-	}
-
-	return finalRoute, totalCost, nil
+func (a *RRTAlgorithm) ComputeConcurrently(ctx context.Context, searchVolume *models.Feature3D, waypoints []*models.Waypoint, constraints []*models.Feature3D, parameters map[string]any, storageType models.StorageType, maxWorkers int) ([]*models.Waypoint, float64, error) {
+	return computeLegsConcurrently(ctx, "RRT", waypoints, constraints, parameters, storageType, maxWorkers, func(ctx context.Context, start, end *models.Waypoint, parameters map[string]any, s storage.Storage) ([]*models.Waypoint, float64, error) {
+		return a.Run(ctx, searchVolume, start, end, parameters, s)
+	})
 }
 
-func (a *RRTAlgorithm) Compute(searchVolume *models.Feature3D, waypoints []*models.Waypoint, constraints []*models.Feature3D, parameters map[string]any, storageType models.StorageType) ([]*models.Waypoint, float64, error) {
-	// Check if waypoints are at least 2
-	numPairs := len(waypoints) - 1
-	if numPairs <= 0 {
-		return nil, 0.0, fmt.Errorf("less than 2 waypoints submitted (%d): abort", len(waypoints))
-	}
+func (a *RRTAlgorithm) Compute(ctx context.Context, searchVolume *models.Feature3D, waypoints []*models.Waypoint, constraints []*models.Feature3D, parameters map[string]any, storageType models.StorageType) ([]*models.Waypoint, float64, error) {
+	return computeLegs(ctx, "RRT", waypoints, constraints, parameters, storageType, func(ctx context.Context, start, end *models.Waypoint, parameters map[string]any, s storage.Storage) ([]*models.Waypoint, float64, error) {
+		return a.Run(ctx, searchVolume, start, end, parameters, s)
+	})
+}
 
-	// Create empty list of wps
-	route := make([]*models.Waypoint, 0)
-	cost := 0.0
+func (a *RRTAlgorithm) Run(ctx context.Context, searchVolume *models.Feature3D, start, end *models.Waypoint, parameters map[string]any, storage storage.Storage) ([]*models.Waypoint, float64, error) {
+	// TODO: Think if this is the correct place
+	storage.ClearWaypoints()
+	fmt.Printf("wpA: %v, wpB: %v, storage starts with %d constraints and %d sampled waypoints.\n", start, end, storage.ConstraintsLen(), storage.WaypointsLen())
 
-	// 0. Load first wp
-	route = append(route, waypoints[0])
-	
-	// TODO: Buffer constraints
-	// TODO: Think about creating and adding constraints in Run function so to parallelize that function
-	// 1. Create storage and load constraint into it
-	storage, err := storage.NewEmptyStorage(storageType)
+	planning_3d, max_gradient, err := a.getSpaceParameters(parameters, searchVolume)
 	if err != nil {
 		return nil, 0.0, err
 	}
-	err = storage.AddConstraints(constraints)
+
+	// With a departure time, the tree keeps the eta of its wps and temporary constraints block only while active
+	clock, err := newLegClock(start, parameters)
 	if err != nil {
 		return nil, 0.0, err
 	}
 
-	// 2. For each pair of wp -> run rrt
-	for i := 0; i < len(waypoints)-1; i++ {
-		tmpRoute, tmpCost, err := a.Run(searchVolume, waypoints[i], waypoints[i+1], parameters, storage.Clone())
-		if err != nil {
-			// Return route until now
-			return route, cost, fmt.Errorf("interrupted RRT for error between wp[%d] and wp[%d]: %w", i, i+1, err)
-		}
-		// Append new route but removing the first one
-		route = append(route, tmpRoute[1:]...)
-		cost += tmpCost
+	// First thing to do if to check if a straight line connection is possible.
+	// A goal with an acceptance radius is reached where the line enters it.
+	goal := end
+	if entry := utils.AcceptanceEntryPoint(start, end, end); entry != nil {
+		goal = entry
 	}
-
-	// TODO: Think if this is the correct place
-	storage.Clear()
-	
-	// 3. Return everything
-	return route, cost, nil
-}
-
-func (a *RRTAlgorithm) Run(searchVolume *models.Feature3D, start, end *models.Waypoint, parameters map[string]any, storage storage.Storage) ([]*models.Waypoint, float64, error) {
-	// TODO: Think if this is the correct place
-	storage.ClearWaypoints()
-	fmt.Printf("wpA: %v, wpB: %v, storage starts with %d constraints and %d sampled waypoints.\n", start, end, storage.ConstraintsLen(), storage.WaypointsLen())
-
-	// First thing to do if to check if a straight line connection is possible
-	if obstacleBetweenStartEnd, _, _ := storage.IsLineInObstacles(start, end); !obstacleBetweenStartEnd {
+	if isStraightLineFree(storage, clock, start, goal) && utils.IsWithinGradient(start, goal, max_gradient) {
 		fmt.Printf("Goal immediately found: straight line collision-free\n\n")
-		return []*models.Waypoint{start, end}, utils.HaversineDistance3D(start, end), nil
+		return []*models.Waypoint{start, goal}, storage.GetCostFunction().Cost(start, goal), nil
 	}
 	
 	// HERE IMPLEMENT RRT
@@ -205,7 +69,7 @@ func (a *RRTAlgorithm) Run(searchVolume *models.Feature3D, start, end *models.Wa
 	sampler, max_iterations, step_size_mt, _ := a.GetParameters(parameters, end)
 
 	// Add start to storage
-	err := storage.AddWaypointWithPrevious(nil, start)
+	err = storage.AddWaypointWithPrevious(nil, start)
 	if err != nil {
 		return nil, 0.0, err
 	}
@@ -214,13 +78,19 @@ func (a *RRTAlgorithm) Run(searchVolume *models.Feature3D, start, end *models.Wa
 	// ------------------------------------------------------------------------------------------------------	
 	
 	for current_iter := range max_iterations {
+		// Stop as soon as the request is cancelled or out of time
+		if ctx.Err() != nil {
+			fmt.Printf("[%d/%d] stopped: %v\n", current_iter, max_iterations, ctx.Err())
+			break
+		}
+
 		if current_iter % 1000 == 0 {
 			fmt.Printf("[%d/%d] #wps: %d, goal not found yet\n", current_iter, max_iterations, storage.WaypointsLen())
 			// fmt.Printf("[%d/%d] radius: %.2fmt, goal not found yet\n", current_iter, MAX_ITERATIONS, R)
 		}
 
 		// 1. Sample a new free wp
-		sampled, err := storage.SampleFree(sampler, searchVolume, end.Alt)
+		sampled, err := a.sampleFree(storage, sampler, searchVolume, end, planning_3d, clock != nil)
 		if err != nil {
 			// Impossible to sample 
 			return nil, 0.0, err
@@ -235,12 +105,12 @@ func (a *RRTAlgorithm) Run(searchVolume *models.Feature3D, start, end *models.Wa
 		// 3. Find wp starting from nearest in direction of sampled at distance (steering) STEP_SIZE_MT
 		new := utils.GetPointInDirectionAtDistance(nearest, sampled, step_size_mt)
 
-		// 4. Check if connection from nearest to new is possible
-		isInObstacles, _, err := storage.IsLineInObstacles(nearest, new)
+		// 4. Check if connection from nearest to new is possible (too steep ones are not, no step towards sampled would ever be)
+		isInObstacles, err := clock.isLineBlocked(storage, nearest, new)
 		if err != nil {
 			return nil, 0.0, err
 		}
-		if isInObstacles {
+		if isInObstacles || !utils.IsWithinGradient(nearest, new, max_gradient) {
 			continue
 		}
 
@@ -250,21 +120,37 @@ func (a *RRTAlgorithm) Run(searchVolume *models.Feature3D, start, end *models.Wa
 		if err != nil {
 			return nil, 0.0, err
 		}
+		clock.connect(nearest, new)
 
-		// 6. Check if it's goal
-		if a.isGoal(new, end, step_size_mt) {
-			// 7. Check if can be connected to goal
-			isInObstacles, _, err := storage.IsLineInObstacles(new, end)
+		// 6. Check if it entered the acceptance radius of the goal, if any: the route ends where it did
+		if entry := utils.AcceptanceEntryPoint(nearest, new, end); entry != nil {
+			err := storage.AddWaypointWithPrevious(nearest, entry)
+			if err != nil {
+				return nil, 0.0, err
+			}
+			goal, goal_found = entry, true
+			fmt.Printf("Acceptance radius of goal entered at iteration %d/%d.\n\n", current_iter, max_iterations)
+			break
+		}
+
+		// Or if it's goal
+		if a.isGoal(new, end, step_size_mt) && utils.IsWithinGradient(new, end, max_gradient) {
+			// 7. Check if can be connected to goal, up to where the connection enters its acceptance radius
+			target := end
+			if entry := utils.AcceptanceEntryPoint(new, end, end); entry != nil {
+				target = entry
+			}
+			isInObstacles, err := clock.isLineBlocked(storage, new, target)
 			if err != nil {
 				return nil, 0.0, err
 			}
 			// If yes, connect to goal, found!!!
 			if !isInObstacles {
-				err := storage.AddWaypointWithPrevious(new, end)
+				err := storage.AddWaypointWithPrevious(new, target)
 				if err != nil {
 					return nil, 0.0, err
 				}
-				goal_found = true
+				goal, goal_found = target, true
 				fmt.Printf("Goal found at iteration %d/%d.\n\n", current_iter, max_iterations)
 				break
 			}
@@ -278,12 +164,14 @@ func (a *RRTAlgorithm) Run(searchVolume *models.Feature3D, start, end *models.Wa
 
 	// Now try to obtain the route from the goal node
 	if goal_found {
-		route, err := storage.GetPathToRoot(end)
+		route, err := storage.GetPathToRoot(goal)
 		if err != nil {
 			return nil, 0.0, err
 		}
-		cost := utils.TotalHaversineDistance(route)
+		cost := utils.TotalCost(storage.GetCostFunction(), route)
 		return route, cost, nil
+	} else if ctx.Err() != nil {
+		return nil, 0.0, fmt.Errorf("goal not found before stop: %w", ctx.Err())
 	} else {
 		return nil, 0.0, fmt.Errorf("goal not found with %d iterations", max_iterations)
 	}
@@ -292,11 +180,11 @@ func (a *RRTAlgorithm) Run(searchVolume *models.Feature3D, start, end *models.Wa
 func (a *RRTAlgorithm) GetParameters(parameters map[string]any, goal *models.Waypoint) (utils.Sampler, int, float64, float64) {
 	// TODO: Take parameters from the actual map, and use defaults if not found
 	fmt.Printf("parameters: %+v\n", parameters)
-	MAX_ITERATIONS := int(utils.GetOrDefault(parameters, "max_iterations", 100000.0))
+	MAX_ITERATIONS := int(utils.GetOrDefault(parameters, "max_iterations", DEFAULT_MAX_ITERATIONS))
 	GOAL_BIAS := utils.GetOrDefault(parameters, "goal_bias", 0.10)
 	STEP_SIZE_MT := utils.GetOrDefault(parameters, "step_size_mt", 20.0)
 	SAMPLER_TYPE := utils.GetOrDefault(parameters, "sampler_type", models.Uniform)
-	SEED := utils.GetOrDefault(parameters, "seed", 945)
+	SEED := utils.GetOrDefault(parameters, "seed", 945.0)
 
 	// use sampler_type and seed
 	base_sampler, err := utils.NewSampler(SAMPLER_TYPE, int64(SEED))
@@ -321,6 +209,38 @@ func (a *RRTAlgorithm) GetParameters(parameters map[string]any, goal *models.Way
 	return SAMPLER, MAX_ITERATIONS, STEP_SIZE_MT, GOAL_BIAS
 }
 
+// Read the 3D mode from parameters: with planning_3d samples take any altitude of the search volume instead of the goal one, so routes can climb over constraints.
+// max_gradient limits climb and descent of every connection (mt per horizontal mt), 0 means no limit.
+func (a *RRTAlgorithm) getSpaceParameters(parameters map[string]any, searchVolume *models.Feature3D) (bool, float64, error) {
+	PLANNING_3D := utils.GetOrDefault(parameters, "planning_3d", false)
+	MAX_GRADIENT := utils.GetOrDefault(parameters, "max_gradient", 0.0)
+
+	if PLANNING_3D && (searchVolume.MinAltitude.Value == models.DEFAULT_MIN_ALT || searchVolume.MaxAltitude.Value == models.DEFAULT_MAX_ALT) {
+		return false, 0.0, fmt.Errorf("planning_3d needs a search volume with minAltitudeValue and maxAltitudeValue")
+	}
+
+	if PLANNING_3D || MAX_GRADIENT > 0 {
+		fmt.Printf("planning_3d: %v (%v - %v)\n", PLANNING_3D, searchVolume.MinAltitude, searchVolume.MaxAltitude)
+		fmt.Printf("max_gradient: %f\n", MAX_GRADIENT)
+	}
+	return PLANNING_3D, MAX_GRADIENT, nil
+}
+
+// Sample a free wp at the goal altitude or, in 3D mode, at any altitude of the search volume.
+// Scheduled legs take any wp, as one inside a temporary constraint may be free when reached: connections are checked anyway.
+func (a *RRTAlgorithm) sampleFree(storage storage.Storage, sampler utils.Sampler, searchVolume *models.Feature3D, goal *models.Waypoint, planning_3d bool, scheduled bool) (*models.Waypoint, error) {
+	if scheduled && planning_3d {
+		return storage.Sample3D(sampler, searchVolume)
+	}
+	if scheduled {
+		return storage.Sample(sampler, searchVolume, goal.Alt)
+	}
+	if planning_3d {
+		return storage.SampleFree3D(sampler, searchVolume)
+	}
+	return storage.SampleFree(sampler, searchVolume, goal.Alt)
+}
+
 func (a *RRTAlgorithm) isGoal(w, goal *models.Waypoint, tolerance_mt float64) bool {
 	// is goal if distance is less than tolerance_mt
 	return utils.HaversineDistance3D(w, goal) < tolerance_mt
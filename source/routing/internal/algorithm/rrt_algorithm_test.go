@@ -1,11 +1,14 @@
 package algorithm_test
 
 import (
+	"context"
 	"geopathplanner/routing/internal/algorithm"
 	"geopathplanner/routing/internal/models"
 	"geopathplanner/routing/internal/storage"
 	"geopathplanner/routing/internal/utils"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestRRTAlgorithm_run(t *testing.T) {
@@ -45,7 +48,7 @@ func TestRRTAlgorithm_run(t *testing.T) {
 			}
       		s.AddConstraints(tt.constraints)
 
-			got, _, gotErr := a.Run(tt.searchVolume, tt.start, tt.end, nil, s)
+			got, _, gotErr := a.Run(context.Background(), tt.searchVolume, tt.start, tt.end, nil, s)
 
 			// TODO: For visually testing, export results in geojson
 			utils.MarkWaypointsAsOriginal(tt.start, tt.end)
@@ -94,7 +97,7 @@ func TestRRTAlgorithm_Compute(t *testing.T) {
 				t.Fatalf("could not construct receiver type: %v", err)
 			}
 
-			got, _, gotErr := a.Compute(tt.searchVolume, tt.waypoints, tt.constraints, nil, tt.storageType)
+			got, _, gotErr := a.Compute(context.Background(), tt.searchVolume, tt.waypoints, tt.constraints, nil, tt.storageType)
 
 			// TODO: For visually testing, export results in geojson
       		utils.MarkWaypointsAsOriginal(tt.waypoints...)
@@ -141,7 +144,7 @@ func TestRRTAlgorithm_ComputeConcurrently(t *testing.T) {
 				t.Fatalf("could not construct receiver type: %v", err)
 			}
 
-			got, _, gotErr := a.ComputeConcurrently(tt.searchVolume, tt.waypoints, tt.constraints, nil, tt.storageType, tt.maxWorkers)
+			got, _, gotErr := a.ComputeConcurrently(context.Background(), tt.searchVolume, tt.waypoints, tt.constraints, nil, tt.storageType, tt.maxWorkers)
 
 			// TODO: For visually testing, export results in geojson
       		utils.MarkWaypointsAsOriginal(tt.waypoints...)
@@ -158,4 +161,260 @@ func TestRRTAlgorithm_ComputeConcurrently(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+func TestRRTAlgorithm_run3D(t *testing.T) {
+	sv, w_list, c_list, _ := utils.SetupTestScenario()
+	w1 := w_list[0]
+	w2 := w_list[1]
+
+	// Wps fly at 100 mt, obstacles are up to 150 mt and the search volume up to 300 mt
+	ground, _ := models.NewAltitude(0, models.MT)
+	low, _ := models.NewAltitude(150, models.MT)
+	ceiling, _ := models.NewAltitude(300, models.MT)
+	for _, c := range c_list {
+		c.SetAltitude(ground, low)
+	}
+	svBanded, _, _, _ := utils.SetupTestScenario()
+	svBanded.SetAltitude(ground, ceiling)
+
+	tests := []struct {
+		name        string // description of this test case
+		storageType models.StorageType
+		// Named input parameters for target function.
+		searchVolume *models.Feature3D
+		start        *models.Waypoint
+		end          *models.Waypoint
+		constraints  []*models.Feature3D
+		parameters   map[string]any
+		wantErr      bool
+	}{
+		{name: "RRT 3D over low obstacles - RTREE", storageType: models.RTree, searchVolume: svBanded, start: w1, end: w2, constraints: c_list, parameters: map[string]any{"planning_3d": true, "max_gradient": 0.3}, wantErr: false},
+		{name: "RRT 3D over low obstacles - LIST", storageType: models.List, searchVolume: svBanded, start: w1, end: w2, constraints: c_list, parameters: map[string]any{"planning_3d": true, "max_gradient": 0.3}, wantErr: false},
+		{name: "RRT 3D without search volume altitudes - RTREE", storageType: models.RTree, searchVolume: sv, start: w1, end: w2, constraints: c_list, parameters: map[string]any{"planning_3d": true}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := algorithm.NewRRTAlgorithm()
+			if err != nil {
+				t.Fatalf("could not construct receiver type: %v", err)
+			}
+
+			s, err := storage.NewEmptyStorage(tt.storageType)
+			if err != nil {
+				t.Fatalf("could not construct storage: %v", err)
+			}
+			s.AddConstraints(tt.constraints)
+
+			got, _, gotErr := a.Run(context.Background(), tt.searchVolume, tt.start, tt.end, tt.parameters, s)
+
+			utils.MarkWaypointsAsOriginal(tt.start, tt.end)
+			utils.ExportToGeoJSONRoute("algorithm", got, tt.constraints, tt.searchVolume, tt.name, true)
+
+			if gotErr != nil {
+				if !tt.wantErr {
+					t.Errorf("Run() failed: %v", gotErr)
+				}
+				return
+			}
+			if tt.wantErr {
+				t.Fatal("Run() succeeded unexpectedly")
+			}
+
+			// The route must climb over the obstacles, within the gradient and the search volume
+			maxGradient := tt.parameters["max_gradient"].(float64)
+			maxAltMt := 0.0
+			for i, wp := range got {
+				altMt := wp.Alt.Normalize().Value
+				maxAltMt = max(maxAltMt, altMt)
+				if !wp.Alt.IsWithin(tt.searchVolume.MinAltitude, tt.searchVolume.MaxAltitude) {
+					t.Errorf("Run() wp %d at %v is outside of the search volume", i, wp.Alt)
+				}
+				if i > 0 && !utils.IsWithinGradient(got[i-1], wp, maxGradient+1e-9) {
+					t.Errorf("Run() segment %d has gradient %.3f, max allowed %.3f", i-1, utils.Gradient(got[i-1], wp), maxGradient)
+				}
+			}
+			if maxAltMt <= low.Value {
+				t.Errorf("Run() route stays below %.1f mt, it never climbs over the obstacles", low.Value)
+			}
+		})
+	}
+}
+
+func TestRRTAlgorithm_ComputeMovingObstacles(t *testing.T) {
+	a, _ := models.NewAltitude(100, models.MT)
+	searchVolume := models.MustNewFeatureFromGeojson(`{"type": "Feature", "properties": {}, "geometry": {"type": "Polygon", "coordinates": [[[3.996, 49.995], [4.007, 49.995], [4.007, 50.005], [3.996, 50.005], [3.996, 49.995]]]}}`)
+	waypoints := []*models.Waypoint{models.MustNewWaypoint(0, 50.0, 3.9985, a), models.MustNewWaypoint(1, 50.0, 4.0045, a)}
+	// Cell ~222 mt south of the leg at 10:00:00, moving north at 10 m/s: it covers the leg from ~10:00:22 to ~10:00:44
+	constraints := []*models.Feature3D{
+		models.MustNewFeatureFromGeojson(`{"type": "Feature", "properties": {"speed_ms": 10, "heading_deg": 0, "reference_time": "2026-10-17T10:00:00Z"}, "geometry": {"type": "Polygon", "coordinates": [[[4.0, 49.996], [4.002, 49.996], [4.002, 49.998], [4.0, 49.998], [4.0, 49.996]]]}}`),
+	}
+
+	tests := []struct {
+		name         string // description of this test case
+		storageType  models.StorageType
+		departure    string
+		wantStraight bool
+	}{
+		{name: "RRT passing before the cell - RTREE", storageType: models.RTree, departure: "2026-10-17T10:00:00Z", wantStraight: true},
+		{name: "RRT meeting the cell - RTREE", storageType: models.RTree, departure: "2026-10-17T10:00:20Z", wantStraight: false},
+		{name: "RRT meeting the cell - LIST", storageType: models.List, departure: "2026-10-17T10:00:20Z", wantStraight: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rrt, err := algorithm.NewRRTAlgorithm()
+			if err != nil {
+				t.Fatalf("could not construct receiver type: %v", err)
+			}
+
+			departure, _ := time.Parse(time.RFC3339, tt.departure)
+			parameters := map[string]any{"max_iterations": 5000.0, models.DEPARTURE_TIME_PARAMETER: departure}
+			got, _, gotErr := rrt.Compute(context.Background(), searchVolume, waypoints, constraints, parameters, tt.storageType)
+			if gotErr != nil {
+				t.Fatalf("Compute() failed: %v", gotErr)
+			}
+
+			utils.MarkWaypointsAsOriginal(waypoints...)
+			utils.ExportToGeoJSONRoute("algorithm", got, constraints, searchVolume, tt.name, true)
+
+			if straight := len(got) == 2; straight != tt.wantStraight {
+				t.Errorf("Compute() = %v, straight line: %t, want %t", got, straight, tt.wantStraight)
+			}
+			assertScheduleFree(t, got, departure, constraints)
+		})
+	}
+}
+
+func TestRRTAlgorithm_ComputeLegRetries(t *testing.T) {
+	sv, w_list, c_list, _ := utils.SetupTestScenario()
+	waypoints := []*models.Waypoint{w_list[0], w_list[1]}
+
+	tests := []struct {
+		name       string // description of this test case
+		parameters map[string]any
+		wantErr    string
+	}{
+		{name: "RRT without retries - RTREE", parameters: map[string]any{"max_iterations": 20.0, "max_leg_retries": 0.0}, wantErr: "leg 0 failed after 0 retries"},
+		{name: "RRT with escalating retries - RTREE", parameters: map[string]any{"max_iterations": 20.0, "max_leg_retries": 8.0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rrt, err := algorithm.NewRRTAlgorithm()
+			if err != nil {
+				t.Fatalf("could not construct receiver type: %v", err)
+			}
+
+			for _, compute := range []func() ([]*models.Waypoint, float64, error){
+				func() ([]*models.Waypoint, float64, error) {
+					return rrt.Compute(context.Background(), sv, waypoints, c_list, tt.parameters, models.RTree)
+				},
+				func() ([]*models.Waypoint, float64, error) {
+					return rrt.ComputeConcurrently(context.Background(), sv, waypoints, c_list, tt.parameters, models.RTree, 0)
+				},
+			} {
+				got, _, gotErr := compute()
+				if gotErr != nil {
+					if tt.wantErr == "" || !strings.Contains(gotErr.Error(), tt.wantErr) {
+						t.Errorf("Compute() failed: %v, want error containing %q", gotErr, tt.wantErr)
+					}
+					continue
+				}
+				if tt.wantErr != "" {
+					t.Fatalf("Compute() succeeded unexpectedly")
+				}
+				if got[0] != waypoints[0] || got[len(got)-1] != waypoints[1] {
+					t.Errorf("Compute() = %v, want a route from wp[0] to wp[1]", got)
+				}
+			}
+		})
+	}
+}
+
+func TestRRTAlgorithm_ComputeAcceptanceRadius(t *testing.T) {
+	searchVolume := models.MustNewFeatureFromGeojson(`{"type": "Feature", "properties": {}, "geometry": {"type": "Polygon", "coordinates": [[[3.995, 49.995], [4.015, 49.995], [4.015, 50.005], [3.995, 50.005], [3.995, 49.995]]]}}`)
+	// The goal is in the middle of a building ~70 mt wide, and a wall may stand half way
+	building := models.MustNewFeatureFromGeojson(`{"type": "Feature", "properties": {}, "geometry": {"type": "Polygon", "coordinates": [[[4.0095, 49.9995], [4.0105, 49.9995], [4.0105, 50.0005], [4.0095, 50.0005], [4.0095, 49.9995]]]}}`)
+	wall := models.MustNewFeatureFromGeojson(`{"type": "Feature", "properties": {}, "geometry": {"type": "Polygon", "coordinates": [[[4.0045, 49.998], [4.0055, 49.998], [4.0055, 50.002], [4.0045, 50.002], [4.0045, 49.998]]]}}`)
+	alt, _ := models.NewAltitude(100, models.MT)
+	goal := func(radiusMt float64) *models.Waypoint {
+		wp := models.MustNewWaypoint(1, 50.0, 4.01, alt)
+		wp.Properties["acceptance_radius_mt"] = radiusMt
+		return wp
+	}
+	start := models.MustNewWaypoint(0, 50.0, 4.0, alt)
+	back := models.MustNewWaypoint(2, 50.001, 4.0, alt)
+
+	tests := []struct {
+		name         string // description of this test case
+		waypoints    []*models.Waypoint
+		constraints  []*models.Feature3D
+		wantStraight bool
+		wantErr      bool
+	}{
+		{name: "Goal in a building, radius out of it", waypoints: []*models.Waypoint{start, goal(60)}, constraints: []*models.Feature3D{building}, wantStraight: true},
+		{name: "Goal in a building behind a wall", waypoints: []*models.Waypoint{start, goal(60)}, constraints: []*models.Feature3D{building, wall}},
+		{name: "Goal in a building, radius within it", waypoints: []*models.Waypoint{start, goal(20)}, constraints: []*models.Feature3D{building}, wantErr: true},
+		{name: "Goal in a building on the way", waypoints: []*models.Waypoint{start, goal(60), back}, constraints: []*models.Feature3D{building}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rrt, err := algorithm.NewRRTAlgorithm()
+			if err != nil {
+				t.Fatalf("could not construct receiver type: %v", err)
+			}
+			s, err := storage.NewStorage(nil, tt.constraints, models.RTree)
+			if err != nil {
+				t.Fatalf("could not construct storage: %v", err)
+			}
+			parameters := map[string]any{"max_iterations": 5000.0, "max_leg_retries": 0.0}
+
+			for _, compute := range []func() ([]*models.Waypoint, float64, error){
+				func() ([]*models.Waypoint, float64, error) {
+					return rrt.Compute(context.Background(), searchVolume, tt.waypoints, tt.constraints, parameters, models.RTree)
+				},
+				func() ([]*models.Waypoint, float64, error) {
+					return rrt.ComputeConcurrently(context.Background(), searchVolume, tt.waypoints, tt.constraints, parameters, models.RTree, 0)
+				},
+			} {
+				got, _, gotErr := compute()
+				utils.MarkWaypointsAsOriginal(tt.waypoints...)
+				utils.ExportToGeoJSONRoute("algorithm", got, tt.constraints, searchVolume, tt.name, true)
+				if gotErr != nil {
+					if !tt.wantErr {
+						t.Errorf("Compute() failed: %v", gotErr)
+					}
+					continue
+				}
+				if tt.wantErr {
+					t.Fatalf("Compute() succeeded unexpectedly")
+				}
+
+				if got[0] != tt.waypoints[0] || !got[len(got)-1].Reaches(tt.waypoints[len(tt.waypoints)-1]) {
+					t.Errorf("Compute() = %v, want a route from the first wp to the last one", got)
+				}
+				if straight := len(got) == len(tt.waypoints); tt.wantStraight && !straight {
+					t.Errorf("Compute() = %v, want a straight line", got)
+				}
+				for i := 1; i < len(got); i++ {
+					if blocked, _, _ := s.IsLineInObstacles(got[i-1], got[i]); blocked {
+						t.Errorf("Compute() segment %d (%v - %v) meets an obstacle", i-1, got[i-1], got[i])
+					}
+				}
+
+				// The goal is reached where the route enters its acceptance radius, and the route goes on from there
+				reached := false
+				for _, wp := range got {
+					if !wp.Reaches(tt.waypoints[1]) {
+						continue
+					}
+					if wp == tt.waypoints[1] || utils.HaversineDistance3D(wp, tt.waypoints[1]) > tt.waypoints[1].AcceptanceRadiusMt()+1e-6 {
+						t.Errorf("Compute() reaches the goal at %v, want a point within %.0f mt of it", wp, tt.waypoints[1].AcceptanceRadiusMt())
+					}
+					reached = true
+				}
+				if !reached {
+					t.Errorf("Compute() = %v, never reaches the goal", got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,231 @@
+package algorithm
+
+import (
+	"context"
+	"fmt"
+	"geopathplanner/routing/internal/models"
+	"geopathplanner/routing/internal/storage"
+	"geopathplanner/routing/internal/utils"
+	"slices"
+)
+
+// RRTConnectAlgorithm grows one tree from the start and one from the goal, and at every iteration tries to join them.
+type RRTConnectAlgorithm struct {
+	*RRTAlgorithm
+}
+
+func NewRRTConnectAlgorithm() (*RRTConnectAlgorithm, error) {
+	a, err := NewRRTAlgorithm()
+	if err != nil {
+		return nil, err
+	}
+
+	return &RRTConnectAlgorithm{
+		a,
+	}, nil
+}
+
+// Concurrency version of Compute function, where every pair of wps is processed in a separate goroutine.
+func (a *RRTConnectAlgorithm) ComputeConcurrently(ctx context.Context, searchVolume *models.Feature3D, waypoints []*models.Waypoint, constraints []*models.Feature3D, parameters map[string]any, storageType models.StorageType, maxWorkers int) ([]*models.Waypoint, float64, error) {
+	return computeLegsConcurrently(ctx, "RRTConnect", waypoints, constraints, parameters, storageType, maxWorkers, func(ctx context.Context, start, end *models.Waypoint, parameters map[string]any, s storage.Storage) ([]*models.Waypoint, float64, error) {
+		return a.Run(ctx, searchVolume, start, end, parameters, s)
+	})
+}
+
+func (a *RRTConnectAlgorithm) Compute(ctx context.Context, searchVolume *models.Feature3D, waypoints []*models.Waypoint, constraints []*models.Feature3D, parameters map[string]any, storageType models.StorageType) ([]*models.Waypoint, float64, error) {
+	return computeLegs(ctx, "RRTConnect", waypoints, constraints, parameters, storageType, func(ctx context.Context, start, end *models.Waypoint, parameters map[string]any, s storage.Storage) ([]*models.Waypoint, float64, error) {
+		return a.Run(ctx, searchVolume, start, end, parameters, s)
+	})
+}
+
+func (a *RRTConnectAlgorithm) Run(ctx context.Context, searchVolume *models.Feature3D, start, end *models.Waypoint, parameters map[string]any, storage storage.Storage) ([]*models.Waypoint, float64, error) {
+	storage.ClearWaypoints()
+	fmt.Printf("wpA: %v, wpB: %v, storage starts with %d constraints and %d sampled waypoints.\n", start, end, storage.ConstraintsLen(), storage.WaypointsLen())
+
+	// With a departure time the start tree keeps the eta of its wps, while the goal tree can't know them:
+	// its part of the route is checked against the schedule once the trees are connected
+	clock, err := newLegClock(start, parameters)
+	if err != nil {
+		return nil, 0.0, err
+	}
+
+	// First thing to do if to check if a straight line connection is possible
+	if isStraightLineFree(storage, clock, start, end) {
+		fmt.Printf("Goal immediately found: straight line collision-free\n\n")
+		return []*models.Waypoint{start, end}, storage.GetCostFunction().Cost(start, end), nil
+	}
+
+	// Get Parameters
+	startSampler, goalSampler, max_iterations, step_size_mt := a.GetParameters(parameters, start, end)
+
+	// One tree rooted in start (the given storage) and one rooted in goal (a clone with the same constraints)
+	startTree := storage
+	goalTree := storage.Clone()
+	if err := startTree.AddWaypointWithPrevious(nil, start); err != nil {
+		return nil, 0.0, err
+	}
+	if err := goalTree.AddWaypointWithPrevious(nil, end); err != nil {
+		return nil, 0.0, err
+	}
+
+	// treeA is the one extended in the current iteration, treeB is the one trying to connect to it
+	treeA, treeB := startTree, goalTree
+	samplerA, samplerB := startSampler, goalSampler
+	clockA, clockB := clock, (*legClock)(nil)
+
+	// ------------------------------------------------------------------------------------------------------
+
+	for current_iter := range max_iterations {
+		// Stop as soon as the request is cancelled or out of time
+		if ctx.Err() != nil {
+			return nil, 0.0, fmt.Errorf("trees not connected before stop at iteration %d: %w", current_iter, ctx.Err())
+		}
+
+		if current_iter%1000 == 0 {
+			fmt.Printf("[%d/%d] #wps: %d+%d, trees not connected yet\n", current_iter, max_iterations, startTree.WaypointsLen(), goalTree.WaypointsLen())
+		}
+
+		// 1. Extend treeA toward a new free sample
+		new, err := a.extend(treeA, clockA, samplerA, searchVolume, end.Alt, step_size_mt)
+		if err != nil {
+			return nil, 0.0, err
+		}
+
+		if new != nil {
+			// 2. Greedily grow treeB toward the new wp
+			joint, err := a.connect(treeB, clockB, new, step_size_mt)
+			if err != nil {
+				return nil, 0.0, err
+			}
+
+			// 3. If the trees are connected build the route from start to goal
+			if joint != nil {
+				startJoint, goalJoint := joint, new
+				if treeA == startTree {
+					startJoint, goalJoint = new, joint
+				}
+				route, cost, err := a.joinTrees(startTree, startJoint, goalTree, goalJoint)
+				if err != nil {
+					return nil, 0.0, err
+				}
+
+				if blocked, err := clock.isRouteBlocked(storage, route); err != nil {
+					return nil, 0.0, err
+				} else if !blocked {
+					fmt.Printf("Trees connected at iteration %d/%d.\n\n", current_iter, max_iterations)
+					return route, cost, nil
+				}
+			}
+		}
+
+		// 4. Swap the role of the trees
+		treeA, treeB = treeB, treeA
+		samplerA, samplerB = samplerB, samplerA
+		clockA, clockB = clockB, clockA
+	}
+
+	return nil, 0.0, fmt.Errorf("trees not connected with %d iterations", max_iterations)
+}
+
+func (a *RRTConnectAlgorithm) GetParameters(parameters map[string]any, start, goal *models.Waypoint) (utils.Sampler, utils.Sampler, int, float64) {
+	START_SAMPLER, MAX_ITERATIONS, STEP_SIZE_MT, GOAL_BIAS := a.RRTAlgorithm.GetParameters(parameters, goal)
+	SAMPLER_TYPE := utils.GetOrDefault(parameters, "sampler_type", models.Uniform)
+	SEED := utils.GetOrDefault(parameters, "seed", 945.0)
+
+	// The goal tree uses its own sampler, biased toward the start
+	base_sampler, err := utils.NewSampler(SAMPLER_TYPE, int64(SEED)+1)
+	if err != nil {
+		base_sampler = utils.NewUniformSampler(int64(SEED) + 1)
+	}
+	GOAL_SAMPLER := utils.NewGoalBiasSampler(
+		base_sampler,
+		start,
+		GOAL_BIAS,
+		int64(SEED)+1,
+	)
+
+	return START_SAMPLER, GOAL_SAMPLER, MAX_ITERATIONS, STEP_SIZE_MT
+}
+
+// extend samples a free wp and adds a new wp at step_size_mt from the nearest one of the tree. Returns nil if the step is blocked.
+// The clock, if any, is the one of the tree.
+func (a *RRTConnectAlgorithm) extend(tree storage.Storage, clock *legClock, sampler utils.Sampler, searchVolume *models.Feature3D, alt models.Altitude, step_size_mt float64) (*models.Waypoint, error) {
+	sampled, err := tree.SampleFree(sampler, searchVolume, alt)
+	if err != nil {
+		return nil, err
+	}
+
+	nearest, _, err := tree.NearestPoint(sampled)
+	if err != nil {
+		return nil, err
+	}
+
+	new := utils.GetPointInDirectionAtDistance(nearest, sampled, step_size_mt)
+	isInObstacles, err := clock.isLineBlocked(tree, nearest, new)
+	if err != nil {
+		return nil, err
+	}
+	if isInObstacles {
+		return nil, nil
+	}
+
+	if err := tree.AddWaypointWithPrevious(nearest, new); err != nil {
+		return nil, err
+	}
+	clock.connect(nearest, new)
+	return new, nil
+}
+
+// connect grows the tree toward target with steps of step_size_mt until it reaches it or it's blocked.
+// Returns the wp of the tree that can be linked to target, or nil if target could not be reached.
+func (a *RRTConnectAlgorithm) connect(tree storage.Storage, clock *legClock, target *models.Waypoint, step_size_mt float64) (*models.Waypoint, error) {
+	current, dist, err := tree.NearestPoint(target)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		if dist <= step_size_mt {
+			isInObstacles, err := clock.isLineBlocked(tree, current, target)
+			if err != nil {
+				return nil, err
+			}
+			if isInObstacles {
+				return nil, nil
+			}
+			return current, nil
+		}
+
+		next := utils.GetPointInDirectionAtDistance(current, target, step_size_mt)
+		isInObstacles, err := clock.isLineBlocked(tree, current, next)
+		if err != nil {
+			return nil, err
+		}
+		if isInObstacles {
+			return nil, nil
+		}
+		if err := tree.AddWaypointWithPrevious(current, next); err != nil {
+			return nil, err
+		}
+		clock.connect(current, next)
+
+		current = next
+		dist = utils.HaversineDistance3D(current, target)
+	}
+}
+
+// joinTrees builds the route going from the root of startTree to startJoint, and then from goalJoint to the root of goalTree.
+func (a *RRTConnectAlgorithm) joinTrees(startTree storage.Storage, startJoint *models.Waypoint, goalTree storage.Storage, goalJoint *models.Waypoint) ([]*models.Waypoint, float64, error) {
+	startRoute, err := startTree.GetPathToRoot(startJoint)
+	if err != nil {
+		return nil, 0.0, err
+	}
+	goalRoute, err := goalTree.GetPathToRoot(goalJoint)
+	if err != nil {
+		return nil, 0.0, err
+	}
+	slices.Reverse(goalRoute)
+
+	route := append(startRoute, goalRoute...)
+	return route, utils.TotalCost(startTree.GetCostFunction(), route), nil
+}
@@ -0,0 +1,161 @@
+package algorithm_test
+
+import (
+	"context"
+	"geopathplanner/routing/internal/algorithm"
+	"geopathplanner/routing/internal/models"
+	"geopathplanner/routing/internal/storage"
+	"geopathplanner/routing/internal/utils"
+	"testing"
+	"time"
+)
+
+func TestRRTConnectAlgorithm_run(t *testing.T) {
+	sv, w_list, c_list, c_overlapping := utils.SetupTestScenario()
+	w1 := w_list[0]
+	w2 := w_list[1]
+	parameters := map[string]any{"max_iterations": 5000.0}
+
+	tests := []struct {
+		name        string // description of this test case
+		storageType models.StorageType
+		// Named input parameters for target function.
+		searchVolume *models.Feature3D
+		start        *models.Waypoint
+		end          *models.Waypoint
+		constraints  []*models.Feature3D
+		wantErr      bool
+	}{
+		{name: "RRTConnect with non-overlapping obstacles - RTREE", storageType: models.RTree, searchVolume: sv, start: w1, end: w2, constraints: c_list, wantErr: false},
+		{name: "RRTConnect with overlapping obstacles - RTREE", storageType: models.RTree, searchVolume: sv, start: w1, end: w2, constraints: append(c_list, c_overlapping...), wantErr: false},
+		{name: "RRTConnect with no obstacles - RTREE", storageType: models.RTree, searchVolume: sv, start: w1, end: w2, constraints: []*models.Feature3D{}, wantErr: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := algorithm.NewRRTConnectAlgorithm()
+			if err != nil {
+				t.Fatalf("could not construct receiver type: %v", err)
+			}
+
+			s, err := storage.NewEmptyStorage(tt.storageType)
+			if err != nil {
+				t.Fatalf("could not construct storage: %v", err)
+			}
+			s.AddConstraints(tt.constraints)
+
+			got, _, gotErr := a.Run(context.Background(), tt.searchVolume, tt.start, tt.end, parameters, s)
+
+			// TODO: For visually testing, export results in geojson
+			utils.MarkWaypointsAsOriginal(tt.start, tt.end)
+			utils.ExportToGeoJSONRoute("algorithm", got, tt.constraints, tt.searchVolume, tt.name, true)
+
+			if gotErr != nil {
+				if !tt.wantErr {
+					t.Errorf("Run() failed: %v", gotErr)
+				}
+				return
+			}
+			if tt.wantErr {
+				t.Fatal("Run() succeeded unexpectedly")
+			}
+
+			// Route must go from start to end without crossing any obstacle
+			if got[0] != tt.start || got[len(got)-1] != tt.end {
+				t.Errorf("Run() route does not go from start to end")
+			}
+			for i := 0; i < len(got)-1; i++ {
+				if blocked, _, _ := s.IsLineInObstacles(got[i], got[i+1]); blocked {
+					t.Errorf("Run() route segment %d crosses an obstacle", i)
+				}
+			}
+		})
+	}
+}
+
+func TestRRTConnectAlgorithm_ComputeConcurrently(t *testing.T) {
+	sv, w_list, c_list, c_overlapping := utils.SetupTestScenario()
+	parameters := map[string]any{"max_iterations": 5000.0}
+
+	tests := []struct {
+		name        string // description of this test case
+		storageType models.StorageType
+		// Named input parameters for target function.
+		searchVolume *models.Feature3D
+		waypoints    []*models.Waypoint
+		constraints  []*models.Feature3D
+		maxWorkers   int
+		wantErr      bool
+	}{
+		{name: "ConcurrentRRTConnectFull 1 with non-overlapping obstacles - RTREE", storageType: models.RTree, searchVolume: sv, waypoints: w_list, constraints: c_list, maxWorkers: 1, wantErr: false},
+		{name: "ConcurrentRRTConnectFull 3 with overlapping obstacles - RTREE", storageType: models.RTree, searchVolume: sv, waypoints: w_list, constraints: append(c_list, c_overlapping...), maxWorkers: 3, wantErr: false},
+		{name: "ConcurrentRRTConnectFull 3 with overlapping obstacles - LIST", storageType: models.List, searchVolume: sv, waypoints: w_list, constraints: append(c_list, c_overlapping...), maxWorkers: 3, wantErr: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := algorithm.NewRRTConnectAlgorithm()
+			if err != nil {
+				t.Fatalf("could not construct receiver type: %v", err)
+			}
+
+			got, _, gotErr := a.ComputeConcurrently(context.Background(), tt.searchVolume, tt.waypoints, tt.constraints, parameters, tt.storageType, tt.maxWorkers)
+
+			// TODO: For visually testing, export results in geojson
+			utils.MarkWaypointsAsOriginal(tt.waypoints...)
+			utils.ExportToGeoJSONRoute("algorithm", got, tt.constraints, tt.searchVolume, tt.name, true)
+
+			if gotErr != nil {
+				if !tt.wantErr {
+					t.Errorf("ComputeConcurrently() failed: %v", gotErr)
+				}
+				return
+			}
+			if tt.wantErr {
+				t.Fatal("ComputeConcurrently() succeeded unexpectedly")
+			}
+		})
+	}
+}
+
+func TestRRTConnectAlgorithm_ComputeMovingObstacles(t *testing.T) {
+	a, _ := models.NewAltitude(100, models.MT)
+	searchVolume := models.MustNewFeatureFromGeojson(`{"type": "Feature", "properties": {}, "geometry": {"type": "Polygon", "coordinates": [[[3.996, 49.995], [4.007, 49.995], [4.007, 50.005], [3.996, 50.005], [3.996, 49.995]]]}}`)
+	waypoints := []*models.Waypoint{models.MustNewWaypoint(0, 50.0, 3.9985, a), models.MustNewWaypoint(1, 50.0, 4.0045, a)}
+	// Cell ~222 mt south of the leg at 10:00:00, moving north at 10 m/s: it covers the leg from ~10:00:22 to ~10:00:44
+	constraints := []*models.Feature3D{
+		models.MustNewFeatureFromGeojson(`{"type": "Feature", "properties": {"speed_ms": 10, "heading_deg": 0, "reference_time": "2026-10-17T10:00:00Z"}, "geometry": {"type": "Polygon", "coordinates": [[[4.0, 49.996], [4.002, 49.996], [4.002, 49.998], [4.0, 49.998], [4.0, 49.996]]]}}`),
+	}
+
+	tests := []struct {
+		name         string // description of this test case
+		storageType  models.StorageType
+		departure    string
+		wantStraight bool
+	}{
+		{name: "RRTConnect passing before the cell - RTREE", storageType: models.RTree, departure: "2026-10-17T10:00:00Z", wantStraight: true},
+		{name: "RRTConnect meeting the cell - RTREE", storageType: models.RTree, departure: "2026-10-17T10:00:20Z", wantStraight: false},
+		{name: "RRTConnect meeting the cell - LIST", storageType: models.List, departure: "2026-10-17T10:00:20Z", wantStraight: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rrtConnect, err := algorithm.NewRRTConnectAlgorithm()
+			if err != nil {
+				t.Fatalf("could not construct receiver type: %v", err)
+			}
+
+			departure, _ := time.Parse(time.RFC3339, tt.departure)
+			parameters := map[string]any{"max_iterations": 5000.0, models.DEPARTURE_TIME_PARAMETER: departure}
+			got, _, gotErr := rrtConnect.Compute(context.Background(), searchVolume, waypoints, constraints, parameters, tt.storageType)
+			if gotErr != nil {
+				t.Fatalf("Compute() failed: %v", gotErr)
+			}
+
+			utils.MarkWaypointsAsOriginal(waypoints...)
+			utils.ExportToGeoJSONRoute("algorithm", got, constraints, searchVolume, tt.name, true)
+
+			if straight := len(got) == 2; straight != tt.wantStraight {
+				t.Errorf("Compute() = %v, straight line: %t, want %t", got, straight, tt.wantStraight)
+			}
+			assertScheduleFree(t, got, departure, constraints)
+		})
+	}
+}
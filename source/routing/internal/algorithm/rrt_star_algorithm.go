@@ -1,13 +1,12 @@
 package algorithm
 
 import (
+	"context"
 	"fmt"
 	"geopathplanner/routing/internal/models"
 	"geopathplanner/routing/internal/storage"
 	"geopathplanner/routing/internal/utils"
 	"math"
-	"runtime"
-	"sync"
 )
 
 const (
@@ -32,201 +31,78 @@ func NewRRTStarAlgorithm() (*RRTStarAlgorithm, error) {
 }
 
 // Concurrency version of Compute function, where every pair of wps is processed in a separate goroutine.
-// TODO: Still in testing
-func (a *RRTStarAlgorithm) ComputeConcurrently(searchVolume *models.Feature3D, waypoints []*models.Waypoint, constraints []*models.Feature3D, parameters map[string]any, storageType models.StorageType, maxWorkers int) ([]*models.Waypoint, float64, error) {
-	// Check if waypoints are at least 2
-	numPairs := len(waypoints) - 1
-	if numPairs <= 0 {
-		return nil, 0.0, fmt.Errorf("less than 2 waypoints submitted (%d): abort", len(waypoints))
-	}
-	
-	maxCPU := runtime.NumCPU()
-	if maxWorkers <= 0 {
-		maxWorkers = min(maxCPU, numPairs)
-	} else {
-		// fmt.Printf("[WARN] Requested %d workers exceeds %d cores, limiting to %d",
-		maxWorkers = min(maxWorkers, maxCPU, numPairs)
-	}
-
-	// If just 1 worker, use the normal version
-	if maxWorkers == 1 {
-		return a.Compute(searchVolume, waypoints, constraints, parameters, storageType)
-	}
-
-	// TODO: Buffer constraints
-	// TODO: Think about creating and adding constraints in Run function so to parallelize that function
-	// Create storage and load constraint into it
-	storage, err := storage.NewEmptyStorage(storageType)
-	if err != nil {
-		return nil, 0.0, err
-	}
-	err = storage.AddConstraints(constraints)
-	if err != nil {
-		return nil, 0.0, err
-	}
-
-	// === Channels and synchronization structures ===
-	jobs := make(chan job, numPairs)       // channel for distributing work
-	results := make(chan result, numPairs) // channel to collect computed results
-	var wg sync.WaitGroup // ensures all workers complete before closing results
-
-	// 1. Create and start the workers
-	for w := 0; w < maxWorkers; w++ {
-		wg.Add(1)
-		go func(workerID int) {
-			defer wg.Done()
-
-			for j := range jobs {
-				// Run RRT for this pair of waypoints
-				tmpRoute, tmpCost, err := a.Run(searchVolume, j.startWP, j.endWP, parameters, storage.Clone())
-				if err != nil {
-					results <- result{i: j.i, err: fmt.Errorf("worker %d: run RRT*: %w", workerID, err)}
-					continue
-				}
-
-				results <- result{
-					i:     j.i,
-					route: tmpRoute,
-					cost:  tmpCost,
-					err:   nil,
-				}
-			}
-		}(w)
-	}
-
-	// 2. Send jobs to workers
-	for i := 0; i < numPairs; i++ {
-		jobs <- job{
-			i:       i,
-			startWP: waypoints[i],
-			endWP:   waypoints[i+1],
-		}
-	}
-	close(jobs) // no more jobs to send
-
-	// 3. Collect results
-	go func() {
-		wg.Wait()      // wait for all workers to finish
-		close(results) // then close result channel
-	}()
-
-	// Store results in correct order
-	routeSegments := make([][]*models.Waypoint, numPairs)
-	costs := make([]float64, numPairs)
-	var firstErr error
-
-	for res := range results {
-		if res.err != nil && firstErr == nil {
-			firstErr = res.err
-		}
-		routeSegments[res.i] = res.route
-		costs[res.i] = res.cost
-	}
-
-	if firstErr != nil {
-		return nil, 0, firstErr
-	}
-
-	// 4. Merge results
-	finalRoute := make([]*models.Waypoint, 0)
-	totalCost := 0.0
-
-	// Start from first waypoint
-	if len(routeSegments) > 0 && len(routeSegments[0]) > 0 {
-		finalRoute = append(finalRoute, routeSegments[0][0])
-	}
-
-	for i, seg := range routeSegments {
-		if len(seg) == 0 {
-			continue
-		}
-		totalCost += costs[i]
-		// Skip first element to avoid duplicates
-		finalRoute = append(finalRoute, seg[1:]...)
-	}
+func (a *RRTStarAlgorithm) ComputeConcurrently(ctx context.Context, searchVolume *models.Feature3D, waypoints []*models.Waypoint, constraints []*models.Feature3D, parameters map[string]any, storageType models.StorageType, maxWorkers int) ([]*models.Waypoint, float64, error) {
+	return computeLegsConcurrently(ctx, "RRTStar", waypoints, constraints, parameters, storageType, maxWorkers, func(ctx context.Context, start, end *models.Waypoint, parameters map[string]any, s storage.Storage) ([]*models.Waypoint, float64, error) {
+		return a.Run(ctx, searchVolume, start, end, parameters, s)
+	})
+}
 
-	return finalRoute, totalCost, nil
+func (a *RRTStarAlgorithm) Compute(ctx context.Context, searchVolume *models.Feature3D, waypoints []*models.Waypoint, constraints []*models.Feature3D, parameters map[string]any, storageType models.StorageType) ([]*models.Waypoint, float64, error) {
+	return computeLegs(ctx, "RRTStar", waypoints, constraints, parameters, storageType, func(ctx context.Context, start, end *models.Waypoint, parameters map[string]any, s storage.Storage) ([]*models.Waypoint, float64, error) {
+		return a.Run(ctx, searchVolume, start, end, parameters, s)
+	})
 }
 
-func (a *RRTStarAlgorithm) Compute(searchVolume *models.Feature3D, waypoints []*models.Waypoint, constraints []*models.Feature3D, parameters map[string]any, storageType models.StorageType) ([]*models.Waypoint, float64, error) {
-	// Check if waypoints are at least 2
-	numPairs := len(waypoints) - 1
-	if numPairs <= 0 {
-		return nil, 0.0, fmt.Errorf("less than 2 waypoints submitted (%d): abort", len(waypoints))
-	}
-	
-	// Create empty list of wps
-	route := make([]*models.Waypoint, 0)
-	cost := 0.0
+func (a *RRTStarAlgorithm) Run(ctx context.Context, searchVolume *models.Feature3D, start, end *models.Waypoint, parameters map[string]any, storage storage.Storage) ([]*models.Waypoint, float64, error) {
+	// TODO: Think if this is the correct place
+	storage.ClearWaypoints()
+	fmt.Printf("wpA: %v, wpB: %v, storage starts with %d constraints and %d sampled waypoints.\n", start, end, storage.ConstraintsLen(), storage.WaypointsLen())
 
-	// 0. Load first wp
-	route = append(route, waypoints[0])
-	
-	// TODO: Buffer constraints
-	// TODO: Think about creating and adding constraints in Run function so to parallelize that function
-	// 1. Create storage and load constraint into it
-	storage, err := storage.NewEmptyStorage(storageType)
+	planning_3d, max_gradient, err := a.getSpaceParameters(parameters, searchVolume)
 	if err != nil {
 		return nil, 0.0, err
 	}
-	err = storage.AddConstraints(constraints)
+
+	// With a departure time, the tree keeps the eta of its wps and temporary constraints block only while active
+	clock, err := newLegClock(start, parameters)
 	if err != nil {
 		return nil, 0.0, err
 	}
 
-	// 2. For each pair of wp -> run rrt
-	for i := 0; i < len(waypoints)-1; i++ {
-		tmpRoute, tmpCost, err := a.Run(searchVolume, waypoints[i], waypoints[i+1], parameters, storage)
-		if err != nil {
-			// Return route until now
-			return route, cost, fmt.Errorf("interrupted RRTStar for error between wp[%d] and wp[%d]: %w", i, i+1, err)
-		}
-		// Append new route but removing the first one
-		route = append(route, tmpRoute[1:]...)
-		cost += tmpCost
+	// First thing to do if to check if a straight line connection is possible.
+	// A goal with an acceptance radius is reached where the line enters it.
+	goal := end
+	if entry := utils.AcceptanceEntryPoint(start, end, end); entry != nil {
+		goal = entry
 	}
-
-	// TODO: Think if this is the correct place
-	storage.Clear()
-	
-	// 3. Return everything
-	return route, cost, nil
-}
-
-func (a *RRTStarAlgorithm) Run(searchVolume *models.Feature3D, start, end *models.Waypoint, parameters map[string]any, storage storage.Storage) ([]*models.Waypoint, float64, error) {
-	// TODO: Think if this is the correct place
-	storage.ClearWaypoints()
-	fmt.Printf("wpA: %v, wpB: %v, storage starts with %d constraints and %d sampled waypoints.\n", start, end, storage.ConstraintsLen(), storage.WaypointsLen())
-
-	// First thing to do if to check if a straight line connection is possible
-	if obstacleBetweenStartEnd, _, _ := storage.IsLineInObstacles(start, end); !obstacleBetweenStartEnd {
+	if isStraightLineFree(storage, clock, start, goal) && utils.IsWithinGradient(start, goal, max_gradient) {
 		fmt.Printf("Goal immediately found: straight line collision-free\n\n")
-		return []*models.Waypoint{start, end}, utils.HaversineDistance3D(start, end), nil
+		return []*models.Waypoint{start, goal}, storage.GetCostFunction().Cost(start, goal), nil
 	}
 
 	// TODO: Parameters
-	// TODO: Think about not to use max_iterations directly, rather continue until a certain condition happen (e.g. cost of route stopped decreasing for a while) 
 	// Get Parameters
 	sampler, max_iterations, step_size_mt, _ := a.GetParameters(parameters, end)
+	informedSampler := a.getInformedSampler(sampler, parameters, start, end, storage.GetCostFunction())
+	convergence_window, convergence_epsilon := a.getConvergenceParameters(parameters)
 
 	// Add start to storage
-	err := storage.AddWaypointWithPrevious(nil, start)
+	err = storage.AddWaypointWithPrevious(nil, start)
 	if err != nil {
 		return nil, 0.0, err
 	}
 	goal_found := false
 
+	// Cost of the route and iteration of the last improvement bigger than convergence_epsilon
+	last_improved_cost, last_improved_iter := math.Inf(1), 0
+
 	// ------------------------------------------------------------------------------------------------------
 
 	for current_iter := range max_iterations {
+		// Stop as soon as the request is cancelled or out of time
+		if ctx.Err() != nil {
+			fmt.Printf("[%d/%d] stopped: %v\n", current_iter, max_iterations, ctx.Err())
+			break
+		}
+
 		// Change K according to cardinality of V (no. of nodes)
 		K := int(K_INIT * math.Log(float64(storage.WaypointsLen())))+1
 		// R := math.Max(R_INIT_MT * math.Sqrt(math.Log(float64(storage.WaypointsLen()))/float64(storage.WaypointsLen())), step_size_mt)
 
 		if current_iter % 1000 == 0 {
 			if goal_found {
-				route, _ := storage.GetPathToRoot(end)
-				cost_km := utils.TotalHaversineDistance(route)
+				route, _ := storage.GetPathToRoot(goal)
+				cost_km := utils.TotalCost(storage.GetCostFunction(), route)
 				fmt.Printf("[%d/%d] k: %d, #wps: %d, #routeWps: %d, routeCost: %.3f mt\n", current_iter, max_iterations, K, storage.WaypointsLen(), len(route), cost_km)
 				// fmt.Printf("[%d/%d] radius: %.2fmt, #wps: %d, cost: %.3f mt\n", current_iter, MAX_ITERATIONS, R, len(route), cost_km)
 			
@@ -237,7 +113,7 @@ func (a *RRTStarAlgorithm) Run(searchVolume *models.Feature3D, start, end *model
 		}
 
 		// 1. Sample a new free wp
-		sampled, err := storage.SampleFree(sampler, searchVolume, end.Alt)
+		sampled, err := a.sampleFree(storage, sampler, searchVolume, end, planning_3d, clock != nil)
 		if err != nil {
 			// Impossible to sample 
 			return nil, 0.0, err
@@ -253,11 +129,11 @@ func (a *RRTStarAlgorithm) Run(searchVolume *models.Feature3D, start, end *model
 		new := utils.GetPointInDirectionAtDistance(nearest, sampled, step_size_mt)
 
 		// 4. Check if connection from nearest to new is possible
-		isInObstacles, _, err := storage.IsLineInObstacles(nearest, new)
+		isInObstacles, err := clock.isLineBlocked(storage, nearest, new)
 		if err != nil {
 			return nil, 0.0, err
 		}
-		if isInObstacles {
+		if isInObstacles || !utils.IsWithinGradient(nearest, new, max_gradient) {
 			continue
 		}
 
@@ -270,7 +146,7 @@ func (a *RRTStarAlgorithm) Run(searchVolume *models.Feature3D, start, end *model
 		// }
 
 		// 5. Here you check all the neighbors to connect to min cost path and rewire the tree
-		_, err = a.ConnectAndRewire(new, nearest, K, storage)
+		_, err = a.ConnectAndRewire(new, nearest, K, max_gradient, clock, storage)
 		if err != nil {
 			return nil, 0.0, err
 		}
@@ -280,37 +156,84 @@ func (a *RRTStarAlgorithm) Run(searchVolume *models.Feature3D, start, end *model
 		// 	fmt.Printf("Rewired Tree\n#wps: %d, cost: %.3f mt\n", len(route), cost_km)
 		// }
 
-		// 6. Check if it's goal
-		if !goal_found && a.isGoal(new, end, step_size_mt) {
-			// 7. Check if can be connected to goal
-			isInObstacles, _, err := storage.IsLineInObstacles(new, end)
+		if goal_found && (informedSampler != nil || convergence_window > 0) {
+			bestCost, err := storage.GetCostToRoot(goal)
+			if err != nil {
+				return nil, 0.0, err
+			}
+
+			// In informed mode, shrink the sampling ellipsoid every time the route improves
+			if informedSampler != nil {
+				informedSampler.SetBestCost(bestCost)
+			}
+
+			// Stop when the route didn't improve enough in the last convergence_window iterations
+			if convergence_window > 0 {
+				if last_improved_cost-bestCost >= convergence_epsilon {
+					last_improved_cost, last_improved_iter = bestCost, current_iter
+				} else if current_iter-last_improved_iter >= convergence_window {
+					fmt.Printf("[%d/%d] converged: cost %.3f mt improved less than %.3f mt in the last %d iterations\n", current_iter, max_iterations, bestCost, convergence_epsilon, convergence_window)
+					break
+				}
+			}
+		}
+
+		// 6. Check if it entered the acceptance radius of the goal, if any: the route ends where it did, and it's improved by the rewiring from now on
+		if entry := utils.AcceptanceEntryPoint(nearest, new, end); !goal_found && entry != nil {
+			err := storage.AddWaypointWithPrevious(nearest, entry)
+			if err != nil {
+				return nil, 0.0, err
+			}
+			clock.attach(nearest, entry)
+
+			route, _ := storage.GetPathToRoot(entry)
+			cost_km := utils.TotalCost(storage.GetCostFunction(), route)
+			fmt.Printf("Acceptance radius of goal entered at iteration %d/%d.\n", current_iter, max_iterations)
+			fmt.Printf("#wps: %d, cost: %.3f mt\n", len(route), cost_km)
+			goal, goal_found = entry, true
+			last_improved_cost, last_improved_iter = cost_km, current_iter
+		}
+
+		// Or if it's goal
+		if !goal_found && a.isGoal(new, end, step_size_mt) && utils.IsWithinGradient(new, end, max_gradient) {
+			// 7. Check if can be connected to goal, up to where the connection enters its acceptance radius
+			target := end
+			if entry := utils.AcceptanceEntryPoint(new, end, end); entry != nil {
+				target = entry
+			}
+			isInObstacles, err := clock.isLineBlocked(storage, new, target)
 			if err != nil {
 				return nil, 0.0, err
 			}
 			// If yes, connect to goal, found!!! but not break
 			if !isInObstacles {
-				err := storage.AddWaypointWithPrevious(new, end)
+				err := storage.AddWaypointWithPrevious(new, target)
 				if err != nil {
 					return nil, 0.0, err
 				}
+				clock.attach(new, target)
+				goal = target
 				
-				route, _ := storage.GetPathToRoot(end)
-				cost_km := utils.TotalHaversineDistance(route)
+				route, _ := storage.GetPathToRoot(goal)
+				cost_km := utils.TotalCost(storage.GetCostFunction(), route)
 				fmt.Printf("New goal found at iteration %d/%d.\n", current_iter, max_iterations)
 				fmt.Printf("#wps: %d, cost: %.3f mt\n", len(route), cost_km)
 				goal_found = true
+				last_improved_cost, last_improved_iter = cost_km, current_iter
 			}
 		}
 	}
 
 	// Now try to obtain the route from the goal node
 	if goal_found {
-		route, err := storage.GetPathToRoot(end)
+		route, err := storage.GetPathToRoot(goal)
 		if err != nil {
 			return nil, 0.0, err
 		}
-		cost := utils.TotalHaversineDistance(route)
+		cost := utils.TotalCost(storage.GetCostFunction(), route)
 		return route, cost, nil
+	} else if ctx.Err() != nil {
+		return nil, 0.0, fmt.Errorf("goal not found before stop: %w", ctx.Err())
 	} else {
 		return nil, 0.0, fmt.Errorf("goal not found with %d iterations", max_iterations)
 	}
@@ -327,26 +250,63 @@ func (a *RRTStarAlgorithm) GetParameters(parameters map[string]any, goal *models
 	return SAMPLER, MAX_ITERATIONS, STEP_SIZE_MT, GOAL_BIAS
 }
 
-func (a *RRTStarAlgorithm) ConnectAndRewire(new, nearest *models.Waypoint, k int, storage storage.Storage) (bool, error) {
+// Read the convergence stop rule from parameters: a window of 0 disables it, so only max_iterations (and the deadline) stop the planning.
+func (a *RRTStarAlgorithm) getConvergenceParameters(parameters map[string]any) (int, float64) {
+	CONVERGENCE_WINDOW := int(utils.GetOrDefault(parameters, "convergence_window", 0.0))
+	CONVERGENCE_EPSILON := utils.GetOrDefault(parameters, "convergence_epsilon", 1.0)
+
+	if CONVERGENCE_WINDOW > 0 {
+		fmt.Printf("convergence_window: %d\n", CONVERGENCE_WINDOW)
+		fmt.Printf("convergence_epsilon: %f\n", CONVERGENCE_EPSILON)
+	}
+	return CONVERGENCE_WINDOW, CONVERGENCE_EPSILON
+}
+
+// Wrap the base sampler (the one inside goal bias) with an informed sampler if requested in parameters. Returns nil otherwise.
+// The ellipsoid is built from the best cost in mt, so it's only used with the distance cost.
+func (a *RRTStarAlgorithm) getInformedSampler(sampler utils.Sampler, parameters map[string]any, start, goal *models.Waypoint, costFunction utils.CostFunction) *utils.InformedSampler {
+	INFORMED := utils.GetOrDefault(parameters, "informed", false)
+	if !INFORMED {
+		return nil
+	}
+	if _, ok := costFunction.(utils.DistanceCost); !ok {
+		fmt.Printf("informed: ignored, the cost is not the distance\n")
+		return nil
+	}
+
+	goalBiasSampler, ok := sampler.(*utils.GoalBiasSampler)
+	if !ok {
+		return nil
+	}
+
+	informedSampler := utils.NewInformedSampler(goalBiasSampler.InternalSampler, start, goal)
+	goalBiasSampler.InternalSampler = informedSampler
+	fmt.Printf("informed: %v\n", INFORMED)
+	return informedSampler
+}
+
+// ConnectAndRewire connects new to the cheapest of its k nearest wps and rewires them through new when cheaper.
+// With a clock, connections are checked at the eta of the wps, and a wp is rewired only if its subtree is still free at the new etas.
+func (a *RRTStarAlgorithm) ConnectAndRewire(new, nearest *models.Waypoint, k int, max_gradient float64, clock *legClock, storage storage.Storage) (bool, error) {
 	// TODO: Test also with radius
-	neighbors, distances, err := storage.KNearestPoints(new, k)
+	neighbors, _, err := storage.KNearestPoints(new, k)
 	if err != nil {
 		return false, fmt.Errorf("error while getting the %d-nn of %v: %+w", k, new, err)
 	}
 
-	return a.connectAndRewireWithNeighbors(new, nearest, neighbors, distances, storage)
+	return a.connectAndRewireWithNeighbors(new, nearest, neighbors, max_gradient, clock, storage)
 }
 
-func (a *RRTStarAlgorithm) ConnectAndRewireInRadius(new, nearest *models.Waypoint, radius_mt float64, storage storage.Storage) (bool, error) {
-	neighbors, distances, err := storage.NearestPointsInRadius(new, radius_mt)
+func (a *RRTStarAlgorithm) ConnectAndRewireInRadius(new, nearest *models.Waypoint, radius_mt float64, max_gradient float64, clock *legClock, storage storage.Storage) (bool, error) {
+	neighbors, _, err := storage.NearestPointsInRadius(new, radius_mt)
 	if err != nil {
 		return false, fmt.Errorf("error while getting point within %.2f mt of %v: %+w", radius_mt, new, err)
 	}
 
-	return a.connectAndRewireWithNeighbors(new, nearest, neighbors, distances, storage)
+	return a.connectAndRewireWithNeighbors(new, nearest, neighbors, max_gradient, clock, storage)
 }
 
-func (a *RRTStarAlgorithm) connectAndRewireWithNeighbors(new, nearest *models.Waypoint, neighbors []*models.Waypoint, distances []float64, storage storage.Storage) (bool, error) {
+func (a *RRTStarAlgorithm) connectAndRewireWithNeighbors(new, nearest *models.Waypoint, neighbors []*models.Waypoint, max_gradient float64, clock *legClock, storage storage.Storage) (bool, error) {
 	// CONNECT
 	// For every neighbor check if connecting to new via that would be better compared to connect to nearest
 	minCostWp := nearest
@@ -354,7 +314,7 @@ func (a *RRTStarAlgorithm) connectAndRewireWithNeighbors(new, nearest *models.Wa
 	if err != nil {
 		return false, err
 	}
-	minCost += distances[0]
+	minCost += a.getLineCost(minCostWp, new, storage)
 
 	// Scan neighbors
 	// TODO: you can skip first one as it will be the nearest
@@ -362,10 +322,12 @@ func (a *RRTStarAlgorithm) connectAndRewireWithNeighbors(new, nearest *models.Wa
 
 	for idx, near := range neighbors {
 		// Check if near can be connected to new
-		isInObstacles, _, err := storage.IsLineInObstacles(near, new)
+		isInObstacles, err := clock.isLineBlocked(storage, near, new)
 		if err != nil {
 			return false, err
 		}
+		// Too steep connections count as blocked ones
+		isInObstacles = isInObstacles || !utils.IsWithinGradient(near, new, max_gradient)
 		isInObstacleList[idx] = isInObstacles
 		if isInObstacles {
 			continue
@@ -376,9 +338,7 @@ func (a *RRTStarAlgorithm) connectAndRewireWithNeighbors(new, nearest *models.Wa
 		if err != nil {
 			return false, err
 		}
-		// TODO: Think if it make sense
-		// currentCost += a.getLineCost(near, new)
-		currentCost += distances[idx]
+		currentCost += a.getLineCost(near, new, storage)
 
 		if currentCost < minCost {
 			minCostWp = near
@@ -391,6 +351,7 @@ func (a *RRTStarAlgorithm) connectAndRewireWithNeighbors(new, nearest *models.Wa
 	if err != nil {
 		return false, err
 	}
+	clock.attach(minCostWp, new)
 
 	// -----------------------------------------------------------
 
@@ -409,13 +370,27 @@ func (a *RRTStarAlgorithm) connectAndRewireWithNeighbors(new, nearest *models.Wa
 		}
 
 		// Here near can be connected to new, check the cost
-		newCost += a.getLineCost(new, near)
 		currentCost, err := a.getCost(near, storage)
 		if err != nil {
 			return rewired, err
 		}
 
-		if newCost < currentCost {
+		if newCost+a.getLineCost(new, near, storage) < currentCost {
+			// Rewiring near changes the eta of its whole subtree, whose connections were checked at the old ones
+			if clock != nil {
+				previous, err := storage.GetPrevious(near)
+				if err != nil {
+					return rewired, err
+				}
+				free, err := clock.rewire(storage, new, near, previous)
+				if err != nil {
+					return rewired, err
+				}
+				if !free {
+					continue
+				}
+			}
+
 			// New becomes the parent of near
 			storage.ChangePrevious(new, near)
 			rewired = true
@@ -436,7 +411,7 @@ func (a *RRTStarAlgorithm) getCost(wp *models.Waypoint, storage storage.Storage)
 	return storage.GetCostToRoot(wp)
 }
 
-func (a *RRTStarAlgorithm) getLineCost(start, end *models.Waypoint) (float64) {
-	// get cost of connecting start to end (haversine distance cost)
-	return utils.HaversineDistance3D(start, end)
+func (a *RRTStarAlgorithm) getLineCost(start, end *models.Waypoint, storage storage.Storage) (float64) {
+	// get cost of connecting start to end, with the same cost function of the tree
+	return storage.GetCostFunction().Cost(start, end)
 }
\ No newline at end of file
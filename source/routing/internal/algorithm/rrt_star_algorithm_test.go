@@ -1,11 +1,14 @@
 package algorithm_test
 
 import (
+	"context"
+	"errors"
 	"geopathplanner/routing/internal/algorithm"
 	"geopathplanner/routing/internal/models"
 	"geopathplanner/routing/internal/storage"
 	"geopathplanner/routing/internal/utils"
 	"testing"
+	"time"
 )
 
 func TestRRTStarAlgorithm_run(t *testing.T) {
@@ -45,7 +48,7 @@ func TestRRTStarAlgorithm_run(t *testing.T) {
 			}
 			s.AddConstraints(tt.constraints)
 
-			got, _, gotErr := a.Run(tt.searchVolume, tt.start, tt.end, nil, s)
+			got, _, gotErr := a.Run(context.Background(), tt.searchVolume, tt.start, tt.end, nil, s)
 
 			// TODO: For visually testing, export results in geojson
 			utils.MarkWaypointsAsOriginal(tt.start, tt.end)
@@ -92,7 +95,7 @@ func TestRRTStarAlgorithm_Compute(t *testing.T) {
 				t.Fatalf("could not construct receiver type: %v", err)
 			}
 
-			got, _, gotErr := a.Compute(tt.searchVolume, tt.waypoints, tt.constraints, nil, tt.storageType)
+			got, _, gotErr := a.Compute(context.Background(), tt.searchVolume, tt.waypoints, tt.constraints, nil, tt.storageType)
 
 			// TODO: For visually testing, export results in geojson
       		utils.MarkWaypointsAsOriginal(tt.waypoints...)
@@ -139,7 +142,7 @@ func TestRRTStarAlgorithm_ComputeConcurrently(t *testing.T) {
 				t.Fatalf("could not construct receiver type: %v", err)
 			}
 
-			got, _, gotErr := a.ComputeConcurrently(tt.searchVolume, tt.waypoints, tt.constraints, nil, tt.storageType, tt.maxWorkers)
+			got, _, gotErr := a.ComputeConcurrently(context.Background(), tt.searchVolume, tt.waypoints, tt.constraints, nil, tt.storageType, tt.maxWorkers)
 
 			// TODO: For visually testing, export results in geojson
       		utils.MarkWaypointsAsOriginal(tt.waypoints...)
@@ -158,6 +161,246 @@ func TestRRTStarAlgorithm_ComputeConcurrently(t *testing.T) {
 	}
 }
 
+func TestRRTStarAlgorithm_ConnectAndRewire(t *testing.T) {
+	a, _ := models.NewAltitude(100, models.MT)
+	// Along a parallel, x mt east and y mt north of the root
+	at := func(id int, x, y float64) *models.Waypoint {
+		return models.MustNewWaypoint(id, 40.0+y/111320.0, 4.0+x/85276.0, a)
+	}
+
+	tests := []struct {
+		name        string // description of this test case
+		storageType models.StorageType
+	}{
+		{name: "RRTStar rewire every cheaper neighbor - LIST", storageType: models.List},
+		{name: "RRTStar rewire every cheaper neighbor - RTREE", storageType: models.RTree},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rrtStar, err := algorithm.NewRRTStarAlgorithm()
+			if err != nil {
+				t.Fatalf("could not construct receiver type: %v", err)
+			}
+			s, err := storage.NewEmptyStorage(tt.storageType)
+			if err != nil {
+				t.Fatalf("could not construct storage: %v", err)
+			}
+
+			// near1 (~137 mt) and near2 (~114 mt) are reached through detours, new (100 mt) goes straight
+			root := at(0, 0, 0)
+			detour1, near1 := at(1, 52.5, 40), at(2, 105, 0)
+			detour2, near2 := at(3, 56, 10.7), at(4, 112, 0)
+			s.AddWaypointWithPrevious(nil, root)
+			s.AddWaypointWithPrevious(root, detour1)
+			s.AddWaypointWithPrevious(detour1, near1)
+			s.AddWaypointWithPrevious(root, detour2)
+			s.AddWaypointWithPrevious(detour2, near2)
+
+			new := at(5, 100, 0)
+			if _, err := rrtStar.ConnectAndRewire(new, root, 5, 0, nil, s); err != nil {
+				t.Fatalf("ConnectAndRewire() failed: %v", err)
+			}
+
+			// Through new, near1 costs ~105 mt and near2 ~112 mt
+			for _, near := range []*models.Waypoint{near1, near2} {
+				if previous, _ := s.GetPrevious(near); previous != new {
+					t.Errorf("ConnectAndRewire() left %v after %v, want after %v", near, previous, new)
+				}
+			}
+		})
+	}
+}
+
+func TestRRTStarAlgorithm_runInformed(t *testing.T) {
+	sv, w_list, c_list, c_overlapping := utils.SetupTestScenario()
+	w1 := w_list[0]
+	w2 := w_list[1]
+
+	tests := []struct {
+		name        string // description of this test case
+		storageType models.StorageType
+		// Named input parameters for target function.
+		searchVolume *models.Feature3D
+		start        *models.Waypoint
+		end          *models.Waypoint
+		constraints  []*models.Feature3D
+		seed         float64
+	}{
+		{name: "InformedRRTStar with non-overlapping obstacles - RTREE", storageType: models.RTree, searchVolume: sv, start: w1, end: w2, constraints: c_list, seed: 945},
+		{name: "InformedRRTStar with overlapping obstacles - RTREE", storageType: models.RTree, searchVolume: sv, start: w1, end: w2, constraints: append(c_list, c_overlapping...), seed: 945},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := algorithm.NewRRTStarAlgorithm()
+			if err != nil {
+				t.Fatalf("could not construct receiver type: %v", err)
+			}
+
+			costs := make(map[bool]float64)
+			for _, informed := range []bool{false, true} {
+				s, err := storage.NewEmptyStorage(tt.storageType)
+				if err != nil {
+					t.Fatalf("could not construct storage: %v", err)
+				}
+				s.AddConstraints(tt.constraints)
+
+				parameters := map[string]any{"max_iterations": 2000.0, "seed": tt.seed, "informed": informed}
+				got, gotCost, gotErr := a.Run(context.Background(), tt.searchVolume, tt.start, tt.end, parameters, s)
+				if gotErr != nil {
+					t.Fatalf("Run() informed=%v failed: %v", informed, gotErr)
+				}
+				costs[informed] = gotCost
+
+				utils.MarkWaypointsAsOriginal(tt.start, tt.end)
+				if informed {
+					utils.ExportToGeoJSONRoute("algorithm", got, tt.constraints, tt.searchVolume, tt.name, true)
+				}
+			}
+
+			// Same seed and same budget: informed sampling must not end up with a worse route
+			t.Logf("plain: %.3f mt, informed: %.3f mt, improvement: %.3f mt (%.2f%%)", costs[false], costs[true], costs[false]-costs[true], 100*(costs[false]-costs[true])/costs[false])
+			if costs[true] > costs[false] {
+				t.Errorf("Run() informed cost %.3f mt is worse than plain cost %.3f mt", costs[true], costs[false])
+			}
+		})
+	}
+}
+
+func TestRRTStarAlgorithm_runDeadline(t *testing.T) {
+	sv, w_list, c_list, _ := utils.SetupTestScenario()
+	w1 := w_list[0]
+	w2 := w_list[1]
+
+	tests := []struct {
+		name        string // description of this test case
+		storageType models.StorageType
+		// Named input parameters for target function.
+		searchVolume *models.Feature3D
+		start        *models.Waypoint
+		end          *models.Waypoint
+		constraints  []*models.Feature3D
+		budget       time.Duration
+		cancelled    bool
+		wantErr      bool
+	}{
+		{name: "RRTStar stopped by deadline - RTREE", storageType: models.RTree, searchVolume: sv, start: w1, end: w2, constraints: c_list, budget: 2 * time.Second, wantErr: false},
+		{name: "RRTStar cancelled before start - RTREE", storageType: models.RTree, searchVolume: sv, start: w1, end: w2, constraints: c_list, budget: 2 * time.Second, cancelled: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := algorithm.NewRRTStarAlgorithm()
+			if err != nil {
+				t.Fatalf("could not construct receiver type: %v", err)
+			}
+
+			s, err := storage.NewEmptyStorage(tt.storageType)
+			if err != nil {
+				t.Fatalf("could not construct storage: %v", err)
+			}
+			s.AddConstraints(tt.constraints)
+
+			ctx, cancel := context.WithTimeout(context.Background(), tt.budget)
+			defer cancel()
+			if tt.cancelled {
+				cancel()
+			}
+
+			// Way more iterations than the budget allows, only the deadline can stop it
+			parameters := map[string]any{"max_iterations": 1e9}
+			begin := time.Now()
+			got, _, gotErr := a.Run(ctx, tt.searchVolume, tt.start, tt.end, parameters, s)
+			elapsed := time.Since(begin)
+
+			if elapsed > tt.budget+time.Second {
+				t.Errorf("Run() took %v with a budget of %v", elapsed, tt.budget)
+			}
+			if gotErr != nil {
+				if !tt.wantErr {
+					t.Errorf("Run() failed: %v", gotErr)
+				}
+				if !errors.Is(gotErr, context.Canceled) {
+					t.Errorf("Run() error should wrap context.Canceled, got: %v", gotErr)
+				}
+				return
+			}
+			if tt.wantErr {
+				t.Fatal("Run() succeeded unexpectedly")
+			}
+
+			// Best route found so far must be a valid one
+			if got[0] != tt.start || got[len(got)-1] != tt.end {
+				t.Errorf("Run() route goes from %v to %v, want %v to %v", got[0], got[len(got)-1], tt.start, tt.end)
+			}
+			for i := 0; i < len(got)-1; i++ {
+				if blocked, _, _ := s.IsLineInObstacles(got[i], got[i+1]); blocked {
+					t.Errorf("Run() segment %d crosses a constraint", i)
+				}
+			}
+		})
+	}
+}
+
+func TestRRTStarAlgorithm_runConvergence(t *testing.T) {
+	sv, w_list, c_list, c_overlapping := utils.SetupTestScenario()
+	w1 := w_list[0]
+	w2 := w_list[1]
+
+	tests := []struct {
+		name        string // description of this test case
+		storageType models.StorageType
+		// Named input parameters for target function.
+		searchVolume *models.Feature3D
+		start        *models.Waypoint
+		end          *models.Waypoint
+		constraints  []*models.Feature3D
+		window       float64
+		epsilon      float64
+	}{
+		{name: "ConvergedRRTStar with non-overlapping obstacles - RTREE", storageType: models.RTree, searchVolume: sv, start: w1, end: w2, constraints: c_list, window: 300.0, epsilon: 1.0},
+		{name: "ConvergedRRTStar with overlapping obstacles - RTREE", storageType: models.RTree, searchVolume: sv, start: w1, end: w2, constraints: append(c_list, c_overlapping...), window: 300.0, epsilon: 1.0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := algorithm.NewRRTStarAlgorithm()
+			if err != nil {
+				t.Fatalf("could not construct receiver type: %v", err)
+			}
+
+			// Same seed and same iterations, with and without the stop rule: the tree of the first is the beginning of the second one
+			var got []*models.Waypoint
+			wps := make(map[bool]int)
+			for _, converge := range []bool{true, false} {
+				s, err := storage.NewEmptyStorage(tt.storageType)
+				if err != nil {
+					t.Fatalf("could not construct storage: %v", err)
+				}
+				s.AddConstraints(tt.constraints)
+
+				parameters := map[string]any{"max_iterations": 3000.0, "seed": 945.0}
+				if converge {
+					parameters["convergence_window"], parameters["convergence_epsilon"] = tt.window, tt.epsilon
+				}
+				route, gotCost, gotErr := a.Run(context.Background(), tt.searchVolume, tt.start, tt.end, parameters, s)
+				if gotErr != nil {
+					t.Fatalf("Run() converge=%v failed: %v", converge, gotErr)
+				}
+				wps[converge] = s.WaypointsLen()
+				if converge {
+					got = route
+					t.Logf("converged with %d wps in the tree, cost: %.3f mt", wps[converge], gotCost)
+				}
+			}
+
+			if wps[true] >= wps[false] {
+				t.Errorf("Run() didn't stop before max_iterations: %d wps in the tree, %d without convergence", wps[true], wps[false])
+			}
+
+			utils.MarkWaypointsAsOriginal(tt.start, tt.end)
+			utils.ExportToGeoJSONRoute("algorithm", got, tt.constraints, tt.searchVolume, tt.name, true)
+		})
+	}
+}
+
 func BenchmarkRRTStarAlgorithm(b *testing.B) {
 	sv, w_list, c_list, c_overlapping := utils.SetupTestScenario()
 
@@ -184,11 +427,166 @@ func BenchmarkRRTStarAlgorithm(b *testing.B) {
 			b.ResetTimer() // Don’t include setup time
 			for b.Loop() {
         if tt.maxWorkers == 0 {
-          _, _, _ = a.Compute(tt.searchVolume, tt.waypoints, tt.constraints, nil, tt.storageType)
+          _, _, _ = a.Compute(context.Background(), tt.searchVolume, tt.waypoints, tt.constraints, nil, tt.storageType)
         } else {
-          _, _, _ = a.ComputeConcurrently(tt.searchVolume, tt.waypoints, tt.constraints, nil, tt.storageType, tt.maxWorkers)
+          _, _, _ = a.ComputeConcurrently(context.Background(), tt.searchVolume, tt.waypoints, tt.constraints, nil, tt.storageType, tt.maxWorkers)
         }
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+
+func TestRRTStarAlgorithm_runTemporaryConstraints(t *testing.T) {
+	a, _ := models.NewAltitude(100, models.MT)
+	searchVolume := models.MustNewFeatureFromGeojson(`{"type": "Feature", "properties": {}, "geometry": {"type": "Polygon", "coordinates": [[[3.996, 49.997], [4.007, 49.997], [4.007, 50.003], [3.996, 50.003], [3.996, 49.997]]]}}`)
+	start, end := models.MustNewWaypoint(0, 50.0, 3.9985, a), models.MustNewWaypoint(1, 50.0, 4.0045, a)
+	constraints := []*models.Feature3D{
+		models.MustNewFeatureFromGeojson(`{"type": "Feature", "properties": {"active_from": "2026-10-17T10:00:00Z", "active_until": "2026-10-17T11:00:00Z"}, "geometry": {"type": "Polygon", "coordinates": [[[4.0, 49.999], [4.002, 49.999], [4.002, 50.001], [4.0, 50.001], [4.0, 49.999]]]}}`),
+	}
+
+	tests := []struct {
+		name         string // description of this test case
+		storageType  models.StorageType
+		departure    string
+		wantStraight bool
+	}{
+		{name: "RRTStar departing after the closure - RTREE", storageType: models.RTree, departure: "2026-10-17T11:00:00Z", wantStraight: true},
+		{name: "RRTStar departing during the closure - RTREE", storageType: models.RTree, departure: "2026-10-17T10:30:00Z", wantStraight: false},
+		{name: "RRTStar departing during the closure - LIST", storageType: models.List, departure: "2026-10-17T10:30:00Z", wantStraight: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rrtStar, err := algorithm.NewRRTStarAlgorithm()
+			if err != nil {
+				t.Fatalf("could not construct receiver type: %v", err)
+			}
+			s, err := storage.NewEmptyStorage(tt.storageType)
+			if err != nil {
+				t.Fatalf("could not construct storage: %v", err)
+			}
+			s.AddConstraints(constraints)
+
+			departure, _ := time.Parse(time.RFC3339, tt.departure)
+			parameters := map[string]any{"max_iterations": 3000.0, models.DEPARTURE_TIME_PARAMETER: departure}
+			got, _, gotErr := rrtStar.Run(context.Background(), searchVolume, start, end, parameters, s)
+			if gotErr != nil {
+				t.Fatalf("Run() failed: %v", gotErr)
+			}
+
+			utils.MarkWaypointsAsOriginal(start, end)
+			utils.ExportToGeoJSONRoute("algorithm", got, constraints, searchVolume, tt.name, true)
+
+			if straight := len(got) == 2; straight != tt.wantStraight {
+				t.Errorf("Run() = %v, straight line: %t, want %t", got, straight, tt.wantStraight)
+			}
+			assertScheduleFree(t, got, departure, constraints)
+		})
+	}
+}
+
+func TestRRTStarAlgorithm_runMovingObstacles(t *testing.T) {
+	a, _ := models.NewAltitude(100, models.MT)
+	searchVolume := models.MustNewFeatureFromGeojson(`{"type": "Feature", "properties": {}, "geometry": {"type": "Polygon", "coordinates": [[[3.996, 49.995], [4.007, 49.995], [4.007, 50.005], [3.996, 50.005], [3.996, 49.995]]]}}`)
+	start, end := models.MustNewWaypoint(0, 50.0, 3.9985, a), models.MustNewWaypoint(1, 50.0, 4.0045, a)
+	// Cell ~222 mt south of the leg at 10:00:00, moving north at 10 m/s: it covers the leg from ~10:00:22 to ~10:00:44
+	constraints := []*models.Feature3D{
+		models.MustNewFeatureFromGeojson(`{"type": "Feature", "properties": {"speed_ms": 10, "heading_deg": 0, "reference_time": "2026-10-17T10:00:00Z"}, "geometry": {"type": "Polygon", "coordinates": [[[4.0, 49.996], [4.002, 49.996], [4.002, 49.998], [4.0, 49.998], [4.0, 49.996]]]}}`),
+	}
+
+	tests := []struct {
+		name        string // description of this test case
+		storageType models.StorageType
+		departure   string
+	}{
+		{name: "RRTStar meeting the cell - RTREE", storageType: models.RTree, departure: "2026-10-17T10:00:20Z"},
+		{name: "RRTStar meeting the cell - LIST", storageType: models.List, departure: "2026-10-17T10:00:20Z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rrtStar, err := algorithm.NewRRTStarAlgorithm()
+			if err != nil {
+				t.Fatalf("could not construct receiver type: %v", err)
+			}
+			s, err := storage.NewEmptyStorage(tt.storageType)
+			if err != nil {
+				t.Fatalf("could not construct storage: %v", err)
+			}
+			s.AddConstraints(constraints)
+
+			// The tree is rewired while the cell moves: the route must still be free at the etas it ends up with
+			departure, _ := time.Parse(time.RFC3339, tt.departure)
+			parameters := map[string]any{"max_iterations": 2000.0, models.DEPARTURE_TIME_PARAMETER: departure}
+			got, _, gotErr := rrtStar.Run(context.Background(), searchVolume, start, end, parameters, s)
+			if gotErr != nil {
+				t.Fatalf("Run() failed: %v", gotErr)
+			}
+
+			utils.MarkWaypointsAsOriginal(start, end)
+			utils.ExportToGeoJSONRoute("algorithm", got, constraints, searchVolume, tt.name, true)
+
+			if len(got) == 2 {
+				t.Errorf("Run() = %v, want around the cell", got)
+			}
+			assertScheduleFree(t, got, departure, constraints)
+		})
+	}
+}
+
+func TestRRTStarAlgorithm_runAcceptanceRadius(t *testing.T) {
+	a, _ := models.NewAltitude(100, models.MT)
+	searchVolume := models.MustNewFeatureFromGeojson(`{"type": "Feature", "properties": {}, "geometry": {"type": "Polygon", "coordinates": [[[3.995, 49.995], [4.015, 49.995], [4.015, 50.005], [3.995, 50.005], [3.995, 49.995]]]}}`)
+	start := models.MustNewWaypoint(0, 50.0, 4.0, a)
+	// The goal is in the middle of a building ~70 mt wide, behind a wall
+	constraints := []*models.Feature3D{
+		models.MustNewFeatureFromGeojson(`{"type": "Feature", "properties": {}, "geometry": {"type": "Polygon", "coordinates": [[[4.0095, 49.9995], [4.0105, 49.9995], [4.0105, 50.0005], [4.0095, 50.0005], [4.0095, 49.9995]]]}}`),
+		models.MustNewFeatureFromGeojson(`{"type": "Feature", "properties": {}, "geometry": {"type": "Polygon", "coordinates": [[[4.0045, 49.998], [4.0055, 49.998], [4.0055, 50.002], [4.0045, 50.002], [4.0045, 49.998]]]}}`),
+	}
+
+	tests := []struct {
+		name     string // description of this test case
+		radiusMt float64
+		wantErr  bool
+	}{
+		{name: "RRTStar with the radius out of the building - RTREE", radiusMt: 60},
+		{name: "RRTStar with the radius within the building - RTREE", radiusMt: 20, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rrtStar, err := algorithm.NewRRTStarAlgorithm()
+			if err != nil {
+				t.Fatalf("could not construct receiver type: %v", err)
+			}
+			s, err := storage.NewEmptyStorage(models.RTree)
+			if err != nil {
+				t.Fatalf("could not construct storage: %v", err)
+			}
+			s.AddConstraints(constraints)
+
+			end := models.MustNewWaypoint(1, 50.0, 4.01, a)
+			end.Properties["acceptance_radius_mt"] = tt.radiusMt
+			got, _, gotErr := rrtStar.Run(context.Background(), searchVolume, start, end, map[string]any{"max_iterations": 3000.0}, s)
+
+			utils.MarkWaypointsAsOriginal(start, end)
+			utils.ExportToGeoJSONRoute("algorithm", got, constraints, searchVolume, tt.name, true)
+
+			if gotErr != nil {
+				if !tt.wantErr {
+					t.Errorf("Run() failed: %v", gotErr)
+				}
+				return
+			}
+			if tt.wantErr {
+				t.Fatal("Run() succeeded unexpectedly")
+			}
+			last := got[len(got)-1]
+			if last == end || !last.Reaches(end) || utils.HaversineDistance3D(last, end) > tt.radiusMt+1e-6 {
+				t.Errorf("Run() ends at %v, want where it enters the %.0f mt around %v", last, tt.radiusMt, end)
+			}
+			for i := 1; i < len(got); i++ {
+				if blocked, _, _ := s.IsLineInObstacles(got[i-1], got[i]); blocked {
+					t.Errorf("Run() segment %d (%v - %v) meets an obstacle", i-1, got[i-1], got[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package algorithm
+
+import (
+	"fmt"
+	"geopathplanner/routing/internal/models"
+	"geopathplanner/routing/internal/storage"
+	"geopathplanner/routing/internal/utils"
+	"maps"
+	"slices"
+	"time"
+)
+
+// departureTime is parameters.departure_time, zero if the route is not scheduled and temporary constraints always block
+func departureTime(parameters map[string]any) time.Time {
+	return utils.GetOrDefault(parameters, models.DEPARTURE_TIME_PARAMETER, time.Time{})
+}
+
+// withDepartureTime returns a copy of parameters departing at t, for the next leg of a scheduled route
+func withDepartureTime(parameters map[string]any, t time.Time) map[string]any {
+	legParameters := maps.Clone(parameters)
+	legParameters[models.DEPARTURE_TIME_PARAMETER] = t
+	return legParameters
+}
+
+// newFlightTime gives the time of flying a connection at parameters.airspeed_ms in the wind field of the request
+func newFlightTime(parameters map[string]any) (*utils.TimeCost, error) {
+	return utils.NewTimeCost(
+		utils.GetOrDefault(parameters, "airspeed_ms", utils.DEFAULT_AIRSPEED_MS),
+		utils.GetOrDefault[*models.WindField](parameters, models.WIND_FIELD_PARAMETER, nil),
+	)
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// legClock keeps the estimated time of arrival at the wps of a leg, flown from parameters.departure_time.
+// A nil legClock is an unscheduled leg, whose lines are checked against every constraint whatever its time window.
+type legClock struct {
+	flightTime *utils.TimeCost
+	eta        map[*models.Waypoint]time.Time
+	children   map[*models.Waypoint][]*models.Waypoint // of the wps attached in a tree, to move their etas when it's rewired
+}
+
+// newLegClock starts the clock at start, or returns nil if parameters have no departure time
+func newLegClock(start *models.Waypoint, parameters map[string]any) (*legClock, error) {
+	departure := departureTime(parameters)
+	if departure.IsZero() {
+		return nil, nil
+	}
+	flightTime, err := newFlightTime(parameters)
+	if err != nil {
+		return nil, err
+	}
+	return &legClock{flightTime: flightTime, eta: map[*models.Waypoint]time.Time{start: departure}}, nil
+}
+
+// arrival is when to is reached flying straight from from
+func (c *legClock) arrival(from, to *models.Waypoint) time.Time {
+	return c.eta[from].Add(seconds(c.flightTime.Cost(from, to)))
+}
+
+// connect sets the eta of to, reached from from
+func (c *legClock) connect(from, to *models.Waypoint) {
+	if c != nil {
+		c.eta[to] = c.arrival(from, to)
+	}
+}
+
+// attach connects to to from in a tree, whose wps can be rewired later
+func (c *legClock) attach(from, to *models.Waypoint) {
+	if c == nil {
+		return
+	}
+	c.connect(from, to)
+	if c.children == nil {
+		c.children = make(map[*models.Waypoint][]*models.Waypoint)
+	}
+	c.children[from] = append(c.children[from], to)
+}
+
+// rewire tells if to, attached to previous, can be reached from from instead, with all the connections of its subtree still free at the new etas.
+// If so, the etas of the subtree are moved and to is attached to from, otherwise nothing changes.
+func (c *legClock) rewire(s storage.Storage, from, to, previous *models.Waypoint) (bool, error) {
+	etas := map[*models.Waypoint]time.Time{to: c.arrival(from, to)}
+	blocked, _, err := s.IsLineInObstaclesAt(from, to, c.eta[from], etas[to])
+	if err != nil || blocked {
+		return false, err
+	}
+
+	queue := []*models.Waypoint{to}
+	for len(queue) > 0 {
+		parent := queue[0]
+		queue = queue[1:]
+		for _, child := range c.children[parent] {
+			etas[child] = etas[parent].Add(seconds(c.flightTime.Cost(parent, child)))
+			blocked, _, err := s.IsLineInObstaclesAt(parent, child, etas[parent], etas[child])
+			if err != nil || blocked {
+				return false, err
+			}
+			queue = append(queue, child)
+		}
+	}
+
+	maps.Copy(c.eta, etas)
+	c.children[previous] = slices.DeleteFunc(c.children[previous], func(child *models.Waypoint) bool { return child == to })
+	c.children[from] = append(c.children[from], to)
+	return true, nil
+}
+
+// isLineBlocked checks the line from -> to against the constraints active while flying it
+func (c *legClock) isLineBlocked(s storage.Storage, from, to *models.Waypoint) (bool, error) {
+	if c == nil {
+		blocked, _, err := s.IsLineInObstacles(from, to)
+		return blocked, err
+	}
+	blocked, _, err := s.IsLineInObstaclesAt(from, to, c.eta[from], c.arrival(from, to))
+	return blocked, err
+}
+
+// isRouteBlocked flies route from the eta of its first wp, and tells if any segment meets an obstacle of s as it is at that time
+func (c *legClock) isRouteBlocked(s storage.Storage, route []*models.Waypoint) (bool, error) {
+	if c == nil {
+		return false, nil
+	}
+	for i := 1; i < len(route); i++ {
+		if blocked, err := c.isLineBlocked(s, route[i-1], route[i]); err != nil || blocked {
+			return blocked, err
+		}
+		c.connect(route[i-1], route[i])
+	}
+	return false, nil
+}
+
+// checkSchedule flies route from departure and returns an error if a segment meets an obstacle of s as it is at that time.
+// Planners that are not time-aware avoid temporary constraints always, but moving ones only where they are at their reference time.
+func checkSchedule(route []*models.Waypoint, departure time.Time, flightTime *utils.TimeCost, s storage.Storage) error {
+	i, from, to, err := firstBlockedSegment(route, departure, flightTime, s)
+	if err != nil {
+		return err
+	}
+	if i >= 0 {
+		return fmt.Errorf("segment %d meets an obstacle between %v and %v", i, from.Format(time.RFC3339), to.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// FirstActiveCrossing flies route from departure and returns the index of the first segment crossing one of constraints while it's active,
+// where it is at that time if it moves, -1 if none.
+func FirstActiveCrossing(route []*models.Waypoint, departure time.Time, flightTime utils.CostFunction, constraints []*models.Feature3D, storageType models.StorageType) (int, error) {
+	s, err := storage.NewStorage(nil, constraints, storageType)
+	if err != nil {
+		return -1, err
+	}
+	defer s.Clear()
+
+	i, _, _, err := firstBlockedSegment(route, departure, flightTime, s)
+	return i, err
+}
+
+// firstBlockedSegment flies route from departure and returns the index of the first segment meeting an obstacle of s as it is at that time,
+// -1 if none, with when that segment is flown.
+func firstBlockedSegment(route []*models.Waypoint, departure time.Time, flightTime utils.CostFunction, s storage.Storage) (int, time.Time, time.Time, error) {
+	t := departure
+	for i := 1; i < len(route); i++ {
+		arrival := t.Add(seconds(flightTime.Cost(route[i-1], route[i])))
+		blocked, _, err := s.IsLineInObstaclesAt(route[i-1], route[i], t, arrival)
+		if err != nil {
+			return -1, t, t, err
+		}
+		if blocked {
+			return i - 1, t, arrival, nil
+		}
+		t = arrival
+	}
+	return -1, t, t, nil
+}
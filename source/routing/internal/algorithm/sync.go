@@ -1,6 +1,30 @@
 package algorithm
 
-import "geopathplanner/routing/internal/models"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"geopathplanner/routing/internal/models"
+	"geopathplanner/routing/internal/storage"
+	"geopathplanner/routing/internal/utils"
+	"maps"
+	"math"
+	"runtime"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// Iterations of the sampling algorithms when parameters.max_iterations is not set
+	DEFAULT_MAX_ITERATIONS float64 = 100000.0
+	// Times a failed leg is planned again before giving up, when parameters.max_leg_retries is not set.
+	// Off by default, as the deterministic planners would only repeat the same search
+	DEFAULT_MAX_LEG_RETRIES float64 = 0.0
+	// Time every leg gets even when the deadline of the request has passed, so that the route is completed on a best-effort basis
+	MIN_LEG_TIME_BUDGET time.Duration = 50 * time.Millisecond
+)
 
 type job struct {
 	i       int
@@ -13,4 +37,320 @@ type result struct {
 	route []*models.Waypoint
 	cost  float64
 	err   error
-}
\ No newline at end of file
+}
+
+// legRunner plans the route between two consecutive waypoints using the given storage.
+// parameters are the ones of the request, departing at the estimated arrival time at start when the route is scheduled.
+type legRunner func(ctx context.Context, start, end *models.Waypoint, parameters map[string]any, storage storage.Storage) ([]*models.Waypoint, float64, error)
+
+// newLegStorage creates the storage cloned by every leg, loaded with the constraints and the cost function of parameters.cost
+func newLegStorage(constraints []*models.Feature3D, parameters map[string]any, storageType models.StorageType) (storage.Storage, error) {
+	s, err := storage.NewEmptyStorage(storageType)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.AddConstraints(constraints); err != nil {
+		return nil, err
+	}
+
+	costFunction, err := utils.NewCostFunctionFromParameters(parameters, constraints)
+	if err != nil {
+		return nil, err
+	}
+	s.SetCostFunction(costFunction)
+	return s, nil
+}
+
+// isStraightLineFree tells if start and end can be joined directly without searching: no obstacle and no soft constraint in between.
+// Lines through soft constraints are allowed, but going around them may be cheaper, so the search goes on.
+// With a clock, only the obstacles active while flying the line count.
+func isStraightLineFree(storage storage.Storage, clock *legClock, start, end *models.Waypoint) bool {
+	if blocked, _ := clock.isLineBlocked(storage, start, end); blocked {
+		return false
+	}
+	inSoftConstraint, _ := utils.LineInPolygon(start, end, storage.GetSoftConstraints()...)
+	return !inSoftConstraint
+}
+
+// computeLegs runs every pair of wps one after the other, each one on a clone of the storage loaded with the constraints.
+// When parameters have a departure time, every leg departs when the previous one is expected to arrive.
+// Every leg starts where the previous one ended, that is the point where it entered the acceptance radius of the wp, if any.
+// With a deadline, every leg gets its share of the time left, so that the first ones don't use it all.
+func computeLegs(ctx context.Context, name string, waypoints []*models.Waypoint, constraints []*models.Feature3D, parameters map[string]any, storageType models.StorageType, run legRunner) ([]*models.Waypoint, float64, error) {
+	// Check if waypoints are at least 2
+	numPairs := len(waypoints) - 1
+	if numPairs <= 0 {
+		return nil, 0.0, fmt.Errorf("less than 2 waypoints submitted (%d): abort", len(waypoints))
+	}
+
+	// Create storage and load constraint into it
+	s, err := newLegStorage(constraints, parameters, storageType)
+	if err != nil {
+		return nil, 0.0, err
+	}
+
+	// Legs of a scheduled route depart at the arrival time of the previous one
+	departure := departureTime(parameters)
+	var flightTime *utils.TimeCost
+	if !departure.IsZero() {
+		flightTime, err = newFlightTime(parameters)
+		if err != nil {
+			return nil, 0.0, err
+		}
+	}
+
+	// Start from first waypoint
+	route := []*models.Waypoint{waypoints[0]}
+	cost := 0.0
+
+	for i := 0; i < numPairs; i++ {
+		// Stop as soon as the request is cancelled, while out of time the leg is planned anyway
+		if cancelled(ctx) {
+			return route, cost, fmt.Errorf("interrupted %s before wp[%d] and wp[%d]: %w", name, i, i+1, ctx.Err())
+		}
+		legCtx, cancel := legContext(ctx, numPairs-i)
+
+		legParameters := parameters
+		if flightTime != nil {
+			legParameters = withDepartureTime(parameters, departure)
+		}
+
+		// A leg that doesn't keep to the schedule failed as well, and it's planned again
+		tmpRoute, tmpCost, err := retryLeg(legCtx, name, i, legParameters, func(parameters map[string]any) ([]*models.Waypoint, float64, error) {
+			tmpRoute, tmpCost, err := run(legCtx, route[len(route)-1], waypoints[i+1], parameters, s.Clone())
+			if err != nil || flightTime == nil {
+				return tmpRoute, tmpCost, err
+			}
+			if err := checkSchedule(tmpRoute, departure, flightTime, s); err != nil {
+				return nil, 0.0, fmt.Errorf("schedule: %w", err)
+			}
+			return tmpRoute, tmpCost, nil
+		})
+		cancel()
+		if err != nil {
+			// Return route until now
+			return route, cost, fmt.Errorf("interrupted %s for error between wp[%d] and wp[%d]: %w", name, i, i+1, err)
+		}
+		if flightTime != nil {
+			departure = departure.Add(seconds(utils.TotalCost(flightTime, tmpRoute)))
+		}
+		// Append new route but removing the first one
+		route = append(route, tmpRoute[1:]...)
+		cost += tmpCost
+	}
+
+	s.Clear()
+	return route, cost, nil
+}
+
+// computeLegsConcurrently is the concurrency version of computeLegs, where every pair of wps is processed in a separate goroutine.
+// Legs depending on the previous one are planned one after the other like computeLegs does: the ones of a scheduled route,
+// departing when the previous one arrives, and the ones after a wp with an acceptance radius, starting where the previous one entered it.
+// With a deadline, the time left is shared among the rounds of legs still to plan, as maxWorkers legs are planned at once.
+func computeLegsConcurrently(ctx context.Context, name string, waypoints []*models.Waypoint, constraints []*models.Feature3D, parameters map[string]any, storageType models.StorageType, maxWorkers int, run legRunner) ([]*models.Waypoint, float64, error) {
+	// Check if waypoints are at least 2
+	numPairs := len(waypoints) - 1
+	if numPairs <= 0 {
+		return nil, 0.0, fmt.Errorf("less than 2 waypoints submitted (%d): abort", len(waypoints))
+	}
+
+	maxCPU := runtime.NumCPU()
+	if maxWorkers <= 0 {
+		maxWorkers = min(maxCPU, numPairs)
+	} else {
+		maxWorkers = min(maxWorkers, maxCPU, numPairs)
+	}
+
+	// If just 1 worker, use the normal version. The same when legs depend on the previous one
+	if maxWorkers == 1 {
+		return computeLegs(ctx, name, waypoints, constraints, parameters, storageType, run)
+	}
+	if !departureTime(parameters).IsZero() {
+		fmt.Printf("%s: scheduled route, legs planned one after the other\n", name)
+		return computeLegs(ctx, name, waypoints, constraints, parameters, storageType, run)
+	}
+	if slices.ContainsFunc(waypoints[1:numPairs], hasAcceptanceRadius) {
+		fmt.Printf("%s: waypoints with an acceptance radius, legs planned one after the other\n", name)
+		return computeLegs(ctx, name, waypoints, constraints, parameters, storageType, run)
+	}
+
+	// Create storage and load constraint into it
+	s, err := newLegStorage(constraints, parameters, storageType)
+	if err != nil {
+		return nil, 0.0, err
+	}
+
+	// === Channels and synchronization structures ===
+	jobs := make(chan job, numPairs)       // channel for distributing work
+	results := make(chan result, numPairs) // channel to collect computed results
+	var wg sync.WaitGroup                  // ensures all workers complete before closing results
+
+	// 1. Create and start the workers, each one with its own storage
+	for w := 0; w < maxWorkers; w++ {
+		wg.Add(1)
+		go func(workerID int, s storage.Storage) {
+			defer wg.Done()
+
+			for j := range jobs {
+				if cancelled(ctx) {
+					results <- result{i: j.i, err: fmt.Errorf("worker %d: run %s: %w", workerID, name, ctx.Err())}
+					continue
+				}
+
+				// Jobs are sent in order, so the ones from j.i on are still to plan
+				legCtx, cancel := legContext(ctx, (numPairs-j.i+maxWorkers-1)/maxWorkers)
+				tmpRoute, tmpCost, err := retryLeg(legCtx, name, j.i, parameters, func(parameters map[string]any) ([]*models.Waypoint, float64, error) {
+					return run(legCtx, j.startWP, j.endWP, parameters, s)
+				})
+				cancel()
+				if err != nil {
+					results <- result{i: j.i, err: fmt.Errorf("worker %d: run %s: %w", workerID, name, err)}
+					continue
+				}
+
+				results <- result{i: j.i, route: tmpRoute, cost: tmpCost}
+			}
+		}(w, s.Clone())
+	}
+
+	// 2. Send jobs to workers
+	for i := 0; i < numPairs; i++ {
+		jobs <- job{i: i, startWP: waypoints[i], endWP: waypoints[i+1]}
+	}
+	close(jobs) // no more jobs to send
+
+	// 3. Collect results
+	go func() {
+		wg.Wait()      // wait for all workers to finish
+		close(results) // then close result channel
+	}()
+
+	// Store results in correct order
+	routeSegments := make([][]*models.Waypoint, numPairs)
+	costs := make([]float64, numPairs)
+	errs := make([]error, numPairs)
+
+	for res := range results {
+		routeSegments[res.i] = res.route
+		costs[res.i] = res.cost
+		errs[res.i] = res.err
+	}
+
+	// Like computeLegs, return the route until the first leg that failed
+	for i, err := range errs {
+		if err != nil {
+			route, cost, _ := mergeLegs(routeSegments[:i], costs[:i])
+			return route, cost, fmt.Errorf("interrupted %s for error between wp[%d] and wp[%d]: %w", name, i, i+1, err)
+		}
+	}
+
+	// 4. Merge results
+	return mergeLegs(routeSegments, costs)
+}
+
+// cancelled tells if ctx was cancelled. Once its deadline passed, the legs are still planned with MIN_LEG_TIME_BUDGET.
+func cancelled(ctx context.Context) bool {
+	return errors.Is(ctx.Err(), context.Canceled)
+}
+
+// legContext bounds a leg to its share of the time left before the deadline of ctx, split among the legsLeft legs still to plan,
+// and never less than MIN_LEG_TIME_BUDGET, even after the deadline. Cancelling ctx stops the leg all the same.
+// A leg still running at the end of its share is recorded in ctx, see WithDeadlineRecord.
+// Without a deadline, the leg runs until ctx is done.
+func legContext(ctx context.Context, legsLeft int) (context.Context, context.CancelFunc) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return context.WithCancel(ctx)
+	}
+
+	share := max(time.Until(deadline)/time.Duration(max(legsLeft, 1)), MIN_LEG_TIME_BUDGET)
+	legCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), share)
+	stop := context.AfterFunc(ctx, func() {
+		if cancelled(ctx) {
+			cancel()
+		}
+	})
+	return legCtx, func() {
+		if reached, ok := ctx.Value(deadlineRecordKey{}).(*atomic.Bool); ok && errors.Is(legCtx.Err(), context.DeadlineExceeded) {
+			reached.Store(true)
+		}
+		stop()
+		cancel()
+	}
+}
+
+type deadlineRecordKey struct{}
+
+// WithDeadlineRecord returns a copy of ctx keeping track of the legs stopped by their share of its deadline,
+// as they may be stopped before the deadline itself and the legs after them may end early.
+func WithDeadlineRecord(ctx context.Context) context.Context {
+	return context.WithValue(ctx, deadlineRecordKey{}, &atomic.Bool{})
+}
+
+// WithoutDeadlineRecord returns a copy of ctx whose legs are not recorded, for the work done after the route is computed
+func WithoutDeadlineRecord(ctx context.Context) context.Context {
+	return context.WithValue(ctx, deadlineRecordKey{}, nil)
+}
+
+// DeadlineReached tells if the deadline of ctx passed or, when ctx comes from WithDeadlineRecord, if a leg planned with it was stopped by its share.
+func DeadlineReached(ctx context.Context) bool {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return true
+	}
+	reached, ok := ctx.Value(deadlineRecordKey{}).(*atomic.Bool)
+	return ok && reached.Load()
+}
+
+func hasAcceptanceRadius(wp *models.Waypoint) bool {
+	return wp.AcceptanceRadiusMt() > 0
+}
+
+// retryLeg runs attempt for leg i and, if it fails, runs it again up to parameters.max_leg_retries times.
+// Every retry uses a new seed and doubles the iterations of the previous attempt, starting from parameters.max_iterations.
+// A cancelled or expired ctx is not retried.
+func retryLeg(ctx context.Context, name string, i int, parameters map[string]any, attempt func(parameters map[string]any) ([]*models.Waypoint, float64, error)) ([]*models.Waypoint, float64, error) {
+	maxRetries := int(utils.GetOrDefault(parameters, "max_leg_retries", DEFAULT_MAX_LEG_RETRIES))
+
+	route, cost, err := attempt(parameters)
+	retry := 1
+	for ; err != nil && retry <= maxRetries && ctx.Err() == nil; retry++ {
+		fmt.Printf("%s leg %d failed, retry %d/%d: %v\n", name, i, retry, maxRetries, err)
+		route, cost, err = attempt(retryParameters(parameters, retry))
+	}
+	if err != nil {
+		return nil, 0.0, fmt.Errorf("leg %d failed after %d retries: %w", i, retry-1, err)
+	}
+	return route, cost, nil
+}
+
+// retryParameters are parameters with the seed moved by retry and the iterations multiplied by 2^retry
+func retryParameters(parameters map[string]any, retry int) map[string]any {
+	retryParameters := maps.Clone(parameters)
+	if retryParameters == nil {
+		retryParameters = map[string]any{}
+	}
+	retryParameters["seed"] = utils.GetOrDefault(parameters, "seed", 945.0) + float64(retry)
+	retryParameters["max_iterations"] = utils.GetOrDefault(parameters, "max_iterations", DEFAULT_MAX_ITERATIONS) * math.Pow(2, float64(retry))
+	return retryParameters
+}
+
+// mergeLegs joins the routes of consecutive legs, skipping the first wp of every leg to avoid duplicates.
+func mergeLegs(routeSegments [][]*models.Waypoint, costs []float64) ([]*models.Waypoint, float64, error) {
+	finalRoute := make([]*models.Waypoint, 0)
+	totalCost := 0.0
+
+	// Start from first waypoint
+	if len(routeSegments) > 0 && len(routeSegments[0]) > 0 {
+		finalRoute = append(finalRoute, routeSegments[0][0])
+	}
+
+	for i, seg := range routeSegments {
+		if len(seg) == 0 {
+			continue
+		}
+		totalCost += costs[i]
+		finalRoute = append(finalRoute, seg[1:]...)
+	}
+
+	return finalRoute, totalCost, nil
+}
@@ -0,0 +1,110 @@
+package algorithm
+
+import (
+	"context"
+	"fmt"
+	"geopathplanner/routing/internal/models"
+	"geopathplanner/routing/internal/storage"
+	"geopathplanner/routing/internal/utils"
+	"slices"
+)
+
+// VisGraphAlgorithm builds a visibility graph between start, goal and the vertices of the constraints, and searches the shortest path on it.
+// When all constraints are full-height prisms, this is the optimal route at the altitude of the leg.
+type VisGraphAlgorithm struct {
+}
+
+func NewVisGraphAlgorithm() (*VisGraphAlgorithm, error) {
+	return &VisGraphAlgorithm{}, nil
+}
+
+// Concurrency version of Compute function, where every pair of wps is processed in a separate goroutine.
+func (a *VisGraphAlgorithm) ComputeConcurrently(ctx context.Context, searchVolume *models.Feature3D, waypoints []*models.Waypoint, constraints []*models.Feature3D, parameters map[string]any, storageType models.StorageType, maxWorkers int) ([]*models.Waypoint, float64, error) {
+	return computeLegsConcurrently(ctx, "VisGraph", waypoints, constraints, parameters, storageType, maxWorkers, func(ctx context.Context, start, end *models.Waypoint, parameters map[string]any, s storage.Storage) ([]*models.Waypoint, float64, error) {
+		return a.Run(ctx, start, end, parameters, s)
+	})
+}
+
+func (a *VisGraphAlgorithm) Compute(ctx context.Context, searchVolume *models.Feature3D, waypoints []*models.Waypoint, constraints []*models.Feature3D, parameters map[string]any, storageType models.StorageType) ([]*models.Waypoint, float64, error) {
+	return computeLegs(ctx, "VisGraph", waypoints, constraints, parameters, storageType, func(ctx context.Context, start, end *models.Waypoint, parameters map[string]any, s storage.Storage) ([]*models.Waypoint, float64, error) {
+		return a.Run(ctx, start, end, parameters, s)
+	})
+}
+
+func (a *VisGraphAlgorithm) Run(ctx context.Context, start, end *models.Waypoint, parameters map[string]any, storage storage.Storage) ([]*models.Waypoint, float64, error) {
+	// With a departure time, temporary constraints block only while active and moving ones where they are: edges are checked during the search, at the eta of the nodes
+	clock, err := newLegClock(start, parameters)
+	if err != nil {
+		return nil, 0.0, err
+	}
+
+	// First thing to do if to check if a straight line connection is possible
+	if isStraightLineFree(storage, clock, start, end) {
+		fmt.Printf("Goal immediately found: straight line collision-free\n\n")
+		return []*models.Waypoint{start, end}, storage.GetCostFunction().Cost(start, end), nil
+	}
+
+	vertex_offset_mt := a.GetParameters(parameters)
+
+	// 1. Collect nodes: start, goal and the (slightly inflated) convex vertices of every constraint at the altitude of the leg.
+	// Soft constraints can be crossed, but their vertices are needed to go around them when it's cheaper.
+	nodes := []*models.Waypoint{start, end}
+	for _, c := range slices.Concat(storage.MustGetConstraints(), storage.GetSoftConstraints()) {
+		if !start.Alt.IsWithin(c.MinAltitude, c.MaxAltitude) {
+			continue
+		}
+		for _, v := range utils.GetConvexVerticesWithOffset(c, start.Alt, vertex_offset_mt) {
+			// Vertices falling inside another constraint can't be part of the route, unless it's temporary and the route is scheduled
+			if !a.isVertexBlocked(v, clock != nil, storage) {
+				nodes = append(nodes, v)
+			}
+		}
+	}
+
+	// 2. Keep every edge that doesn't cross the obstacles, the ones through soft constraints cost more.
+	// Scheduled legs keep them all, as they are checked by the search.
+	graph := newRoadmap(storage.GetCostFunction())
+	for i := range nodes {
+		if ctx.Err() != nil {
+			return nil, 0.0, fmt.Errorf("visibility graph not completed: %w", ctx.Err())
+		}
+		graph.AddNode(nodes[i])
+		for j := i + 1; j < len(nodes); j++ {
+			if clock != nil {
+				graph.AddEdge(nodes[i], nodes[j])
+				continue
+			}
+			blocked, _, err := storage.IsLineInObstacles(nodes[i], nodes[j])
+			if err != nil {
+				return nil, 0.0, err
+			}
+			if !blocked {
+				graph.AddEdge(nodes[i], nodes[j])
+			}
+		}
+	}
+	fmt.Printf("Visibility graph built with %d nodes\n", graph.NodesLen())
+
+	// 3. Search the cheapest path
+	return graph.ShortestPath(start, end, clock, storage)
+}
+
+// isVertexBlocked tells if v is inside an obstacle. With scheduled legs only static obstacles count, as temporary or moving ones may be elsewhere when v is reached.
+func (a *VisGraphAlgorithm) isVertexBlocked(v *models.Waypoint, scheduled bool, storage storage.Storage) bool {
+	if !scheduled {
+		inside, _, _ := storage.IsPointInObstacles(v)
+		return inside
+	}
+	obstacles, _ := storage.GetAllObstaclesContainingPoint(v)
+	return slices.ContainsFunc(obstacles, func(c *models.Feature3D) bool { return !c.IsTimeDependent() })
+}
+
+func (a *VisGraphAlgorithm) GetParameters(parameters map[string]any) float64 {
+	VERTEX_OFFSET_MT := utils.GetOrDefault(parameters, "vertex_offset_mt", 1.0)
+
+	fmt.Printf("PARAMETERS\n")
+	fmt.Printf("vertex_offset_mt: %f\n", VERTEX_OFFSET_MT)
+	fmt.Printf("--------------------------------------------------------\n")
+
+	return VERTEX_OFFSET_MT
+}
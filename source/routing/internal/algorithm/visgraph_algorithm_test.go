@@ -0,0 +1,305 @@
+package algorithm_test
+
+import (
+	"context"
+	"geopathplanner/routing/internal/algorithm"
+	"geopathplanner/routing/internal/models"
+	"geopathplanner/routing/internal/storage"
+	"geopathplanner/routing/internal/utils"
+	"math"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestVisGraphAlgorithm_run(t *testing.T) {
+	_, w_list, c_list, c_overlapping := utils.SetupTestScenario()
+	w1 := w_list[0]
+	w2 := w_list[1]
+
+	tests := []struct {
+		name        string // description of this test case
+		storageType models.StorageType
+		// Named input parameters for target function.
+		start       *models.Waypoint
+		end         *models.Waypoint
+		constraints []*models.Feature3D
+		wantErr     bool
+	}{
+		{name: "VisGraph with non-overlapping obstacles - RTREE", storageType: models.RTree, start: w1, end: w2, constraints: c_list, wantErr: false},
+		{name: "VisGraph with overlapping obstacles - RTREE", storageType: models.RTree, start: w1, end: w2, constraints: append(c_list, c_overlapping...), wantErr: false},
+		{name: "VisGraph with overlapping obstacles - LIST", storageType: models.List, start: w1, end: w2, constraints: append(c_list, c_overlapping...), wantErr: false},
+		{name: "VisGraph with no obstacles - RTREE", storageType: models.RTree, start: w1, end: w2, constraints: []*models.Feature3D{}, wantErr: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := algorithm.NewVisGraphAlgorithm()
+			if err != nil {
+				t.Fatalf("could not construct receiver type: %v", err)
+			}
+
+			s, err := storage.NewEmptyStorage(tt.storageType)
+			if err != nil {
+				t.Fatalf("could not construct storage: %v", err)
+			}
+			s.AddConstraints(tt.constraints)
+
+			got, gotCost, gotErr := a.Run(context.Background(), tt.start, tt.end, nil, s)
+
+			// TODO: For visually testing, export results in geojson
+			utils.MarkWaypointsAsOriginal(tt.start, tt.end)
+			utils.ExportToGeoJSONRoute("algorithm", got, tt.constraints, nil, tt.name, true)
+
+			if gotErr != nil {
+				if !tt.wantErr {
+					t.Errorf("Run() failed: %v", gotErr)
+				}
+				return
+			}
+			if tt.wantErr {
+				t.Fatal("Run() succeeded unexpectedly")
+			}
+
+			for i := 0; i < len(got)-1; i++ {
+				if blocked, _, _ := s.IsLineInObstacles(got[i], got[i+1]); blocked {
+					t.Errorf("Run() route segment %d crosses an obstacle", i)
+				}
+			}
+
+			// Being the optimum, it can't be longer than the route found by the other deterministic planner
+			antpath, _ := algorithm.NewAntPathAlgorithm()
+			_, antpathCost, err := antpath.Run(tt.start, tt.end, nil, s)
+			if err == nil && gotCost > antpathCost {
+				t.Errorf("Run() cost %.3f mt is greater than AntPath cost %.3f mt", gotCost, antpathCost)
+			}
+		})
+	}
+}
+
+func TestVisGraphAlgorithm_multiPolygon(t *testing.T) {
+	a, _ := models.NewAltitude(100, models.MT)
+	start, end := models.MustNewWaypoint(0, 50.0, 3.9985, a), models.MustNewWaypoint(1, 50.0, 4.0045, a)
+	// Two squares in one constraint, the first one on the straight line
+	constraints := []*models.Feature3D{
+		models.MustNewFeatureFromGeojson(`{"type": "Feature", "properties": {}, "geometry": {"type": "MultiPolygon", "coordinates": [
+			[[[4.0, 49.999], [4.002, 49.999], [4.002, 50.001], [4.0, 50.001], [4.0, 49.999]]],
+			[[[4.003, 50.002], [4.004, 50.002], [4.004, 50.003], [4.003, 50.003], [4.003, 50.002]]]
+		]}}`),
+	}
+
+	tests := []struct {
+		name        string // description of this test case
+		storageType models.StorageType
+	}{
+		{name: "VisGraph around a MultiPolygon - RTREE", storageType: models.RTree},
+		{name: "VisGraph around a MultiPolygon - LIST", storageType: models.List},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := algorithm.NewVisGraphAlgorithm()
+			if err != nil {
+				t.Fatalf("could not construct receiver type: %v", err)
+			}
+			s, err := storage.NewEmptyStorage(tt.storageType)
+			if err != nil {
+				t.Fatalf("could not construct storage: %v", err)
+			}
+			s.AddConstraints(constraints)
+
+			got, _, gotErr := a.Run(context.Background(), start, end, nil, s)
+			if gotErr != nil {
+				t.Fatalf("Run() failed: %v", gotErr)
+			}
+
+			utils.MarkWaypointsAsOriginal(start, end)
+			utils.ExportToGeoJSONRoute("algorithm", got, constraints, nil, tt.name, true)
+
+			// The vertices of every polygon are in the graph, so the route bends around the one in the way
+			if len(got) < 3 {
+				t.Errorf("Run() route has %d wps, want it to go around the constraint", len(got))
+			}
+			for i := 0; i < len(got)-1; i++ {
+				if blocked, _, _ := s.IsLineInObstacles(got[i], got[i+1]); blocked {
+					t.Errorf("Run() route segment %d crosses an obstacle", i)
+				}
+			}
+		})
+	}
+}
+
+func TestVisGraphAlgorithm_softConstraints(t *testing.T) {
+	a, _ := models.NewAltitude(100, models.MT)
+	// Soft square of ~143x222 mt in the middle of a straight leg of ~430 mt: going around it is ~75 mt longer
+	start, end := models.MustNewWaypoint(0, 50.0, 3.9985, a), models.MustNewWaypoint(1, 50.0, 4.0045, a)
+	softConstraint := func(multiplier string) *models.Feature3D {
+		return models.MustNewFeatureFromGeojson(`{"type": "Feature", "properties": {"constraint_type": "soft", "cost_multiplier": ` + multiplier + `}, "geometry": {"type": "Polygon", "coordinates": [[[4.0, 49.999], [4.002, 49.999], [4.002, 50.001], [4.0, 50.001], [4.0, 49.999]]]}}`)
+	}
+
+	tests := []struct {
+		name        string // description of this test case
+		storageType models.StorageType
+		constraint  *models.Feature3D
+		wantCrossed bool
+	}{
+		{name: "VisGraph crossing a cheap soft constraint - RTREE", storageType: models.RTree, constraint: softConstraint("1.2"), wantCrossed: true},
+		{name: "VisGraph going around an expensive soft constraint - RTREE", storageType: models.RTree, constraint: softConstraint("5"), wantCrossed: false},
+		{name: "VisGraph going around an expensive soft constraint - LIST", storageType: models.List, constraint: softConstraint("5"), wantCrossed: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := algorithm.NewVisGraphAlgorithm()
+			if err != nil {
+				t.Fatalf("could not construct receiver type: %v", err)
+			}
+
+			constraints := []*models.Feature3D{tt.constraint}
+			got, gotCost, gotErr := a.Compute(context.Background(), nil, []*models.Waypoint{start, end}, constraints, nil, tt.storageType)
+			if gotErr != nil {
+				t.Fatalf("Compute() failed: %v", gotErr)
+			}
+
+			utils.MarkWaypointsAsOriginal(start, end)
+			utils.ExportToGeoJSONRoute("algorithm", got, constraints, nil, tt.name, true)
+
+			crossed := false
+			for i := 0; i < len(got)-1; i++ {
+				if inside, _ := utils.LineInPolygon(got[i], got[i+1], tt.constraint); inside {
+					crossed = true
+				}
+			}
+			if crossed != tt.wantCrossed {
+				t.Errorf("Compute() crossed the soft constraint: %t, want %t", crossed, tt.wantCrossed)
+			}
+
+			// Cost is the one of the cost function, which makes the route cheaper than the straight line when going around
+			costFunction, _ := utils.NewCostFunctionFromParameters(nil, constraints)
+			if want := utils.TotalCost(costFunction, got); math.Abs(gotCost-want) > 1e-6 {
+				t.Errorf("Compute() cost = %.3f, want the cost of its route %.3f", gotCost, want)
+			}
+			if straight := costFunction.Cost(start, end); gotCost > straight+1e-6 {
+				t.Errorf("Compute() cost = %.3f, more than the straight line %.3f", gotCost, straight)
+			}
+		})
+	}
+}
+
+func TestVisGraphAlgorithm_windField(t *testing.T) {
+	a, _ := models.NewAltitude(100, models.MT)
+	// Obstacle between start and goal, going around its south side is ~45 mt shorter than around the north one
+	start, end := models.MustNewWaypoint(0, 50.0, 3.9985, a), models.MustNewWaypoint(1, 50.0, 4.0045, a)
+	constraints := []*models.Feature3D{
+		models.MustNewFeatureFromGeojson(`{"type": "Feature", "properties": {}, "geometry": {"type": "Polygon", "coordinates": [[[4.0, 49.9992], [4.002, 49.9992], [4.002, 50.0012], [4.0, 50.0012], [4.0, 49.9992]]]}}`),
+	}
+	// 10 m/s headwind south of the leg, calm north of it
+	u := make([][]float64, 11)
+	v := make([][]float64, 11)
+	for i := range u {
+		u[i], v[i] = []float64{0, 0}, []float64{0, 0}
+		if i < 5 {
+			u[i] = []float64{-10, -10}
+		}
+	}
+	wind := &models.WindField{MinLat: 49.995, MinLon: 3.99, LatStep: 0.001, LonStep: 0.02, U: [][][]float64{u}, V: [][][]float64{v}}
+
+	visGraph, err := algorithm.NewVisGraphAlgorithm()
+	if err != nil {
+		t.Fatalf("could not construct receiver type: %v", err)
+	}
+	waypoints := []*models.Waypoint{start, end}
+	shortest, _, err := visGraph.Compute(context.Background(), nil, waypoints, constraints, nil, models.RTree)
+	if err != nil {
+		t.Fatalf("Compute() with distance cost failed: %v", err)
+	}
+	parameters := map[string]any{"cost": "time", "airspeed_ms": 15.0, models.WIND_FIELD_PARAMETER: wind}
+	fastest, fastestTime, err := visGraph.Compute(context.Background(), nil, waypoints, constraints, parameters, models.RTree)
+	if err != nil {
+		t.Fatalf("Compute() with time cost failed: %v", err)
+	}
+
+	utils.MarkWaypointsAsOriginal(waypoints...)
+	utils.ExportToGeoJSONRoute("algorithm", fastest, constraints, nil, "VisGraph with time cost and wind - RTREE", true)
+
+	timeCost, err := utils.NewTimeCostFromParameters(parameters)
+	if err != nil {
+		t.Fatalf("could not construct cost function: %v", err)
+	}
+	shortestTime := utils.TotalCost(timeCost, shortest)
+	t.Logf("distance cost: %.3f mt, %.3f s; time cost: %.3f mt, %.3f s", utils.TotalHaversineDistance(shortest), shortestTime, utils.TotalHaversineDistance(fastest), fastestTime)
+
+	// The shortest route goes south, into the headwind, the fastest one north
+	south := func(route []*models.Waypoint) bool {
+		return slices.ContainsFunc(route, func(w *models.Waypoint) bool { return w.Lat < 50.0 })
+	}
+	if !south(shortest) || south(fastest) {
+		t.Errorf("shortest route goes south: %t, fastest one: %t, want true and false", south(shortest), south(fastest))
+	}
+	if math.Abs(utils.TotalCost(timeCost, fastest)-fastestTime) > 1e-6 {
+		t.Errorf("Compute() cost = %.3f, want the flight time of its route %.3f", fastestTime, utils.TotalCost(timeCost, fastest))
+	}
+	if fastestTime >= shortestTime {
+		t.Errorf("fastest route takes %.3f s, not less than the shortest one %.3f s", fastestTime, shortestTime)
+	}
+}
+
+func TestVisGraphAlgorithm_temporaryConstraints(t *testing.T) {
+	a, _ := models.NewAltitude(100, models.MT)
+	// Straight leg of ~430 mt (~29 s at 15 m/s) through the middle of a zone closed from 10:00 to 11:00
+	start, end := models.MustNewWaypoint(0, 50.0, 3.9985, a), models.MustNewWaypoint(1, 50.0, 4.0045, a)
+	constraints := []*models.Feature3D{
+		models.MustNewFeatureFromGeojson(`{"type": "Feature", "properties": {"active_from": "2026-10-17T10:00:00Z", "active_until": "2026-10-17T11:00:00Z"}, "geometry": {"type": "Polygon", "coordinates": [[[4.0, 49.999], [4.002, 49.999], [4.002, 50.001], [4.0, 50.001], [4.0, 49.999]]]}}`),
+	}
+
+	tests := []struct {
+		name         string // description of this test case
+		storageType  models.StorageType
+		departure    string
+		wantStraight bool
+	}{
+		{name: "VisGraph departing before the closure - RTREE", storageType: models.RTree, departure: "2026-10-17T09:00:00Z", wantStraight: true},
+		{name: "VisGraph departing during the closure - RTREE", storageType: models.RTree, departure: "2026-10-17T10:30:00Z", wantStraight: false},
+		{name: "VisGraph reaching the zone when it closes - LIST", storageType: models.List, departure: "2026-10-17T09:59:55Z", wantStraight: false},
+		{name: "VisGraph leaving the zone before it closes - LIST", storageType: models.List, departure: "2026-10-17T09:59:30Z", wantStraight: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			visGraph, err := algorithm.NewVisGraphAlgorithm()
+			if err != nil {
+				t.Fatalf("could not construct receiver type: %v", err)
+			}
+
+			departure, _ := time.Parse(time.RFC3339, tt.departure)
+			parameters := map[string]any{models.DEPARTURE_TIME_PARAMETER: departure}
+			got, _, gotErr := visGraph.Compute(context.Background(), nil, []*models.Waypoint{start, end}, constraints, parameters, tt.storageType)
+			if gotErr != nil {
+				t.Fatalf("Compute() failed: %v", gotErr)
+			}
+
+			utils.MarkWaypointsAsOriginal(start, end)
+			utils.ExportToGeoJSONRoute("algorithm", got, constraints, nil, tt.name, true)
+
+			if straight := len(got) == 2; straight != tt.wantStraight {
+				t.Errorf("Compute() = %v, straight line: %t, want %t", got, straight, tt.wantStraight)
+			}
+			assertScheduleFree(t, got, departure, constraints)
+		})
+	}
+}
+
+// assertScheduleFree flies route from departure at the default airspeed and checks that no segment crosses a constraint while active
+func assertScheduleFree(t *testing.T, route []*models.Waypoint, departure time.Time, constraints []*models.Feature3D) {
+	t.Helper()
+	flightTime, _ := utils.NewTimeCost(utils.DEFAULT_AIRSPEED_MS, nil)
+	s, err := storage.NewStorage(nil, constraints, models.List)
+	if err != nil {
+		t.Fatalf("could not construct storage: %v", err)
+	}
+
+	eta := departure
+	for i := 0; i < len(route)-1; i++ {
+		arrival := eta.Add(time.Duration(flightTime.Cost(route[i], route[i+1]) * float64(time.Second)))
+		if blocked, _, _ := s.IsLineInObstaclesAt(route[i], route[i+1], eta, arrival); blocked {
+			t.Errorf("route segment %d crosses an active constraint between %v and %v", i, eta, arrival)
+		}
+		eta = arrival
+	}
+}
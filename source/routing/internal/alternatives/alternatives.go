@@ -0,0 +1,188 @@
+package alternatives
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"geopathplanner/routing/internal/algorithm"
+	"geopathplanner/routing/internal/models"
+	"geopathplanner/routing/internal/utils"
+	"maps"
+	"math"
+	"slices"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+)
+
+const (
+	// Routes are compared and measured on points this far apart
+	METRICS_STEP_MT float64 = 10.0
+	// Detours are slightly larger than the min distance, so that the new route is far enough even with the resampling error
+	DETOUR_MARGIN float64 = 1.1
+)
+
+// Where detours are put along the routes already found, changing at every attempt
+var DETOUR_FRACTIONS = []float64{0.5, 0.25, 0.75, 0.375, 0.625}
+
+// Refine is applied to every alternative before comparing it, e.g. the post-processing pipeline.
+type Refine func(ctx context.Context, route []*models.Waypoint) ([]*models.Waypoint, error)
+
+// Generator looks for routes that differ from the best one by at least MinDistanceMt (Hausdorff distance), so operators can pick between them.
+// Every attempt plans again with a different seed and with a detour around a point of each route already found, so deterministic algorithms change route too.
+type Generator struct {
+	NumAlternatives int
+	MinDistanceMt   float64
+	MaxAttempts     int
+}
+
+// NewGeneratorFromParameters reads parameters.num_alternatives (routes in the response, the best one included), alternatives_min_distance_mt and alternatives_max_attempts.
+// Returns nil if less than 2 routes were requested.
+func NewGeneratorFromParameters(parameters map[string]any) (*Generator, error) {
+	NUM_ALTERNATIVES := int(utils.GetOrDefault(parameters, "num_alternatives", 1.0))
+	if NUM_ALTERNATIVES < 2 {
+		return nil, nil
+	}
+	MIN_DISTANCE_MT := utils.GetOrDefault(parameters, "alternatives_min_distance_mt", 100.0)
+	MAX_ATTEMPTS := int(utils.GetOrDefault(parameters, "alternatives_max_attempts", float64(2*NUM_ALTERNATIVES)))
+
+	if MIN_DISTANCE_MT <= 0 {
+		return nil, fmt.Errorf("alternatives_min_distance_mt must be positive, got %f", MIN_DISTANCE_MT)
+	}
+
+	fmt.Printf("ALTERNATIVES\n")
+	fmt.Printf("num_alternatives: %d\n", NUM_ALTERNATIVES)
+	fmt.Printf("alternatives_min_distance_mt: %f\n", MIN_DISTANCE_MT)
+	fmt.Printf("alternatives_max_attempts: %d\n", MAX_ATTEMPTS)
+	fmt.Printf("--------------------------------------------------------\n")
+
+	return &Generator{NumAlternatives: NUM_ALTERNATIVES, MinDistanceMt: MIN_DISTANCE_MT, MaxAttempts: MAX_ATTEMPTS}, nil
+}
+
+// Generate returns best first, then up to NumAlternatives-1 routes through the same waypoints, in increasing cost.
+// Attempts that fail or end too close to a route already found are discarded, so fewer routes may be returned.
+// Costs are measured with costFunction, the one the algorithm minimizes.
+func (g *Generator) Generate(ctx context.Context, algo algorithm.Algorithm, searchVolume *models.Feature3D, waypoints []*models.Waypoint, constraints []*models.Feature3D, parameters map[string]any, storageType models.StorageType, best []*models.Waypoint, costFunction utils.CostFunction, refine Refine) []*models.RouteAlternative {
+	found := [][]*models.Waypoint{best}
+	baseSeed := utils.GetOrDefault(parameters, "seed", 945.0)
+
+	for attempt := 1; attempt <= g.MaxAttempts && len(found) < g.NumAlternatives; attempt++ {
+		if ctx.Err() != nil {
+			fmt.Printf("Alternatives stopped: %v\n", ctx.Err())
+			break
+		}
+
+		// Same request with another seed, going around the routes already found
+		attemptParameters := maps.Clone(parameters)
+		if attemptParameters == nil {
+			attemptParameters = map[string]any{}
+		}
+		attemptParameters["seed"] = baseSeed + float64(attempt)
+		fraction := DETOUR_FRACTIONS[(attempt-1)%len(DETOUR_FRACTIONS)]
+		attemptConstraints := slices.Clone(constraints)
+		for _, route := range found {
+			if detour := g.detour(route, waypoints, fraction); detour != nil {
+				attemptConstraints = append(attemptConstraints, detour)
+			}
+		}
+
+		route, _, err := algo.ComputeConcurrently(ctx, searchVolume, waypoints, attemptConstraints, attemptParameters, storageType, 0)
+		if err != nil {
+			fmt.Printf("Alternative attempt %d/%d failed: %v\n", attempt, g.MaxAttempts, err)
+			continue
+		}
+		if refine != nil {
+			if route, err = refine(ctx, route); err != nil {
+				fmt.Printf("Alternative attempt %d/%d failed: %v\n", attempt, g.MaxAttempts, err)
+				continue
+			}
+		}
+
+		if g.isDiverse(route, found) {
+			fmt.Printf("Alternative attempt %d/%d: route %d found\n", attempt, g.MaxAttempts, len(found))
+			found = append(found, route)
+		} else {
+			fmt.Printf("Alternative attempt %d/%d: too close to a route already found\n", attempt, g.MaxAttempts)
+		}
+	}
+
+	alternatives := make([]*models.RouteAlternative, 0, len(found))
+	for _, route := range found {
+		alternatives = append(alternatives, newRouteAlternative(route, best, constraints, costFunction))
+	}
+	slices.SortStableFunc(alternatives[1:], func(a1, a2 *models.RouteAlternative) int {
+		return cmp.Compare(a1.CostKm, a2.CostKm)
+	})
+	return alternatives
+}
+
+// isDiverse tells if route is at least MinDistanceMt from every route in found
+func (g *Generator) isDiverse(route []*models.Waypoint, found [][]*models.Waypoint) bool {
+	for _, other := range found {
+		if utils.HausdorffDistance(route, other, METRICS_STEP_MT) < g.MinDistanceMt {
+			return false
+		}
+	}
+	return true
+}
+
+// detour returns a square constraint centered on the point of route at fraction of its length, large enough that a route around it is MinDistanceMt away from that point.
+// Returns nil if the square would cover one of the waypoints.
+func (g *Generator) detour(route []*models.Waypoint, waypoints []*models.Waypoint, fraction float64) *models.Feature3D {
+	center := pointAtFraction(route, fraction)
+	if center == nil {
+		return nil
+	}
+
+	halfSideMt := g.MinDistanceMt * DETOUR_MARGIN
+	for _, wp := range waypoints {
+		if utils.HaversineDistance3D(wp, center) <= halfSideMt*math.Sqrt2 {
+			return nil
+		}
+	}
+
+	dLat := halfSideMt / models.METERS_PER_DEGREE
+	dLon := halfSideMt / (models.METERS_PER_DEGREE * math.Cos(center.Lat*math.Pi/180))
+	square := orb.Polygon{orb.Ring{
+		{center.Lon - dLon, center.Lat - dLat},
+		{center.Lon + dLon, center.Lat - dLat},
+		{center.Lon + dLon, center.Lat + dLat},
+		{center.Lon - dLon, center.Lat + dLat},
+		{center.Lon - dLon, center.Lat - dLat},
+	}}
+
+	c, err := models.NewFeatureFromGeojsonFeature(geojson.NewFeature(square))
+	if err != nil {
+		return nil
+	}
+	return c
+}
+
+// pointAtFraction returns the point of route at fraction of its length
+func pointAtFraction(route []*models.Waypoint, fraction float64) *models.Waypoint {
+	target := utils.TotalHaversineDistance(route) * fraction
+	for i := 1; i < len(route); i++ {
+		d := utils.HaversineDistance3D(route[i-1], route[i])
+		if d >= target && d > 0 {
+			return utils.GetPointInDirectionAtDistance(route[i-1], route[i], target)
+		}
+		target -= d
+	}
+	return nil
+}
+
+func newRouteAlternative(route, best []*models.Waypoint, constraints []*models.Feature3D, costFunction utils.CostFunction) *models.RouteAlternative {
+	// Soft constraints can be crossed, the clearance is from obstacles only
+	hard, _ := models.SplitConstraints(constraints)
+	clearance := utils.RouteClearance(route, hard, METRICS_STEP_MT)
+	if math.IsInf(clearance, 1) {
+		clearance = -1
+	}
+
+	return &models.RouteAlternative{
+		Route:              route,
+		CostKm:             utils.TotalCost(costFunction, route),
+		DistanceFromBestMt: utils.HausdorffDistance(route, best, METRICS_STEP_MT),
+		MinClearanceMt:     clearance,
+	}
+}
@@ -0,0 +1,94 @@
+package alternatives_test
+
+import (
+	"context"
+	"geopathplanner/routing/internal/algorithm"
+	"geopathplanner/routing/internal/alternatives"
+	"geopathplanner/routing/internal/models"
+	"geopathplanner/routing/internal/storage"
+	"geopathplanner/routing/internal/utils"
+	"slices"
+	"testing"
+)
+
+func TestGenerator_Generate(t *testing.T) {
+	sv, w_list, c_list, c_overlapping := utils.SetupTestScenario()
+
+	tests := []struct {
+		name        string // description of this test case
+		storageType models.StorageType
+		algorithm   models.AlgorithmType
+		// Named input parameters for target function.
+		searchVolume *models.Feature3D
+		waypoints    []*models.Waypoint
+		constraints  []*models.Feature3D
+		parameters   map[string]any
+	}{
+		{name: "VisGraph with non-overlapping obstacles - RTREE", storageType: models.RTree, algorithm: models.VisGraph, searchVolume: sv, waypoints: w_list[:2], constraints: c_list, parameters: map[string]any{"num_alternatives": 3.0, "alternatives_min_distance_mt": 100.0}},
+		{name: "VisGraph with overlapping obstacles - LIST", storageType: models.List, algorithm: models.VisGraph, searchVolume: sv, waypoints: w_list, constraints: append(c_list, c_overlapping...), parameters: map[string]any{"num_alternatives": 2.0, "alternatives_min_distance_mt": 150.0}},
+		{name: "RRT with non-overlapping obstacles - RTREE", storageType: models.RTree, algorithm: models.RRT, searchVolume: sv, waypoints: w_list[:2], constraints: c_list, parameters: map[string]any{"num_alternatives": 3.0, "alternatives_min_distance_mt": 100.0, "max_iterations": 20000.0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := alternatives.NewGeneratorFromParameters(tt.parameters)
+			if err != nil || g == nil {
+				t.Fatalf("could not construct generator: %v", err)
+			}
+			a, err := algorithm.NewAlgorithm(tt.algorithm)
+			if err != nil {
+				t.Fatalf("could not construct algorithm: %v", err)
+			}
+
+			best, _, err := a.Compute(context.Background(), tt.searchVolume, tt.waypoints, tt.constraints, tt.parameters, tt.storageType)
+			if err != nil {
+				t.Fatalf("Compute() failed: %v", err)
+			}
+
+			got := g.Generate(context.Background(), a, tt.searchVolume, tt.waypoints, tt.constraints, tt.parameters, tt.storageType, best, utils.DistanceCost{}, nil)
+
+			utils.MarkWaypointsAsOriginal(tt.waypoints...)
+			for i, alt := range got {
+				t.Logf("route %d: cost %.3f mt, distance from best %.3f mt, clearance %.3f mt, %d wps", i, alt.CostKm, alt.DistanceFromBestMt, alt.MinClearanceMt, len(alt.Route))
+				utils.ExportToGeoJSONRoute("alternatives", alt.Route, tt.constraints, tt.searchVolume, tt.name+" "+string(rune('A'+i)), true)
+			}
+
+			if len(got) < 2 || len(got) > g.NumAlternatives {
+				t.Fatalf("Generate() returned %d routes, want 2 to %d", len(got), g.NumAlternatives)
+			}
+			if got[0].DistanceFromBestMt != 0 || !slices.Equal(got[0].Route, best) {
+				t.Errorf("Generate() first route is not the best one")
+			}
+
+			s, err := storage.NewEmptyStorage(tt.storageType)
+			if err != nil {
+				t.Fatalf("could not construct storage: %v", err)
+			}
+			s.AddConstraints(tt.constraints)
+
+			for i, alt := range got {
+				if alt.Route[0] != tt.waypoints[0] || alt.Route[len(alt.Route)-1] != tt.waypoints[len(tt.waypoints)-1] {
+					t.Errorf("route %d doesn't go from the first to the last waypoint", i)
+				}
+				// Alternatives come after the best route, in increasing cost
+				if i > 1 && got[i-1].CostKm > alt.CostKm {
+					t.Errorf("route %d is cheaper than route %d", i, i-1)
+				}
+				if alt.MinClearanceMt < 0 {
+					t.Errorf("route %d has clearance %.3f mt, want >= 0", i, alt.MinClearanceMt)
+				}
+				for k := 1; k < len(alt.Route); k++ {
+					if inObstacle, _, _ := s.IsLineInObstacles(alt.Route[k-1], alt.Route[k]); inObstacle {
+						t.Errorf("route %d crosses a constraint between wp %d and %d", i, k-1, k)
+					}
+				}
+
+				// Every pair of routes is far enough apart
+				for j := range i {
+					if d := utils.HausdorffDistance(alt.Route, got[j].Route, alternatives.METRICS_STEP_MT); d < g.MinDistanceMt {
+						t.Errorf("routes %d and %d are %.3f mt apart, want >= %.3f", j, i, d, g.MinDistanceMt)
+					}
+				}
+			}
+		})
+	}
+}
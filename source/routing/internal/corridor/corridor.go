@@ -0,0 +1,289 @@
+package corridor
+
+import (
+	"fmt"
+	"geopathplanner/routing/internal/models"
+	"geopathplanner/routing/internal/utils"
+	"maps"
+	"math"
+
+	"github.com/engelsjk/polygol"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+)
+
+const (
+	// Half-widths used when parameters.corridor doesn't set them
+	DEFAULT_LATERAL_HALF_WIDTH_MT  float64 = 25.0
+	DEFAULT_VERTICAL_HALF_WIDTH_MT float64 = 10.0
+	// Obstacles are grown a bit more than the half-widths, so that the corridor stays clear despite the rounding of the collision checks
+	INFLATION_MARGIN_MT float64 = 1.0
+	// Points of every half circle around the ends of a segment
+	ARC_POINTS int = 8
+)
+
+// Builder turns a route into its corridor: the volume within LateralHalfWidthMt horizontally and VerticalHalfWidthMt vertically of every segment.
+// Routes planned among the obstacles grown by Inflate have a corridor clear of the constraints, as checked by Conflicts.
+type Builder struct {
+	LateralHalfWidthMt  float64
+	VerticalHalfWidthMt float64
+}
+
+// NewBuilderFromParameters reads parameters.corridor:
+//
+//	"corridor": {
+//		"lateral_half_width_mt": 25,
+//		"vertical_half_width_mt": 10
+//	}
+//
+// Returns nil if parameters.corridor is not set, so no corridor is built.
+func NewBuilderFromParameters(parameters map[string]any) (*Builder, error) {
+	var config map[string]any
+	switch v := parameters["corridor"].(type) {
+	case nil:
+		return nil, nil
+	case map[string]any:
+		config = v
+	default:
+		return nil, fmt.Errorf("corridor must be an object, got %T", v)
+	}
+
+	b := &Builder{
+		LateralHalfWidthMt:  utils.GetOrDefault(config, "lateral_half_width_mt", DEFAULT_LATERAL_HALF_WIDTH_MT),
+		VerticalHalfWidthMt: utils.GetOrDefault(config, "vertical_half_width_mt", DEFAULT_VERTICAL_HALF_WIDTH_MT),
+	}
+	if b.LateralHalfWidthMt <= 0 {
+		return nil, fmt.Errorf("corridor.lateral_half_width_mt must be positive, got %f", b.LateralHalfWidthMt)
+	}
+	if b.VerticalHalfWidthMt < 0 {
+		return nil, fmt.Errorf("corridor.vertical_half_width_mt can't be negative, got %f", b.VerticalHalfWidthMt)
+	}
+
+	fmt.Printf("CORRIDOR\n")
+	fmt.Printf("lateral_half_width_mt: %f\n", b.LateralHalfWidthMt)
+	fmt.Printf("vertical_half_width_mt: %f\n", b.VerticalHalfWidthMt)
+	fmt.Printf("--------------------------------------------------------\n")
+
+	return b, nil
+}
+
+// Build returns the corridor of route as a single Feature3D: the union of the buffers of its segments,
+// from the lowest altitude of the route minus VerticalHalfWidthMt to the highest one plus VerticalHalfWidthMt.
+// The half-widths are written in its properties.
+func (b *Builder) Build(route []*models.Waypoint) (*models.Feature3D, error) {
+	if len(route) < 2 {
+		return nil, fmt.Errorf("corridor needs a route of at least 2 wps, got %d", len(route))
+	}
+
+	f := newFrame(route[0].Point2D())
+	buffers := make([]polygol.Geom, 0, len(route)-1)
+	minAlt, maxAlt := math.Inf(1), math.Inf(-1)
+	for i := 1; i < len(route); i++ {
+		buffers = append(buffers, f.capsule(route[i-1].Point2D(), route[i].Point2D(), b.LateralHalfWidthMt))
+	}
+	for _, wp := range route {
+		minAlt = math.Min(minAlt, wp.Alt.Normalize().Value)
+		maxAlt = math.Max(maxAlt, wp.Alt.Normalize().Value)
+	}
+
+	geometry, err := union(buffers)
+	if err != nil {
+		return nil, fmt.Errorf("corridor not built: %w", err)
+	}
+	corridor, err := models.NewFeatureFromGeojsonFeature(geojson.NewFeature(geometry))
+	if err != nil {
+		return nil, err
+	}
+	if err := corridor.SetAltitude(models.MustNewAltitude(minAlt-b.VerticalHalfWidthMt, models.MT), models.MustNewAltitude(maxAlt+b.VerticalHalfWidthMt, models.MT)); err != nil {
+		return nil, err
+	}
+	corridor.Properties["lateral_half_width_mt"] = b.LateralHalfWidthMt
+	corridor.Properties["vertical_half_width_mt"] = b.VerticalHalfWidthMt
+	return corridor, nil
+}
+
+// Inflate returns the constraints with every obstacle grown by the half-widths, and a little more, both horizontally and vertically.
+// Soft constraints are kept as they are, as routes can cross them. The other properties of the obstacles, e.g. their time window, are kept.
+func (b *Builder) Inflate(constraints []*models.Feature3D) ([]*models.Feature3D, error) {
+	inflated := make([]*models.Feature3D, 0, len(constraints))
+	for _, c := range constraints {
+		if c.IsSoft() {
+			inflated = append(inflated, c)
+			continue
+		}
+
+		polygons := c.ToPolygol()
+		if len(polygons) == 0 || len(polygons[0]) == 0 || len(polygons[0][0]) == 0 {
+			return nil, fmt.Errorf("constraint %v can't be inflated: not a polygon", c.ID)
+		}
+		f := newFrame(orb.Point{polygons[0][0][0][0], polygons[0][0][0][1]})
+		buffers := []polygol.Geom{polygons}
+		for _, polygon := range polygons {
+			ring := polygon[0]
+			for i := 1; i < len(ring); i++ {
+				buffers = append(buffers, f.capsule(orb.Point{ring[i-1][0], ring[i-1][1]}, orb.Point{ring[i][0], ring[i][1]}, b.LateralHalfWidthMt+INFLATION_MARGIN_MT))
+			}
+		}
+
+		geometry, err := union(buffers)
+		if err != nil {
+			return nil, fmt.Errorf("constraint %v can't be inflated: %w", c.ID, err)
+		}
+		feature := geojson.NewFeature(geometry)
+		feature.ID = c.ID
+		feature.Properties = maps.Clone(c.Properties)
+		obstacle, err := models.NewFeatureFromGeojsonFeature(feature)
+		if err != nil {
+			return nil, err
+		}
+		margin := b.VerticalHalfWidthMt + INFLATION_MARGIN_MT
+		if err := obstacle.SetAltitude(models.MustNewAltitude(c.MinAltitude.Normalize().Value-margin, models.MT), models.MustNewAltitude(c.MaxAltitude.Normalize().Value+margin, models.MT)); err != nil {
+			return nil, err
+		}
+		inflated = append(inflated, obstacle)
+	}
+	return inflated, nil
+}
+
+// Conflicts returns the obstacles closer to a segment of route than the half-widths, that is the ones the corridor meets.
+// Soft constraints don't count, and neither do temporary and moving ones, which may be somewhere else when the route is flown:
+// the planners keep the centreline clear of their inflated shapes while they are there.
+func (b *Builder) Conflicts(route []*models.Waypoint, constraints []*models.Feature3D) []*models.Feature3D {
+	conflicts := make([]*models.Feature3D, 0)
+	for _, c := range constraints {
+		if c.IsSoft() || c.IsTimeDependent() {
+			continue
+		}
+		for i := 1; i < len(route); i++ {
+			low := math.Min(route[i-1].Alt.Normalize().Value, route[i].Alt.Normalize().Value) - b.VerticalHalfWidthMt
+			high := math.Max(route[i-1].Alt.Normalize().Value, route[i].Alt.Normalize().Value) + b.VerticalHalfWidthMt
+			if low >= c.MaxAltitude.Normalize().Value || high <= c.MinAltitude.Normalize().Value {
+				continue
+			}
+			if segmentDistanceToPolygons(route[i-1].Point2D(), route[i].Point2D(), c) < b.LateralHalfWidthMt {
+				conflicts = append(conflicts, c)
+				break
+			}
+		}
+	}
+	return conflicts
+}
+
+// union joins the polygons in one geometry, a Polygon if they touch each other and a MultiPolygon if they don't
+func union(polygons []polygol.Geom) (orb.Geometry, error) {
+	result, err := polygol.Union(polygons[0], polygons[1:]...)
+	if err != nil {
+		return nil, err
+	}
+	multiPolygon := make(orb.MultiPolygon, len(result))
+	for i, polygonData := range result {
+		multiPolygon[i] = make(orb.Polygon, len(polygonData))
+		for j, ringData := range polygonData {
+			multiPolygon[i][j] = make(orb.Ring, len(ringData))
+			for k, pointData := range ringData {
+				multiPolygon[i][j][k] = orb.Point{pointData[0], pointData[1]}
+			}
+		}
+	}
+	if len(multiPolygon) == 1 {
+		return multiPolygon[0], nil
+	}
+	return multiPolygon, nil
+}
+
+// segmentDistanceToPolygons returns the horizontal distance (mt) from the segment p1 -> p2 to the outer rings of c, 0 if they cross or p1 is inside
+func segmentDistanceToPolygons(p1, p2 orb.Point, c *models.Feature3D) float64 {
+	var polygons orb.MultiPolygon
+	switch g := c.Geometry.(type) {
+	case orb.Polygon:
+		polygons = orb.MultiPolygon{g}
+	case orb.MultiPolygon:
+		polygons = g
+	}
+
+	f := newFrame(p1)
+	ax, ay := f.toLocal(p1)
+	bx, by := f.toLocal(p2)
+	minDist := math.Inf(1)
+	for _, polygon := range polygons {
+		if len(polygon) == 0 {
+			continue
+		}
+		if utils.PointInPolygon2D(p1, polygon) {
+			return 0
+		}
+		ring := polygon[0]
+		for i := 1; i < len(ring); i++ {
+			cx, cy := f.toLocal(ring[i-1])
+			dx, dy := f.toLocal(ring[i])
+			if segmentsCross(ax, ay, bx, by, cx, cy, dx, dy) {
+				return 0
+			}
+			minDist = math.Min(minDist, math.Min(
+				math.Min(pointSegmentDistance(ax, ay, cx, cy, dx, dy), pointSegmentDistance(bx, by, cx, cy, dx, dy)),
+				math.Min(pointSegmentDistance(cx, cy, ax, ay, bx, by), pointSegmentDistance(dx, dy, ax, ay, bx, by)),
+			))
+		}
+	}
+	return minDist
+}
+
+// pointSegmentDistance is the distance from (px, py) to the segment (ax, ay) -> (bx, by), in a planar frame
+func pointSegmentDistance(px, py, ax, ay, bx, by float64) float64 {
+	dx, dy := bx-ax, by-ay
+	t := 0.0
+	if l2 := dx*dx + dy*dy; l2 > 0 {
+		t = math.Max(0, math.Min(1, ((px-ax)*dx+(py-ay)*dy)/l2))
+	}
+	return math.Hypot(ax+t*dx-px, ay+t*dy-py)
+}
+
+// segmentsCross tells if the segments (ax, ay) -> (bx, by) and (cx, cy) -> (dx, dy) have a point in common, in a planar frame
+func segmentsCross(ax, ay, bx, by, cx, cy, dx, dy float64) bool {
+	side := func(px, py, qx, qy, rx, ry float64) float64 {
+		return (qx-px)*(ry-py) - (qy-py)*(rx-px)
+	}
+	d1, d2 := side(cx, cy, dx, dy, ax, ay), side(cx, cy, dx, dy, bx, by)
+	d3, d4 := side(ax, ay, bx, by, cx, cy), side(ax, ay, bx, by, dx, dy)
+	return ((d1 > 0 && d2 < 0) || (d1 < 0 && d2 > 0)) && ((d3 > 0 && d4 < 0) || (d3 < 0 && d4 > 0))
+}
+
+// frame is a local planar frame (mt) around origin, good enough for the size of a route
+type frame struct {
+	origin          orb.Point
+	metersPerDegLon float64
+}
+
+func newFrame(origin orb.Point) *frame {
+	return &frame{origin: origin, metersPerDegLon: models.METERS_PER_DEGREE * math.Cos(origin.Lat()*math.Pi/180)}
+}
+
+func (f *frame) toLocal(p orb.Point) (float64, float64) {
+	return (p.Lon() - f.origin.Lon()) * f.metersPerDegLon, (p.Lat() - f.origin.Lat()) * models.METERS_PER_DEGREE
+}
+
+func (f *frame) fromLocal(x, y float64) []float64 {
+	return []float64{f.origin.Lon() + x/f.metersPerDegLon, f.origin.Lat() + y/models.METERS_PER_DEGREE}
+}
+
+// capsule is the polygon around the segment p1 -> p2 with half circles at its ends, containing every point within radiusMt of it
+func (f *frame) capsule(p1, p2 orb.Point, radiusMt float64) polygol.Geom {
+	ax, ay := f.toLocal(p1)
+	bx, by := f.toLocal(p2)
+	heading := math.Atan2(by-ay, bx-ax)
+
+	// Vertices a bit farther than the radius, so that the edges between them are not closer than it
+	step := math.Pi / float64(ARC_POINTS)
+	r := radiusMt / math.Cos(step/2)
+	ring := make([][]float64, 0, 2*(ARC_POINTS+1)+1)
+	for i := 0; i <= ARC_POINTS; i++ {
+		angle := heading - math.Pi/2 + float64(i)*step
+		ring = append(ring, f.fromLocal(bx+r*math.Cos(angle), by+r*math.Sin(angle)))
+	}
+	for i := 0; i <= ARC_POINTS; i++ {
+		angle := heading + math.Pi/2 + float64(i)*step
+		ring = append(ring, f.fromLocal(ax+r*math.Cos(angle), ay+r*math.Sin(angle)))
+	}
+	ring = append(ring, ring[0])
+	return polygol.Geom{{ring}}
+}
@@ -0,0 +1,160 @@
+package corridor_test
+
+import (
+	"geopathplanner/routing/internal/corridor"
+	"geopathplanner/routing/internal/models"
+	"geopathplanner/routing/internal/utils"
+	"testing"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/planar"
+)
+
+func TestNewBuilderFromParameters(t *testing.T) {
+	tests := []struct {
+		name       string // description of this test case
+		parameters map[string]any
+		want       *corridor.Builder
+		wantErr    bool
+	}{
+		{name: "Not set", parameters: nil, want: nil},
+		{name: "Defaults", parameters: map[string]any{"corridor": map[string]any{}}, want: &corridor.Builder{LateralHalfWidthMt: corridor.DEFAULT_LATERAL_HALF_WIDTH_MT, VerticalHalfWidthMt: corridor.DEFAULT_VERTICAL_HALF_WIDTH_MT}},
+		{name: "Given", parameters: map[string]any{"corridor": map[string]any{"lateral_half_width_mt": 50.0, "vertical_half_width_mt": 0.0}}, want: &corridor.Builder{LateralHalfWidthMt: 50, VerticalHalfWidthMt: 0}},
+		{name: "Not an object", parameters: map[string]any{"corridor": true}, wantErr: true},
+		{name: "Non-positive lateral", parameters: map[string]any{"corridor": map[string]any{"lateral_half_width_mt": 0.0}}, wantErr: true},
+		{name: "Negative vertical", parameters: map[string]any{"corridor": map[string]any{"vertical_half_width_mt": -1.0}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, gotErr := corridor.NewBuilderFromParameters(tt.parameters)
+			if gotErr != nil {
+				if !tt.wantErr {
+					t.Errorf("NewBuilderFromParameters() failed: %v", gotErr)
+				}
+				return
+			}
+			if tt.wantErr {
+				t.Fatal("NewBuilderFromParameters() succeeded unexpectedly")
+			}
+			if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+				t.Errorf("NewBuilderFromParameters() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuilder_Build(t *testing.T) {
+	low, _ := models.NewAltitude(100, models.MT)
+	high, _ := models.NewAltitude(150, models.MT)
+	b := &corridor.Builder{LateralHalfWidthMt: 30, VerticalHalfWidthMt: 10}
+	// ~430 mt east, then ~220 mt north climbing
+	route := []*models.Waypoint{models.MustNewWaypoint(0, 50.0, 4.0, low), models.MustNewWaypoint(1, 50.0, 4.006, low), models.MustNewWaypoint(2, 50.002, 4.006, high)}
+
+	got, err := b.Build(route)
+	if err != nil {
+		t.Fatalf("Build() failed: %v", err)
+	}
+	utils.ExportToGeoJSONRoute("corridor", route, []*models.Feature3D{got}, nil, "Corridor", true)
+
+	polygon, ok := got.Geometry.(orb.Polygon)
+	if !ok {
+		t.Fatalf("Build() = %T, want a Polygon", got.Geometry)
+	}
+	// Along the first segment, 25 mt south is inside, 40 mt south is not (~0.000225 and ~0.00036 degrees)
+	tests := []struct {
+		name string
+		p    orb.Point
+		want bool
+	}{
+		{name: "Route wp", p: route[1].Point2D(), want: true},
+		{name: "Within the lateral half-width", p: orb.Point{4.003, 50.0 - 0.000225}, want: true},
+		{name: "Beyond the lateral half-width", p: orb.Point{4.003, 50.0 - 0.00036}, want: false},
+		{name: "Within the half-width of the end", p: orb.Point{4.006, 50.002 + 0.000225}, want: true},
+		{name: "Beyond the half-width of the start", p: orb.Point{4.0 - 0.0005, 50.0}, want: false},
+	}
+	for _, tt := range tests {
+		if inside := planar.PolygonContains(polygon, tt.p); inside != tt.want {
+			t.Errorf("Build() contains %s: %t, want %t", tt.name, inside, tt.want)
+		}
+	}
+
+	if got.MinAltitude.Normalize().Value != 90 || got.MaxAltitude.Normalize().Value != 160 {
+		t.Errorf("Build() altitudes = %v - %v, want 90 - 160", got.MinAltitude, got.MaxAltitude)
+	}
+	if got.Properties["lateral_half_width_mt"] != 30.0 || got.Properties["vertical_half_width_mt"] != 10.0 {
+		t.Errorf("Build() properties = %v, want the half-widths", got.Properties)
+	}
+}
+
+func TestBuilder_Conflicts(t *testing.T) {
+	alt, _ := models.NewAltitude(100, models.MT)
+	b := &corridor.Builder{LateralHalfWidthMt: 25, VerticalHalfWidthMt: 10}
+	// ~140 mt square, from 0 to 95 mt: its north edge is at 50.0, its top 5 mt below the route
+	obstacle := models.MustNewFeatureFromGeojson(`{"type": "Feature", "properties": {"minAltitudeValue": 0, "maxAltitudeValue": 95}, "geometry": {"type": "Polygon", "coordinates": [[[4.002, 49.99875], [4.004, 49.99875], [4.004, 50.0], [4.002, 50.0], [4.002, 49.99875]]]}}`)
+	soft := models.MustNewFeatureFromGeojson(`{"type": "Feature", "properties": {"constraint_type": "soft"}, "geometry": {"type": "Polygon", "coordinates": [[[4.002, 49.99875], [4.004, 49.99875], [4.004, 50.0], [4.002, 50.0], [4.002, 49.99875]]]}}`)
+	// Routes going east, ~0.00009 degrees of latitude every 10 mt north of the obstacle
+	eastAt := func(lat float64, a models.Altitude) []*models.Waypoint {
+		return []*models.Waypoint{models.MustNewWaypoint(0, lat, 4.0, a), models.MustNewWaypoint(1, lat, 4.006, a)}
+	}
+	lower, _ := models.NewAltitude(50, models.MT)
+	higher, _ := models.NewAltitude(110, models.MT)
+
+	tests := []struct {
+		name        string // description of this test case
+		route       []*models.Waypoint
+		constraints []*models.Feature3D
+		want        int
+	}{
+		{name: "Through the obstacle", route: eastAt(49.9995, lower), constraints: []*models.Feature3D{obstacle}, want: 1},
+		{name: "10 mt from the obstacle", route: eastAt(50.00009, alt), constraints: []*models.Feature3D{obstacle}, want: 1},
+		{name: "40 mt from the obstacle", route: eastAt(50.00036, alt), constraints: []*models.Feature3D{obstacle}, want: 0},
+		{name: "Over the obstacle, closer than the vertical half-width", route: eastAt(49.9995, alt), constraints: []*models.Feature3D{obstacle}, want: 1},
+		{name: "Over the obstacle, farther than the vertical half-width", route: eastAt(49.9995, higher), constraints: []*models.Feature3D{obstacle}, want: 0},
+		{name: "Through a soft constraint", route: eastAt(49.9995, alt), constraints: []*models.Feature3D{soft}, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := b.Conflicts(tt.route, tt.constraints); len(got) != tt.want {
+				t.Errorf("Conflicts() = %d constraints, want %d", len(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestBuilder_Inflate(t *testing.T) {
+	b := &corridor.Builder{LateralHalfWidthMt: 25, VerticalHalfWidthMt: 10}
+	obstacle := models.MustNewFeatureFromGeojson(`{"type": "Feature", "id": "tower", "properties": {"minAltitudeValue": 0, "maxAltitudeValue": 95, "active_from": "2026-10-17T10:00:00Z"}, "geometry": {"type": "Polygon", "coordinates": [[[4.002, 49.99875], [4.004, 49.99875], [4.004, 50.0], [4.002, 50.0], [4.002, 49.99875]]]}}`)
+	soft := models.MustNewFeatureFromGeojson(`{"type": "Feature", "properties": {"constraint_type": "soft"}, "geometry": {"type": "Polygon", "coordinates": [[[4.0, 49.99875], [4.001, 49.99875], [4.001, 50.0], [4.0, 50.0], [4.0, 49.99875]]]}}`)
+
+	got, err := b.Inflate([]*models.Feature3D{obstacle, soft})
+	if err != nil {
+		t.Fatalf("Inflate() failed: %v", err)
+	}
+	utils.ExportToGeoJSON("corridor", nil, append([]*models.Feature3D{obstacle}, got...), "Inflate", true)
+
+	if len(got) != 2 || got[1] != soft {
+		t.Fatalf("Inflate() = %v, want the obstacle inflated and the soft constraint as it is", got)
+	}
+	inflated := got[0]
+	if inflated.ID != obstacle.ID || !inflated.ActiveFrom().Equal(obstacle.ActiveFrom()) {
+		t.Errorf("Inflate() = %v, want the id and the time window of %v", inflated, obstacle)
+	}
+	if inflated.MinAltitude.Normalize().Value >= -10 || inflated.MaxAltitude.Normalize().Value <= 105 {
+		t.Errorf("Inflate() altitudes = %v - %v, want beyond -10 - 105", inflated.MinAltitude, inflated.MaxAltitude)
+	}
+
+	polygon, ok := inflated.Geometry.(orb.Polygon)
+	if !ok {
+		t.Fatalf("Inflate() = %T, want a Polygon", inflated.Geometry)
+	}
+	// 20 mt north of the obstacle is inside, 40 mt north is not
+	if !planar.PolygonContains(polygon, orb.Point{4.003, 50.00018}) {
+		t.Errorf("Inflate() doesn't contain a point 20 mt from the obstacle")
+	}
+	if planar.PolygonContains(polygon, orb.Point{4.003, 50.00036}) {
+		t.Errorf("Inflate() contains a point 40 mt from the obstacle")
+	}
+	if obstacle.Properties["maxAltitudeValue"] != 95.0 {
+		t.Errorf("Inflate() changed the properties of the obstacle: %v", obstacle.Properties)
+	}
+}
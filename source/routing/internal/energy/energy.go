@@ -0,0 +1,259 @@
+package energy
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"geopathplanner/routing/internal/algorithm"
+	"geopathplanner/routing/internal/models"
+	"geopathplanner/routing/internal/utils"
+	"maps"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/paulmach/orb/geo"
+)
+
+const (
+	// Charging sites tried, closest first, when a leg can't be flown with the energy left
+	MAX_CHARGING_CANDIDATES int = 5
+)
+
+// Refine is applied to the legs planned to and from the charging sites, e.g. the post-processing of the route
+type Refine func(ctx context.Context, route []*models.Waypoint) ([]*models.Waypoint, error)
+
+// Model gives the energy (Wh) needed to fly a route.
+// Every segment takes the time of flying it at the airspeed in the wind, at a power that mixes cruise and climb (or descent) power
+// by how much of the segment is horizontal or vertical.
+type Model struct {
+	BatteryWh     float64
+	ReserveWh     float64 // energy that must be left when landing
+	CruisePowerW  float64
+	ClimbPowerW   float64
+	DescentPowerW float64
+	time          *utils.TimeCost
+}
+
+// NewModelFromParameters reads parameters.energy:
+//
+//	"energy": {
+//		"battery_wh": 500,
+//		"reserve_wh": 0,
+//		"cruise_power_w": 200,
+//		"climb_power_w": 200,
+//		"descent_power_w": 200
+//	}
+//
+// climb_power_w and descent_power_w default to cruise_power_w. Segment times use parameters.airspeed_ms and the wind field of the request.
+// Returns nil if parameters.energy is not set, so routes are not checked.
+func NewModelFromParameters(parameters map[string]any) (*Model, error) {
+	var config map[string]any
+	switch v := parameters["energy"].(type) {
+	case nil:
+		return nil, nil
+	case map[string]any:
+		config = v
+	default:
+		return nil, fmt.Errorf("energy must be an object, got %T", v)
+	}
+
+	cruisePowerW := utils.GetOrDefault(config, "cruise_power_w", 0.0)
+	m := &Model{
+		BatteryWh:     utils.GetOrDefault(config, "battery_wh", 0.0),
+		ReserveWh:     utils.GetOrDefault(config, "reserve_wh", 0.0),
+		CruisePowerW:  cruisePowerW,
+		ClimbPowerW:   utils.GetOrDefault(config, "climb_power_w", cruisePowerW),
+		DescentPowerW: utils.GetOrDefault(config, "descent_power_w", cruisePowerW),
+	}
+	if m.BatteryWh <= 0 || m.CruisePowerW <= 0 {
+		return nil, fmt.Errorf("energy.battery_wh and energy.cruise_power_w must be positive")
+	}
+	if m.ReserveWh < 0 || m.ReserveWh >= m.BatteryWh {
+		return nil, fmt.Errorf("energy.reserve_wh must be between 0 and battery_wh, got %f", m.ReserveWh)
+	}
+	if m.ClimbPowerW < 0 || m.DescentPowerW < 0 {
+		return nil, fmt.Errorf("energy.climb_power_w and energy.descent_power_w can't be negative")
+	}
+
+	time, err := utils.NewTimeCost(
+		utils.GetOrDefault(parameters, "airspeed_ms", utils.DEFAULT_AIRSPEED_MS),
+		utils.GetOrDefault[*models.WindField](parameters, models.WIND_FIELD_PARAMETER, nil),
+	)
+	if err != nil {
+		return nil, err
+	}
+	m.time = time
+
+	fmt.Printf("ENERGY\n")
+	fmt.Printf("battery_wh: %f\n", m.BatteryWh)
+	fmt.Printf("reserve_wh: %f\n", m.ReserveWh)
+	fmt.Printf("cruise_power_w: %f\n", m.CruisePowerW)
+	fmt.Printf("climb_power_w: %f\n", m.ClimbPowerW)
+	fmt.Printf("descent_power_w: %f\n", m.DescentPowerW)
+	fmt.Printf("airspeed_ms: %f\n", m.time.AirspeedMs)
+	fmt.Printf("--------------------------------------------------------\n")
+
+	return m, nil
+}
+
+// SegmentWh is the energy needed to fly from p1 to p2
+func (m *Model) SegmentWh(p1, p2 *models.Waypoint) float64 {
+	horizontal := geo.DistanceHaversine(p1.Point2D(), p2.Point2D())
+	vertical := p2.Alt.Normalize().Value - p1.Alt.Normalize().Value
+	if horizontal+math.Abs(vertical) == 0 {
+		return 0
+	}
+
+	verticalPowerW := m.ClimbPowerW
+	if vertical < 0 {
+		verticalPowerW = m.DescentPowerW
+	}
+	powerW := (m.CruisePowerW*horizontal + verticalPowerW*math.Abs(vertical)) / (horizontal + math.Abs(vertical))
+	return powerW * m.time.Cost(p1, p2) / 3600
+}
+
+// RouteWh is the energy needed to fly the whole route
+func (m *Model) RouteWh(route []*models.Waypoint) float64 {
+	energy := 0.0
+	for i := 1; i < len(route); i++ {
+		energy += m.SegmentWh(route[i-1], route[i])
+	}
+	return energy
+}
+
+// RemainingWh returns the energy left on arrival at every wp of the route, taking off with a full battery.
+// The battery is full again when leaving the wps at the indexes in stops.
+func (m *Model) RemainingWh(route []*models.Waypoint, stops []int) []float64 {
+	remaining := make([]float64, len(route))
+	energy := m.BatteryWh
+	for i := range route {
+		if i > 0 {
+			energy -= m.SegmentWh(route[i-1], route[i])
+		}
+		remaining[i] = energy
+		if slices.Contains(stops, i) {
+			energy = m.BatteryWh
+		}
+	}
+	return remaining
+}
+
+// Feasible tells if the reserve is always left, given the energy remaining at every wp
+func (m *Model) Feasible(remaining []float64) bool {
+	return !slices.ContainsFunc(remaining, func(e float64) bool { return e < m.ReserveWh })
+}
+
+// InsertChargingStops goes along route, which goes through waypoints in order, and when a leg between two waypoints can't be flown
+// with the energy left it goes to a charging site first, where the battery is recharged.
+// Legs to and from the site are planned with algo, and refined with refine if not nil.
+// When parameters have a departure time, they depart when the vehicle is expected at the start of the leg and at the site.
+// Returns the new route and the indexes in it of the charging stops, or an error if some leg can't be flown even with a stop.
+func (m *Model) InsertChargingStops(ctx context.Context, algo algorithm.Algorithm, searchVolume *models.Feature3D, route []*models.Waypoint, waypoints []*models.Waypoint, sites []*models.Waypoint, constraints []*models.Feature3D, parameters map[string]any, storageType models.StorageType, refine Refine) ([]*models.Waypoint, []int, error) {
+	newRoute := []*models.Waypoint{route[0]}
+	stops := make([]int, 0)
+	energy := m.BatteryWh
+	eta := utils.GetOrDefault(parameters, models.DEPARTURE_TIME_PARAMETER, time.Time{})
+
+	for i, leg := range splitLegs(route, waypoints) {
+		if legWh := m.RouteWh(leg); energy-legWh >= m.ReserveWh {
+			newRoute = append(newRoute, leg[1:]...)
+			energy -= legWh
+			eta = m.arrival(eta, leg)
+			continue
+		}
+
+		toSite, fromSite, err := m.detour(ctx, algo, searchVolume, leg[0], leg[len(leg)-1], energy, sites, constraints, parameters, eta, storageType, refine)
+		if err != nil {
+			return nil, nil, fmt.Errorf("leg %d needs %.3f Wh with %.3f Wh left: %w", i, m.RouteWh(leg), energy, err)
+		}
+		newRoute = append(newRoute, toSite[1:]...)
+		stops = append(stops, len(newRoute)-1)
+		newRoute = append(newRoute, fromSite[1:]...)
+		energy = m.BatteryWh - m.RouteWh(fromSite)
+		eta = m.arrival(m.arrival(eta, toSite), fromSite)
+		fmt.Printf("leg %d: charging stop at %v\n", i, toSite[len(toSite)-1])
+	}
+	return newRoute, stops, nil
+}
+
+// detour plans start -> site -> end through the closest charging site reachable with energy and from which end is reachable with a full battery.
+// The vehicle leaves start at eta, zero if the route is not scheduled.
+func (m *Model) detour(ctx context.Context, algo algorithm.Algorithm, searchVolume *models.Feature3D, start, end *models.Waypoint, energy float64, sites []*models.Waypoint, constraints []*models.Feature3D, parameters map[string]any, eta time.Time, storageType models.StorageType, refine Refine) ([]*models.Waypoint, []*models.Waypoint, error) {
+	// Straight lines give the order of the candidates, and discard the ones that can't be reached in any case
+	candidates := slices.Clone(sites)
+	candidates = slices.DeleteFunc(candidates, func(site *models.Waypoint) bool {
+		return m.lowerBoundWh(start, site) > energy-m.ReserveWh || m.lowerBoundWh(site, end) > m.BatteryWh-m.ReserveWh
+	})
+	slices.SortFunc(candidates, func(a, b *models.Waypoint) int {
+		return cmp.Compare(m.SegmentWh(start, a)+m.SegmentWh(a, end), m.SegmentWh(start, b)+m.SegmentWh(b, end))
+	})
+
+	for _, site := range candidates[:min(len(candidates), MAX_CHARGING_CANDIDATES)] {
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+
+		toSite, err := m.plan(ctx, algo, searchVolume, start, site, constraints, departingAt(parameters, eta), storageType, refine)
+		if err != nil || energy-m.RouteWh(toSite) < m.ReserveWh {
+			continue
+		}
+		fromSite, err := m.plan(ctx, algo, searchVolume, site, end, constraints, departingAt(parameters, m.arrival(eta, toSite)), storageType, refine)
+		if err != nil || m.BatteryWh-m.RouteWh(fromSite) < m.ReserveWh {
+			continue
+		}
+		return toSite, fromSite, nil
+	}
+	return nil, nil, fmt.Errorf("no charging site within reach (%d candidates out of %d sites)", len(candidates), len(sites))
+}
+
+func (m *Model) plan(ctx context.Context, algo algorithm.Algorithm, searchVolume *models.Feature3D, start, end *models.Waypoint, constraints []*models.Feature3D, parameters map[string]any, storageType models.StorageType, refine Refine) ([]*models.Waypoint, error) {
+	route, _, err := algo.Compute(ctx, searchVolume, []*models.Waypoint{start, end}, constraints, parameters, storageType)
+	if err != nil {
+		return nil, err
+	}
+	if refine != nil {
+		return refine(ctx, route)
+	}
+	return route, nil
+}
+
+// arrival is when route is flown, leaving at departure. Zero if the route is not scheduled.
+func (m *Model) arrival(departure time.Time, route []*models.Waypoint) time.Time {
+	if departure.IsZero() {
+		return departure
+	}
+	return departure.Add(time.Duration(utils.TotalCost(m.time, route) * float64(time.Second)))
+}
+
+// departingAt returns a copy of parameters departing at t, or parameters if the route is not scheduled
+func departingAt(parameters map[string]any, t time.Time) map[string]any {
+	if t.IsZero() {
+		return parameters
+	}
+	legParameters := maps.Clone(parameters)
+	legParameters[models.DEPARTURE_TIME_PARAMETER] = t
+	return legParameters
+}
+
+// lowerBoundWh is less than the energy of any route from p1 to p2: the straight line, always with the strongest wind in the back, at the lowest power
+func (m *Model) lowerBoundWh(p1, p2 *models.Waypoint) float64 {
+	return min(m.CruisePowerW, m.ClimbPowerW, m.DescentPowerW) * m.time.Heuristic(p1, p2) / 3600
+}
+
+// splitLegs splits route at the waypoints it goes through, in order. Every leg starts and ends with a waypoint.
+func splitLegs(route []*models.Waypoint, waypoints []*models.Waypoint) [][]*models.Waypoint {
+	legs := make([][]*models.Waypoint, 0, len(waypoints)-1)
+	start, next := 0, 1
+	for i := 1; i < len(route); i++ {
+		if next < len(waypoints) && route[i].Reaches(waypoints[next]) {
+			legs = append(legs, route[start:i+1])
+			start, next = i, next+1
+		}
+	}
+	// Anything after the last waypoint found is one more leg
+	if start < len(route)-1 {
+		legs = append(legs, route[start:])
+	}
+	return legs
+}
@@ -0,0 +1,216 @@
+package energy_test
+
+import (
+	"context"
+	"geopathplanner/routing/internal/algorithm"
+	"geopathplanner/routing/internal/energy"
+	"geopathplanner/routing/internal/models"
+	"geopathplanner/routing/internal/utils"
+	"math"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestModel_SegmentWh(t *testing.T) {
+	low, _ := models.NewAltitude(100, models.MT)
+	high, _ := models.NewAltitude(400, models.MT)
+	// ~3 km toward east, flown in 200 s at 15 m/s
+	west, east := models.MustNewWaypoint(0, 50.0, 4.0, low), models.MustNewWaypoint(1, 50.0, 4.042, low)
+	bottom, top := models.MustNewWaypoint(2, 50.0, 4.0, low), models.MustNewWaypoint(3, 50.0, 4.0, high)
+	m, err := energy.NewModelFromParameters(map[string]any{"energy": map[string]any{"battery_wh": 100.0, "cruise_power_w": 200.0, "climb_power_w": 500.0, "descent_power_w": 100.0}})
+	if err != nil {
+		t.Fatalf("could not construct model: %v", err)
+	}
+
+	tests := []struct {
+		name string // description of this test case
+		p1   *models.Waypoint
+		p2   *models.Waypoint
+		want float64
+	}{
+		{name: "Cruise", p1: west, p2: east, want: 200 * utils.HaversineDistance3D(west, east) / 15 / 3600},
+		{name: "Climb", p1: bottom, p2: top, want: 500 * 300.0 / 15 / 3600},
+		{name: "Descent", p1: top, p2: bottom, want: 100 * 300.0 / 15 / 3600},
+		{name: "Same wp", p1: west, p2: west, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := m.SegmentWh(tt.p1, tt.p2); math.Abs(got-tt.want) > 1e-6 {
+				t.Errorf("SegmentWh() = %.6f, want %.6f", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewModelFromParameters(t *testing.T) {
+	tests := []struct {
+		name       string // description of this test case
+		parameters map[string]any
+		wantNil    bool
+		wantErr    bool
+	}{
+		{name: "Not set", parameters: nil, wantNil: true},
+		{name: "Defaults to cruise power", parameters: map[string]any{"energy": map[string]any{"battery_wh": 100.0, "cruise_power_w": 200.0}}},
+		{name: "Not an object", parameters: map[string]any{"energy": 100.0}, wantErr: true},
+		{name: "Missing battery", parameters: map[string]any{"energy": map[string]any{"cruise_power_w": 200.0}}, wantErr: true},
+		{name: "Reserve above battery", parameters: map[string]any{"energy": map[string]any{"battery_wh": 100.0, "cruise_power_w": 200.0, "reserve_wh": 100.0}}, wantErr: true},
+		{name: "Negative climb power", parameters: map[string]any{"energy": map[string]any{"battery_wh": 100.0, "cruise_power_w": 200.0, "climb_power_w": -1.0}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, gotErr := energy.NewModelFromParameters(tt.parameters)
+			if gotErr != nil {
+				if !tt.wantErr {
+					t.Errorf("NewModelFromParameters() failed: %v", gotErr)
+				}
+				return
+			}
+			if tt.wantErr {
+				t.Fatal("NewModelFromParameters() succeeded unexpectedly")
+			}
+			if (got == nil) != tt.wantNil {
+				t.Fatalf("NewModelFromParameters() = %+v, want nil: %t", got, tt.wantNil)
+			}
+			if got != nil && (got.ClimbPowerW != got.CruisePowerW || got.DescentPowerW != got.CruisePowerW) {
+				t.Errorf("NewModelFromParameters() = %+v, want climb and descent power equal to cruise power", got)
+			}
+		})
+	}
+}
+
+func TestModel_InsertChargingStops(t *testing.T) {
+	a, _ := models.NewAltitude(100, models.MT)
+	// Two legs of ~3 km, each one taking ~11.1 Wh
+	waypoints := []*models.Waypoint{
+		models.MustNewWaypoint(0, 50.0, 4.0, a),
+		models.MustNewWaypoint(1, 50.0, 4.042, a),
+		models.MustNewWaypoint(2, 50.0, 4.084, a),
+	}
+	nearSecond := models.MustNewWaypoint(3, 50.002, 4.045, a)
+	farAway := models.MustNewWaypoint(4, 50.1, 4.0, a)
+
+	tests := []struct {
+		name      string // description of this test case
+		batteryWh float64
+		reserveWh float64
+		sites     []*models.Waypoint
+		wantStops []*models.Waypoint
+		wantErr   bool
+	}{
+		{name: "Enough battery", batteryWh: 30, sites: []*models.Waypoint{nearSecond}, wantStops: []*models.Waypoint{}},
+		{name: "Stop after the first leg", batteryWh: 15, sites: []*models.Waypoint{farAway, nearSecond}, wantStops: []*models.Waypoint{nearSecond}},
+		{name: "Stop after the first leg to keep the reserve", batteryWh: 25, reserveWh: 5, sites: []*models.Waypoint{nearSecond}, wantStops: []*models.Waypoint{nearSecond}},
+		{name: "No site within reach", batteryWh: 15, sites: []*models.Waypoint{farAway}, wantErr: true},
+		{name: "Leg longer than the battery", batteryWh: 10, sites: []*models.Waypoint{nearSecond}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parameters := map[string]any{"energy": map[string]any{"battery_wh": tt.batteryWh, "reserve_wh": tt.reserveWh, "cruise_power_w": 200.0}}
+			m, err := energy.NewModelFromParameters(parameters)
+			if err != nil {
+				t.Fatalf("could not construct model: %v", err)
+			}
+			algo, err := algorithm.NewAlgorithm(models.VisGraph)
+			if err != nil {
+				t.Fatalf("could not construct algorithm: %v", err)
+			}
+			route, _, err := algo.Compute(context.Background(), nil, waypoints, nil, parameters, models.RTree)
+			if err != nil {
+				t.Fatalf("Compute() failed: %v", err)
+			}
+
+			got, gotStops, gotErr := m.InsertChargingStops(context.Background(), algo, nil, route, waypoints, tt.sites, nil, parameters, models.RTree, nil)
+			if gotErr != nil {
+				if !tt.wantErr {
+					t.Errorf("InsertChargingStops() failed: %v", gotErr)
+				}
+				return
+			}
+			if tt.wantErr {
+				t.Fatal("InsertChargingStops() succeeded unexpectedly")
+			}
+
+			utils.MarkWaypointsAsOriginal(waypoints...)
+			utils.ExportToGeoJSONRoute("energy", got, nil, nil, tt.name, true)
+
+			stops := make([]*models.Waypoint, len(gotStops))
+			for i, stop := range gotStops {
+				stops[i] = got[stop]
+			}
+			if !slices.Equal(stops, tt.wantStops) {
+				t.Errorf("InsertChargingStops() stops at %v, want %v", stops, tt.wantStops)
+			}
+
+			// Every waypoint is still visited in order, and the battery is enough for every sortie
+			visited := slices.DeleteFunc(slices.Clone(got), func(w *models.Waypoint) bool { return !slices.Contains(waypoints, w) })
+			if !slices.Equal(visited, waypoints) {
+				t.Errorf("InsertChargingStops() visits %v, want %v", visited, waypoints)
+			}
+			remaining := m.RemainingWh(got, gotStops)
+			if !m.Feasible(remaining) {
+				t.Errorf("InsertChargingStops() route is not feasible, remaining energy %v", remaining)
+			}
+		})
+	}
+}
+
+// departureRecorder plans with Algorithm and records the departure time of every route it's asked for
+type departureRecorder struct {
+	algorithm.Algorithm
+	departures []time.Time
+}
+
+func (r *departureRecorder) Compute(ctx context.Context, searchVolume *models.Feature3D, waypoints []*models.Waypoint, constraints []*models.Feature3D, parameters map[string]any, storageType models.StorageType) ([]*models.Waypoint, float64, error) {
+	r.departures = append(r.departures, utils.GetOrDefault(parameters, models.DEPARTURE_TIME_PARAMETER, time.Time{}))
+	return r.Algorithm.Compute(ctx, searchVolume, waypoints, constraints, parameters, storageType)
+}
+
+func TestModel_InsertChargingStops_departureTime(t *testing.T) {
+	a, _ := models.NewAltitude(100, models.MT)
+	waypoints := []*models.Waypoint{
+		models.MustNewWaypoint(0, 50.0, 4.0, a),
+		models.MustNewWaypoint(1, 50.0, 4.042, a),
+		models.MustNewWaypoint(2, 50.0, 4.084, a),
+	}
+	site := models.MustNewWaypoint(3, 50.002, 4.045, a)
+	departure, _ := time.Parse(time.RFC3339, "2026-10-17T10:00:00Z")
+
+	parameters := map[string]any{"energy": map[string]any{"battery_wh": 15.0, "cruise_power_w": 200.0}, models.DEPARTURE_TIME_PARAMETER: departure}
+	m, err := energy.NewModelFromParameters(parameters)
+	if err != nil {
+		t.Fatalf("could not construct model: %v", err)
+	}
+	visGraph, err := algorithm.NewAlgorithm(models.VisGraph)
+	if err != nil {
+		t.Fatalf("could not construct algorithm: %v", err)
+	}
+	route, _, err := visGraph.Compute(context.Background(), nil, waypoints, nil, parameters, models.RTree)
+	if err != nil {
+		t.Fatalf("Compute() failed: %v", err)
+	}
+
+	algo := &departureRecorder{Algorithm: visGraph}
+	got, gotStops, err := m.InsertChargingStops(context.Background(), algo, nil, route, waypoints, []*models.Waypoint{site}, nil, parameters, models.RTree, nil)
+	if err != nil {
+		t.Fatalf("InsertChargingStops() failed: %v", err)
+	}
+	if len(gotStops) != 1 {
+		t.Fatalf("InsertChargingStops() stops %d times, want 1", len(gotStops))
+	}
+
+	// The leg to the site departs when the first leg is flown, the one from the site when the site is reached
+	flightTime, _ := utils.NewTimeCost(utils.DEFAULT_AIRSPEED_MS, nil)
+	eta := func(route []*models.Waypoint) time.Time {
+		return departure.Add(time.Duration(utils.TotalCost(flightTime, route) * float64(time.Second)))
+	}
+	want := []time.Time{eta(got[:slices.Index(got, waypoints[1])+1]), eta(got[:gotStops[0]+1])}
+	if len(algo.departures) != len(want) {
+		t.Fatalf("InsertChargingStops() planned %d routes, want %d", len(algo.departures), len(want))
+	}
+	for i := range want {
+		if d := algo.departures[i].Sub(want[i]); math.Abs(d.Seconds()) > 1e-3 {
+			t.Errorf("InsertChargingStops() route %d departs at %v, want %v", i, algo.departures[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package fleet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"geopathplanner/routing/internal/algorithm"
+	"geopathplanner/routing/internal/models"
+	"geopathplanner/routing/internal/utils"
+	"maps"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geo"
+	"github.com/paulmach/orb/geojson"
+)
+
+const (
+	DEFAULT_HORIZONTAL_SEPARATION_MT float64 = 50.0
+	DEFAULT_VERTICAL_SEPARATION_MT   float64 = 15.0
+)
+
+// Refine is applied to the route of every vehicle, e.g. the post-processing pipeline.
+type Refine func(ctx context.Context, route []*models.Waypoint, waypoints []*models.Waypoint) ([]*models.Waypoint, error)
+
+// Planner routes several vehicles flying at once with prioritized planning: vehicles are planned one after the other, in the order of the request,
+// and every route becomes a set of moving separation zones for the ones planned after it.
+// Each zone is a box around the vehicle along one segment of its route, active only while the vehicle flies that segment,
+// so the time-aware algorithms (RRT, RRT*, RRTConnect, PRM, VisGraph), the only ones accepted with vehicles, keep the other vehicles apart in space and time.
+type Planner struct {
+	HorizontalSeparationMt float64
+	VerticalSeparationMt   float64
+}
+
+// NewPlannerFromParameters reads parameters.separation_horizontal_mt and separation_vertical_mt.
+// Two vehicles are separated when they are at least one or the other apart at the same time.
+func NewPlannerFromParameters(parameters map[string]any) (*Planner, error) {
+	HORIZONTAL_SEPARATION_MT := utils.GetOrDefault(parameters, "separation_horizontal_mt", DEFAULT_HORIZONTAL_SEPARATION_MT)
+	VERTICAL_SEPARATION_MT := utils.GetOrDefault(parameters, "separation_vertical_mt", DEFAULT_VERTICAL_SEPARATION_MT)
+
+	if HORIZONTAL_SEPARATION_MT <= 0 || VERTICAL_SEPARATION_MT <= 0 {
+		return nil, fmt.Errorf("separation_horizontal_mt and separation_vertical_mt must be positive")
+	}
+
+	fmt.Printf("FLEET\n")
+	fmt.Printf("separation_horizontal_mt: %f\n", HORIZONTAL_SEPARATION_MT)
+	fmt.Printf("separation_vertical_mt: %f\n", VERTICAL_SEPARATION_MT)
+	fmt.Printf("--------------------------------------------------------\n")
+
+	return &Planner{HorizontalSeparationMt: HORIZONTAL_SEPARATION_MT, VerticalSeparationMt: VERTICAL_SEPARATION_MT}, nil
+}
+
+// Plan returns one route per vehicle, in the order of vehicles, which is also their priority.
+// Vehicles without a departure time take off at departure. A vehicle is only kept apart from the others while flying:
+// before its departure and after its arrival it is on the ground.
+// Fails if any vehicle can't be routed around the constraints and the vehicles planned before it.
+func (p *Planner) Plan(ctx context.Context, algo algorithm.Algorithm, searchVolume *models.Feature3D, vehicles []*models.Vehicle, constraints []*models.Feature3D, parameters map[string]any, storageType models.StorageType, departure time.Time, refine Refine) ([]*models.VehicleRoute, error) {
+	routes := make([]*models.VehicleRoute, 0, len(vehicles))
+	separation := make([]*models.Feature3D, 0)
+
+	for i, vehicle := range vehicles {
+		// Out of time, the vehicles left are still planned on a best-effort basis
+		if errors.Is(ctx.Err(), context.Canceled) {
+			return nil, fmt.Errorf("vehicle %s not planned: %w", vehicle.ID, ctx.Err())
+		}
+
+		vehicleParameters := maps.Clone(parameters)
+		if vehicleParameters == nil {
+			vehicleParameters = map[string]any{}
+		}
+		vehicleDeparture := departure
+		if vehicle.DepartureTime != nil {
+			vehicleDeparture = *vehicle.DepartureTime
+		}
+		vehicleParameters[models.DEPARTURE_TIME_PARAMETER] = vehicleDeparture
+		if vehicle.AirspeedMs > 0 {
+			vehicleParameters["airspeed_ms"] = vehicle.AirspeedMs
+		}
+
+		flightTime, err := utils.NewTimeCostFromParameters(vehicleParameters)
+		if err != nil {
+			return nil, fmt.Errorf("vehicle %s: %w", vehicle.ID, err)
+		}
+		costFunction, err := utils.NewCostFunctionFromParameters(vehicleParameters, constraints)
+		if err != nil {
+			return nil, fmt.Errorf("vehicle %s: %w", vehicle.ID, err)
+		}
+
+		vehicleConstraints := append(slices.Clone(constraints), separation...)
+		route, _, err := algo.Compute(ctx, searchVolume, vehicle.Waypoints, vehicleConstraints, vehicleParameters, storageType)
+		if err != nil {
+			return nil, fmt.Errorf("vehicle %s (priority %d) not routed: %w", vehicle.ID, i, err)
+		}
+
+		if refine != nil {
+			refined, err := refine(ctx, route, vehicle.Waypoints)
+			if err != nil {
+				return nil, fmt.Errorf("vehicle %s: %w", vehicle.ID, err)
+			}
+			// Refining doesn't know about the other vehicles, keep the planned route if the refined one gets too close to them
+			conflict, err := algorithm.FirstActiveCrossing(refined, vehicleDeparture, flightTime, vehicleConstraints, storageType)
+			if err != nil {
+				return nil, fmt.Errorf("vehicle %s: %w", vehicle.ID, err)
+			}
+			if conflict < 0 {
+				route = refined
+			} else {
+				fmt.Printf("Refined route of vehicle %s conflicts at segment %d, keeping the planned one\n", vehicle.ID, conflict)
+			}
+		}
+
+		zones, err := p.separationZones(route, vehicleDeparture, flightTime)
+		if err != nil {
+			return nil, fmt.Errorf("vehicle %s: %w", vehicle.ID, err)
+		}
+		separation = append(separation, zones...)
+
+		routes = append(routes, &models.VehicleRoute{
+			ID:            vehicle.ID,
+			Route:         route,
+			CostKm:        utils.TotalCost(costFunction, route),
+			DepartureTime: vehicleDeparture,
+			ArrivalTime:   vehicleDeparture.Add(time.Duration(utils.TotalCost(flightTime, route) * float64(time.Second))),
+		})
+		fmt.Printf("Vehicle %s routed (%d/%d), %d separation zones\n", vehicle.ID, i+1, len(vehicles), len(zones))
+	}
+
+	return routes, nil
+}
+
+// separationZones returns one zone per segment of route flown from departure: a box as wide as twice the horizontal separation
+// and as high as the segment plus the vertical separation above and below, moving with the vehicle while it flies the segment.
+// The box contains the circle of the horizontal separation, so it keeps the vehicles a bit farther apart than needed.
+func (p *Planner) separationZones(route []*models.Waypoint, departure time.Time, flightTime utils.CostFunction) ([]*models.Feature3D, error) {
+	zones := make([]*models.Feature3D, 0, len(route)-1)
+	t := departure
+	for i := 1; i < len(route); i++ {
+		from, to := route[i-1], route[i]
+		seconds := flightTime.Cost(from, to)
+		arrival := t.Add(time.Duration(seconds * float64(time.Second)))
+		if !arrival.After(t) {
+			continue
+		}
+
+		properties := geojson.Properties{
+			"active_from":      t.Format(time.RFC3339Nano),
+			"active_until":     arrival.Format(time.RFC3339Nano),
+			"minAltitudeValue": math.Min(from.Alt.Normalize().Value, to.Alt.Normalize().Value) - p.VerticalSeparationMt,
+			"maxAltitudeValue": math.Max(from.Alt.Normalize().Value, to.Alt.Normalize().Value) + p.VerticalSeparationMt,
+			"altitudeUnit":     string(models.MT),
+		}
+		// Vertical segments don't move the box
+		if distance := geo.Distance(from.Point2D(), to.Point2D()); distance > 0 {
+			properties["speed_ms"] = distance / seconds
+			properties["heading_deg"] = geo.Bearing(from.Point2D(), to.Point2D())
+			properties["reference_time"] = t.Format(time.RFC3339Nano)
+		}
+
+		feature := geojson.NewFeature(p.box(from.Point2D()))
+		feature.Properties = properties
+		zone, err := models.NewFeatureFromGeojsonFeature(feature)
+		if err != nil {
+			return nil, err
+		}
+		zones = append(zones, zone)
+		t = arrival
+	}
+	return zones, nil
+}
+
+// box is the square centered in center with sides 2*HorizontalSeparationMt long, aligned to north
+func (p *Planner) box(center orb.Point) orb.Polygon {
+	north := geo.PointAtBearingAndDistance(center, 0, p.HorizontalSeparationMt)
+	east := geo.PointAtBearingAndDistance(center, 90, p.HorizontalSeparationMt)
+	dLat, dLon := north.Lat()-center.Lat(), east.Lon()-center.Lon()
+	return orb.Polygon{orb.Ring{
+		{center.Lon() - dLon, center.Lat() - dLat},
+		{center.Lon() + dLon, center.Lat() - dLat},
+		{center.Lon() + dLon, center.Lat() + dLat},
+		{center.Lon() - dLon, center.Lat() + dLat},
+		{center.Lon() - dLon, center.Lat() - dLat},
+	}}
+}
@@ -0,0 +1,144 @@
+package fleet_test
+
+import (
+	"context"
+	"geopathplanner/routing/internal/algorithm"
+	"geopathplanner/routing/internal/fleet"
+	"geopathplanner/routing/internal/models"
+	"geopathplanner/routing/internal/utils"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/paulmach/orb/geo"
+)
+
+func TestNewPlannerFromParameters(t *testing.T) {
+	tests := []struct {
+		name       string // description of this test case
+		parameters map[string]any
+		want       *fleet.Planner
+		wantErr    bool
+	}{
+		{name: "Defaults", parameters: nil, want: &fleet.Planner{HorizontalSeparationMt: fleet.DEFAULT_HORIZONTAL_SEPARATION_MT, VerticalSeparationMt: fleet.DEFAULT_VERTICAL_SEPARATION_MT}},
+		{name: "Given", parameters: map[string]any{"separation_horizontal_mt": 100.0, "separation_vertical_mt": 30.0}, want: &fleet.Planner{HorizontalSeparationMt: 100, VerticalSeparationMt: 30}},
+		{name: "Non-positive horizontal", parameters: map[string]any{"separation_horizontal_mt": 0.0}, wantErr: true},
+		{name: "Negative vertical", parameters: map[string]any{"separation_vertical_mt": -1.0}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, gotErr := fleet.NewPlannerFromParameters(tt.parameters)
+			if gotErr != nil {
+				if !tt.wantErr {
+					t.Errorf("NewPlannerFromParameters() failed: %v", gotErr)
+				}
+				return
+			}
+			if tt.wantErr {
+				t.Fatal("NewPlannerFromParameters() succeeded unexpectedly")
+			}
+			if *got != *tt.want {
+				t.Errorf("NewPlannerFromParameters() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlanner_Plan(t *testing.T) {
+	low, _ := models.NewAltitude(100, models.MT)
+	high, _ := models.NewAltitude(150, models.MT)
+	searchVolume := models.MustNewFeatureFromGeojson(`{"type": "Feature", "properties": {}, "geometry": {"type": "Polygon", "coordinates": [[[3.995, 49.994], [4.011, 49.994], [4.011, 50.006], [3.995, 50.006], [3.995, 49.994]]]}}`)
+	departure, _ := time.Parse(time.RFC3339, "2026-10-17T10:00:00Z")
+	// Two legs of ~645 mt crossing in the middle, reached by both after ~21 s at 15 m/s
+	eastbound := func(alt models.Altitude) *models.Vehicle {
+		return &models.Vehicle{ID: "east", Waypoints: []*models.Waypoint{models.MustNewWaypoint(0, 50.0, 3.9985, alt), models.MustNewWaypoint(1, 50.0, 4.0075, alt)}}
+	}
+	northbound := func(alt models.Altitude) *models.Vehicle {
+		return &models.Vehicle{ID: "north", Waypoints: []*models.Waypoint{models.MustNewWaypoint(0, 49.9971, 4.003, alt), models.MustNewWaypoint(1, 50.0029, 4.003, alt)}}
+	}
+	late := departure.Add(2 * time.Minute)
+
+	tests := []struct {
+		name          string // description of this test case
+		vehicles      []*models.Vehicle
+		wantStraights []bool
+	}{
+		{name: "Crossing at the same time and altitude", vehicles: []*models.Vehicle{eastbound(low), northbound(low)}, wantStraights: []bool{true, false}},
+		{name: "Crossing at different altitudes", vehicles: []*models.Vehicle{eastbound(low), northbound(high)}, wantStraights: []bool{true, true}},
+		{name: "Crossing after the other landed", vehicles: []*models.Vehicle{eastbound(low), {ID: "north", Waypoints: northbound(low).Waypoints, DepartureTime: &late}}, wantStraights: []bool{true, true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			planner, err := fleet.NewPlannerFromParameters(nil)
+			if err != nil {
+				t.Fatalf("could not construct receiver type: %v", err)
+			}
+			algo, err := algorithm.NewRRTAlgorithm()
+			if err != nil {
+				t.Fatalf("could not construct algorithm: %v", err)
+			}
+
+			got, gotErr := planner.Plan(context.Background(), algo, searchVolume, tt.vehicles, nil, map[string]any{"max_iterations": 5000.0}, models.RTree, departure, nil)
+			if gotErr != nil {
+				t.Fatalf("Plan() failed: %v", gotErr)
+			}
+			if len(got) != len(tt.vehicles) {
+				t.Fatalf("Plan() returned %d routes, want %d", len(got), len(tt.vehicles))
+			}
+
+			for i, r := range got {
+				utils.MarkWaypointsAsOriginal(tt.vehicles[i].Waypoints...)
+				utils.ExportToGeoJSONRoute("fleet", r.Route, nil, searchVolume, tt.name+" - "+r.ID, true)
+				if r.ID != tt.vehicles[i].ID {
+					t.Errorf("Plan()[%d].ID = %s, want %s", i, r.ID, tt.vehicles[i].ID)
+				}
+				if straight := len(r.Route) == 2; straight != tt.wantStraights[i] {
+					t.Errorf("Plan()[%d] = %v, straight line: %t, want %t", i, r.Route, straight, tt.wantStraights[i])
+				}
+				if !r.ArrivalTime.After(r.DepartureTime) {
+					t.Errorf("Plan()[%d] arrives at %v, before departing at %v", i, r.ArrivalTime, r.DepartureTime)
+				}
+			}
+			assertSeparated(t, got, planner)
+		})
+	}
+}
+
+// assertSeparated flies the routes at the default airspeed and checks every pair of vehicles in the air every 100 ms
+func assertSeparated(t *testing.T, routes []*models.VehicleRoute, planner *fleet.Planner) {
+	t.Helper()
+	for i := range routes {
+		for j := i + 1; j < len(routes); j++ {
+			for tick := routes[i].DepartureTime; tick.Before(routes[i].ArrivalTime); tick = tick.Add(100 * time.Millisecond) {
+				p1, p2 := positionAt(routes[i], tick), positionAt(routes[j], tick)
+				if p1 == nil || p2 == nil {
+					continue
+				}
+				horizontal := geo.Distance(p1.Point2D(), p2.Point2D())
+				vertical := math.Abs(p1.Alt.Normalize().Value - p2.Alt.Normalize().Value)
+				if horizontal < planner.HorizontalSeparationMt && vertical < planner.VerticalSeparationMt {
+					t.Fatalf("vehicles %s and %s are %.1f mt apart (%.1f mt vertically) at %v", routes[i].ID, routes[j].ID, horizontal, vertical, tick)
+				}
+			}
+		}
+	}
+}
+
+// positionAt is where the vehicle is at t, nil if it's on the ground
+func positionAt(r *models.VehicleRoute, t time.Time) *models.Waypoint {
+	if t.Before(r.DepartureTime) || !t.Before(r.ArrivalTime) {
+		return nil
+	}
+	elapsed := t.Sub(r.DepartureTime).Seconds()
+	for i := 1; i < len(r.Route); i++ {
+		seconds := utils.HaversineDistance3D(r.Route[i-1], r.Route[i]) / utils.DEFAULT_AIRSPEED_MS
+		if elapsed <= seconds {
+			f := elapsed / seconds
+			alt, _ := models.NewAltitude(r.Route[i-1].Alt.Normalize().Value*(1-f)+r.Route[i].Alt.Normalize().Value*f, models.MT)
+			wp, _ := models.NewWaypoint(r.Route[i-1].Lat*(1-f)+r.Route[i].Lat*f, r.Route[i-1].Lon*(1-f)+r.Route[i].Lon*f, alt)
+			return wp
+		}
+		elapsed -= seconds
+	}
+	return nil
+}
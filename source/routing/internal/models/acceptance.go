@@ -0,0 +1,32 @@
+package models
+
+// AcceptanceRadiusMt is how close the route must pass to the waypoint, from the property acceptance_radius_mt.
+// By default it's 0 and the route goes through the waypoint itself. Only rrt and rrtstar plan to the radius, see AlgorithmType.HonoursAcceptanceRadius.
+func (w *Waypoint) AcceptanceRadiusMt() float64 {
+	return w.Feature.Properties.MustFloat64("acceptance_radius_mt", 0)
+}
+
+// NewEntryPoint returns a copy of p standing for goal in the route, as the point where it entered the acceptance radius of goal
+func NewEntryPoint(p, goal *Waypoint) *Waypoint {
+	entry, err := NewWaypoint(p.Lat, p.Lon, p.Alt)
+	if err != nil {
+		return nil
+	}
+	entry.ID = goal.ID
+	entry.Feature.Properties["acceptance_entry"] = true
+	entry.reached = goal
+	return entry
+}
+
+// Reached is the waypoint w stands for in a route: the one whose acceptance radius it entered, or w itself
+func (w *Waypoint) Reached() *Waypoint {
+	if w.reached != nil {
+		return w.reached
+	}
+	return w
+}
+
+// Reaches tells if the route reaches goal at w
+func (w *Waypoint) Reaches(goal *Waypoint) bool {
+	return w.Reached() == goal
+}
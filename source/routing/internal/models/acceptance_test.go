@@ -0,0 +1,59 @@
+package models_test
+
+import (
+	"encoding/json"
+	"geopathplanner/routing/internal/models"
+	"testing"
+)
+
+func TestWaypoint_AcceptanceRadiusMt(t *testing.T) {
+	tests := []struct {
+		name       string // description of this test case
+		properties string
+		want       float64
+		wantErr    bool
+	}{
+		{name: "Default", properties: `{}`, want: 0},
+		{name: "Given", properties: `{"acceptance_radius_mt": 25}`, want: 25},
+		{name: "Negative", properties: `{"acceptance_radius_mt": -1}`, wantErr: true},
+		{name: "Not a number", properties: `{"acceptance_radius_mt": "25"}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got models.Waypoint
+			gotErr := json.Unmarshal([]byte(`{"type": "Feature", "properties": `+tt.properties+`, "geometry": {"type": "Point", "coordinates": [4.0, 50.0]}}`), &got)
+			if gotErr != nil {
+				if !tt.wantErr {
+					t.Errorf("UnmarshalJSON() failed: %v", gotErr)
+				}
+				return
+			}
+			if tt.wantErr {
+				t.Fatal("UnmarshalJSON() succeeded unexpectedly")
+			}
+			if radius := got.AcceptanceRadiusMt(); radius != tt.want {
+				t.Errorf("AcceptanceRadiusMt() = %f, want %f", radius, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewEntryPoint(t *testing.T) {
+	alt, _ := models.NewAltitude(100, models.MT)
+	goal := models.MustNewWaypoint(1, 50.0, 4.0, alt)
+	p := models.MustNewWaypoint(0, 50.0001, 4.0, alt)
+
+	entry := models.NewEntryPoint(p, goal)
+	if entry.Lat != p.Lat || entry.Lon != p.Lon || entry.Alt != p.Alt {
+		t.Errorf("NewEntryPoint() = %v, want at %v", entry, p)
+	}
+	if entry.ID != goal.ID {
+		t.Errorf("NewEntryPoint().ID = %v, want %v", entry.ID, goal.ID)
+	}
+	if !entry.Reaches(goal) || entry.Reached() != goal {
+		t.Errorf("NewEntryPoint() doesn't reach %v", goal)
+	}
+	if p.Reaches(goal) || !goal.Reaches(goal) {
+		t.Errorf("Reaches() holds for the waypoint itself only, or its entry points")
+	}
+}
@@ -8,9 +8,15 @@ import (
 type AlgorithmType string
 
 const (
-	RRT     AlgorithmType = "rrt"
-	RRTStar AlgorithmType = "rrtstar"
-	AntPath AlgorithmType = "antpath"
+	RRT        AlgorithmType = "rrt"
+	RRTStar    AlgorithmType = "rrtstar"
+	AntPath    AlgorithmType = "antpath"
+	RRTConnect AlgorithmType = "rrtconnect"
+	PRM        AlgorithmType = "prm"
+	VisGraph   AlgorithmType = "visgraph"
+	AStar      AlgorithmType = "astar"
+	ThetaStar  AlgorithmType = "thetastar"
+	Portfolio  AlgorithmType = "portfolio"
 	// TODO: Decide which one
 	DEFAULT_ALGORITHM AlgorithmType = RRTStar
 )
@@ -18,13 +24,34 @@ const (
 // Validate algorithm type (enforce enum)
 func (a AlgorithmType) Validate() error {
 	switch a {
-	case RRT, RRTStar, AntPath:
+	case RRT, RRTStar, AntPath, RRTConnect, PRM, VisGraph, AStar, ThetaStar, Portfolio:
 		return nil
 	default:
-		return fmt.Errorf("invalid algorithm type: %s, available options are %s, %s, %s", a, RRT, RRTStar, AntPath)
+		return fmt.Errorf("invalid algorithm type: %s, available options are %s, %s, %s, %s, %s, %s, %s, %s, %s", a, RRT, RRTStar, AntPath, RRTConnect, PRM, VisGraph, AStar, ThetaStar, Portfolio)
 	}
 }
 
+// HonoursAcceptanceRadius tells if the algorithm ends a leg where it enters the acceptance radius of its goal, the others plan to the goal itself
+func (a AlgorithmType) HonoursAcceptanceRadius() bool {
+	return a == RRT || a == RRTStar
+}
+
+// HonoursSpaceParameters tells if the algorithm reads planning_3d and max_gradient, the others ignore them
+func (a AlgorithmType) HonoursSpaceParameters() bool {
+	return a == RRT || a == RRTStar
+}
+
+// HonoursSchedule tells if the algorithm checks the constraints as they are when the vehicle gets there, the others block
+// the time-windowed ones all the time and the moving ones where they are at their reference time
+func (a AlgorithmType) HonoursSchedule() bool {
+	return a != AStar && a != ThetaStar && a != AntPath
+}
+
+// HonoursSoftConstraints tells if the algorithm weighs crossing a soft constraint against going around it, antpath only goes around the hard ones
+func (a AlgorithmType) HonoursSoftConstraints() bool {
+	return a != AntPath
+}
+
 func (a *AlgorithmType) UnmarshalJSON(data []byte) error {
     var value string
     if err := json.Unmarshal(data, &value); err != nil {
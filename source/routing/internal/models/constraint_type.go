@@ -0,0 +1,36 @@
+package models
+
+import "fmt"
+
+// ConstraintType is read from the constraint_type property of every constraint.
+// Hard constraints are no-fly zones, soft ones can be crossed but every mt inside them costs cost_multiplier times more.
+type ConstraintType string
+
+const (
+	Hard                    ConstraintType = "hard"
+	Soft                    ConstraintType = "soft"
+	DEFAULT_CONSTRAINT_TYPE ConstraintType = Hard
+	DEFAULT_COST_MULTIPLIER                = 2.0
+)
+
+// Validate constraint type (enforce enum)
+func (c ConstraintType) Validate() error {
+	switch c {
+	case Hard, Soft:
+		return nil
+	default:
+		return fmt.Errorf("invalid constraint type: %s, available options are %s, %s", c, Hard, Soft)
+	}
+}
+
+// SplitConstraints separates the obstacles from the soft constraints, keeping their order
+func SplitConstraints(constraints []*Feature3D) (hard, soft []*Feature3D) {
+	for _, c := range constraints {
+		if c.IsSoft() {
+			soft = append(soft, c)
+		} else {
+			hard = append(hard, c)
+		}
+	}
+	return hard, soft
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/dhconnelly/rtreego"
 	"github.com/paulmach/orb"
@@ -15,6 +16,13 @@ type Feature3D struct {
 	*geojson.Feature
 	MinAltitude Altitude
 	MaxAltitude Altitude
+
+	// Time window and motion, parsed once from the properties when the feature is validated
+	activeFrom    time.Time
+	activeUntil   time.Time
+	speedMs       float64
+	headingDeg    float64
+	referenceTime time.Time
 }
 
 func NewFeatureFromGeojsonFeature(feature *geojson.Feature) (*Feature3D, error) {
@@ -37,6 +45,15 @@ func NewFeatureFromGeojsonFeature(feature *geojson.Feature) (*Feature3D, error)
 	if err := c.SetAltitude(minAlt, maxAlt); err != nil {
 		return nil, err
 	}
+	if err := c.validateConstraintType(); err != nil {
+		return nil, err
+	}
+	if err := c.validateTimeWindow(); err != nil {
+		return nil, err
+	}
+	if err := c.validateMotion(); err != nil {
+		return nil, err
+	}
 
 	return c, nil
 }
@@ -130,6 +147,15 @@ func (c *Feature3D) UnmarshalJSON(data []byte) error {
 	if err := c.SetAltitude(minAlt, maxAlt); err != nil {
 		return err
 	}
+	if err := c.validateConstraintType(); err != nil {
+		return err
+	}
+	if err := c.validateTimeWindow(); err != nil {
+		return err
+	}
+	if err := c.validateMotion(); err != nil {
+		return err
+	}
 
 	return nil
 }
@@ -138,6 +164,30 @@ func (c *Feature3D) MarshalJSON() ([]byte, error) {
 	return c.Feature.MarshalJSON()
 }
 
+func (c *Feature3D) Type() ConstraintType {
+	return ConstraintType(c.Feature.Properties.MustString("constraint_type", string(DEFAULT_CONSTRAINT_TYPE)))
+}
+
+func (c *Feature3D) IsSoft() bool {
+	return c.Type() == Soft
+}
+
+// CostMultiplier is how many times more it costs to fly inside a soft constraint
+func (c *Feature3D) CostMultiplier() float64 {
+	return c.Feature.Properties.MustFloat64("cost_multiplier", DEFAULT_COST_MULTIPLIER)
+}
+
+func (c *Feature3D) validateConstraintType() error {
+	if err := c.Type().Validate(); err != nil {
+		return err
+	}
+	// Crossing a soft constraint can't be cheaper than going around it
+	if c.IsSoft() && c.CostMultiplier() < 1 {
+		return fmt.Errorf("cost_multiplier of soft constraints must be at least 1, got %f", c.CostMultiplier())
+	}
+	return nil
+}
+
 func (c *Feature3D) GetVertices(alt Altitude, reversed bool) []*Waypoint {
 	polygon := c.ToPolygon()
 	if len(polygon) == 0 {
@@ -234,7 +284,7 @@ func (c *Feature3D) ToPolygol() [][][][]float64 {
 // Implement rtreego.Spatial interface so to use waypoint with the rtree
 func (c *Feature3D) Bounds() rtreego.Rect {
 	// Create rtreego point
-	rect, err := rtreego.NewRectFromPoints(rtreego.Point{c.Bound().Min.Lon(), c.Bound().Min.Lat(), c.MinAltitude.Normalize().Value}, rtreego.Point{c.Bound().Max.Lon(), c.Bound().Max.Lat(), c.MaxAltitude.Normalize().Value})
+	rect, err := rtreego.NewRectFromPoints(rtreego.Point{c.Bound().Min.Lon(), c.Bound().Min.Lat(), c.MinAltitude.Normalize().Value / METERS_PER_DEGREE}, rtreego.Point{c.Bound().Max.Lon(), c.Bound().Max.Lat(), c.MaxAltitude.Normalize().Value / METERS_PER_DEGREE})
 	if err != nil {
 		panic(err)
 	}
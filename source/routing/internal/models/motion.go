@@ -0,0 +1,82 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/paulmach/orb/geo"
+)
+
+// SpeedMs is how fast the constraint moves, from the property speed_ms. Constraints are still by default.
+func (c *Feature3D) SpeedMs() float64 {
+	return c.speedMs
+}
+
+// HeadingDeg is where the constraint moves to, in degrees clockwise from north, from the property heading_deg
+func (c *Feature3D) HeadingDeg() float64 {
+	return c.headingDeg
+}
+
+// ReferenceTime is when the constraint is where its geometry says, from the RFC3339 property reference_time
+func (c *Feature3D) ReferenceTime() time.Time {
+	return c.referenceTime
+}
+
+// IsMoving tells if the constraint moves in a straight line at constant speed, like a weather cell
+func (c *Feature3D) IsMoving() bool {
+	return c.speedMs > 0
+}
+
+// IsTimeDependent tells if the constraint blocks a point depends on when the point is reached
+func (c *Feature3D) IsTimeDependent() bool {
+	return c.IsTemporary() || c.IsMoving()
+}
+
+// Rewind returns where p is relative to the geometry of the constraint, when p is reached at t.
+// The constraint contains p at t if its geometry contains the rewound point, so the polygon is never moved.
+func (c *Feature3D) Rewind(p *Waypoint, t time.Time) *Waypoint {
+	if !c.IsMoving() {
+		return p
+	}
+	distance := c.speedMs * t.Sub(c.referenceTime).Seconds()
+	point := geo.PointAtBearingAndDistance(p.Point2D(), c.headingDeg+180, distance)
+	rewound, err := NewWaypoint(point.Lat(), point.Lon(), p.Alt)
+	if err != nil {
+		return p
+	}
+	return rewound
+}
+
+// SplitTimeDependentConstraints separates the constraints always blocking the same area from the temporary or moving ones
+func SplitTimeDependentConstraints(constraints []*Feature3D) ([]*Feature3D, []*Feature3D) {
+	static := make([]*Feature3D, 0, len(constraints))
+	timeDependent := make([]*Feature3D, 0)
+	for _, c := range constraints {
+		if c.IsTimeDependent() {
+			timeDependent = append(timeDependent, c)
+		} else {
+			static = append(static, c)
+		}
+	}
+	return static, timeDependent
+}
+
+func (c *Feature3D) validateMotion() error {
+	speed := c.Feature.Properties.MustFloat64("speed_ms", 0)
+	if speed < 0 {
+		return fmt.Errorf("speed_ms can't be negative, got %f", speed)
+	}
+	if speed == 0 {
+		c.speedMs, c.headingDeg, c.referenceTime = 0, 0, time.Time{}
+		return nil
+	}
+	reference, err := c.propertyTime("reference_time")
+	if err != nil {
+		return fmt.Errorf("reference_time must be an RFC3339 time: %w", err)
+	}
+	if reference.IsZero() {
+		return fmt.Errorf("moving constraints need a reference_time")
+	}
+	c.speedMs, c.headingDeg, c.referenceTime = speed, c.Feature.Properties.MustFloat64("heading_deg", 0), reference
+	return nil
+}
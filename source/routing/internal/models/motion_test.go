@@ -0,0 +1,60 @@
+package models_test
+
+import (
+	"geopathplanner/routing/internal/models"
+	"geopathplanner/routing/internal/utils"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestFeature3D_Rewind(t *testing.T) {
+	feature := func(properties string) string {
+		return `{"type": "Feature", "properties": {` + properties + `}, "geometry": {"type": "Polygon", "coordinates": [[[4.0, 49.999], [4.002, 49.999], [4.002, 50.001], [4.0, 50.001], [4.0, 49.999]]]}}`
+	}
+	a, _ := models.NewAltitude(100, models.MT)
+	p := models.MustNewWaypoint(0, 50.0, 4.001, a)
+	reference, _ := time.Parse(time.RFC3339, "2026-10-17T10:00:00Z")
+
+	tests := []struct {
+		name       string // description of this test case
+		geojson    string
+		t          time.Time
+		wantMoving bool
+		wantDistMt float64 // distance of the rewound point from p
+		wantNorth  bool    // rewound point north of p
+		wantErr    bool
+	}{
+		{name: "Still", geojson: feature(``), t: reference.Add(time.Minute), wantMoving: false, wantDistMt: 0},
+		{name: "Moving east, after the reference time", geojson: feature(`"speed_ms": 10, "heading_deg": 90, "reference_time": "2026-10-17T10:00:00Z"`), t: reference.Add(time.Minute), wantMoving: true, wantDistMt: 600},
+		{name: "Moving south, after the reference time", geojson: feature(`"speed_ms": 5, "heading_deg": 180, "reference_time": "2026-10-17T10:00:00Z"`), t: reference.Add(time.Minute), wantMoving: true, wantDistMt: 300, wantNorth: true},
+		{name: "Moving north, before the reference time", geojson: feature(`"speed_ms": 5, "heading_deg": 0, "reference_time": "2026-10-17T10:00:00Z"`), t: reference.Add(-time.Minute), wantMoving: true, wantDistMt: 300, wantNorth: true},
+		{name: "Missing reference time", geojson: feature(`"speed_ms": 5`), wantErr: true},
+		{name: "Negative speed", geojson: feature(`"speed_ms": -5, "reference_time": "2026-10-17T10:00:00Z"`), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, gotErr := models.NewFeatureFromGeojson(tt.geojson)
+			if gotErr != nil {
+				if !tt.wantErr {
+					t.Errorf("NewFeatureFromGeojson() failed: %v", gotErr)
+				}
+				return
+			}
+			if tt.wantErr {
+				t.Fatal("NewFeatureFromGeojson() succeeded unexpectedly")
+			}
+
+			if got.IsMoving() != tt.wantMoving || got.IsTimeDependent() != tt.wantMoving {
+				t.Errorf("IsMoving() = %t, IsTimeDependent() = %t, want %t", got.IsMoving(), got.IsTimeDependent(), tt.wantMoving)
+			}
+			rewound := got.Rewind(p, tt.t)
+			if dist := utils.HaversineDistance3D(p, rewound); math.Abs(dist-tt.wantDistMt) > 1 {
+				t.Errorf("Rewind() is %.3f mt from p, want %.3f mt", dist, tt.wantDistMt)
+			}
+			if tt.wantDistMt > 0 && (rewound.Lat > p.Lat) != tt.wantNorth {
+				t.Errorf("Rewind() = %v, north of p: %t, want %t", rewound, rewound.Lat > p.Lat, tt.wantNorth)
+			}
+		})
+	}
+}
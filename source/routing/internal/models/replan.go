@@ -0,0 +1,29 @@
+package models
+
+import "fmt"
+
+// Replan asks to fix the route of a previous request from where the vehicle is now, after the constraints changed
+type Replan struct {
+	PreviousRequestID    string       `json:"previous_request_id"`    // request whose route is being flown
+	CurrentPosition      *Waypoint    `json:"current_position"`       // where the vehicle is, on or near the previous route
+	AddedConstraints     []*Feature3D `json:"added_constraints"`      // constraints that appeared since the previous request
+	RemovedConstraintIDs []string     `json:"removed_constraint_ids"` // id of the constraints of the previous request that are gone
+}
+
+func (r *Replan) Validate() error {
+	if r.PreviousRequestID == "" {
+		return fmt.Errorf("replan needs the previous_request_id")
+	}
+	if r.CurrentPosition == nil {
+		return fmt.Errorf("replan needs the current_position of the vehicle")
+	}
+	return nil
+}
+
+// ConstraintID is the id of the geojson feature, as a string, empty if it has none
+func (c *Feature3D) ConstraintID() string {
+	if c.Feature.ID == nil {
+		return ""
+	}
+	return fmt.Sprint(c.Feature.ID)
+}
@@ -13,6 +13,11 @@ type RoutingRequest struct {
 	Constraints []*Feature3D  	`json:"constraints"` 	// constraints
 	SearchVolume *Feature3D 	`json:"search_volume"` 	// search area
 	Parameters  map[string]any 	`json:"parameters"`  	// optional additional params (may be related to algorithm, may not)
+	WindField   *WindField     	`json:"wind_field"`  	// optional wind grid, inline or from a file of the wind data directory
+	ChargingSites []*Waypoint   `json:"charging_sites"` // optional sites where the battery can be recharged, used with parameters.energy
+	DepartureTime *time.Time    `json:"departure_time"` // optional RFC3339 take-off time, to plan against the time windows of the constraints
+	Vehicles    []*Vehicle      `json:"vehicles"`     	// optional, several vehicles flying at once: one route each instead of the one of waypoints
+	Replan      *Replan         `json:"replan"`       	// optional, repair the route of a previous request instead of planning a new one
 	ReceivedAt  time.Time      	`json:"received_at"` 	// when request arrived (unix timestamp)
 }
 
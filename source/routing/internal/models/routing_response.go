@@ -26,9 +26,47 @@ type RoutingResponse struct {
 	*RoutingRequest
 	RouteFound  bool       `json:"route_found"`  // true if route was computed
 	Route       []*Waypoint `json:"route"`        // final route if found
-	CostKm      float64    `json:"cost_km"`      // optional, distance
+	CostKm      float64    `json:"cost_km"`      // in the units of parameters.cost despite the name: mt for distance (the default), s for time, a score for weights
 	Message     string     `json:"message"`      // error or informational message
 	CompletedAt time.Time  `json:"completed_at"` // when response generated
+	InformedImprovementKm *float64 `json:"informed_improvement_km,omitempty"` // cost (mt) of plain RRT* on the same seed and budget minus the one of the algorithm, when parameters.informed and parameters.compare_plain are set and plain RRT* found a route
+	DeadlineReached bool   `json:"deadline_reached"` // true if the route is the best found before time_budget_ms expired
+	CostBeforePostprocessKm float64 `json:"cost_before_postprocess_km"` // cost of the route returned by the algorithm, in the units of cost_km, when parameters.postprocess is set
+	WaypointOrder []int `json:"waypoint_order"` // index in the request waypoints of every visited one, when parameters.optimize_order is set
+	Alternatives []*RouteAlternative `json:"alternatives"` // route first, then the ones different enough from it, when parameters.num_alternatives is set
+	LegFlightTimesS []float64 `json:"leg_flight_times_s"` // estimated flight time between consecutive waypoints, when there is a wind field or parameters.cost is time
+	Energy *EnergyReport `json:"energy"` // battery use along the route, when parameters.energy is set
+	VehicleRoutes []*VehicleRoute `json:"vehicle_routes"` // one route per vehicle, in the order of the request, when vehicles are set
+	ReplannedSegments int `json:"replanned_segments"` // segments of the previous route planned again, when replan is set
+	LegAlgorithms []AlgorithmType `json:"leg_algorithms"` // algorithm that planned every pair of consecutive waypoints, when parameters.fallback_algorithms is set and the order was not optimized
+	PortfolioStats []*PortfolioCandidate `json:"portfolio_stats"` // how every candidate did on every leg, when the algorithm is portfolio and the order was not optimized
+	Corridor *Feature3D `json:"corridor"` // route buffered by the half-widths and clear of the constraints, when parameters.corridor is set
+}
+
+// One of the routes the operator can pick, with the metrics to compare it with the others
+type RouteAlternative struct {
+	Route              []*Waypoint `json:"route"`
+	CostKm             float64     `json:"cost_km"`               // in the units of the cost_km of the response
+	DistanceFromBestMt float64     `json:"distance_from_best_mt"` // Hausdorff distance from the route of the response
+	MinClearanceMt     float64     `json:"min_clearance_mt"`      // smallest distance from the constraints, -1 if none is at the route altitudes
+}
+
+// How one candidate of the portfolio algorithm did on one leg
+type PortfolioCandidate struct {
+	Leg        int     `json:"leg"`       // index of the pair of consecutive waypoints
+	Candidate  string  `json:"candidate"` // name given in parameters.portfolio, or the algorithm
+	Found      bool    `json:"found"`     // true if it found a collision-free route in time
+	CostKm     float64 `json:"cost_km"`   // in the units of the cost_km of the response
+	DurationMs float64 `json:"duration_ms"`
+	Selected   bool    `json:"selected"` // true for the cheapest route, the one kept
+	Error      string  `json:"error"`
+}
+
+// Battery use along the route
+type EnergyReport struct {
+	Feasible      bool      `json:"feasible"`       // true if the reserve is left at every wp
+	RemainingWh   []float64 `json:"remaining_wh"`   // energy left on arrival at every wp of the route
+	ChargingStops []int     `json:"charging_stops"` // index in the route of the charging sites where the battery is recharged
 }
 
 // Success response
@@ -55,4 +93,10 @@ func NewRoutingResponseError(routingRequest *RoutingRequest, message string) *Ro
 		Message:     message,
 		CompletedAt: now,
 	}
-}
\ No newline at end of file
+}
+
+// Mark the response as cut short by the time budget
+func (r *RoutingResponse) SetDeadlineReached() {
+	r.DeadlineReached = true
+	r.Message = "Route computed within time budget (best found before deadline)"
+}
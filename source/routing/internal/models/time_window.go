@@ -0,0 +1,61 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// Key of the parameters where the service puts the departure time of the request, so that routes are planned against arrival times
+	DEPARTURE_TIME_PARAMETER = "departure_time"
+)
+
+// ActiveFrom is when the constraint starts blocking, from the RFC3339 property active_from. Zero if always active in the past.
+func (c *Feature3D) ActiveFrom() time.Time {
+	return c.activeFrom
+}
+
+// ActiveUntil is when the constraint stops blocking, from the RFC3339 property active_until. Zero if active forever.
+func (c *Feature3D) ActiveUntil() time.Time {
+	return c.activeUntil
+}
+
+// IsTemporary tells if the constraint blocks only within a time window
+func (c *Feature3D) IsTemporary() bool {
+	return !c.activeFrom.IsZero() || !c.activeUntil.IsZero()
+}
+
+// IsActiveAt tells if the constraint blocks at time t, which is within [active_from, active_until)
+func (c *Feature3D) IsActiveAt(t time.Time) bool {
+	if !c.activeFrom.IsZero() && t.Before(c.activeFrom) {
+		return false
+	}
+	if !c.activeUntil.IsZero() && !t.Before(c.activeUntil) {
+		return false
+	}
+	return true
+}
+
+func (c *Feature3D) propertyTime(key string) (time.Time, error) {
+	value := c.Feature.Properties.MustString(key, "")
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+func (c *Feature3D) validateTimeWindow() error {
+	from, err := c.propertyTime("active_from")
+	if err != nil {
+		return fmt.Errorf("active_from must be an RFC3339 time: %w", err)
+	}
+	until, err := c.propertyTime("active_until")
+	if err != nil {
+		return fmt.Errorf("active_until must be an RFC3339 time: %w", err)
+	}
+	if !from.IsZero() && !until.IsZero() && !until.After(from) {
+		return fmt.Errorf("active_until (%v) must be after active_from (%v)", until, from)
+	}
+	c.activeFrom, c.activeUntil = from, until
+	return nil
+}
@@ -0,0 +1,55 @@
+package models_test
+
+import (
+	"geopathplanner/routing/internal/models"
+	"testing"
+	"time"
+)
+
+func TestFeature3D_IsActiveAt(t *testing.T) {
+	feature := func(properties string) string {
+		return `{"type": "Feature", "properties": {` + properties + `}, "geometry": {"type": "Polygon", "coordinates": [[[4.0, 49.999], [4.002, 49.999], [4.002, 50.001], [4.0, 50.001], [4.0, 49.999]]]}}`
+	}
+	before, _ := time.Parse(time.RFC3339, "2026-10-17T09:00:00Z")
+	within, _ := time.Parse(time.RFC3339, "2026-10-17T10:30:00+00:00")
+	after, _ := time.Parse(time.RFC3339, "2026-10-17T11:00:00Z")
+
+	tests := []struct {
+		name          string // description of this test case
+		geojson       string
+		wantTemporary bool
+		wantActive    []bool // before, within and after the window
+		wantErr       bool
+	}{
+		{name: "Permanent", geojson: feature(``), wantTemporary: false, wantActive: []bool{true, true, true}},
+		{name: "Window", geojson: feature(`"active_from": "2026-10-17T10:00:00Z", "active_until": "2026-10-17T11:00:00Z"`), wantTemporary: true, wantActive: []bool{false, true, false}},
+		{name: "Window in another time zone", geojson: feature(`"active_from": "2026-10-17T12:00:00+02:00", "active_until": "2026-10-17T13:00:00+02:00"`), wantTemporary: true, wantActive: []bool{false, true, false}},
+		{name: "Only from", geojson: feature(`"active_from": "2026-10-17T10:00:00Z"`), wantTemporary: true, wantActive: []bool{false, true, true}},
+		{name: "Only until", geojson: feature(`"active_until": "2026-10-17T11:00:00Z"`), wantTemporary: true, wantActive: []bool{true, true, false}},
+		{name: "Not RFC3339", geojson: feature(`"active_from": "17/10/2026 10:00"`), wantErr: true},
+		{name: "Until before from", geojson: feature(`"active_from": "2026-10-17T11:00:00Z", "active_until": "2026-10-17T10:00:00Z"`), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, gotErr := models.NewFeatureFromGeojson(tt.geojson)
+			if gotErr != nil {
+				if !tt.wantErr {
+					t.Errorf("NewFeatureFromGeojson() failed: %v", gotErr)
+				}
+				return
+			}
+			if tt.wantErr {
+				t.Fatal("NewFeatureFromGeojson() succeeded unexpectedly")
+			}
+
+			if got.IsTemporary() != tt.wantTemporary {
+				t.Errorf("IsTemporary() = %t, want %t", got.IsTemporary(), tt.wantTemporary)
+			}
+			for i, at := range []time.Time{before, within, after} {
+				if active := got.IsActiveAt(at); active != tt.wantActive[i] {
+					t.Errorf("IsActiveAt(%v) = %t, want %t", at, active, tt.wantActive[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// Vehicle is one of the drones of a multi-vehicle request, flying its own waypoints
+type Vehicle struct {
+	ID            string      `json:"id"`
+	Waypoints     []*Waypoint `json:"waypoints"`      // at least 2 waypoints
+	AirspeedMs    float64     `json:"airspeed_ms"`    // optional, parameters.airspeed_ms if not set
+	DepartureTime *time.Time  `json:"departure_time"` // optional RFC3339 take-off time, the departure time of the request if not set
+}
+
+// Route planned for one vehicle, kept apart from the routes of the others
+type VehicleRoute struct {
+	ID            string      `json:"id"`
+	Route         []*Waypoint `json:"route"`
+	CostKm        float64     `json:"cost_km"`        // in the units of parameters.cost, like the cost_km of the response
+	DepartureTime time.Time   `json:"departure_time"`
+	ArrivalTime   time.Time   `json:"arrival_time"` // estimated, at the airspeed of the vehicle in the wind of the request
+}
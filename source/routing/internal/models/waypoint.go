@@ -16,13 +16,17 @@ import (
 const (
 	TOLERANCE = 0.0001
 	NUM_SIDES = 32
+	// Meters in a degree of latitude, or of longitude at the equator.
+	// Altitudes go in the rtrees in degrees as well, otherwise their euclidean distance would weigh 1 mt of altitude as 1 degree of lat/lon
+	METERS_PER_DEGREE float64 = 111320.0
 )
 
 type Waypoint struct {
 	*geojson.Feature
-	Lat float64
-	Lon float64
-	Alt Altitude
+	Lat     float64
+	Lon     float64
+	Alt     Altitude
+	reached *Waypoint // waypoint whose acceptance radius the route entered here, if any
 }
 
 // NewWaypoint is a constructor with validation
@@ -127,6 +131,11 @@ func (w *Waypoint) UnmarshalJSON(data []byte) error {
 	w.Lon = w.Feature.Point().Lon()
 	w.SetAltitude(alt)
 
+	if radius, ok := w.Feature.Properties["acceptance_radius_mt"]; ok {
+		if r, isNumber := radius.(float64); !isNumber || r < 0 {
+			return fmt.Errorf("acceptance_radius_mt must be a non-negative number, got %v", radius)
+		}
+	}
 	return nil
 }
 
@@ -253,7 +262,7 @@ func (w *Waypoint) GetLineStringBoundFeature(w2 *Waypoint) *geojson.Feature {
 // Implement rtreego.Spatial interface so to use waypoint with the rtree
 
 func (w *Waypoint) RTreePoint() rtreego.Point {
-	return rtreego.Point{w.Lon, w.Lat, w.Alt.Normalize().Value}
+	return rtreego.Point{w.Lon, w.Lat, w.Alt.Normalize().Value / METERS_PER_DEGREE}
 }
 
 func (w *Waypoint) Bounds() rtreego.Rect {
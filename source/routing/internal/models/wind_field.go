@@ -0,0 +1,152 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const (
+	// Key of the parameters where the service puts the wind field of the request, for the cost functions of the algorithms
+	WIND_FIELD_PARAMETER = "wind_field"
+)
+
+// WindField is a regular lat/lon/altitude grid of wind vectors, in m/s toward east (U) and north (V).
+// U and V are indexed [altitude][lat][lon], starting from MinAltMt, MinLat and MinLon.
+// Instead of the grid, File can name a json file containing it, relative to the wind data directory of the service.
+type WindField struct {
+	File      string        `json:"file,omitempty"`
+	MinLat    float64       `json:"min_lat"`
+	MinLon    float64       `json:"min_lon"`
+	MinAltMt  float64       `json:"min_alt_mt"`
+	LatStep   float64       `json:"lat_step"`
+	LonStep   float64       `json:"lon_step"`
+	AltStepMt float64       `json:"alt_step_mt"`
+	U         [][][]float64 `json:"u"`
+	V         [][][]float64 `json:"v"`
+}
+
+// UnmarshalJSON reads the grid inline and checks its shape.
+// A File is only kept as a reference: the grid is read by Load, against the directory the service allows.
+func (w *WindField) UnmarshalJSON(data []byte) error {
+	type windField WindField
+	var tmp windField
+	if err := json.Unmarshal(data, &tmp); err != nil {
+		return err
+	}
+
+	if tmp.File != "" {
+		*w = WindField{File: tmp.File}
+		return nil
+	}
+
+	*w = WindField(tmp)
+	return w.Validate()
+}
+
+// Load reads the grid of File from dir, nothing to do if the grid is inline.
+// File must be a relative path inside dir: absolute paths and ".." are rejected.
+func (w *WindField) Load(dir string) error {
+	if w.File == "" {
+		return nil
+	}
+	if dir == "" {
+		return fmt.Errorf("wind field files are not enabled, the grid must be inline")
+	}
+	file := w.File
+	if filepath.IsAbs(file) || slices.Contains(strings.Split(filepath.ToSlash(file), "/"), "..") {
+		return fmt.Errorf("wind field file must be relative to the wind data directory, got %s", file)
+	}
+
+	content, err := os.ReadFile(filepath.Join(dir, file))
+	if err != nil {
+		return fmt.Errorf("reading wind field %s: %w", file, err)
+	}
+	type windField WindField
+	var tmp windField
+	if err := json.Unmarshal(content, &tmp); err != nil {
+		return fmt.Errorf("unmarshaling wind field %s: %w", file, err)
+	}
+	tmp.File = file
+
+	*w = WindField(tmp)
+	return w.Validate()
+}
+
+// MarshalJSON writes just the file reference when the grid was read from a file
+func (w *WindField) MarshalJSON() ([]byte, error) {
+	if w.File != "" {
+		return json.Marshal(map[string]string{"file": w.File})
+	}
+	type windField WindField
+	return json.Marshal((*windField)(w))
+}
+
+// Validate checks that U and V have the same non-empty shape and that the steps are positive
+func (w *WindField) Validate() error {
+	if len(w.U) == 0 || len(w.U[0]) == 0 || len(w.U[0][0]) == 0 {
+		return fmt.Errorf("wind field is empty")
+	}
+	if w.LatStep <= 0 || w.LonStep <= 0 || (len(w.U) > 1 && w.AltStepMt <= 0) {
+		return fmt.Errorf("wind field steps must be positive")
+	}
+
+	if len(w.V) != len(w.U) {
+		return fmt.Errorf("wind field u and v have different shapes")
+	}
+	for k := range w.U {
+		if len(w.U[k]) != len(w.U[0]) || len(w.V[k]) != len(w.U[0]) {
+			return fmt.Errorf("wind field layer %d has a different number of rows", k)
+		}
+		for i := range w.U[k] {
+			if len(w.U[k][i]) != len(w.U[0][0]) || len(w.V[k][i]) != len(w.U[0][0]) {
+				return fmt.Errorf("wind field row %d of layer %d has a different number of columns", i, k)
+			}
+		}
+	}
+	return nil
+}
+
+// At interpolates (trilinearly) the wind at the given position. Outside the grid the nearest border values are used.
+func (w *WindField) At(lat, lon, altMt float64) (float64, float64) {
+	k0, k1, fk := gridCell(altMt, w.MinAltMt, w.AltStepMt, len(w.U))
+	i0, i1, fi := gridCell(lat, w.MinLat, w.LatStep, len(w.U[0]))
+	j0, j1, fj := gridCell(lon, w.MinLon, w.LonStep, len(w.U[0][0]))
+
+	interpolate := func(grid [][][]float64) float64 {
+		bilinear := func(layer [][]float64) float64 {
+			south := layer[i0][j0]*(1-fj) + layer[i0][j1]*fj
+			north := layer[i1][j0]*(1-fj) + layer[i1][j1]*fj
+			return south*(1-fi) + north*fi
+		}
+		return bilinear(grid[k0])*(1-fk) + bilinear(grid[k1])*fk
+	}
+	return interpolate(w.U), interpolate(w.V)
+}
+
+// MaxSpeed is the strongest wind of the grid (m/s): no interpolated wind can be stronger
+func (w *WindField) MaxSpeed() float64 {
+	maxSpeed := 0.0
+	for k := range w.U {
+		for i := range w.U[k] {
+			for j := range w.U[k][i] {
+				maxSpeed = math.Max(maxSpeed, math.Hypot(w.U[k][i][j], w.V[k][i][j]))
+			}
+		}
+	}
+	return maxSpeed
+}
+
+// gridCell returns the indexes of the two grid points around value along one axis, and how far value is from the first one (0 to 1)
+func gridCell(value, origin, step float64, n int) (int, int, float64) {
+	if n == 1 {
+		return 0, 0, 0
+	}
+	pos := math.Max(0, math.Min((value-origin)/step, float64(n-1)))
+	i0 := min(int(pos), n-2)
+	return i0, i0 + 1, pos - float64(i0)
+}
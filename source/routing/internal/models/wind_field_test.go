@@ -0,0 +1,122 @@
+package models_test
+
+import (
+	"encoding/json"
+	"geopathplanner/routing/internal/models"
+	"geopathplanner/routing/internal/utils"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestWindField_UnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name     string // description of this test case
+		data     string
+		wantFile string
+		wantErr  bool
+	}{
+		{name: "Inline", data: `{"min_lat": 50, "min_lon": 4, "lat_step": 0.01, "lon_step": 0.01, "u": [[[1, 2], [3, 4]]], "v": [[[0, 0], [0, 0]]]}`},
+		{name: "File reference", data: `{"file": "wind_field_example.json"}`, wantFile: "wind_field_example.json"},
+		{name: "File is not read", data: `{"file": "/etc/passwd"}`, wantFile: "/etc/passwd"},
+		{name: "Empty", data: `{"lat_step": 0.01, "lon_step": 0.01, "u": [], "v": []}`, wantErr: true},
+		{name: "Different shapes", data: `{"lat_step": 0.01, "lon_step": 0.01, "u": [[[1, 2], [3, 4]]], "v": [[[0, 0], [0]]]}`, wantErr: true},
+		{name: "Missing altitude step", data: `{"lat_step": 0.01, "lon_step": 0.01, "u": [[[1]], [[2]]], "v": [[[0]], [[0]]]}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got models.WindField
+			gotErr := json.Unmarshal([]byte(tt.data), &got)
+			if gotErr != nil {
+				if !tt.wantErr {
+					t.Errorf("UnmarshalJSON() failed: %v", gotErr)
+				}
+				return
+			}
+			if tt.wantErr {
+				t.Fatal("UnmarshalJSON() succeeded unexpectedly")
+			}
+			if got.File != tt.wantFile {
+				t.Errorf("UnmarshalJSON() file = %s, want %s", got.File, tt.wantFile)
+			}
+
+			// Grids read from a file are written back as the file reference only
+			data, err := json.Marshal(&got)
+			if err != nil {
+				t.Fatalf("MarshalJSON() failed: %v", err)
+			}
+			if hasGrid := strings.Contains(string(data), `"u"`); hasGrid != (tt.wantFile == "") {
+				t.Errorf("MarshalJSON() = %s, contains the grid: %t", data, hasGrid)
+			}
+		})
+	}
+}
+
+func TestWindField_Load(t *testing.T) {
+	dir := utils.ResolvePath("dev/requests")
+	tests := []struct {
+		name    string // description of this test case
+		dir     string
+		file    string
+		wantErr bool
+	}{
+		{name: "Inline", dir: "", file: ""},
+		{name: "From file", dir: dir, file: "wind_field_example.json"},
+		{name: "No directory", dir: "", file: "wind_field_example.json", wantErr: true},
+		{name: "Missing file", dir: dir, file: "does_not_exist.json", wantErr: true},
+		{name: "Absolute path", dir: dir, file: utils.ResolvePath("dev/requests/wind_field_example.json"), wantErr: true},
+		{name: "Outside the directory", dir: dir, file: "../requests/wind_field_example.json", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &models.WindField{File: tt.file}
+			gotErr := w.Load(tt.dir)
+			if gotErr != nil {
+				if !tt.wantErr {
+					t.Errorf("Load() failed: %v", gotErr)
+				}
+				return
+			}
+			if tt.wantErr {
+				t.Fatal("Load() succeeded unexpectedly")
+			}
+			if tt.file != "" && (w.File != tt.file || len(w.U) == 0) {
+				t.Errorf("Load() = %+v, want the grid of %s", w, tt.file)
+			}
+		})
+	}
+}
+
+func TestWindField_At(t *testing.T) {
+	w := &models.WindField{
+		MinLat: 50, MinLon: 4, MinAltMt: 0, LatStep: 0.01, LonStep: 0.02, AltStepMt: 100,
+		U: [][][]float64{{{0, 2}, {4, 6}}, {{10, 12}, {14, 16}}},
+		V: [][][]float64{{{1, 1}, {1, 1}}, {{-1, -1}, {-1, -1}}},
+	}
+
+	tests := []struct {
+		name  string // description of this test case
+		lat   float64
+		lon   float64
+		altMt float64
+		wantU float64
+		wantV float64
+	}{
+		{name: "Grid point", lat: 50.01, lon: 4.02, altMt: 0, wantU: 6, wantV: 1},
+		{name: "Middle of a cell", lat: 50.005, lon: 4.01, altMt: 50, wantU: 8, wantV: 0},
+		{name: "Between two altitudes", lat: 50, lon: 4, altMt: 25, wantU: 2.5, wantV: 0.5},
+		{name: "Outside the grid", lat: 49, lon: 5, altMt: 1000, wantU: 12, wantV: -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotU, gotV := w.At(tt.lat, tt.lon, tt.altMt)
+			if math.Abs(gotU-tt.wantU) > 1e-9 || math.Abs(gotV-tt.wantV) > 1e-9 {
+				t.Errorf("At() = (%.3f, %.3f), want (%.3f, %.3f)", gotU, gotV, tt.wantU, tt.wantV)
+			}
+		})
+	}
+
+	if got, want := w.MaxSpeed(), math.Hypot(16, 1); math.Abs(got-want) > 1e-9 {
+		t.Errorf("MaxSpeed() = %.3f, want %.3f", got, want)
+	}
+}
@@ -0,0 +1,206 @@
+package ordering
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"geopathplanner/routing/internal/algorithm"
+	"geopathplanner/routing/internal/models"
+	"math"
+	"runtime"
+	"slices"
+	"sync"
+)
+
+// Mode tells which waypoints keep their place when the visiting order is optimized.
+type Mode string
+
+const (
+	OpenPath   Mode = "open"   // start from the first waypoint, end at any of them
+	ClosedTour Mode = "closed" // start from the first waypoint and come back to it
+	FixedEnds  Mode = "fixed"  // start from the first waypoint, end at the last one
+)
+
+// Optimizer looks for the visiting order of the mission waypoints with the cheapest route.
+// Costs between waypoints are obstacle-aware: every pair is planned with the chosen algorithm.
+type Optimizer struct {
+	Mode       Mode
+	MaxWorkers int
+	Asymmetric bool // legs may cost differently each way, e.g. flight time in the wind, so every pair is planned both ways
+}
+
+// NewOptimizerFromParameters reads parameters.optimize_order, one of "open", "closed" or "fixed".
+// Only the distance costs the same both ways: with any other parameters.cost, every pair is planned both ways.
+// Returns nil if the order was not requested, so waypoints are visited as given.
+func NewOptimizerFromParameters(parameters map[string]any) (*Optimizer, error) {
+	var mode Mode
+	switch v := parameters["optimize_order"].(type) {
+	case nil:
+		return nil, nil
+	case string:
+		mode = Mode(v)
+	default:
+		return nil, fmt.Errorf("optimize_order must be a string, got %T", v)
+	}
+
+	switch mode {
+	case "":
+		return nil, nil
+	case OpenPath, ClosedTour, FixedEnds:
+	default:
+		return nil, fmt.Errorf("optimize_order not recognized: %s (use %s, %s or %s)", mode, OpenPath, ClosedTour, FixedEnds)
+	}
+
+	cost, _ := parameters["cost"].(string)
+	asymmetric := parameters["cost"] != nil && cost != "distance"
+
+	fmt.Printf("ORDER\n")
+	fmt.Printf("optimize_order: %s\n", mode)
+	fmt.Printf("asymmetric: %t\n", asymmetric)
+	fmt.Printf("--------------------------------------------------------\n")
+
+	return &Optimizer{Mode: mode, Asymmetric: asymmetric}, nil
+}
+
+// Result of the optimization. Order holds the index in the input waypoints of every visited one, each exactly once.
+// Waypoints and Route follow that order, and for closed tours they come back to the first waypoint.
+type Result struct {
+	Order     []int
+	Waypoints []*models.Waypoint
+	Route     []*models.Waypoint
+	Cost      float64
+}
+
+// Optimize plans every pair of waypoints with algo, solves the visiting order on those costs and joins the legs of that order into the route.
+// Unless the optimizer is asymmetric, legs are assumed to cost the same both ways, so every pair is planned once.
+func (o *Optimizer) Optimize(ctx context.Context, algo algorithm.Algorithm, searchVolume *models.Feature3D, waypoints []*models.Waypoint, constraints []*models.Feature3D, parameters map[string]any, storageType models.StorageType) (*Result, error) {
+	if len(waypoints) < 2 {
+		return nil, fmt.Errorf("less than 2 waypoints submitted (%d): abort", len(waypoints))
+	}
+
+	costs, legs, err := o.costMatrix(ctx, algo, searchVolume, waypoints, constraints, parameters, storageType)
+	if err != nil {
+		return nil, err
+	}
+
+	order := SolveOrder(costs, o.Mode)
+	visits := order
+	if o.Mode == ClosedTour {
+		visits = append(slices.Clone(order), order[0])
+	}
+
+	result := &Result{
+		Order:     order,
+		Waypoints: make([]*models.Waypoint, 0, len(visits)),
+		Route:     []*models.Waypoint{waypoints[visits[0]]},
+	}
+	for k, i := range visits {
+		result.Waypoints = append(result.Waypoints, waypoints[i])
+		if k == 0 {
+			continue
+		}
+
+		prev := visits[k-1]
+		if math.IsInf(costs[prev][i], 1) {
+			return nil, fmt.Errorf("no order visits all waypoints: wp[%d] and wp[%d] can't be connected", prev, i)
+		}
+		result.Route = append(result.Route, legBetween(legs, prev, i)[1:]...)
+		result.Cost += costs[prev][i]
+	}
+
+	fmt.Printf("Optimized order %v: cost %.3f mt\n", order, result.Cost)
+	return result, nil
+}
+
+type pair struct {
+	i, j int
+}
+
+// costMatrix plans the route between every pair of waypoints, concurrently, in both ways if the optimizer is asymmetric.
+// Pairs that can't be connected cost +Inf.
+func (o *Optimizer) costMatrix(ctx context.Context, algo algorithm.Algorithm, searchVolume *models.Feature3D, waypoints []*models.Waypoint, constraints []*models.Feature3D, parameters map[string]any, storageType models.StorageType) ([][]float64, [][][]*models.Waypoint, error) {
+	n := len(waypoints)
+	costs := make([][]float64, n)
+	legs := make([][][]*models.Waypoint, n)
+	for i := range n {
+		costs[i] = make([]float64, n)
+		legs[i] = make([][]*models.Waypoint, n)
+	}
+
+	numPairs := n * (n - 1) / 2
+	if o.Asymmetric {
+		numPairs *= 2
+	}
+	maxWorkers := o.MaxWorkers
+	if maxWorkers <= 0 {
+		maxWorkers = runtime.NumCPU()
+	}
+	maxWorkers = min(maxWorkers, numPairs)
+	fmt.Printf("Cost matrix: %d pairs of waypoints with %d workers\n", numPairs, maxWorkers)
+
+	pairs := make(chan pair, numPairs)
+	for i := range n {
+		for j := range n {
+			if i < j || (o.Asymmetric && i > j) {
+				pairs <- pair{i, j}
+			}
+		}
+	}
+	close(pairs)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for range maxWorkers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for p := range pairs {
+				// Out of time, the pairs left are still planned on a best-effort basis
+				if errors.Is(ctx.Err(), context.Canceled) {
+					return
+				}
+
+				// Plan between copies: algorithms mark the wps they touch, and other workers may be using the same ones
+				start, end := copyWaypoint(waypoints[p.i]), copyWaypoint(waypoints[p.j])
+				route, cost, err := algo.Compute(ctx, searchVolume, []*models.Waypoint{start, end}, constraints, parameters, storageType)
+				if err != nil {
+					fmt.Printf("wp[%d] and wp[%d] can't be connected: %v\n", p.i, p.j, err)
+					route, cost = nil, math.Inf(1)
+				} else {
+					route[0], route[len(route)-1] = waypoints[p.i], waypoints[p.j]
+				}
+
+				mu.Lock()
+				costs[p.i][p.j] = cost
+				if !o.Asymmetric {
+					costs[p.j][p.i] = cost
+				}
+				legs[p.i][p.j] = route
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return nil, nil, fmt.Errorf("interrupted cost matrix: %w", ctx.Err())
+	}
+	return costs, legs, nil
+}
+
+// legBetween returns the route from wp[i] to wp[j], reversing the one planned from wp[j] to wp[i] if it was planned one way only.
+func legBetween(legs [][][]*models.Waypoint, i, j int) []*models.Waypoint {
+	if i < j || legs[i][j] != nil {
+		return legs[i][j]
+	}
+	leg := slices.Clone(legs[j][i])
+	slices.Reverse(leg)
+	return leg
+}
+
+func copyWaypoint(wp *models.Waypoint) *models.Waypoint {
+	cp, _ := models.NewWaypoint(wp.Lat, wp.Lon, wp.Alt)
+	cp.ID = wp.ID
+	return cp
+}
@@ -0,0 +1,203 @@
+package ordering_test
+
+import (
+	"context"
+	"geopathplanner/routing/internal/algorithm"
+	"geopathplanner/routing/internal/models"
+	"geopathplanner/routing/internal/ordering"
+	"geopathplanner/routing/internal/utils"
+	"maps"
+	"math"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+func TestSolveOrder(t *testing.T) {
+	// Random points in the plane, small enough to find the optimum by brute force
+	r := rand.New(rand.NewSource(945))
+	n := 8
+	xs, ys := make([]float64, n), make([]float64, n)
+	for i := range n {
+		xs[i], ys[i] = r.Float64()*1000, r.Float64()*1000
+	}
+	costs := make([][]float64, n)
+	// Like flying in a wind blowing east: going east is cheaper than coming back
+	windCosts := make([][]float64, n)
+	for i := range n {
+		costs[i] = make([]float64, n)
+		windCosts[i] = make([]float64, n)
+		for j := range n {
+			costs[i][j] = math.Hypot(xs[i]-xs[j], ys[i]-ys[j])
+			windCosts[i][j] = costs[i][j] - 0.5*(xs[j]-xs[i])
+		}
+	}
+
+	tests := []struct {
+		name  string // description of this test case
+		mode  ordering.Mode
+		costs [][]float64
+	}{
+		{name: "Open path", mode: ordering.OpenPath, costs: costs},
+		{name: "Closed tour", mode: ordering.ClosedTour, costs: costs},
+		{name: "Fixed start and end", mode: ordering.FixedEnds, costs: costs},
+		{name: "Open path with asymmetric costs", mode: ordering.OpenPath, costs: windCosts},
+		{name: "Closed tour with asymmetric costs", mode: ordering.ClosedTour, costs: windCosts},
+		{name: "Fixed start and end with asymmetric costs", mode: ordering.FixedEnds, costs: windCosts},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			costs := tt.costs
+			got := ordering.SolveOrder(costs, tt.mode)
+
+			if sorted := slices.Sorted(slices.Values(got)); !slices.Equal(sorted, []int{0, 1, 2, 3, 4, 5, 6, 7}) {
+				t.Fatalf("SolveOrder() = %v, not a permutation", got)
+			}
+			if got[0] != 0 {
+				t.Errorf("SolveOrder() = %v, doesn't start from 0", got)
+			}
+			if tt.mode == ordering.FixedEnds && got[n-1] != n-1 {
+				t.Errorf("SolveOrder() = %v, doesn't end at %d", got, n-1)
+			}
+
+			gotCost := ordering.OrderCost(costs, got, tt.mode)
+			bestCost := bruteForceCost(costs, tt.mode)
+			t.Logf("order: %v, cost: %.3f, optimum: %.3f", got, gotCost, bestCost)
+			if gotCost > bestCost*1.05 {
+				t.Errorf("SolveOrder() cost %.3f is more than 5%% worse than the optimum %.3f", gotCost, bestCost)
+			}
+		})
+	}
+}
+
+// bruteForceCost tries every order with the same fixed nodes as mode.
+func bruteForceCost(costs [][]float64, mode ordering.Mode) float64 {
+	n := len(costs)
+	free := []int{}
+	for i := 1; i < n; i++ {
+		if mode != ordering.FixedEnds || i != n-1 {
+			free = append(free, i)
+		}
+	}
+
+	best := math.Inf(1)
+	var permute func(k int)
+	permute = func(k int) {
+		if k == len(free) {
+			order := append([]int{0}, free...)
+			if mode == ordering.FixedEnds {
+				order = append(order, n-1)
+			}
+			best = math.Min(best, ordering.OrderCost(costs, order, mode))
+			return
+		}
+		for i := k; i < len(free); i++ {
+			free[k], free[i] = free[i], free[k]
+			permute(k + 1)
+			free[k], free[i] = free[i], free[k]
+		}
+	}
+	permute(0)
+	return best
+}
+
+func TestOptimizer_Optimize(t *testing.T) {
+	sv, w_list, c_list, c_overlapping := utils.SetupTestScenario()
+	// Same mission, listed in a worse order
+	shuffled := []*models.Waypoint{w_list[0], w_list[2], w_list[1], w_list[3]}
+	wind := &models.WindField{LatStep: 1, LonStep: 1, U: [][][]float64{{{10}}}, V: [][][]float64{{{0}}}}
+
+	tests := []struct {
+		name        string // description of this test case
+		storageType models.StorageType
+		// Named input parameters for target function.
+		searchVolume *models.Feature3D
+		waypoints    []*models.Waypoint
+		constraints  []*models.Feature3D
+		parameters   map[string]any
+		mode         string
+	}{
+		{name: "Open path with non-overlapping obstacles - RTREE", storageType: models.RTree, searchVolume: sv, waypoints: shuffled, constraints: c_list, mode: "open"},
+		{name: "Closed tour with overlapping obstacles - RTREE", storageType: models.RTree, searchVolume: sv, waypoints: shuffled, constraints: append(c_list, c_overlapping...), mode: "closed"},
+		{name: "Fixed ends with overlapping obstacles - LIST", storageType: models.List, searchVolume: sv, waypoints: shuffled, constraints: append(c_list, c_overlapping...), mode: "fixed"},
+		{name: "Open path in the wind with non-overlapping obstacles - RTREE", storageType: models.RTree, searchVolume: sv, waypoints: shuffled, constraints: c_list, parameters: map[string]any{"cost": "time", "airspeed_ms": 15.0, models.WIND_FIELD_PARAMETER: wind}, mode: "open"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			optimizerParameters := map[string]any{"optimize_order": tt.mode}
+			maps.Copy(optimizerParameters, tt.parameters)
+			o, err := ordering.NewOptimizerFromParameters(optimizerParameters)
+			if err != nil || o == nil {
+				t.Fatalf("could not construct optimizer: %v", err)
+			}
+			if _, timeCost := tt.parameters["cost"]; o.Asymmetric != timeCost {
+				t.Errorf("NewOptimizerFromParameters() asymmetric = %t, want %t", o.Asymmetric, timeCost)
+			}
+			// Visibility graph is deterministic, so the costs of the two orders can be compared
+			a, err := algorithm.NewVisGraphAlgorithm()
+			if err != nil {
+				t.Fatalf("could not construct algorithm: %v", err)
+			}
+
+			got, gotErr := o.Optimize(context.Background(), a, tt.searchVolume, tt.waypoints, tt.constraints, tt.parameters, tt.storageType)
+			if gotErr != nil {
+				t.Fatalf("Optimize() failed: %v", gotErr)
+			}
+
+			utils.MarkWaypointsAsOriginal(tt.waypoints...)
+			utils.ExportToGeoJSONRoute("ordering", got.Route, tt.constraints, tt.searchVolume, tt.name, true)
+
+			if sorted := slices.Sorted(slices.Values(got.Order)); !slices.Equal(sorted, []int{0, 1, 2, 3}) {
+				t.Fatalf("Optimize() order = %v, not a permutation", got.Order)
+			}
+			if got.Route[0] != tt.waypoints[0] || got.Waypoints[0] != tt.waypoints[0] {
+				t.Errorf("Optimize() doesn't start from the first waypoint")
+			}
+			last := got.Route[len(got.Route)-1]
+			switch o.Mode {
+			case ordering.ClosedTour:
+				if last != tt.waypoints[0] || len(got.Waypoints) != len(tt.waypoints)+1 {
+					t.Errorf("Optimize() doesn't come back to the first waypoint")
+				}
+			case ordering.FixedEnds:
+				if last != tt.waypoints[len(tt.waypoints)-1] {
+					t.Errorf("Optimize() doesn't end at the last waypoint")
+				}
+			}
+
+			// Every waypoint is on the route, in the optimized order
+			next := 0
+			for _, wp := range got.Route {
+				if next < len(got.Waypoints) && wp == got.Waypoints[next] {
+					next++
+				}
+			}
+			if next != len(got.Waypoints) {
+				t.Errorf("Optimize() route visits %d/%d waypoints in order", next, len(got.Waypoints))
+			}
+
+			// The cost is the one of the route, flown in the optimized order
+			costFunction, err := utils.NewCostFunctionFromParameters(tt.parameters, tt.constraints)
+			if err != nil {
+				t.Fatalf("could not construct cost function: %v", err)
+			}
+			if routeCost := utils.TotalCost(costFunction, got.Route); math.Abs(routeCost-got.Cost) > 1e-6 {
+				t.Errorf("Optimize() cost = %.3f, route costs %.3f", got.Cost, routeCost)
+			}
+
+			// Never worse than the given order
+			given := tt.waypoints
+			if o.Mode == ordering.ClosedTour {
+				given = append(slices.Clone(given), given[0])
+			}
+			_, givenCost, err := a.Compute(context.Background(), tt.searchVolume, given, tt.constraints, tt.parameters, tt.storageType)
+			if err != nil {
+				t.Fatalf("Compute() of the given order failed: %v", err)
+			}
+			t.Logf("order: %v, cost: %.3f mt, given order cost: %.3f mt", got.Order, got.Cost, givenCost)
+			if got.Cost > givenCost+1e-6 {
+				t.Errorf("Optimize() cost %.3f mt is worse than the given order %.3f mt", got.Cost, givenCost)
+			}
+		})
+	}
+}
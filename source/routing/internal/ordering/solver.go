@@ -0,0 +1,106 @@
+package ordering
+
+import (
+	"math"
+	"slices"
+)
+
+// Improvements smaller than this are ignored, so that 2-opt can't loop on rounding errors
+const MIN_IMPROVEMENT float64 = 1e-9
+
+// SolveOrder returns the visiting order of the nodes of the costs matrix, always starting from node 0.
+// With FixedEnds the order ends at the last node, with ClosedTour the way back to node 0 is part of the cost.
+// It's a nearest neighbor tour improved with 2-opt: not always the optimum, but close to it for the few tens of waypoints of a mission.
+func SolveOrder(costs [][]float64, mode Mode) []int {
+	order := nearestNeighborOrder(costs, mode)
+
+	// The start (and the end, if fixed) never moves
+	last := len(order) - 1
+	if mode == FixedEnds {
+		last--
+	}
+
+	for improved := true; improved; {
+		improved = false
+		for i := 1; i < last; i++ {
+			for j := i + 1; j <= last; j++ {
+				if delta := twoOptDelta(costs, order, i, j, mode); delta < -MIN_IMPROVEMENT {
+					slices.Reverse(order[i : j+1])
+					improved = true
+				}
+			}
+		}
+	}
+
+	return order
+}
+
+// OrderCost is the cost of visiting the nodes in order, including the way back to the first one for closed tours.
+func OrderCost(costs [][]float64, order []int, mode Mode) float64 {
+	cost := 0.0
+	for k := 1; k < len(order); k++ {
+		cost += costs[order[k-1]][order[k]]
+	}
+	if mode == ClosedTour && len(order) > 1 {
+		cost += costs[order[len(order)-1]][order[0]]
+	}
+	return cost
+}
+
+// nearestNeighborOrder goes from node 0 to the cheapest node not visited yet, keeping the last node for the end if fixed.
+func nearestNeighborOrder(costs [][]float64, mode Mode) []int {
+	n := len(costs)
+	visited := make([]bool, n)
+	order := []int{0}
+	visited[0] = true
+
+	toVisit := n - 1
+	if mode == FixedEnds && n > 1 {
+		visited[n-1] = true
+		toVisit--
+	}
+
+	for range toVisit {
+		current := order[len(order)-1]
+		next := -1
+		for j := range n {
+			if !visited[j] && (next < 0 || costs[current][j] < costs[current][next]) {
+				next = j
+			}
+		}
+		order = append(order, next)
+		visited[next] = true
+	}
+
+	if mode == FixedEnds && n > 1 {
+		order = append(order, n-1)
+	}
+	return order
+}
+
+// twoOptDelta is the change of cost when reversing order[i..j]: edges (i-1, i) and (j, j+1) become (i-1, j) and (i, j+1).
+// The edges in between are flown the other way, which changes the cost too when it's not the same both ways.
+func twoOptDelta(costs [][]float64, order []int, i, j int, mode Mode) float64 {
+	a, b, c := order[i-1], order[i], order[j]
+	delta := costs[a][c] - costs[a][b]
+	for k := i; k < j; k++ {
+		delta += costs[order[k+1]][order[k]] - costs[order[k]][order[k+1]]
+	}
+
+	// The open path has no edge after its last node
+	next := -1
+	if j+1 < len(order) {
+		next = order[j+1]
+	} else if mode == ClosedTour {
+		next = order[0]
+	}
+	if next >= 0 {
+		delta += costs[b][next] - costs[c][next]
+	}
+
+	// Edges that can't be flown make the difference undefined (Inf - Inf)
+	if math.IsNaN(delta) {
+		return 0
+	}
+	return delta
+}
@@ -0,0 +1,303 @@
+package postprocess
+
+import (
+	"context"
+	"fmt"
+	"geopathplanner/routing/internal/models"
+	"geopathplanner/routing/internal/storage"
+	"geopathplanner/routing/internal/utils"
+	"math/rand"
+)
+
+// Step transforms the portion of route between two mission waypoints.
+// The first and last wp of the segment must be kept, and every new connection must be checked against the constraints in storage.
+type Step interface {
+	Name() string
+	Apply(segment []*models.Waypoint, s storage.Storage) ([]*models.Waypoint, error)
+}
+
+// Pipeline applies its steps in order to the route computed by any algorithm, then smooths the whole route if a turn radius is given.
+type Pipeline struct {
+	Steps     []Step
+	Smoothing *TurnRadiusSmoothing
+}
+
+// NewPipelineFromParameters reads parameters.postprocess, that can be either true (all defaults) or an object:
+//
+//	"postprocess": {
+//		"greedy_shortcut": true,
+//		"random_shortcut_iterations": 0,
+//		"remove_collinear": true,
+//		"collinear_tolerance_mt": 0.5,
+//		"seed": 945
+//	}
+//
+// A positive min_turn_radius_mt (with arc_step_mt, the sampling distance of curves) adds the smoothing for fixed-wing vehicles, even without postprocess.
+// Every new connection keeps to parameters.max_gradient, like the ones of the planners.
+// Returns nil if post-processing was not requested.
+func NewPipelineFromParameters(parameters map[string]any) (*Pipeline, error) {
+	p := &Pipeline{}
+
+	MIN_TURN_RADIUS_MT := utils.GetOrDefault(parameters, "min_turn_radius_mt", 0.0)
+	ARC_STEP_MT := utils.GetOrDefault(parameters, "arc_step_mt", 10.0)
+	MAX_GRADIENT := utils.GetOrDefault(parameters, "max_gradient", 0.0)
+	if MIN_TURN_RADIUS_MT > 0 {
+		smoothing, err := NewTurnRadiusSmoothing(MIN_TURN_RADIUS_MT, ARC_STEP_MT, MAX_GRADIENT)
+		if err != nil {
+			return nil, err
+		}
+		p.Smoothing = smoothing
+	}
+
+	var config map[string]any
+	switch v := parameters["postprocess"].(type) {
+	case nil:
+		config = nil
+	case bool:
+		if v {
+			config = map[string]any{}
+		}
+	case map[string]any:
+		config = v
+	default:
+		return nil, fmt.Errorf("postprocess must be a boolean or an object, got %T", v)
+	}
+
+	if config == nil {
+		if p.Smoothing == nil {
+			return nil, nil
+		}
+		fmt.Printf("POSTPROCESS\n")
+		fmt.Printf("min_turn_radius_mt: %f\n", MIN_TURN_RADIUS_MT)
+		fmt.Printf("arc_step_mt: %f\n", ARC_STEP_MT)
+		fmt.Printf("max_gradient: %f\n", MAX_GRADIENT)
+		fmt.Printf("--------------------------------------------------------\n")
+		return p, nil
+	}
+
+	GREEDY_SHORTCUT := utils.GetOrDefault(config, "greedy_shortcut", true)
+	RANDOM_SHORTCUT_ITERATIONS := int(utils.GetOrDefault(config, "random_shortcut_iterations", 0.0))
+	REMOVE_COLLINEAR := utils.GetOrDefault(config, "remove_collinear", true)
+	COLLINEAR_TOLERANCE_MT := utils.GetOrDefault(config, "collinear_tolerance_mt", 0.5)
+	SEED := utils.GetOrDefault(config, "seed", utils.GetOrDefault(parameters, "seed", 945.0))
+
+	if GREEDY_SHORTCUT {
+		p.Steps = append(p.Steps, NewGreedyShortcut(MAX_GRADIENT))
+	}
+	if RANDOM_SHORTCUT_ITERATIONS > 0 {
+		p.Steps = append(p.Steps, NewRandomShortcut(RANDOM_SHORTCUT_ITERATIONS, int64(SEED), MAX_GRADIENT))
+	}
+	if REMOVE_COLLINEAR {
+		p.Steps = append(p.Steps, NewCollinearRemoval(COLLINEAR_TOLERANCE_MT, MAX_GRADIENT))
+	}
+
+	fmt.Printf("POSTPROCESS\n")
+	fmt.Printf("greedy_shortcut: %v\n", GREEDY_SHORTCUT)
+	fmt.Printf("random_shortcut_iterations: %d\n", RANDOM_SHORTCUT_ITERATIONS)
+	fmt.Printf("remove_collinear: %v\n", REMOVE_COLLINEAR)
+	fmt.Printf("collinear_tolerance_mt: %f\n", COLLINEAR_TOLERANCE_MT)
+	fmt.Printf("min_turn_radius_mt: %f\n", MIN_TURN_RADIUS_MT)
+	fmt.Printf("max_gradient: %f\n", MAX_GRADIENT)
+	fmt.Printf("--------------------------------------------------------\n")
+
+	return p, nil
+}
+
+// Process runs every step on each segment of route between two consecutive mission waypoints, so that none of them is ever removed.
+// The smoothing, if any, runs last on the whole route, as turns continue across segments.
+func (p *Pipeline) Process(ctx context.Context, route []*models.Waypoint, mission []*models.Waypoint, s storage.Storage) ([]*models.Waypoint, error) {
+	if len(route) < 3 {
+		return route, nil
+	}
+
+	isMission := make(map[*models.Waypoint]bool, len(mission))
+	for _, wp := range mission {
+		isMission[wp] = true
+	}
+	// Where the route enters the acceptance radius of a mission waypoint stands for it
+	for _, wp := range route {
+		if isMission[wp.Reached()] {
+			isMission[wp] = true
+		}
+	}
+
+	processed := []*models.Waypoint{route[0]}
+	start := 0
+	for i := 1; i < len(route); i++ {
+		if !isMission[route[i]] && i != len(route)-1 {
+			continue
+		}
+
+		segment := route[start : i+1]
+		for _, step := range p.Steps {
+			var err error
+			segment, err = step.Apply(segment, s)
+			if err != nil {
+				return nil, fmt.Errorf("postprocess %s between route[%d] and route[%d]: %w", step.Name(), start, i, err)
+			}
+		}
+
+		// Skip first one, it's the last of the previous segment
+		processed = append(processed, segment[1:]...)
+		start = i
+	}
+
+	if p.Smoothing != nil {
+		isMission[processed[0]] = true
+		isMission[processed[len(processed)-1]] = true
+		return p.Smoothing.Smooth(ctx, processed, isMission, s)
+	}
+	return processed, nil
+}
+
+// ---------------------------------------------------------------- SHORTCUTTING
+
+// A shortcut is taken only if it doesn't cost more than the wps it skips, up to this tolerance for rounding errors
+const SHORTCUT_COST_TOLERANCE float64 = 1e-6
+
+// isWorthShortcut tells if the straight line between the ends of path costs no more than path itself, with the cost function of the storage.
+// Always true with the distance cost, but penalties (e.g. proximity to constraints) may make the detour cheaper.
+func isWorthShortcut(path []*models.Waypoint, s storage.Storage) bool {
+	f := s.GetCostFunction()
+	return f.Cost(path[0], path[len(path)-1]) <= utils.TotalCost(f, path)+SHORTCUT_COST_TOLERANCE
+}
+
+// isConnectionFree tells if the new connection p1 -> p2 meets no obstacle in s and climbs and descends at most maxGradient (0 means no limit)
+func isConnectionFree(p1, p2 *models.Waypoint, maxGradient float64, s storage.Storage) (bool, error) {
+	if !utils.IsWithinGradient(p1, p2, maxGradient) {
+		return false, nil
+	}
+	blocked, _, err := s.IsLineInObstacles(p1, p2)
+	return !blocked, err
+}
+
+// GreedyShortcut connects every wp to the farthest following one in line of sight (and not more expensive), within MaxGradient.
+type GreedyShortcut struct {
+	MaxGradient float64
+}
+
+func NewGreedyShortcut(maxGradient float64) *GreedyShortcut {
+	return &GreedyShortcut{
+		MaxGradient: maxGradient,
+	}
+}
+
+func (g *GreedyShortcut) Name() string {
+	return "greedy_shortcut"
+}
+
+func (g *GreedyShortcut) Apply(segment []*models.Waypoint, s storage.Storage) ([]*models.Waypoint, error) {
+	shortcut := []*models.Waypoint{segment[0]}
+
+	for i := 0; i < len(segment)-1; {
+		// Fall back to the next wp, that is already connected to segment[i]
+		next := i + 1
+		for j := len(segment) - 1; j > i+1; j-- {
+			if !isWorthShortcut(segment[i:j+1], s) {
+				continue
+			}
+			free, err := isConnectionFree(segment[i], segment[j], g.MaxGradient, s)
+			if err != nil {
+				return nil, err
+			}
+			if free {
+				next = j
+				break
+			}
+		}
+
+		shortcut = append(shortcut, segment[next])
+		i = next
+	}
+
+	return shortcut, nil
+}
+
+// RandomShortcut tries to connect two random non-consecutive wps for the given number of iterations, dropping the ones in between when possible.
+// It can escape the local choices of GreedyShortcut. Shortcuts keep within MaxGradient.
+type RandomShortcut struct {
+	Iterations  int
+	MaxGradient float64
+	r           *rand.Rand
+}
+
+func NewRandomShortcut(iterations int, seed int64, maxGradient float64) *RandomShortcut {
+	return &RandomShortcut{
+		Iterations:  iterations,
+		MaxGradient: maxGradient,
+		r:           rand.New(rand.NewSource(seed)),
+	}
+}
+
+func (rs *RandomShortcut) Name() string {
+	return "random_shortcut"
+}
+
+func (rs *RandomShortcut) Apply(segment []*models.Waypoint, s storage.Storage) ([]*models.Waypoint, error) {
+	shortcut := append([]*models.Waypoint(nil), segment...)
+
+	for range rs.Iterations {
+		if len(shortcut) < 3 {
+			break
+		}
+
+		// Pick i < j with at least one wp between them
+		i := rs.r.Intn(len(shortcut) - 2)
+		j := i + 2 + rs.r.Intn(len(shortcut)-i-2)
+		if !isWorthShortcut(shortcut[i:j+1], s) {
+			continue
+		}
+
+		free, err := isConnectionFree(shortcut[i], shortcut[j], rs.MaxGradient, s)
+		if err != nil {
+			return nil, err
+		}
+		if !free {
+			continue
+		}
+		shortcut = append(shortcut[:i+1], shortcut[j:]...)
+	}
+
+	return shortcut, nil
+}
+
+// ---------------------------------------------------------------- COLLINEAR
+
+// CollinearRemoval drops the wps that lengthen the route less than ToleranceMt compared to connecting their neighbors directly,
+// if the direct connection keeps within MaxGradient.
+type CollinearRemoval struct {
+	ToleranceMt float64
+	MaxGradient float64
+}
+
+func NewCollinearRemoval(toleranceMt, maxGradient float64) *CollinearRemoval {
+	return &CollinearRemoval{
+		ToleranceMt: toleranceMt,
+		MaxGradient: maxGradient,
+	}
+}
+
+func (c *CollinearRemoval) Name() string {
+	return "remove_collinear"
+}
+
+func (c *CollinearRemoval) Apply(segment []*models.Waypoint, s storage.Storage) ([]*models.Waypoint, error) {
+	cleaned := []*models.Waypoint{segment[0]}
+
+	for i := 1; i < len(segment)-1; i++ {
+		prev, curr, next := cleaned[len(cleaned)-1], segment[i], segment[i+1]
+		detour := utils.HaversineDistance3D(prev, curr) + utils.HaversineDistance3D(curr, next) - utils.HaversineDistance3D(prev, next)
+		if detour <= c.ToleranceMt {
+			free, err := isConnectionFree(prev, next, c.MaxGradient, s)
+			if err != nil {
+				return nil, err
+			}
+			if free {
+				continue
+			}
+		}
+		cleaned = append(cleaned, curr)
+	}
+
+	return append(cleaned, segment[len(segment)-1]), nil
+}
@@ -0,0 +1,148 @@
+package postprocess_test
+
+import (
+	"context"
+	"geopathplanner/routing/internal/algorithm"
+	"geopathplanner/routing/internal/models"
+	"geopathplanner/routing/internal/postprocess"
+	"geopathplanner/routing/internal/storage"
+	"geopathplanner/routing/internal/utils"
+	"testing"
+)
+
+func TestPipeline_Process(t *testing.T) {
+	sv, w_list, c_list, c_overlapping := utils.SetupTestScenario()
+
+	tests := []struct {
+		name        string // description of this test case
+		storageType models.StorageType
+		// Named input parameters for target function.
+		searchVolume *models.Feature3D
+		waypoints    []*models.Waypoint
+		constraints  []*models.Feature3D
+		postprocess  any
+	}{
+		{name: "Postprocess defaults with non-overlapping obstacles - RTREE", storageType: models.RTree, searchVolume: sv, waypoints: w_list, constraints: c_list, postprocess: true},
+		{name: "Postprocess random shortcut with overlapping obstacles - RTREE", storageType: models.RTree, searchVolume: sv, waypoints: w_list, constraints: append(c_list, c_overlapping...), postprocess: map[string]any{"greedy_shortcut": false, "random_shortcut_iterations": 500.0}},
+		{name: "Postprocess all steps with overlapping obstacles - LIST", storageType: models.List, searchVolume: sv, waypoints: w_list, constraints: append(c_list, c_overlapping...), postprocess: map[string]any{"random_shortcut_iterations": 500.0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := algorithm.NewRRTAlgorithm()
+			if err != nil {
+				t.Fatalf("could not construct algorithm: %v", err)
+			}
+			raw, rawCost, err := a.Compute(context.Background(), tt.searchVolume, tt.waypoints, tt.constraints, map[string]any{"seed": 10.0}, tt.storageType)
+			if err != nil {
+				t.Fatalf("Compute() failed: %v", err)
+			}
+
+			p, err := postprocess.NewPipelineFromParameters(map[string]any{"postprocess": tt.postprocess})
+			if err != nil || p == nil {
+				t.Fatalf("could not construct pipeline: %v", err)
+			}
+			s, err := storage.NewEmptyStorage(tt.storageType)
+			if err != nil {
+				t.Fatalf("could not construct storage: %v", err)
+			}
+			s.AddConstraints(tt.constraints)
+
+			got, gotErr := p.Process(context.Background(), raw, tt.waypoints, s)
+			if gotErr != nil {
+				t.Fatalf("Process() failed: %v", gotErr)
+			}
+			gotCost := utils.TotalHaversineDistance(got)
+			t.Logf("wps: %d -> %d, cost: %.3f -> %.3f mt", len(raw), len(got), rawCost, gotCost)
+
+			utils.MarkWaypointsAsOriginal(tt.waypoints...)
+			utils.ExportToGeoJSONRoute("postprocess", got, tt.constraints, tt.searchVolume, tt.name, true)
+
+			if gotCost > rawCost+1e-6 {
+				t.Errorf("Process() cost %.3f mt is worse than raw cost %.3f mt", gotCost, rawCost)
+			}
+
+			// Mission waypoints are all kept and in the same order
+			next := 0
+			for _, wp := range got {
+				if next < len(tt.waypoints) && wp == tt.waypoints[next] {
+					next++
+				}
+			}
+			if next != len(tt.waypoints) {
+				t.Errorf("Process() kept %d/%d mission waypoints", next, len(tt.waypoints))
+			}
+
+			for i := 0; i < len(got)-1; i++ {
+				if blocked, _, _ := s.IsLineInObstacles(got[i], got[i+1]); blocked {
+					t.Errorf("Process() segment %d crosses a constraint", i)
+				}
+			}
+		})
+	}
+}
+
+func TestCollinearRemoval_Apply(t *testing.T) {
+	_, w_list, _, _ := utils.SetupTestScenario()
+	start, end := w_list[0], w_list[1]
+
+	// Straight line split every 20 mt
+	segment := []*models.Waypoint{start}
+	for d := 20.0; d < utils.HaversineDistance3D(start, end); d += 20.0 {
+		segment = append(segment, utils.GetPointInDirectionAtDistance(start, end, d))
+	}
+	segment = append(segment, end)
+
+	s, err := storage.NewEmptyStorage(models.RTree)
+	if err != nil {
+		t.Fatalf("could not construct storage: %v", err)
+	}
+
+	got, err := postprocess.NewCollinearRemoval(0.5, 0).Apply(segment, s)
+	if err != nil {
+		t.Fatalf("Apply() failed: %v", err)
+	}
+	if len(got) != 2 || got[0] != start || got[1] != end {
+		t.Errorf("Apply() kept %d of %d wps, want only start and end", len(got), len(segment))
+	}
+}
+
+func TestStep_Apply_maxGradient(t *testing.T) {
+	// Switchback: 40 mt up over 200 mt east, then 40 mt up again coming back 20 mt north of the start
+	alt := func(mt float64) models.Altitude {
+		a, _ := models.NewAltitude(mt, models.MT)
+		return a
+	}
+	start := models.MustNewWaypoint(0, 50.0, 4.0, alt(100))
+	turn := models.MustNewWaypoint(1, 50.0, 4.0028, alt(140))
+	end := models.MustNewWaypoint(2, 50.00018, 4.0, alt(180))
+	segment := []*models.Waypoint{start, turn, end}
+
+	s, err := storage.NewEmptyStorage(models.RTree)
+	if err != nil {
+		t.Fatalf("could not construct storage: %v", err)
+	}
+
+	tests := []struct {
+		name   string // description of this test case
+		step   postprocess.Step
+		wantWp int
+	}{
+		{name: "Greedy shortcut", step: postprocess.NewGreedyShortcut(0), wantWp: 2},
+		{name: "Greedy shortcut within gradient", step: postprocess.NewGreedyShortcut(0.3), wantWp: 3},
+		{name: "Random shortcut", step: postprocess.NewRandomShortcut(10, 945, 0), wantWp: 2},
+		{name: "Random shortcut within gradient", step: postprocess.NewRandomShortcut(10, 945, 0.3), wantWp: 3},
+		{name: "Collinear removal", step: postprocess.NewCollinearRemoval(1000, 0), wantWp: 2},
+		{name: "Collinear removal within gradient", step: postprocess.NewCollinearRemoval(1000, 0.3), wantWp: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.step.Apply(segment, s)
+			if err != nil {
+				t.Fatalf("Apply() failed: %v", err)
+			}
+			if len(got) != tt.wantWp {
+				t.Errorf("Apply() kept %d wps, want %d", len(got), tt.wantWp)
+			}
+		})
+	}
+}
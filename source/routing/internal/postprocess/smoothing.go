@@ -0,0 +1,264 @@
+package postprocess
+
+import (
+	"context"
+	"fmt"
+	"geopathplanner/routing/internal/algorithm"
+	"geopathplanner/routing/internal/models"
+	"geopathplanner/routing/internal/storage"
+	"geopathplanner/routing/internal/utils"
+	"math"
+)
+
+const (
+	// Turns smaller than this (rad) are flown as they are
+	MIN_TURN_RAD float64 = 1e-3
+	// Dubins paths start and end at most this many radii away from the corner
+	DUBINS_REACH float64 = 4.0
+)
+
+// TurnRadiusSmoothing replaces the corners of the route with curves flyable by a vehicle that can't turn tighter than MinTurnRadiusMt.
+// Every corner is first replaced by a tangent arc (fillet); if it doesn't fit or collides, by the Dubins paths between the two legs around it.
+// Mission waypoints are flown over, so the turn there always starts on the waypoint itself.
+// Corners that still can't be flown are replanned locally with a visibility graph keeping 2*MinTurnRadiusMt from the constraint vertices.
+// Curves are horizontal, the altitude changes linearly along them, and they climb and descend at most MaxGradient (0 means no limit).
+// Only the new connections are checked against the constraints: the straight parts left of the legs are as free as the legs themselves.
+type TurnRadiusSmoothing struct {
+	MinTurnRadiusMt float64
+	ArcStepMt       float64
+	MaxGradient     float64
+	replanner       *algorithm.VisGraphAlgorithm
+}
+
+func NewTurnRadiusSmoothing(minTurnRadiusMt, arcStepMt, maxGradient float64) (*TurnRadiusSmoothing, error) {
+	if minTurnRadiusMt <= 0 || arcStepMt <= 0 {
+		return nil, fmt.Errorf("min_turn_radius_mt (%f) and arc_step_mt (%f) must be positive", minTurnRadiusMt, arcStepMt)
+	}
+
+	replanner, err := algorithm.NewVisGraphAlgorithm()
+	if err != nil {
+		return nil, err
+	}
+
+	return &TurnRadiusSmoothing{
+		MinTurnRadiusMt: minTurnRadiusMt,
+		ArcStepMt:       arcStepMt,
+		MaxGradient:     maxGradient,
+		replanner:       replanner,
+	}, nil
+}
+
+// Smooth returns route with all its corners replaced by curves, fixed wps are always kept.
+func (sm *TurnRadiusSmoothing) Smooth(ctx context.Context, route []*models.Waypoint, fixed map[*models.Waypoint]bool, s storage.Storage) ([]*models.Waypoint, error) {
+	poly := append([]*models.Waypoint(nil), route...)
+	replanned := make(map[*models.Waypoint]bool)
+
+	for {
+		smoothed, failed, err := sm.smoothCorners(poly, fixed, s)
+		if err != nil {
+			return nil, err
+		}
+		if failed < 0 {
+			return smoothed, nil
+		}
+
+		corner := poly[failed]
+		if fixed[corner] {
+			return nil, fmt.Errorf("turn at mission waypoint %v can't be flown with min_turn_radius_mt %.1f", corner, sm.MinTurnRadiusMt)
+		}
+		if replanned[corner] {
+			return nil, fmt.Errorf("corner %v can't be flown with min_turn_radius_mt %.1f, even after local replan", corner, sm.MinTurnRadiusMt)
+		}
+
+		// Replace prev -> corner -> next with a route keeping far enough from the constraints
+		fmt.Printf("corner %v can't be smoothed, local replan\n", corner)
+		local, _, err := sm.replanner.Run(ctx, poly[failed-1], poly[failed+1], map[string]any{"vertex_offset_mt": 2 * sm.MinTurnRadiusMt}, s)
+		if err != nil {
+			return nil, fmt.Errorf("local replan around corner %v: %w", corner, err)
+		}
+		for i := 1; i < len(local); i++ {
+			if !utils.IsWithinGradient(local[i-1], local[i], sm.MaxGradient) {
+				return nil, fmt.Errorf("local replan around corner %v climbs more than max_gradient %.3f", corner, sm.MaxGradient)
+			}
+		}
+		for _, wp := range local[1 : len(local)-1] {
+			replanned[wp] = true
+		}
+
+		newPoly := append([]*models.Waypoint(nil), poly[:failed-1]...)
+		newPoly = append(newPoly, local...)
+		poly = append(newPoly, poly[failed+2:]...)
+	}
+}
+
+// smoothCorners goes through the corners of poly, returning the smoothed route or the index of the first corner that can't be smoothed.
+func (sm *TurnRadiusSmoothing) smoothCorners(poly []*models.Waypoint, fixed map[*models.Waypoint]bool, s storage.Storage) ([]*models.Waypoint, int, error) {
+	smoothed := []*models.Waypoint{poly[0]}
+
+	for i := 1; i < len(poly)-1; i++ {
+		prev, corner, next := poly[i-1], poly[i], poly[i+1]
+		// Where the previous curve ended, it always lies on prev -> corner
+		current := smoothed[len(smoothed)-1]
+
+		// Work in a local planar frame (mt) centered in the corner
+		frame := newLocalFrame(corner)
+		px, py := frame.toLocal(prev)
+		nx, ny := frame.toLocal(next)
+		cx, cy := frame.toLocal(current)
+		headingIn := math.Atan2(-py, -px)
+		headingOut := math.Atan2(ny, nx)
+		turn := math.Remainder(headingOut-headingIn, 2*math.Pi)
+
+		if math.Abs(turn) < MIN_TURN_RAD {
+			if current != corner {
+				smoothed = append(smoothed, corner)
+			}
+			continue
+		}
+
+		// The curve can use half of the next leg, or all of it if next is where the following turn starts
+		lenIn, lenOut := math.Hypot(cx, cy), math.Hypot(nx, ny)
+		availOut := lenOut / 2
+		if fixed[next] || i+1 == len(poly)-1 {
+			availOut = lenOut
+		}
+
+		// 1. Tangent arc
+		if !fixed[corner] {
+			tangent := sm.MinTurnRadiusMt * math.Tan(math.Abs(turn)/2)
+			if tangent <= lenIn && tangent <= availOut {
+				from := utils.Pose{X: -tangent * math.Cos(headingIn), Y: -tangent * math.Sin(headingIn), Heading: headingIn}
+				to := utils.Pose{X: tangent * math.Cos(headingOut), Y: tangent * math.Sin(headingOut), Heading: headingOut}
+				fromAlt := interpolateAlt(corner, prev, tangent/math.Hypot(px, py))
+				toAlt := interpolateAlt(corner, next, tangent/lenOut)
+
+				curve, err := sm.curve(frame, from, fromAlt, nil, to, toAlt, nil, 1, s)
+				if err != nil {
+					return nil, i, err
+				}
+				if curve != nil {
+					smoothed = append(smoothed, curve...)
+					continue
+				}
+			}
+		}
+
+		// 2. Dubins paths from the leg before (or from the corner itself, if it must be flown over) to the leg after
+		reach := DUBINS_REACH * sm.MinTurnRadiusMt
+		var fromWp *models.Waypoint
+		fromDist := math.Min(lenIn, reach)
+		switch {
+		case fixed[corner]:
+			fromWp, fromDist = corner, 0
+		case fromDist == lenIn:
+			fromWp = current
+		}
+		from := utils.Pose{X: -fromDist * math.Cos(headingIn), Y: -fromDist * math.Sin(headingIn), Heading: headingIn}
+		fromAlt := interpolateAlt(corner, prev, fromDist/math.Hypot(px, py))
+
+		// Keep next itself when the curve ends there
+		var toWp *models.Waypoint
+		toDist := availOut
+		if availOut > reach {
+			toDist = reach
+		} else if availOut == lenOut {
+			toWp = next
+		}
+		to := utils.Pose{X: toDist * math.Cos(headingOut), Y: toDist * math.Sin(headingOut), Heading: headingOut}
+		toAlt := interpolateAlt(corner, next, toDist/lenOut)
+
+		curve, err := sm.curve(frame, from, fromAlt, fromWp, to, toAlt, toWp, 0, s)
+		if err != nil {
+			return nil, i, err
+		}
+		if curve == nil {
+			return nil, i, nil
+		}
+		if curve[0] == current {
+			curve = curve[1:]
+		}
+		smoothed = append(smoothed, curve...)
+	}
+
+	if last := poly[len(poly)-1]; smoothed[len(smoothed)-1] != last {
+		smoothed = append(smoothed, last)
+	}
+	return smoothed, -1, nil
+}
+
+// curve samples the Dubins paths from -> to, from the shortest one, and returns the first collision-free one within MaxGradient (nil if none is).
+// If fromWp or toWp are not nil, they are used as first and last wp of the curve in place of the sampled ones.
+// At most maxPaths are tried, 0 means all of them.
+func (sm *TurnRadiusSmoothing) curve(frame localFrame, from utils.Pose, fromAltMt float64, fromWp *models.Waypoint, to utils.Pose, toAltMt float64, toWp *models.Waypoint, maxPaths int, s storage.Storage) ([]*models.Waypoint, error) {
+	paths := utils.DubinsPaths(from, to, sm.MinTurnRadiusMt)
+	if maxPaths > 0 && len(paths) > maxPaths {
+		paths = paths[:maxPaths]
+	}
+
+	for _, path := range paths {
+		poses := path.Sample(sm.ArcStepMt)
+		curve := make([]*models.Waypoint, len(poses))
+		for i, pose := range poses {
+			altMt := fromAltMt + (toAltMt-fromAltMt)*float64(i)/float64(len(poses)-1)
+			wp, err := frame.toWaypoint(pose.X, pose.Y, altMt)
+			if err != nil {
+				return nil, err
+			}
+			curve[i] = wp
+		}
+		if fromWp != nil {
+			curve[0] = fromWp
+		}
+		if toWp != nil {
+			curve[len(curve)-1] = toWp
+		}
+
+		free := true
+		for i := 0; i < len(curve)-1 && free; i++ {
+			var err error
+			free, err = isConnectionFree(curve[i], curve[i+1], sm.MaxGradient, s)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if free {
+			return curve, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// interpolateAlt returns the altitude (mt) at fraction of the way from w1 to w2.
+func interpolateAlt(w1, w2 *models.Waypoint, fraction float64) float64 {
+	alt1, alt2 := w1.Alt.Normalize().Value, w2.Alt.Normalize().Value
+	return alt1 + (alt2-alt1)*fraction
+}
+
+// ---------------------------------------------------------------- LOCAL FRAME
+
+// localFrame is a planar frame (mt) centered in origin, x pointing east and y north.
+// It's accurate enough for the few hundred meters around a corner.
+type localFrame struct {
+	origin          *models.Waypoint
+	metersPerDegLon float64
+}
+
+func newLocalFrame(origin *models.Waypoint) localFrame {
+	return localFrame{
+		origin:          origin,
+		metersPerDegLon: models.METERS_PER_DEGREE * math.Cos(origin.Lat*math.Pi/180),
+	}
+}
+
+func (f localFrame) toLocal(wp *models.Waypoint) (float64, float64) {
+	return (wp.Lon - f.origin.Lon) * f.metersPerDegLon, (wp.Lat - f.origin.Lat) * models.METERS_PER_DEGREE
+}
+
+func (f localFrame) toWaypoint(x, y, altMt float64) (*models.Waypoint, error) {
+	alt, err := models.NewAltitude(altMt, models.MT)
+	if err != nil {
+		return nil, err
+	}
+	return models.NewWaypoint(f.origin.Lat+y/models.METERS_PER_DEGREE, f.origin.Lon+x/f.metersPerDegLon, alt)
+}
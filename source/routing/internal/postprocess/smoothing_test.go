@@ -0,0 +1,149 @@
+package postprocess_test
+
+import (
+	"context"
+	"geopathplanner/routing/internal/algorithm"
+	"geopathplanner/routing/internal/models"
+	"geopathplanner/routing/internal/postprocess"
+	"geopathplanner/routing/internal/storage"
+	"geopathplanner/routing/internal/utils"
+	"math"
+	"testing"
+)
+
+func TestTurnRadiusSmoothing_Smooth(t *testing.T) {
+	sv, w_list, c_list, c_overlapping := utils.SetupTestScenario()
+
+	tests := []struct {
+		name        string // description of this test case
+		storageType models.StorageType
+		// Named input parameters for target function.
+		searchVolume *models.Feature3D
+		waypoints    []*models.Waypoint
+		constraints  []*models.Feature3D
+		parameters   map[string]any
+	}{
+		{name: "Smoothing RRT route with non-overlapping obstacles - RTREE", storageType: models.RTree, searchVolume: sv, waypoints: w_list, constraints: c_list, parameters: map[string]any{"postprocess": true, "min_turn_radius_mt": 30.0}},
+		{name: "Smoothing RRT route with overlapping obstacles - RTREE", storageType: models.RTree, searchVolume: sv, waypoints: w_list, constraints: append(c_list, c_overlapping...), parameters: map[string]any{"postprocess": true, "min_turn_radius_mt": 30.0}},
+		{name: "Smoothing RRT route with large radius - RTREE", storageType: models.RTree, searchVolume: sv, waypoints: w_list, constraints: c_list, parameters: map[string]any{"postprocess": true, "min_turn_radius_mt": 100.0, "arc_step_mt": 20.0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := algorithm.NewRRTAlgorithm()
+			if err != nil {
+				t.Fatalf("could not construct algorithm: %v", err)
+			}
+			raw, _, err := a.Compute(context.Background(), tt.searchVolume, tt.waypoints, tt.constraints, nil, tt.storageType)
+			if err != nil {
+				t.Fatalf("Compute() failed: %v", err)
+			}
+
+			p, err := postprocess.NewPipelineFromParameters(tt.parameters)
+			if err != nil || p == nil || p.Smoothing == nil {
+				t.Fatalf("could not construct pipeline with smoothing: %v", err)
+			}
+			s, err := storage.NewEmptyStorage(tt.storageType)
+			if err != nil {
+				t.Fatalf("could not construct storage: %v", err)
+			}
+			s.AddConstraints(tt.constraints)
+
+			got, gotErr := p.Process(context.Background(), raw, tt.waypoints, s)
+			if gotErr != nil {
+				t.Fatalf("Process() failed: %v", gotErr)
+			}
+
+			utils.MarkWaypointsAsOriginal(tt.waypoints...)
+			utils.ExportToGeoJSONRoute("postprocess", got, tt.constraints, tt.searchVolume, tt.name, true)
+
+			// Mission waypoints are all kept and in the same order
+			next := 0
+			for _, wp := range got {
+				if next < len(tt.waypoints) && wp == tt.waypoints[next] {
+					next++
+				}
+			}
+			if next != len(tt.waypoints) {
+				t.Errorf("Process() kept %d/%d mission waypoints", next, len(tt.waypoints))
+			}
+
+			// Curves are sampled every arc_step_mt, longer segments are what's left of the legs, as free as the legs themselves
+			arcStep := utils.GetOrDefault(tt.parameters, "arc_step_mt", 10.0)
+			for i := 0; i < len(got)-1; i++ {
+				if utils.HaversineDistance3D(got[i], got[i+1]) > arcStep*1.01 {
+					continue
+				}
+				if blocked, _, _ := s.IsLineInObstacles(got[i], got[i+1]); blocked {
+					t.Errorf("Process() curve segment %d crosses a constraint", i)
+				}
+			}
+
+			// On a circle of radius R, two chords l1 and l2 meet at an angle of (l1+l2)/(2R): nothing can turn sharper than that
+			radius := tt.parameters["min_turn_radius_mt"].(float64)
+			for i := 1; i < len(got)-1; i++ {
+				h1, l1 := planarHeading(got[i-1], got[i])
+				h2, l2 := planarHeading(got[i], got[i+1])
+				if l1 < 1e-6 || l2 < 1e-6 {
+					continue
+				}
+				turn := math.Abs(math.Remainder(h2-h1, 2*math.Pi))
+				if maxTurn := (l1+l2)/(2*radius)*1.05 + 1e-2; turn > maxTurn {
+					t.Errorf("Process() turns %.1f deg at wp %d, max allowed %.1f deg", turn*180/math.Pi, i, maxTurn*180/math.Pi)
+				}
+			}
+			t.Logf("wps: %d -> %d, cost: %.3f -> %.3f mt", len(raw), len(got), utils.TotalHaversineDistance(raw), utils.TotalHaversineDistance(got))
+		})
+	}
+}
+
+// planarHeading returns heading (rad) and length (mt) of w1 -> w2 in a local planar frame.
+func planarHeading(w1, w2 *models.Waypoint) (float64, float64) {
+	dx := (w2.Lon - w1.Lon) * models.METERS_PER_DEGREE * math.Cos(w1.Lat*math.Pi/180)
+	dy := (w2.Lat - w1.Lat) * models.METERS_PER_DEGREE
+	return math.Atan2(dy, dx), math.Hypot(dx, dy)
+}
+
+func TestTurnRadiusSmoothing_Smooth_maxGradient(t *testing.T) {
+	// Right turn climbing 40 mt on each 200 mt leg, a gradient of 0.2: a tangent arc cuts the corner, climbing the same on a shorter path
+	alt := func(mt float64) models.Altitude {
+		a, _ := models.NewAltitude(mt, models.MT)
+		return a
+	}
+	start := models.MustNewWaypoint(0, 50.0, 4.0, alt(100))
+	corner := models.MustNewWaypoint(1, 50.0, 4.0028, alt(140))
+	end := models.MustNewWaypoint(2, 50.0018, 4.0028, alt(180))
+	route := []*models.Waypoint{start, corner, end}
+
+	tests := []struct {
+		name        string // description of this test case
+		maxGradient float64
+	}{
+		{name: "No gradient limit", maxGradient: 0},
+		{name: "Gradient limit", maxGradient: 0.22},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := postprocess.NewPipelineFromParameters(map[string]any{"min_turn_radius_mt": 30.0, "max_gradient": tt.maxGradient})
+			if err != nil || p == nil || p.Smoothing == nil {
+				t.Fatalf("could not construct pipeline with smoothing: %v", err)
+			}
+			s, err := storage.NewEmptyStorage(models.RTree)
+			if err != nil {
+				t.Fatalf("could not construct storage: %v", err)
+			}
+
+			got, gotErr := p.Process(context.Background(), route, []*models.Waypoint{start, end}, s)
+			if gotErr != nil {
+				// The turn can't be flown within the limit, that's fine as long as it's not flown beyond it
+				t.Logf("Process() failed: %v", gotErr)
+				return
+			}
+			for i := 0; i < len(got)-1; i++ {
+				if !utils.IsWithinGradient(got[i], got[i+1], tt.maxGradient) {
+					t.Errorf("Process() segment %d climbs more than max_gradient %.2f", i, tt.maxGradient)
+				}
+			}
+			t.Logf("wps: %d -> %d", len(route), len(got))
+		})
+	}
+}
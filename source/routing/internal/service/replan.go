@@ -0,0 +1,321 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"geopathplanner/routing/internal/algorithm"
+	"geopathplanner/routing/internal/corridor"
+	"geopathplanner/routing/internal/models"
+	"geopathplanner/routing/internal/storage"
+	"geopathplanner/routing/internal/utils"
+	"geopathplanner/routing/internal/validator"
+	"maps"
+	"math"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	// Plans kept for the replan requests, the oldest one is dropped first
+	MAX_CACHED_PLANS int = 100
+)
+
+// plan is what a replan needs to know of a request that found a route
+type plan struct {
+	searchVolume *models.Feature3D
+	waypoints    []*models.Waypoint  // validated, in the order the route visits them
+	constraints  []*models.Feature3D // the ones of the request, not grown by the corridor
+	parameters   map[string]any
+	windField    *models.WindField // already loaded
+	route        []*models.Waypoint
+}
+
+// planCache keeps the plans of the last requests by request id.
+// It lives in the memory of the service, so a replan must reach the same instance that planned the previous request.
+type planCache struct {
+	mu       sync.Mutex
+	capacity int
+	plans    map[string]*plan
+	order    []string // oldest first
+}
+
+func newPlanCache(capacity int) *planCache {
+	return &planCache{capacity: capacity, plans: make(map[string]*plan)}
+}
+
+func (c *planCache) get(requestID string) (*plan, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	p, ok := c.plans[requestID]
+	return p, ok
+}
+
+func (c *planCache) put(requestID string, p *plan) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.plans[requestID]; !ok {
+		c.order = append(c.order, requestID)
+	}
+	c.plans[requestID] = p
+	for len(c.order) > c.capacity {
+		delete(c.plans, c.order[0])
+		c.order = c.order[1:]
+	}
+}
+
+// handleReplan repairs the route of a previous request after its constraints changed, without planning it again from scratch.
+// The route is cut where the vehicle is now, then only the runs of segments blocked by the new constraints are planned again,
+// from the last free wp before them to the first free wp after them. The rest of the route is kept as it is, and it's not post-processed.
+// Search volume, parameters and wind field are the ones of the previous request, unless the replan gives new ones.
+// The previous request is found by its request id alone, so the replan is not restricted to whoever sent it.
+func (rs *RoutingService) handleReplan(ctx context.Context, input *models.RoutingRequest, val validator.Validator) (*models.RoutingResponse, bool) {
+	if err := input.Replan.Validate(); err != nil {
+		return models.NewRoutingResponseError(input, err.Error()), false
+	}
+	previous, ok := rs.plans.get(input.Replan.PreviousRequestID)
+	if !ok {
+		return models.NewRoutingResponseError(input, fmt.Sprintf("previous request %s not found, send a full request", input.Replan.PreviousRequestID)), false
+	}
+	// The route is repaired among the constraints of the previous request and the added ones, moving ones need a departure time too
+	setDefaultDepartureTime(input, slices.Concat(previous.constraints, input.Replan.AddedConstraints))
+
+	request := *input
+	if request.Parameters == nil {
+		request.Parameters = previous.parameters
+	}
+	if request.SearchVolume == nil {
+		request.SearchVolume = previous.searchVolume
+	}
+	if request.WindField == nil {
+		request.WindField = previous.windField
+	}
+	parameters := requestParameters(&request)
+	if err := algorithm.CheckAcceptanceRadius(request.Algorithm(), parameters, previous.waypoints); err != nil {
+		return models.NewRoutingResponseError(input, err.Error()), false
+	}
+	if err := algorithm.CheckSpaceParameters(request.Algorithm(), parameters); err != nil {
+		return models.NewRoutingResponseError(input, err.Error()), false
+	}
+	if input.DepartureTime != nil {
+		if err := algorithm.CheckSchedule(request.Algorithm(), parameters); err != nil {
+			return models.NewRoutingResponseError(input, err.Error()), false
+		}
+	}
+
+	// 1. Constraints of the previous request, updated, and the current position validated like the waypoints of a request
+	current, added, err := val.ValidateInput(request.SearchVolume, []*models.Waypoint{input.Replan.CurrentPosition}, input.Replan.AddedConstraints)
+	if err != nil {
+		return models.NewRoutingResponseError(input, err.Error()), false
+	}
+	if len(current) == 0 {
+		return models.NewRoutingResponseError(input, "current position is outside the search volume"), false
+	}
+	constraints := slices.DeleteFunc(slices.Clone(previous.constraints), func(c *models.Feature3D) bool {
+		return c.ConstraintID() != "" && slices.Contains(input.Replan.RemovedConstraintIDs, c.ConstraintID())
+	})
+	constraints = append(constraints, added...)
+	if err := algorithm.CheckSoftConstraints(request.Algorithm(), parameters, constraints); err != nil {
+		return models.NewRoutingResponseError(input, err.Error()), false
+	}
+
+	// With a corridor, the route is repaired among the obstacles grown by its half-widths, as it was planned
+	corridorBuilder, err := corridor.NewBuilderFromParameters(parameters)
+	if err != nil {
+		return models.NewRoutingResponseError(input, err.Error()), false
+	}
+	planningConstraints := constraints
+	if corridorBuilder != nil {
+		planningConstraints, err = corridorBuilder.Inflate(constraints)
+		if err != nil {
+			return models.NewRoutingResponseError(input, err.Error()), false
+		}
+	}
+	if c := hardConstraintAt(input.Replan.CurrentPosition, planningConstraints, input.DepartureTime); c != nil {
+		return models.NewRoutingResponseError(input, fmt.Sprintf("current position is inside a constraint (id %q), the route can't be repaired from there", c.ConstraintID())), false
+	}
+
+	algo, err := algorithm.NewAlgorithm(request.Algorithm())
+	if err != nil {
+		return models.NewRoutingResponseError(input, err.Error()), false
+	}
+	fallback, err := algorithm.NewFallbackAlgorithmFromParameters(request.Algorithm(), parameters)
+	if err != nil {
+		return models.NewRoutingResponseError(input, err.Error()), false
+	}
+	if fallback != nil {
+		algo = fallback
+	}
+	costFunction, err := utils.NewCostFunctionFromParameters(parameters, planningConstraints)
+	if err != nil {
+		return models.NewRoutingResponseError(input, err.Error()), false
+	}
+	var flightTime *utils.TimeCost
+	if input.DepartureTime != nil {
+		flightTime, err = utils.NewTimeCostFromParameters(parameters)
+		if err != nil {
+			return models.NewRoutingResponseError(input, err.Error()), false
+		}
+	}
+
+	// 2. What is left of the previous route, and of its waypoints
+	remaining := remainingRoute(previous.route, input.Replan.CurrentPosition)
+	wps := []*models.Waypoint{remaining[0]}
+	for _, wp := range remaining[1:] {
+		if slices.Contains(previous.waypoints, wp.Reached()) {
+			wps = append(wps, wp)
+		}
+	}
+
+	// 3. Plan again the blocked parts only
+	route, replanned, err := repairRoute(ctx, algo, request.SearchVolume, remaining, wps, planningConstraints, parameters, request.Storage(), input.DepartureTime, flightTime)
+	if err != nil {
+		response := models.NewRoutingResponseError(input, err.Error())
+		response.DeadlineReached = algorithm.DeadlineReached(ctx)
+		return response, false
+	}
+	fmt.Printf("Route repaired: %d/%d segments planned again\n", replanned, len(remaining)-1)
+
+	// The corridor is checked against the constraints of the request, not only its centreline
+	var routeCorridor *models.Feature3D
+	if corridorBuilder != nil {
+		if conflicts := corridorBuilder.Conflicts(route, constraints); len(conflicts) > 0 {
+			return models.NewRoutingResponseError(input, fmt.Sprintf("corridor of the route meets %d constraints", len(conflicts))), false
+		}
+		routeCorridor, err = corridorBuilder.Build(route)
+		if err != nil {
+			return models.NewRoutingResponseError(input, err.Error()), false
+		}
+	}
+
+	response := models.NewRoutingResponseSuccess(input, route, utils.TotalCost(costFunction, route))
+	response.ReplannedSegments = replanned
+	response.Corridor = routeCorridor
+	if replanned == 0 {
+		response.Message = "Route still valid, nothing to replan"
+	}
+	if algorithm.DeadlineReached(ctx) {
+		response.SetDeadlineReached()
+	}
+	rs.plans.put(input.RequestID, &plan{searchVolume: request.SearchVolume, waypoints: wps, constraints: constraints, parameters: request.Parameters, windField: request.WindField, route: route})
+	return response, true
+}
+
+// hardConstraintAt returns the hard constraint p is inside of, if any: where it is at departure if it's known, otherwise as the planners see it without a time
+func hardConstraintAt(p *models.Waypoint, constraints []*models.Feature3D, departure *time.Time) *models.Feature3D {
+	for _, c := range constraints {
+		if c.IsSoft() {
+			continue
+		}
+		if departure != nil {
+			if utils.PointInPolygonAt(p, c, *departure) {
+				return c
+			}
+		} else if p.Alt.IsWithin(c.MinAltitude, c.MaxAltitude) && utils.PointInGeometry2D(p.Point2D(), c.Geometry) {
+			return c
+		}
+	}
+	return nil
+}
+
+// remainingRoute returns current followed by the wps of route after the segment current is on, the closest one if it's on none
+func remainingRoute(route []*models.Waypoint, current *models.Waypoint) []*models.Waypoint {
+	segment, bestDetour := 0, math.Inf(1)
+	for i := 1; i < len(route); i++ {
+		detour := utils.HaversineDistance3D(route[i-1], current) + utils.HaversineDistance3D(current, route[i]) - utils.HaversineDistance3D(route[i-1], route[i])
+		if detour < bestDetour {
+			segment, bestDetour = i, detour
+		}
+	}
+	return append([]*models.Waypoint{current}, route[segment:]...)
+}
+
+// repairRoute keeps the segments of route that are still free, and plans again every run of blocked ones through the wps in it.
+// A run ends on the first wp outside every constraint, so that the new part can reach it. Returns the route and how many segments were planned again.
+// With a departure from route[0], segments are checked against the constraints as they are when they are flown.
+func repairRoute(ctx context.Context, algo algorithm.Algorithm, searchVolume *models.Feature3D, route []*models.Waypoint, wps []*models.Waypoint, constraints []*models.Feature3D, parameters map[string]any, storageType models.StorageType, departure *time.Time, flightTime utils.CostFunction) ([]*models.Waypoint, int, error) {
+	s, err := storage.NewStorage(nil, constraints, storageType)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer s.Clear()
+
+	// isBlocked checks from -> to, left at t if the route is scheduled, and returns when to is reached
+	isBlocked := func(from, to *models.Waypoint, t time.Time) (bool, time.Time, error) {
+		if departure == nil {
+			blocked, _, err := s.IsLineInObstacles(from, to)
+			return blocked, t, err
+		}
+		arrival := t.Add(time.Duration(flightTime.Cost(from, to) * float64(time.Second)))
+		blocked, _, err := s.IsLineInObstaclesAt(from, to, t, arrival)
+		return blocked, arrival, err
+	}
+	var eta time.Time
+	if departure != nil {
+		eta = *departure
+	}
+
+	repaired := []*models.Waypoint{route[0]}
+	replanned := 0
+	for i := 0; i < len(route)-1; {
+		// Out of time, the pieces left are still planned on a best-effort basis
+		if errors.Is(ctx.Err(), context.Canceled) {
+			return nil, 0, fmt.Errorf("route not repaired: %w", ctx.Err())
+		}
+
+		blocked, arrival, err := isBlocked(route[i], route[i+1], eta)
+		if err != nil {
+			return nil, 0, err
+		}
+		if !blocked {
+			repaired = append(repaired, route[i+1])
+			i, eta = i+1, arrival
+			continue
+		}
+
+		// Extend the run while the next segment is blocked too, or it starts inside a constraint
+		end, t := i+1, arrival
+		for end < len(route)-1 {
+			inside, _, err := s.IsPointInObstacles(route[end])
+			if err != nil {
+				return nil, 0, err
+			}
+			next, nextArrival, err := isBlocked(route[end], route[end+1], t)
+			if err != nil {
+				return nil, 0, err
+			}
+			if !inside && !next {
+				break
+			}
+			end, t = end+1, nextArrival
+		}
+
+		pieceWps := []*models.Waypoint{route[i]}
+		for _, wp := range route[i+1 : end] {
+			if slices.Contains(wps, wp) {
+				pieceWps = append(pieceWps, wp)
+			}
+		}
+		pieceWps = append(pieceWps, route[end])
+
+		pieceParameters := parameters
+		if departure != nil {
+			pieceParameters = maps.Clone(parameters)
+			pieceParameters[models.DEPARTURE_TIME_PARAMETER] = eta
+		}
+		piece, _, err := algo.Compute(ctx, searchVolume, pieceWps, constraints, pieceParameters, storageType)
+		if err != nil {
+			return nil, 0, fmt.Errorf("segments %d-%d not replanned: %w", i, end, err)
+		}
+		if departure != nil {
+			eta = eta.Add(time.Duration(utils.TotalCost(flightTime, piece) * float64(time.Second)))
+		}
+
+		repaired = append(repaired, piece[1:]...)
+		replanned += end - i
+		i = end
+	}
+
+	return repaired, replanned, nil
+}
@@ -1,22 +1,69 @@
 package service
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"geopathplanner/routing/internal/algorithm"
+	"geopathplanner/routing/internal/alternatives"
+	"geopathplanner/routing/internal/corridor"
+	"geopathplanner/routing/internal/energy"
+	"geopathplanner/routing/internal/fleet"
 	"geopathplanner/routing/internal/models"
+	"geopathplanner/routing/internal/ordering"
+	"geopathplanner/routing/internal/postprocess"
+	"geopathplanner/routing/internal/storage"
 	"geopathplanner/routing/internal/utils"
 	"geopathplanner/routing/internal/validator"
+	"maps"
+	"os"
+	"slices"
+	"time"
+)
+
+const (
+	// Environment variable with the directory of the wind field files the requests can refer to
+	WIND_DATA_DIR_ENV = "WIND_DATA_DIR"
 )
 
 type RoutingService struct {
+	plans       *planCache // routes found by the last requests, repaired by the replan ones
+	windDataDir string     // wind field files are read from here only, none if empty
 }
 
 func NewRoutingService() (*RoutingService, error) {
-	return &RoutingService{}, nil
+	return &RoutingService{plans: newPlanCache(MAX_CACHED_PLANS), windDataDir: os.Getenv(WIND_DATA_DIR_ENV)}, nil
 }
 
-func (rs *RoutingService) HandleRoutingRequest(input *models.RoutingRequest, val validator.Validator) (*models.RoutingResponse, bool) {
+func (rs *RoutingService) HandleRoutingRequest(ctx context.Context, input *models.RoutingRequest, val validator.Validator) (*models.RoutingResponse, bool) {
 	// TODO: Think about this
 
+	// 0. Bound the computation with time_budget_ms, if given
+	if budget := utils.GetOrDefault(input.Parameters, "time_budget_ms", 0.0); budget > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(budget*float64(time.Millisecond)))
+		defer cancel()
+		// Every leg gets a share of the budget, and the ones stopped by it are recorded to flag the response
+		ctx = algorithm.WithDeadlineRecord(ctx)
+	}
+
+	// The wind field of a file is read here, not while decoding the request
+	if input.WindField != nil {
+		if err := input.WindField.Load(rs.windDataDir); err != nil {
+			return models.NewRoutingResponseError(input, err.Error()), false
+		}
+	}
+
+	// Moving constraints are checked where they are when the vehicle gets there, so a departure time is needed: it takes off now by default
+	setDefaultDepartureTime(input, input.Constraints)
+
+	// A replan repairs the route of a previous request, from where the vehicle is now
+	if input.Replan != nil {
+		return rs.handleReplan(ctx, input, val)
+	}
+
+	parameters := requestParameters(input)
+
 	// 1. Validate waypoints and constraint
 	wps, constraints, err := val.ValidateInput(input.SearchVolume, input.Waypoints, input.Constraints)
 	if err != nil {
@@ -27,19 +74,426 @@ func (rs *RoutingService) HandleRoutingRequest(input *models.RoutingRequest, val
 	utils.MarkWaypointsAsInsideSearchVolume(input.Waypoints, wps...)
 	utils.MarkConstraintsAsInsideSearchVolume(input.Constraints, constraints...)
 
+	if err := algorithm.CheckAcceptanceRadius(input.Algorithm(), parameters, wps); err != nil {
+		return models.NewRoutingResponseError(input, err.Error()), false
+	}
+	if err := algorithm.CheckSpaceParameters(input.Algorithm(), parameters); err != nil {
+		return models.NewRoutingResponseError(input, err.Error()), false
+	}
+	if err := algorithm.CheckSoftConstraints(input.Algorithm(), parameters, constraints); err != nil {
+		return models.NewRoutingResponseError(input, err.Error()), false
+	}
+	if input.DepartureTime != nil || len(input.Vehicles) > 0 {
+		if err := algorithm.CheckSchedule(input.Algorithm(), parameters); err != nil {
+			return models.NewRoutingResponseError(input, err.Error()), false
+		}
+	}
+
 	// 2. Pick and create algorithm (from input)
 	algo, err := algorithm.NewAlgorithm(input.Algorithm())
 	if err != nil {
 		return models.NewRoutingResponseError(input, err.Error()), false
 	}
+	portfolio, _ := algo.(*algorithm.PortfolioAlgorithm)
+	// Legs the algorithm can't plan are tried with the fallback algorithms, if any
+	fallback, err := algorithm.NewFallbackAlgorithmFromParameters(input.Algorithm(), parameters)
+	if err != nil {
+		return models.NewRoutingResponseError(input, err.Error()), false
+	}
+	if fallback != nil {
+		algo = fallback
+	}
+
+	// Read the post-processing pipeline before computing, so that a wrong configuration fails fast
+	pipeline, err := postprocess.NewPipelineFromParameters(parameters)
+	if err != nil {
+		return models.NewRoutingResponseError(input, err.Error()), false
+	}
+
+	optimizer, err := ordering.NewOptimizerFromParameters(parameters)
+	if err != nil {
+		return models.NewRoutingResponseError(input, err.Error()), false
+	}
+
+	generator, err := alternatives.NewGeneratorFromParameters(parameters)
+	if err != nil {
+		return models.NewRoutingResponseError(input, err.Error()), false
+	}
+
+	// A corridor around the route must be clear too: routes are planned among the obstacles grown by its half-widths
+	corridorBuilder, err := corridor.NewBuilderFromParameters(parameters)
+	if err != nil {
+		return models.NewRoutingResponseError(input, err.Error()), false
+	}
+
+	// Several vehicles flying at once get one route each, instead of the one through the waypoints of the request
+	if len(input.Vehicles) > 0 {
+		if corridorBuilder != nil {
+			return models.NewRoutingResponseError(input, "corridor is not supported with vehicles"), false
+		}
+		return rs.handleVehicles(ctx, input, val, algo, pipeline, parameters, constraints)
+	}
+
+	energyModel, err := energy.NewModelFromParameters(parameters)
+	if err != nil {
+		return models.NewRoutingResponseError(input, err.Error()), false
+	}
 
-	// 3. Compute route
+	requestConstraints := constraints
+	if corridorBuilder != nil {
+		for i, wp := range wps {
+			if wp.AcceptanceRadiusMt() == 0 && len(corridorBuilder.Conflicts([]*models.Waypoint{wp, wp}, constraints)) > 0 {
+				return models.NewRoutingResponseError(input, fmt.Sprintf("waypoint %d is closer to a constraint than the corridor half-widths", i)), false
+			}
+		}
+		constraints, err = corridorBuilder.Inflate(constraints)
+		if err != nil {
+			return models.NewRoutingResponseError(input, err.Error()), false
+		}
+	}
+
+	// Same cost function of the algorithms, built from the same constraints, so that the cost in the response is the one they minimized
+	costFunction, err := utils.NewCostFunctionFromParameters(parameters, constraints)
+	if err != nil {
+		return models.NewRoutingResponseError(input, err.Error()), false
+	}
+
+	// Flight time of every leg, for the requests that care about time
+	var flightTime *utils.TimeCost
+	if input.WindField != nil || input.DepartureTime != nil || utils.GetOrDefault(parameters, "cost", "") == "time" {
+		flightTime, err = utils.NewTimeCostFromParameters(parameters)
+		if err != nil {
+			return models.NewRoutingResponseError(input, err.Error()), false
+		}
+	}
+
+	// 3. Compute route, in the given order or in the cheapest one
 	// TODO: Test with both compute and computeConcurrently
-	route, cost, err := algo.ComputeConcurrently(input.SearchVolume, wps, constraints, input.Parameters, input.Storage(), 0)
+	var route []*models.Waypoint
+	var cost float64
+	var order *ordering.Result
+	plannedInOrder := optimizer == nil // legs planned between the wps of the route, not between copies of them
+	if optimizer != nil {
+		order, err = optimizer.Optimize(ctx, algo, input.SearchVolume, wps, constraints, parameters, input.Storage())
+		if err == nil {
+			route, cost, wps = order.Route, order.Cost, order.Waypoints
+		}
+		// Every pair was planned departing at the departure time, not when the vehicle gets there in the chosen order.
+		// If the route meets an active constraint, its legs are planned again in that order, each one departing when the previous one arrives
+		if err == nil && input.DepartureTime != nil {
+			var segment int
+			segment, err = algorithm.FirstActiveCrossing(route, *input.DepartureTime, flightTime, constraints, input.Storage())
+			if err == nil && segment >= 0 {
+				fmt.Printf("Route in the optimized order crosses an active constraint at segment %d, planning it again on schedule\n", segment)
+				route, cost, err = algo.ComputeConcurrently(ctx, input.SearchVolume, wps, constraints, parameters, input.Storage(), 0)
+				plannedInOrder = true
+			}
+		}
+	} else {
+		route, cost, err = algo.ComputeConcurrently(ctx, input.SearchVolume, wps, constraints, parameters, input.Storage(), 0)
+	}
+	// The flag tells if the route was cut short: the steps after it still stop at the deadline, but they don't set it
+	deadlineReached := algorithm.DeadlineReached(ctx)
+	ctx = algorithm.WithoutDeadlineRecord(ctx)
+	if err != nil {
+		response := models.NewRoutingResponseError(input, err.Error())
+		response.DeadlineReached = deadlineReached
+		return response, false
+	}
+
+	// The optimizer plans every pair between copies of the wps, so what planned the legs of the route is only known if they were planned again in order
+	var legAlgorithms []models.AlgorithmType
+	if fallback != nil && plannedInOrder {
+		legAlgorithms = fallback.LegAlgorithms(wps)
+	}
+	var portfolioStats []*models.PortfolioCandidate
+	if portfolio != nil && plannedInOrder {
+		portfolioStats = portfolio.Stats(wps)
+	}
+
+	// With parameters.compare_plain, informed RRT* is compared with the plain one on the same seed, before the route is post-processed.
+	// It's off by default, as it plans the whole route a second time
+	var informedImprovement *float64
+	comparePlain := utils.GetOrDefault(parameters, "compare_plain", false) && utils.GetOrDefault(parameters, "informed", false)
+	if _, ok := costFunction.(utils.DistanceCost); ok && comparePlain && input.Algorithm() == models.RRTStar && !errors.Is(ctx.Err(), context.Canceled) {
+		plainCost, err := plainRRTStarCost(ctx, input, wps, constraints, parameters)
+		if err != nil {
+			fmt.Printf("Informed RRT* not compared with plain RRT*: %v\n", err)
+		} else {
+			improvement := plainCost - cost
+			informedImprovement = &improvement
+		}
+	}
+
+	// 4. Post-process route, whatever algorithm produced it
+	costBeforePostprocess := cost
+	postprocessRoute := func(ctx context.Context, route []*models.Waypoint) ([]*models.Waypoint, error) {
+		s, err := storage.NewEmptyStorage(input.Storage())
+		if err != nil {
+			return nil, err
+		}
+		if err := s.AddConstraints(constraints); err != nil {
+			return nil, err
+		}
+		s.SetCostFunction(costFunction)
+		return pipeline.Process(ctx, route, wps, s)
+	}
+	if pipeline != nil {
+		processed, err := postprocessRoute(ctx, route)
+		if err != nil {
+			return models.NewRoutingResponseError(input, err.Error()), false
+		}
+		// Shorter routes arrive earlier, maybe while a temporary constraint they go through is still active
+		if input.DepartureTime != nil {
+			segment, err := algorithm.FirstActiveCrossing(processed, *input.DepartureTime, flightTime, constraints, input.Storage())
+			if err != nil {
+				return models.NewRoutingResponseError(input, err.Error()), false
+			}
+			if segment >= 0 {
+				fmt.Printf("Post-processed route crosses an active constraint at segment %d, keeping the computed one\n", segment)
+				processed = route
+			}
+		}
+		route = processed
+		cost = utils.TotalCost(costFunction, route)
+		fmt.Printf("Route post-processed: cost %.3f -> %.3f\n", costBeforePostprocess, cost)
+	}
+
+	// Look for other routes through the same waypoints, post-processed the same way
+	var routeAlternatives []*models.RouteAlternative
+	if generator != nil {
+		var refine alternatives.Refine
+		if pipeline != nil {
+			refine = postprocessRoute
+		}
+		routeAlternatives = generator.Generate(ctx, algo, input.SearchVolume, wps, constraints, parameters, input.Storage(), route, costFunction, refine)
+	}
+
+	// Check the battery along the route, stopping at the charging sites when it's not enough
+	var energyReport *models.EnergyReport
+	if energyModel != nil {
+		stops := []int{}
+		if len(input.ChargingSites) > 0 && !energyModel.Feasible(energyModel.RemainingWh(route, stops)) {
+			var refine energy.Refine
+			if pipeline != nil {
+				refine = postprocessRoute
+			}
+			withStops, withStopsIndexes, err := energyModel.InsertChargingStops(ctx, algo, input.SearchVolume, route, wps, input.ChargingSites, constraints, parameters, input.Storage(), refine)
+			// Legs to and from the sites are refined like the route, so they may cross an active constraint as well
+			if err == nil && input.DepartureTime != nil {
+				var segment int
+				if segment, err = algorithm.FirstActiveCrossing(withStops, *input.DepartureTime, flightTime, constraints, input.Storage()); err == nil && segment >= 0 {
+					err = fmt.Errorf("route with charging stops crosses an active constraint at segment %d", segment)
+				}
+			}
+			if err != nil {
+				fmt.Printf("Charging stops not inserted: %v\n", err)
+			} else {
+				route, stops = withStops, withStopsIndexes
+				cost = utils.TotalCost(costFunction, route)
+			}
+		}
+		remaining := energyModel.RemainingWh(route, stops)
+		energyReport = &models.EnergyReport{Feasible: energyModel.Feasible(remaining), RemainingWh: remaining, ChargingStops: stops}
+	}
+
+	// The corridor is checked against the constraints of the request, not only its centreline
+	var routeCorridor *models.Feature3D
+	if corridorBuilder != nil {
+		if conflicts := corridorBuilder.Conflicts(route, requestConstraints); len(conflicts) > 0 {
+			return models.NewRoutingResponseError(input, fmt.Sprintf("corridor of the route meets %d constraints", len(conflicts))), false
+		}
+		routeCorridor, err = corridorBuilder.Build(route)
+		if err != nil {
+			return models.NewRoutingResponseError(input, err.Error()), false
+		}
+	}
+
+	// 5. Return route, flagging it if the planners were stopped by the time budget
+	response := models.NewRoutingResponseSuccess(input, route, cost)
+	if pipeline != nil {
+		response.CostBeforePostprocessKm = costBeforePostprocess
+	}
+	response.Alternatives = routeAlternatives
+	response.LegAlgorithms = legAlgorithms
+	response.PortfolioStats = portfolioStats
+	response.InformedImprovementKm = informedImprovement
+	response.Corridor = routeCorridor
+	response.Energy = energyReport
+	if flightTime != nil {
+		response.LegFlightTimesS = legCosts(route, wps, flightTime)
+	}
+	if order != nil {
+		response.WaypointOrder = requestIndexes(input.Waypoints, wps[:len(order.Order)])
+	}
+	if deadlineReached {
+		response.SetDeadlineReached()
+	}
+	// The battery warning goes with the deadline message, if any
+	if energyReport != nil && !energyReport.Feasible {
+		if deadlineReached {
+			response.Message += ", but it exceeds the battery"
+		} else {
+			response.Message = "Route computed but it exceeds the battery"
+		}
+	}
+	rs.plans.put(input.RequestID, &plan{searchVolume: input.SearchVolume, waypoints: wps, constraints: requestConstraints, parameters: input.Parameters, windField: input.WindField, route: route})
+	return response, true
+}
+
+// requestParameters are the parameters of input for the algorithms.
+// The wind field goes with the parameters, so that the algorithms build the same cost function of the service.
+// The same for the departure time, so that they know when the vehicle is inside the temporary constraints.
+func requestParameters(input *models.RoutingRequest) map[string]any {
+	if input.WindField == nil && input.DepartureTime == nil {
+		return input.Parameters
+	}
+	parameters := make(map[string]any, len(input.Parameters)+2)
+	maps.Copy(parameters, input.Parameters)
+	if input.WindField != nil {
+		parameters[models.WIND_FIELD_PARAMETER] = input.WindField
+	}
+	if input.DepartureTime != nil {
+		parameters[models.DEPARTURE_TIME_PARAMETER] = *input.DepartureTime
+	}
+	return parameters
+}
+
+// setDefaultDepartureTime makes input depart at defaultDepartureTime if it has no departure time and any of constraints moves
+func setDefaultDepartureTime(input *models.RoutingRequest, constraints []*models.Feature3D) {
+	if input.DepartureTime != nil || !slices.ContainsFunc(constraints, (*models.Feature3D).IsMoving) {
+		return
+	}
+	departure := defaultDepartureTime(input)
+	input.DepartureTime = &departure
+	fmt.Printf("Moving constraints and no departure_time, departing at %v\n", departure)
+}
+
+// defaultDepartureTime is when the request was received, or now if it's not known
+func defaultDepartureTime(input *models.RoutingRequest) time.Time {
+	if input.ReceivedAt.IsZero() {
+		return time.Now()
+	}
+	return input.ReceivedAt
+}
+
+// plainRRTStarCost is the cost of the route through wps computed by RRT* without informed sampling, with the other parameters as they are.
+// It gets the whole time_budget_ms of its own, like the informed run did, not what is left of ctx. Cancelling ctx stops it all the same.
+func plainRRTStarCost(ctx context.Context, input *models.RoutingRequest, wps []*models.Waypoint, constraints []*models.Feature3D, parameters map[string]any) (float64, error) {
+	plain, err := algorithm.NewRRTStarAlgorithm()
+	if err != nil {
+		return 0.0, err
+	}
+	plainParameters := maps.Clone(parameters)
+	plainParameters["informed"] = false
+
+	plainCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	if budget := utils.GetOrDefault(input.Parameters, "time_budget_ms", 0.0); budget > 0 {
+		plainCtx, cancel = context.WithTimeout(context.WithoutCancel(ctx), time.Duration(budget*float64(time.Millisecond)))
+	}
+	defer cancel()
+	stop := context.AfterFunc(ctx, func() {
+		if errors.Is(ctx.Err(), context.Canceled) {
+			cancel()
+		}
+	})
+	defer stop()
+
+	_, cost, err := plain.ComputeConcurrently(plainCtx, input.SearchVolume, wps, constraints, plainParameters, input.Storage(), 0)
+	return cost, err
+}
+
+// handleVehicles routes every vehicle of the request, kept apart from the ones before it in the list.
+// The waypoints of every vehicle are validated like the ones of the request, the constraints have already been.
+func (rs *RoutingService) handleVehicles(ctx context.Context, input *models.RoutingRequest, val validator.Validator, algo algorithm.Algorithm, pipeline *postprocess.Pipeline, parameters map[string]any, constraints []*models.Feature3D) (*models.RoutingResponse, bool) {
+	planner, err := fleet.NewPlannerFromParameters(parameters)
 	if err != nil {
 		return models.NewRoutingResponseError(input, err.Error()), false
 	}
 
-	// 4. Return route
-	return models.NewRoutingResponseSuccess(input, route, cost), true
-}
\ No newline at end of file
+	vehicles := make([]*models.Vehicle, 0, len(input.Vehicles))
+	for _, vehicle := range input.Vehicles {
+		wps, _, err := val.ValidateInput(input.SearchVolume, vehicle.Waypoints, nil)
+		if err != nil {
+			return models.NewRoutingResponseError(input, fmt.Sprintf("vehicle %s: %v", vehicle.ID, err)), false
+		}
+		if err := algorithm.CheckAcceptanceRadius(input.Algorithm(), parameters, wps); err != nil {
+			return models.NewRoutingResponseError(input, fmt.Sprintf("vehicle %s: %v", vehicle.ID, err)), false
+		}
+		validated := *vehicle
+		validated.Waypoints = wps
+		vehicles = append(vehicles, &validated)
+	}
+
+	// Vehicles without their own departure time take off together, when the request says or when it was received
+	departure := defaultDepartureTime(input)
+	if input.DepartureTime != nil {
+		departure = *input.DepartureTime
+	}
+
+	var refine fleet.Refine
+	if pipeline != nil {
+		refine = func(ctx context.Context, route []*models.Waypoint, wps []*models.Waypoint) ([]*models.Waypoint, error) {
+			s, err := storage.NewEmptyStorage(input.Storage())
+			if err != nil {
+				return nil, err
+			}
+			if err := s.AddConstraints(constraints); err != nil {
+				return nil, err
+			}
+			costFunction, err := utils.NewCostFunctionFromParameters(parameters, constraints)
+			if err != nil {
+				return nil, err
+			}
+			s.SetCostFunction(costFunction)
+			return pipeline.Process(ctx, route, wps, s)
+		}
+	}
+
+	routes, err := planner.Plan(ctx, algo, input.SearchVolume, vehicles, constraints, parameters, input.Storage(), departure, refine)
+	if err != nil {
+		response := models.NewRoutingResponseError(input, err.Error())
+		response.DeadlineReached = algorithm.DeadlineReached(ctx)
+		return response, false
+	}
+
+	cost := 0.0
+	for _, r := range routes {
+		cost += r.CostKm
+	}
+	response := models.NewRoutingResponseSuccess(input, nil, cost)
+	response.Message = fmt.Sprintf("Routes computed successfully for %d vehicles", len(routes))
+	response.VehicleRoutes = routes
+	if algorithm.DeadlineReached(ctx) {
+		response.SetDeadlineReached()
+	}
+	return response, true
+}
+
+// requestIndexes returns the position in the request of every wp, as validation may have dropped some of them.
+func requestIndexes(requested []*models.Waypoint, wps []*models.Waypoint) []int {
+	position := make(map[*models.Waypoint]int, len(requested))
+	for i, wp := range requested {
+		position[wp] = i
+	}
+
+	indexes := make([]int, len(wps))
+	for i, wp := range wps {
+		indexes[i] = position[wp]
+	}
+	return indexes
+}
+
+// legCosts splits route at the wps it goes through, in order, and returns the cost of every part.
+func legCosts(route []*models.Waypoint, wps []*models.Waypoint, f utils.CostFunction) []float64 {
+	costs := make([]float64, 0, len(wps)-1)
+	next, cost := 1, 0.0
+	for i := 1; i < len(route); i++ {
+		cost += f.Cost(route[i-1], route[i])
+		if next < len(wps) && route[i].Reaches(wps[next]) {
+			costs = append(costs, cost)
+			next, cost = next+1, 0.0
+		}
+	}
+	return costs
+}
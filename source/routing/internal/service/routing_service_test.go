@@ -1,10 +1,18 @@
 package service_test
 
 import (
+	"cmp"
+	"context"
+	"fmt"
+	"geopathplanner/routing/internal/algorithm"
 	"geopathplanner/routing/internal/models"
 	"geopathplanner/routing/internal/service"
 	"geopathplanner/routing/internal/utils"
 	"geopathplanner/routing/internal/validator"
+	"maps"
+	"math"
+	"slices"
+	"strings"
 	"testing"
 )
 
@@ -2339,7 +2347,7 @@ func TestRoutingService_HandleRoutingRequest(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			rs, _ := service.NewRoutingService()
-			got, found := rs.HandleRoutingRequest(tt.input, validator.NewDefaultValidator())
+			got, found := rs.HandleRoutingRequest(context.Background(), tt.input, validator.NewDefaultValidator())
             
             // Export result in geojson
             utils.MarkWaypointsAsOriginal(tt.input.Waypoints...)
@@ -2353,3 +2361,847 @@ func TestRoutingService_HandleRoutingRequest(t *testing.T) {
 		})
 	}
 }
+
+func TestRoutingService_HandleRoutingRequest_timeBudget(t *testing.T) {
+	// The first and the last leg go through the constraint, RRT* never ends its iterations before the budget
+	request := func(name string, departure string) string {
+		return `{
+			"request_id": "` + name + `",
+			"waypoints": [
+				{"type": "Feature", "geometry": {"type": "Point", "coordinates": [3.9985, 50.0]}, "properties": {"altitudeUnit": "mt", "altitudeValue": 100}},
+				{"type": "Feature", "geometry": {"type": "Point", "coordinates": [4.0045, 50.0]}, "properties": {"altitudeUnit": "mt", "altitudeValue": 100}},
+				{"type": "Feature", "geometry": {"type": "Point", "coordinates": [4.001, 49.9975]}, "properties": {"altitudeUnit": "mt", "altitudeValue": 100}},
+				{"type": "Feature", "geometry": {"type": "Point", "coordinates": [4.001, 50.0025]}, "properties": {"altitudeUnit": "mt", "altitudeValue": 100}}
+			],
+			"constraints": [
+				{"type": "Feature", "geometry": {"type": "Polygon", "coordinates": [[[4.0, 49.999], [4.002, 49.999], [4.002, 50.001], [4.0, 50.001], [4.0, 49.999]]]}, "properties": {}}
+			],
+			"search_volume": {"type": "Feature", "geometry": {"type": "Polygon", "coordinates": [[[3.996, 49.997], [4.007, 49.997], [4.007, 50.003], [3.996, 50.003], [3.996, 49.997]]]}, "properties": {}},
+			"parameters": {"algorithm": "rrtstar", "storage": "rtree", "seed": 945, "time_budget_ms": 1500}` + departure + `
+		}`
+	}
+
+	tests := []struct {
+		name      string // description of this test case
+		departure string
+	}{
+		{name: "RR-TimeBudget-RRTStar", departure: ``},
+		// Scheduled legs are planned one after the other
+		{name: "RR-TimeBudget-Scheduled-RRTStar", departure: `, "departure_time": "2026-10-17T09:00:00Z"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input, err := models.NewRoutingRequestFromJson(request(tt.name, tt.departure))
+			if err != nil {
+				t.Fatalf("could not construct request: %v", err)
+			}
+			rs, _ := service.NewRoutingService()
+			got, found := rs.HandleRoutingRequest(context.Background(), input, validator.NewDefaultValidator())
+			if !found {
+				t.Fatalf("HandleRoutingRequest() found no route: %s", got.Message)
+			}
+			utils.ExportToJSON(got, "service", tt.name, false)
+
+			if !got.DeadlineReached {
+				t.Errorf("HandleRoutingRequest() deadline reached = false, want true")
+			}
+			// The best route so far of every leg, through all the waypoints in order
+			next := 0
+			for _, wp := range got.Route {
+				if next < len(input.Waypoints) && wp.Lat == input.Waypoints[next].Lat && wp.Lon == input.Waypoints[next].Lon {
+					next++
+				}
+			}
+			if next != len(input.Waypoints) {
+				t.Errorf("HandleRoutingRequest() route goes through %d of %d waypoints", next, len(input.Waypoints))
+			}
+		})
+	}
+}
+
+func TestRoutingService_HandleRoutingRequest_informed(t *testing.T) {
+	const request = `{
+		"request_id": "%s",
+		"waypoints": [
+			{"type": "Feature", "geometry": {"type": "Point", "coordinates": [3.9985, 50.0]}, "properties": {"altitudeUnit": "mt", "altitudeValue": 100}},
+			{"type": "Feature", "geometry": {"type": "Point", "coordinates": [4.0045, 50.0]}, "properties": {"altitudeUnit": "mt", "altitudeValue": 100}}
+		],
+		"constraints": [
+			{"type": "Feature", "geometry": {"type": "Polygon", "coordinates": [[[4.0, 49.999], [4.002, 49.999], [4.002, 50.001], [4.0, 50.001], [4.0, 49.999]]]}, "properties": {}}
+		],
+		"search_volume": {"type": "Feature", "geometry": {"type": "Polygon", "coordinates": [[[3.996, 49.997], [4.007, 49.997], [4.007, 50.003], [3.996, 50.003], [3.996, 49.997]]]}, "properties": {}},
+		"parameters": %s
+	}`
+
+	tests := []struct {
+		name         string // description of this test case
+		params       string
+		wantCompared bool
+	}{
+		{name: "RR-Informed", params: `{"algorithm": "rrtstar", "storage": "rtree", "max_iterations": 1500, "seed": 945, "informed": true, "compare_plain": true}`, wantCompared: true},
+		// The informed run uses up the budget, the plain one gets the same budget of its own
+		{name: "RR-Informed-TimeBudget", params: `{"algorithm": "rrtstar", "storage": "rtree", "max_iterations": 100000, "seed": 945, "informed": true, "compare_plain": true, "time_budget_ms": 300}`, wantCompared: true},
+		{name: "RR-Informed-NotCompared", params: `{"algorithm": "rrtstar", "storage": "rtree", "max_iterations": 1500, "seed": 945, "informed": true}`, wantCompared: false},
+		{name: "RR-Informed-WeightedCost", params: `{"algorithm": "rrtstar", "storage": "rtree", "max_iterations": 1500, "seed": 945, "informed": true, "compare_plain": true, "cost": {"climb_weight": 1}}`, wantCompared: false},
+		{name: "RR-Informed-TimeCost", params: `{"algorithm": "rrtstar", "storage": "rtree", "max_iterations": 1500, "seed": 945, "informed": true, "compare_plain": true, "cost": "time"}`, wantCompared: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input, err := models.NewRoutingRequestFromJson(fmt.Sprintf(request, tt.name, tt.params))
+			if err != nil {
+				t.Fatalf("could not construct request: %v", err)
+			}
+			rs, _ := service.NewRoutingService()
+			got, found := rs.HandleRoutingRequest(context.Background(), input, validator.NewDefaultValidator())
+			if !found {
+				t.Fatalf("HandleRoutingRequest() found no route: %s", got.Message)
+			}
+			utils.ExportToJSON(got, "service", tt.name, false)
+
+			// Without compare_plain, or with costs that don't use informed sampling, there is nothing to compare
+			if compared := got.InformedImprovementKm != nil; compared != tt.wantCompared {
+				t.Errorf("HandleRoutingRequest() compared with plain RRT* = %t, want %t", compared, tt.wantCompared)
+			}
+		})
+	}
+}
+
+func TestRoutingService_HandleRoutingRequest_windField(t *testing.T) {
+	sv, w_list, c_list, _ := utils.SetupTestScenario()
+	wind := &models.WindField{LatStep: 1, LonStep: 1, U: [][][]float64{{{5}}}, V: [][][]float64{{{-3}}}}
+
+	tests := []struct {
+		name       string // description of this test case
+		parameters map[string]any
+		wind       *models.WindField
+	}{
+		{name: "RR-Wind-TimeCost-VisGraph", parameters: map[string]any{"algorithm": "visgraph", "storage": "rtree", "cost": "time", "airspeed_ms": 15.0}, wind: wind},
+		{name: "RR-NoWind-TimeCost-VisGraph", parameters: map[string]any{"algorithm": "visgraph", "storage": "rtree", "cost": "time", "airspeed_ms": 15.0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := &models.RoutingRequest{RequestID: tt.name, Waypoints: w_list, Constraints: c_list, SearchVolume: sv, Parameters: tt.parameters, WindField: tt.wind}
+			rs, _ := service.NewRoutingService()
+			got, found := rs.HandleRoutingRequest(context.Background(), input, validator.NewDefaultValidator())
+			if !found {
+				t.Fatalf("HandleRoutingRequest() found no route: %s", got.Message)
+			}
+			utils.ExportToJSON(got, "service", tt.name, false)
+
+			if len(got.LegFlightTimesS) != len(w_list)-1 {
+				t.Fatalf("HandleRoutingRequest() returned %d leg flight times, want %d", len(got.LegFlightTimesS), len(w_list)-1)
+			}
+			// The cost is the flight time, and every leg is flown at most at airspeed + wind
+			total := 0.0
+			for _, legTime := range got.LegFlightTimesS {
+				total += legTime
+			}
+			if math.Abs(total-got.CostKm) > 1e-6 {
+				t.Errorf("leg flight times add up to %.3f s, want the cost %.3f s", total, got.CostKm)
+			}
+			if minTime := utils.TotalHaversineDistance(got.Route) / (15 + math.Hypot(5, 3)); total < minTime {
+				t.Errorf("flight time %.3f s is less than flying the route with the wind in the back %.3f s", total, minTime)
+			}
+			if _, ok := tt.parameters[models.WIND_FIELD_PARAMETER]; ok {
+				t.Errorf("HandleRoutingRequest() changed the parameters of the request")
+			}
+		})
+	}
+}
+
+func TestRoutingService_HandleRoutingRequest_windFieldFile(t *testing.T) {
+	sv, w_list, c_list, _ := utils.SetupTestScenario()
+
+	tests := []struct {
+		name      string // description of this test case
+		dir       string
+		file      string
+		wantFound bool
+	}{
+		{name: "RR-WindFile", dir: utils.ResolvePath("dev/requests"), file: "wind_field_example.json", wantFound: true},
+		{name: "RR-WindFile-OutsideDir", dir: utils.ResolvePath("dev/requests"), file: "../requests/wind_field_example.json", wantFound: false},
+		{name: "RR-WindFile-NoDir", dir: "", file: "wind_field_example.json", wantFound: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(service.WIND_DATA_DIR_ENV, tt.dir)
+			input := &models.RoutingRequest{RequestID: tt.name, Waypoints: w_list, Constraints: c_list, SearchVolume: sv, Parameters: map[string]any{"algorithm": "visgraph", "storage": "rtree"}, WindField: &models.WindField{File: tt.file}}
+			rs, _ := service.NewRoutingService()
+			got, found := rs.HandleRoutingRequest(context.Background(), input, validator.NewDefaultValidator())
+			if found != tt.wantFound {
+				t.Fatalf("HandleRoutingRequest() found = %t, want %t: %s", found, tt.wantFound, got.Message)
+			}
+			if found && len(got.LegFlightTimesS) != len(w_list)-1 {
+				t.Errorf("HandleRoutingRequest() returned %d leg flight times, want %d", len(got.LegFlightTimesS), len(w_list)-1)
+			}
+		})
+	}
+}
+
+func TestRoutingService_HandleRoutingRequest_energy(t *testing.T) {
+	sv, w_list, c_list, _ := utils.SetupTestScenario()
+
+	visgraph := map[string]any{"algorithm": "visgraph", "storage": "rtree"}
+
+	tests := []struct {
+		name         string // description of this test case
+		parameters   map[string]any
+		batteryWh    float64
+		wantFeasible bool
+		wantDeadline bool
+	}{
+		{name: "RR-Energy-Feasible-VisGraph", parameters: visgraph, batteryWh: 1000, wantFeasible: true},
+		{name: "RR-Energy-NotFeasible-VisGraph", parameters: visgraph, batteryWh: 0.1, wantFeasible: false},
+		{name: "RR-Energy-NotFeasible-TimeBudget-RRTStar", parameters: map[string]any{"algorithm": "rrtstar", "storage": "rtree", "seed": 945.0, "step_size_mt": 50.0, "goal_bias": 0.1, "time_budget_ms": 3000.0}, batteryWh: 0.1, wantFeasible: false, wantDeadline: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parameters := maps.Clone(tt.parameters)
+			parameters["energy"] = map[string]any{"battery_wh": tt.batteryWh, "cruise_power_w": 200.0}
+			input := &models.RoutingRequest{RequestID: tt.name, Waypoints: w_list, Constraints: c_list, SearchVolume: sv, Parameters: parameters}
+			rs, _ := service.NewRoutingService()
+			got, found := rs.HandleRoutingRequest(context.Background(), input, validator.NewDefaultValidator())
+			if !found {
+				t.Fatalf("HandleRoutingRequest() found no route: %s", got.Message)
+			}
+			utils.ExportToJSON(got, "service", tt.name, false)
+
+			if got.Energy == nil {
+				t.Fatal("HandleRoutingRequest() returned no energy report")
+			}
+			if got.Energy.Feasible != tt.wantFeasible {
+				t.Errorf("HandleRoutingRequest() feasible: %t, want %t", got.Energy.Feasible, tt.wantFeasible)
+			}
+			if len(got.Energy.RemainingWh) != len(got.Route) {
+				t.Errorf("HandleRoutingRequest() returned %d remaining energies for %d wps", len(got.Energy.RemainingWh), len(got.Route))
+			}
+			if !slices.IsSortedFunc(got.Energy.RemainingWh, func(a, b float64) int { return cmp.Compare(b, a) }) {
+				t.Errorf("remaining energy %v grows without charging stops", got.Energy.RemainingWh)
+			}
+			// Neither the battery warning nor the deadline message hides the other
+			if got.DeadlineReached != tt.wantDeadline {
+				t.Errorf("HandleRoutingRequest() deadline reached = %t, want %t", got.DeadlineReached, tt.wantDeadline)
+			}
+			if !tt.wantFeasible && !strings.Contains(got.Message, "exceeds the battery") {
+				t.Errorf("HandleRoutingRequest() message = %q, want the battery warning", got.Message)
+			}
+			if tt.wantDeadline && !strings.Contains(got.Message, "deadline") {
+				t.Errorf("HandleRoutingRequest() message = %q, want the deadline message", got.Message)
+			}
+		})
+	}
+}
+
+func TestRoutingService_HandleRoutingRequest_departureTime(t *testing.T) {
+	request := func(departure string) string {
+		return `{
+			"request_id": "RR-DepartureTime",
+			"waypoints": [
+				{"type": "Feature", "geometry": {"type": "Point", "coordinates": [3.9985, 50.0]}, "properties": {"altitudeUnit": "mt", "altitudeValue": 100}},
+				{"type": "Feature", "geometry": {"type": "Point", "coordinates": [4.0045, 50.0]}, "properties": {"altitudeUnit": "mt", "altitudeValue": 100}}
+			],
+			"constraints": [
+				{"type": "Feature", "geometry": {"type": "Polygon", "coordinates": [[[4.0, 49.999], [4.002, 49.999], [4.002, 50.001], [4.0, 50.001], [4.0, 49.999]]]}, "properties": {"active_from": "2026-10-17T10:00:00Z", "active_until": "2026-10-17T11:00:00Z"}}
+			],
+			"search_volume": {"type": "Feature", "geometry": {"type": "Polygon", "coordinates": [[[3.996, 49.997], [4.007, 49.997], [4.007, 50.003], [3.996, 50.003], [3.996, 49.997]]]}, "properties": {}},
+			"parameters": {"algorithm": "visgraph", "storage": "rtree"}` + departure + `
+		}`
+	}
+
+	tests := []struct {
+		name         string // description of this test case
+		departure    string
+		wantStraight bool
+	}{
+		{name: "RR-DepartureTime-BeforeClosure-VisGraph", departure: `, "departure_time": "2026-10-17T09:00:00Z"`, wantStraight: true},
+		{name: "RR-DepartureTime-DuringClosure-VisGraph", departure: `, "departure_time": "2026-10-17T10:30:00+00:00"`, wantStraight: false},
+		{name: "RR-NoDepartureTime-VisGraph", departure: ``, wantStraight: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input, err := models.NewRoutingRequestFromJson(request(tt.departure))
+			if err != nil {
+				t.Fatalf("could not construct request: %v", err)
+			}
+			rs, _ := service.NewRoutingService()
+			got, found := rs.HandleRoutingRequest(context.Background(), input, validator.NewDefaultValidator())
+			if !found {
+				t.Fatalf("HandleRoutingRequest() found no route: %s", got.Message)
+			}
+			utils.ExportToJSON(got, "service", tt.name, false)
+
+			// Without a departure time temporary constraints always block
+			if straight := len(got.Route) == 2; straight != tt.wantStraight {
+				t.Errorf("HandleRoutingRequest() route has %d wps, straight line: %t, want %t", len(got.Route), straight, tt.wantStraight)
+			}
+			if scheduled := input.DepartureTime != nil; scheduled != (len(got.LegFlightTimesS) == 1) {
+				t.Errorf("HandleRoutingRequest() returned %d leg flight times, scheduled: %t", len(got.LegFlightTimesS), scheduled)
+			}
+			if _, ok := input.Parameters[models.DEPARTURE_TIME_PARAMETER]; ok {
+				t.Errorf("HandleRoutingRequest() changed the parameters of the request")
+			}
+		})
+	}
+}
+
+func TestRoutingService_HandleRoutingRequest_optimizeOrderDepartureTime(t *testing.T) {
+	// wp[1] is the nearest to wp[0]: the cheapest order flies north to south through the zone from wp[1] to wp[2], between 34 s and 49 s after departing
+	request := func(activeFrom string) string {
+		return `{
+			"request_id": "RR-OptimizeOrder-DepartureTime",
+			"waypoints": [
+				{"type": "Feature", "geometry": {"type": "Point", "coordinates": [3.997, 50.003]}, "properties": {"altitudeUnit": "mt", "altitudeValue": 100}},
+				{"type": "Feature", "geometry": {"type": "Point", "coordinates": [4.001, 50.003]}, "properties": {"altitudeUnit": "mt", "altitudeValue": 100}},
+				{"type": "Feature", "geometry": {"type": "Point", "coordinates": [4.001, 49.997]}, "properties": {"altitudeUnit": "mt", "altitudeValue": 100}}
+			],
+			"constraints": [
+				{"type": "Feature", "geometry": {"type": "Polygon", "coordinates": [[[4.0, 49.999], [4.002, 49.999], [4.002, 50.001], [4.0, 50.001], [4.0, 49.999]]]}, "properties": {"active_from": "` + activeFrom + `", "active_until": "2026-10-17T11:00:00Z"}}
+			],
+			"search_volume": {"type": "Feature", "geometry": {"type": "Polygon", "coordinates": [[[3.995, 49.995], [4.007, 49.995], [4.007, 50.005], [3.995, 50.005], [3.995, 49.995]]]}, "properties": {}},
+			"departure_time": "2026-10-17T10:00:00Z",
+			"parameters": {"algorithm": "visgraph", "storage": "rtree", "optimize_order": "open"}
+		}`
+	}
+
+	tests := []struct {
+		name         string // description of this test case
+		activeFrom   string
+		wantStraight bool
+	}{
+		{name: "RR-OptimizeOrder-ClosingOnTheWay-VisGraph", activeFrom: "2026-10-17T10:00:40Z", wantStraight: false},
+		{name: "RR-OptimizeOrder-ClosingAfterwards-VisGraph", activeFrom: "2026-10-17T10:30:00Z", wantStraight: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input, err := models.NewRoutingRequestFromJson(request(tt.activeFrom))
+			if err != nil {
+				t.Fatalf("could not construct request: %v", err)
+			}
+			rs, _ := service.NewRoutingService()
+			got, found := rs.HandleRoutingRequest(context.Background(), input, validator.NewDefaultValidator())
+			if !found {
+				t.Fatalf("HandleRoutingRequest() found no route: %s", got.Message)
+			}
+			utils.ExportToJSON(got, "service", tt.name, false)
+
+			if !slices.Equal(got.WaypointOrder, []int{0, 1, 2}) {
+				t.Errorf("HandleRoutingRequest() waypoint order = %v, want [0 1 2]", got.WaypointOrder)
+			}
+			if straight := len(got.Route) == 3; straight != tt.wantStraight {
+				t.Errorf("HandleRoutingRequest() route has %d wps, straight lines: %t, want %t", len(got.Route), straight, tt.wantStraight)
+			}
+			flightTime, _ := utils.NewTimeCostFromParameters(input.Parameters)
+			segment, err := algorithm.FirstActiveCrossing(got.Route, *input.DepartureTime, flightTime, input.Constraints, models.RTree)
+			if err != nil || segment >= 0 {
+				t.Errorf("HandleRoutingRequest() route crosses an active constraint at segment %d: %v", segment, err)
+			}
+		})
+	}
+}
+
+func TestRoutingService_HandleRoutingRequest_movingConstraintNoDepartureTime(t *testing.T) {
+	// The cell is on the straight line at 09:00, then it moves south at 1 m/s: 3.6 km away at 10:00
+	request := func(receivedAt string) string {
+		return `{
+			"request_id": "RR-Moving-NoDepartureTime",
+			"received_at": "` + receivedAt + `",
+			"waypoints": [
+				{"type": "Feature", "geometry": {"type": "Point", "coordinates": [3.9985, 50.0]}, "properties": {"altitudeUnit": "mt", "altitudeValue": 100}},
+				{"type": "Feature", "geometry": {"type": "Point", "coordinates": [4.0045, 50.0]}, "properties": {"altitudeUnit": "mt", "altitudeValue": 100}}
+			],
+			"constraints": [
+				{"type": "Feature", "geometry": {"type": "Polygon", "coordinates": [[[4.0, 49.999], [4.002, 49.999], [4.002, 50.001], [4.0, 50.001], [4.0, 49.999]]]}, "properties": {"speed_ms": 1, "heading_deg": 180, "reference_time": "2026-10-17T09:00:00Z"}}
+			],
+			"search_volume": {"type": "Feature", "geometry": {"type": "Polygon", "coordinates": [[[3.996, 49.997], [4.007, 49.997], [4.007, 50.003], [3.996, 50.003], [3.996, 49.997]]]}, "properties": {}},
+			"parameters": {"algorithm": "visgraph", "storage": "rtree"}
+		}`
+	}
+
+	tests := []struct {
+		name         string // description of this test case
+		receivedAt   string
+		wantStraight bool
+	}{
+		{name: "RR-Moving-ReceivedOnTheLine-VisGraph", receivedAt: "2026-10-17T09:00:00Z", wantStraight: false},
+		{name: "RR-Moving-ReceivedAfterItMoved-VisGraph", receivedAt: "2026-10-17T10:00:00Z", wantStraight: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input, err := models.NewRoutingRequestFromJson(request(tt.receivedAt))
+			if err != nil {
+				t.Fatalf("could not construct request: %v", err)
+			}
+			rs, _ := service.NewRoutingService()
+			got, found := rs.HandleRoutingRequest(context.Background(), input, validator.NewDefaultValidator())
+			if !found {
+				t.Fatalf("HandleRoutingRequest() found no route: %s", got.Message)
+			}
+			utils.ExportToJSON(got, "service", tt.name, false)
+
+			// The vehicle departs when the request was received, where the cell is then
+			if input.DepartureTime == nil || !input.DepartureTime.Equal(input.ReceivedAt) {
+				t.Errorf("HandleRoutingRequest() departure time = %v, want %v", input.DepartureTime, input.ReceivedAt)
+			}
+			if straight := len(got.Route) == 2; straight != tt.wantStraight {
+				t.Errorf("HandleRoutingRequest() route has %d wps, straight line: %t, want %t", len(got.Route), straight, tt.wantStraight)
+			}
+		})
+	}
+}
+
+func TestRoutingService_HandleRoutingRequest_vehicles(t *testing.T) {
+	request := func(northAlt float64) string {
+		return fmt.Sprintf(`{
+			"request_id": "RR-Vehicles",
+			"vehicles": [
+				{"id": "east", "waypoints": [
+					{"type": "Feature", "geometry": {"type": "Point", "coordinates": [3.9985, 50.0]}, "properties": {"altitudeUnit": "mt", "altitudeValue": 100}},
+					{"type": "Feature", "geometry": {"type": "Point", "coordinates": [4.0075, 50.0]}, "properties": {"altitudeUnit": "mt", "altitudeValue": 100}}
+				]},
+				{"id": "north", "airspeed_ms": 15, "waypoints": [
+					{"type": "Feature", "geometry": {"type": "Point", "coordinates": [4.003, 49.9971]}, "properties": {"altitudeUnit": "mt", "altitudeValue": %f}},
+					{"type": "Feature", "geometry": {"type": "Point", "coordinates": [4.003, 50.0029]}, "properties": {"altitudeUnit": "mt", "altitudeValue": %f}}
+				]}
+			],
+			"search_volume": {"type": "Feature", "geometry": {"type": "Polygon", "coordinates": [[[3.995, 49.994], [4.011, 49.994], [4.011, 50.006], [3.995, 50.006], [3.995, 49.994]]]}, "properties": {}},
+			"departure_time": "2026-10-17T10:00:00Z",
+			"parameters": {"algorithm": "rrt", "storage": "rtree", "postprocess": true}
+		}`, northAlt, northAlt)
+	}
+
+	tests := []struct {
+		name              string // description of this test case
+		northAlt          float64
+		wantNorthStraight bool
+	}{
+		{name: "RR-Vehicles-SameAltitude-RRT", northAlt: 100, wantNorthStraight: false},
+		{name: "RR-Vehicles-VerticallySeparated-RRT", northAlt: 150, wantNorthStraight: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input, err := models.NewRoutingRequestFromJson(request(tt.northAlt))
+			if err != nil {
+				t.Fatalf("could not construct request: %v", err)
+			}
+			rs, _ := service.NewRoutingService()
+			got, found := rs.HandleRoutingRequest(context.Background(), input, validator.NewDefaultValidator())
+			if !found {
+				t.Fatalf("HandleRoutingRequest() found no route: %s", got.Message)
+			}
+			utils.ExportToJSON(got, "service", tt.name, false)
+
+			if len(got.VehicleRoutes) != 2 {
+				t.Fatalf("HandleRoutingRequest() returned %d vehicle routes, want 2", len(got.VehicleRoutes))
+			}
+			if got.VehicleRoutes[0].ID != "east" || len(got.VehicleRoutes[0].Route) != 2 {
+				t.Errorf("HandleRoutingRequest() first vehicle = %s with %d wps, want east flying straight", got.VehicleRoutes[0].ID, len(got.VehicleRoutes[0].Route))
+			}
+			if straight := len(got.VehicleRoutes[1].Route) == 2; straight != tt.wantNorthStraight {
+				t.Errorf("HandleRoutingRequest() second vehicle has %d wps, straight line: %t, want %t", len(got.VehicleRoutes[1].Route), straight, tt.wantNorthStraight)
+			}
+		})
+	}
+}
+
+func TestRoutingService_HandleRoutingRequest_replan(t *testing.T) {
+	const first = `{
+		"request_id": "RR-Replan-First",
+		"waypoints": [
+			{"type": "Feature", "geometry": {"type": "Point", "coordinates": [3.9985, 50.0]}, "properties": {"altitudeUnit": "mt", "altitudeValue": 100}},
+			{"type": "Feature", "geometry": {"type": "Point", "coordinates": [4.0045, 50.0]}, "properties": {"altitudeUnit": "mt", "altitudeValue": 100}},
+			{"type": "Feature", "geometry": {"type": "Point", "coordinates": [4.0045, 50.003]}, "properties": {"altitudeUnit": "mt", "altitudeValue": 100}}
+		],
+		"constraints": [
+			{"type": "Feature", "id": "old-zone", "geometry": {"type": "Polygon", "coordinates": [[[4.005, 50.001], [4.006, 50.001], [4.006, 50.002], [4.005, 50.002], [4.005, 50.001]]]}, "properties": {}}
+		],
+		"search_volume": {"type": "Feature", "geometry": {"type": "Polygon", "coordinates": [[[3.996, 49.997], [4.007, 49.997], [4.007, 50.005], [3.996, 50.005], [3.996, 49.997]]]}, "properties": {}},
+		"parameters": {"algorithm": "rrt", "storage": "rtree"}
+	}`
+	replanFrom := func(position, previous, changes string) string {
+		return `{
+			"request_id": "RR-Replan-Second",
+			"replan": {
+				"previous_request_id": "` + previous + `",
+				"current_position": {"type": "Feature", "geometry": {"type": "Point", "coordinates": ` + position + `}, "properties": {"altitudeUnit": "mt", "altitudeValue": 100}}` + changes + `
+			}
+		}`
+	}
+	replan := func(previous, changes string) string {
+		return replanFrom(`[3.999, 50.0]`, previous, changes)
+	}
+
+	tests := []struct {
+		name          string // description of this test case
+		replan        string
+		wantFound     bool
+		wantReplanned int
+		wantMessage   string // part of the error message, when the route is not found
+	}{
+		{name: "RR-Replan-AddedConstraint-RRT", replan: replan("RR-Replan-First", `, "added_constraints": [{"type": "Feature", "id": "new-zone", "geometry": {"type": "Polygon", "coordinates": [[[4.0, 49.999], [4.002, 49.999], [4.002, 50.001], [4.0, 50.001], [4.0, 49.999]]]}, "properties": {}}]`), wantFound: true, wantReplanned: 1},
+		{name: "RR-Replan-RemovedConstraint-RRT", replan: replan("RR-Replan-First", `, "removed_constraint_ids": ["old-zone"]`), wantFound: true, wantReplanned: 0},
+		{name: "RR-Replan-UnknownPrevious-RRT", replan: replan("RR-Unknown", ``), wantFound: false, wantMessage: "not found"},
+		{name: "RR-Replan-OutsideSearchVolume-RRT", replan: replanFrom(`[3.99, 50.0]`, "RR-Replan-First", ``), wantFound: false, wantMessage: "outside the search volume"},
+		{name: "RR-Replan-InsideAddedConstraint-RRT", replan: replanFrom(`[4.001, 50.0]`, "RR-Replan-First", `, "added_constraints": [{"type": "Feature", "id": "new-zone", "geometry": {"type": "Polygon", "coordinates": [[[4.0, 49.999], [4.002, 49.999], [4.002, 50.001], [4.0, 50.001], [4.0, 49.999]]]}, "properties": {}}]`), wantFound: false, wantMessage: "inside a constraint"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs, _ := service.NewRoutingService()
+			previous, found := rs.HandleRoutingRequest(context.Background(), models.MustNewRoutingRequestFromJson(first), validator.NewDefaultValidator())
+			if !found {
+				t.Fatalf("HandleRoutingRequest() found no route for the first request: %s", previous.Message)
+			}
+
+			input, err := models.NewRoutingRequestFromJson(tt.replan)
+			if err != nil {
+				t.Fatalf("could not construct request: %v", err)
+			}
+			got, found := rs.HandleRoutingRequest(context.Background(), input, validator.NewDefaultValidator())
+			if found != tt.wantFound {
+				t.Fatalf("HandleRoutingRequest() found = %t, want %t: %s", found, tt.wantFound, got.Message)
+			}
+			if !found {
+				if !strings.Contains(got.Message, tt.wantMessage) {
+					t.Errorf("HandleRoutingRequest() message = %q, want it to contain %q", got.Message, tt.wantMessage)
+				}
+				return
+			}
+			utils.ExportToJSON(got, "service", tt.name, false)
+
+			if got.ReplannedSegments != tt.wantReplanned {
+				t.Errorf("HandleRoutingRequest() replanned %d segments, want %d", got.ReplannedSegments, tt.wantReplanned)
+			}
+			if got.Route[0].Lon != 3.999 {
+				t.Errorf("HandleRoutingRequest() route starts at %v, want the current position", got.Route[0])
+			}
+			// The leg after the changes is the one of the previous route
+			if n, m := len(got.Route), len(previous.Route); got.Route[n-1] != previous.Route[m-1] || got.Route[n-2] != previous.Route[m-2] {
+				t.Errorf("HandleRoutingRequest() route = %v, want it to end like %v", got.Route, previous.Route)
+			}
+		})
+	}
+}
+
+func TestRoutingService_HandleRoutingRequest_replanWindField(t *testing.T) {
+	// The wind blows east at 10 m/s, on the way of the route
+	const first = `{
+		"request_id": "RR-ReplanWind-First",
+		"waypoints": [
+			{"type": "Feature", "geometry": {"type": "Point", "coordinates": [3.9985, 50.0]}, "properties": {"altitudeUnit": "mt", "altitudeValue": 100}},
+			{"type": "Feature", "geometry": {"type": "Point", "coordinates": [4.0045, 50.0]}, "properties": {"altitudeUnit": "mt", "altitudeValue": 100}}
+		],
+		"search_volume": {"type": "Feature", "geometry": {"type": "Polygon", "coordinates": [[[3.996, 49.997], [4.007, 49.997], [4.007, 50.003], [3.996, 50.003], [3.996, 49.997]]]}, "properties": {}},
+		"parameters": {"algorithm": "visgraph", "storage": "rtree", "cost": "time", "airspeed_ms": 15.0},
+		"wind_field": {"lat_step": 1, "lon_step": 1, "u": [[[10]]], "v": [[[0]]]}
+	}`
+	const second = `{
+		"request_id": "RR-ReplanWind-Second",
+		"replan": {
+			"previous_request_id": "RR-ReplanWind-First",
+			"current_position": {"type": "Feature", "geometry": {"type": "Point", "coordinates": [3.999, 50.0]}, "properties": {"altitudeUnit": "mt", "altitudeValue": 100}},
+			"added_constraints": [{"type": "Feature", "id": "new-zone", "geometry": {"type": "Polygon", "coordinates": [[[4.0, 49.999], [4.002, 49.999], [4.002, 50.001], [4.0, 50.001], [4.0, 49.999]]]}, "properties": {}}]
+		}
+	}`
+
+	rs, _ := service.NewRoutingService()
+	firstInput := models.MustNewRoutingRequestFromJson(first)
+	previous, found := rs.HandleRoutingRequest(context.Background(), firstInput, validator.NewDefaultValidator())
+	if !found {
+		t.Fatalf("HandleRoutingRequest() found no route for the first request: %s", previous.Message)
+	}
+	got, found := rs.HandleRoutingRequest(context.Background(), models.MustNewRoutingRequestFromJson(second), validator.NewDefaultValidator())
+	if !found {
+		t.Fatalf("HandleRoutingRequest() found no route: %s", got.Message)
+	}
+	utils.ExportToJSON(got, "service", "RR-ReplanWind-VisGraph", false)
+
+	// The replan has no wind field of its own: the route is still flown in the wind of the previous request
+	parameters := maps.Clone(firstInput.Parameters)
+	parameters[models.WIND_FIELD_PARAMETER] = firstInput.WindField
+	costFunction, err := utils.NewCostFunctionFromParameters(parameters, nil)
+	if err != nil {
+		t.Fatalf("could not build the cost function: %v", err)
+	}
+	if want := utils.TotalCost(costFunction, got.Route); math.Abs(got.CostKm-want) > 1e-6 {
+		t.Errorf("HandleRoutingRequest() cost = %.3f s, want the flight time in the wind %.3f s", got.CostKm, want)
+	}
+}
+
+func TestRoutingService_HandleRoutingRequest_replanMovingConstraint(t *testing.T) {
+	const first = `{
+		"request_id": "RR-ReplanMoving-First",
+		"waypoints": [
+			{"type": "Feature", "geometry": {"type": "Point", "coordinates": [3.9985, 50.0]}, "properties": {"altitudeUnit": "mt", "altitudeValue": 100}},
+			{"type": "Feature", "geometry": {"type": "Point", "coordinates": [4.0045, 50.0]}, "properties": {"altitudeUnit": "mt", "altitudeValue": 100}}
+		],
+		"search_volume": {"type": "Feature", "geometry": {"type": "Polygon", "coordinates": [[[3.996, 49.997], [4.007, 49.997], [4.007, 50.003], [3.996, 50.003], [3.996, 49.997]]]}, "properties": {}},
+		"parameters": {"algorithm": "visgraph", "storage": "rtree"}
+	}`
+	// The cell is on the straight line at 09:00, then it moves south at 1 m/s: 3.6 km away at 10:00
+	replan := func(receivedAt string) string {
+		return `{
+			"request_id": "RR-ReplanMoving-Second",
+			"received_at": "` + receivedAt + `",
+			"replan": {
+				"previous_request_id": "RR-ReplanMoving-First",
+				"current_position": {"type": "Feature", "geometry": {"type": "Point", "coordinates": [3.999, 50.0]}, "properties": {"altitudeUnit": "mt", "altitudeValue": 100}},
+				"added_constraints": [
+					{"type": "Feature", "id": "cell", "geometry": {"type": "Polygon", "coordinates": [[[4.0, 49.999], [4.002, 49.999], [4.002, 50.001], [4.0, 50.001], [4.0, 49.999]]]}, "properties": {"speed_ms": 1, "heading_deg": 180, "reference_time": "2026-10-17T09:00:00Z"}}
+				]
+			}
+		}`
+	}
+
+	tests := []struct {
+		name          string // description of this test case
+		receivedAt    string
+		wantReplanned int
+	}{
+		{name: "RR-ReplanMoving-ReceivedOnTheLine-VisGraph", receivedAt: "2026-10-17T09:00:00Z", wantReplanned: 1},
+		{name: "RR-ReplanMoving-ReceivedAfterItMoved-VisGraph", receivedAt: "2026-10-17T10:00:00Z", wantReplanned: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs, _ := service.NewRoutingService()
+			previous, found := rs.HandleRoutingRequest(context.Background(), models.MustNewRoutingRequestFromJson(first), validator.NewDefaultValidator())
+			if !found {
+				t.Fatalf("HandleRoutingRequest() found no route for the first request: %s", previous.Message)
+			}
+
+			input, err := models.NewRoutingRequestFromJson(replan(tt.receivedAt))
+			if err != nil {
+				t.Fatalf("could not construct request: %v", err)
+			}
+			got, found := rs.HandleRoutingRequest(context.Background(), input, validator.NewDefaultValidator())
+			if !found {
+				t.Fatalf("HandleRoutingRequest() found no route: %s", got.Message)
+			}
+			utils.ExportToJSON(got, "service", tt.name, false)
+
+			// The vehicle goes on when the replan was received, where the cell is then
+			if input.DepartureTime == nil || !input.DepartureTime.Equal(input.ReceivedAt) {
+				t.Errorf("HandleRoutingRequest() departure time = %v, want %v", input.DepartureTime, input.ReceivedAt)
+			}
+			if got.ReplannedSegments != tt.wantReplanned {
+				t.Errorf("HandleRoutingRequest() replanned %d segments, want %d", got.ReplannedSegments, tt.wantReplanned)
+			}
+		})
+	}
+}
+
+func TestRoutingService_HandleRoutingRequest_fallbackAlgorithms(t *testing.T) {
+	request := func(parameters string) string {
+		return `{
+			"request_id": "RR-Fallback",
+			"waypoints": [
+				{"type": "Feature", "geometry": {"type": "Point", "coordinates": [3.9985, 50.0]}, "properties": {"altitudeUnit": "mt", "altitudeValue": 100}},
+				{"type": "Feature", "geometry": {"type": "Point", "coordinates": [4.0045, 50.0]}, "properties": {"altitudeUnit": "mt", "altitudeValue": 100}},
+				{"type": "Feature", "geometry": {"type": "Point", "coordinates": [4.0045, 50.002]}, "properties": {"altitudeUnit": "mt", "altitudeValue": 100}}
+			],
+			"constraints": [
+				{"type": "Feature", "geometry": {"type": "Polygon", "coordinates": [[[4.0, 49.999], [4.002, 49.999], [4.002, 50.001], [4.0, 50.001], [4.0, 49.999]]]}, "properties": {}}
+			],
+			"search_volume": {"type": "Feature", "geometry": {"type": "Polygon", "coordinates": [[[3.996, 49.997], [4.007, 49.997], [4.007, 50.003], [3.996, 50.003], [3.996, 49.997]]]}, "properties": {}},
+			"parameters": ` + parameters + `
+		}`
+	}
+
+	tests := []struct {
+		name      string // description of this test case
+		params    string
+		wantFound bool
+		want      []models.AlgorithmType
+	}{
+		// The first leg goes around the constraint, the second one is a straight line found without iterations
+		{name: "RR-Fallback-RRTOutOfIterations", params: `{"algorithm": "rrt", "storage": "rtree", "max_iterations": 1, "max_leg_retries": 0, "fallback_algorithms": ["antpath"]}`, wantFound: true, want: []models.AlgorithmType{models.AntPath, models.RRT}},
+		{name: "RR-NoFallback-RRTOutOfIterations", params: `{"algorithm": "rrt", "storage": "rtree", "max_iterations": 1, "max_leg_retries": 0}`, wantFound: false},
+		// Every pair was planned by the optimizer, not the legs of the route
+		{name: "RR-Fallback-OptimizeOrder-RRTOutOfIterations", params: `{"algorithm": "rrt", "storage": "rtree", "max_iterations": 1, "max_leg_retries": 0, "fallback_algorithms": ["antpath"], "optimize_order": "open"}`, wantFound: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input, err := models.NewRoutingRequestFromJson(request(tt.params))
+			if err != nil {
+				t.Fatalf("could not construct request: %v", err)
+			}
+			rs, _ := service.NewRoutingService()
+			got, found := rs.HandleRoutingRequest(context.Background(), input, validator.NewDefaultValidator())
+			if found != tt.wantFound {
+				t.Fatalf("HandleRoutingRequest() found = %t, want %t: %s", found, tt.wantFound, got.Message)
+			}
+			utils.ExportToJSON(got, "service", tt.name, false)
+
+			if !slices.Equal(got.LegAlgorithms, tt.want) {
+				t.Errorf("HandleRoutingRequest() leg algorithms = %v, want %v", got.LegAlgorithms, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoutingService_HandleRoutingRequest_portfolio(t *testing.T) {
+	const request = `{
+		"request_id": "RR-Portfolio",
+		"waypoints": [
+			{"type": "Feature", "geometry": {"type": "Point", "coordinates": [3.9985, 50.0]}, "properties": {"altitudeUnit": "mt", "altitudeValue": 100}},
+			{"type": "Feature", "geometry": {"type": "Point", "coordinates": [4.0045, 50.0]}, "properties": {"altitudeUnit": "mt", "altitudeValue": 100}},
+			{"type": "Feature", "geometry": {"type": "Point", "coordinates": [4.0045, 50.002]}, "properties": {"altitudeUnit": "mt", "altitudeValue": 100}}
+		],
+		"constraints": [
+			{"type": "Feature", "geometry": {"type": "Polygon", "coordinates": [[[4.0, 49.999], [4.002, 49.999], [4.002, 50.001], [4.0, 50.001], [4.0, 49.999]]]}, "properties": {}}
+		],
+		"search_volume": {"type": "Feature", "geometry": {"type": "Polygon", "coordinates": [[[3.996, 49.997], [4.007, 49.997], [4.007, 50.003], [3.996, 50.003], [3.996, 49.997]]]}, "properties": {}},
+		"parameters": {"algorithm": "portfolio", "storage": "rtree", "portfolio_budget_ms": 10000, "portfolio": [{"algorithm": "rrt"}, {"algorithm": "visgraph"}]}
+	}`
+
+	input, err := models.NewRoutingRequestFromJson(request)
+	if err != nil {
+		t.Fatalf("could not construct request: %v", err)
+	}
+	rs, _ := service.NewRoutingService()
+	got, found := rs.HandleRoutingRequest(context.Background(), input, validator.NewDefaultValidator())
+	if !found {
+		t.Fatalf("HandleRoutingRequest() found no route: %s", got.Message)
+	}
+	utils.ExportToJSON(got, "service", "RR-Portfolio", false)
+
+	// 2 candidates on each of the 2 legs, one of them kept for every leg
+	if len(got.PortfolioStats) != 4 {
+		t.Fatalf("HandleRoutingRequest() returned %d portfolio stats, want 4", len(got.PortfolioStats))
+	}
+	selected := map[int]int{}
+	for _, stat := range got.PortfolioStats {
+		if stat.Selected {
+			selected[stat.Leg]++
+		}
+	}
+	if selected[0] != 1 || selected[1] != 1 {
+		t.Errorf("HandleRoutingRequest() selected candidates per leg = %v, want one for every leg", selected)
+	}
+}
+
+func TestRoutingService_HandleRoutingRequest_corridor(t *testing.T) {
+	request := func(startLon float64) string {
+		return fmt.Sprintf(`{
+		"request_id": "RR-Corridor",
+		"waypoints": [
+			{"type": "Feature", "geometry": {"type": "Point", "coordinates": [%f, 50.0]}, "properties": {"altitudeUnit": "mt", "altitudeValue": 100}},
+			{"type": "Feature", "geometry": {"type": "Point", "coordinates": [4.0045, 50.0]}, "properties": {"altitudeUnit": "mt", "altitudeValue": 100}}
+		],
+		"constraints": [
+			{"type": "Feature", "geometry": {"type": "Polygon", "coordinates": [[[3.9995, 49.998], [4.002, 49.998], [4.002, 49.99991], [3.9995, 49.99991], [3.9995, 49.998]]]}, "properties": {}}
+		],
+		"search_volume": {"type": "Feature", "geometry": {"type": "Polygon", "coordinates": [[[3.996, 49.997], [4.007, 49.997], [4.007, 50.003], [3.996, 50.003], [3.996, 49.997]]]}, "properties": {}},
+		"parameters": {"algorithm": "rrtstar", "storage": "rtree", "max_iterations": 3000, "corridor": {"lateral_half_width_mt": 25, "vertical_half_width_mt": 10}}
+	}`, startLon)
+	}
+
+	tests := []struct {
+		name      string // description of this test case
+		startLon  float64
+		wantFound bool
+	}{
+		// The straight line passes ~10 mt north of the obstacle, the route must keep 25 mt from it
+		{name: "RR-Corridor-Detour", startLon: 3.9985, wantFound: true},
+		// The first waypoint is ~10 mt north of the obstacle
+		{name: "RR-Corridor-WaypointTooClose", startLon: 4.0, wantFound: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input, err := models.NewRoutingRequestFromJson(request(tt.startLon))
+			if err != nil {
+				t.Fatalf("could not construct request: %v", err)
+			}
+			rs, _ := service.NewRoutingService()
+			got, found := rs.HandleRoutingRequest(context.Background(), input, validator.NewDefaultValidator())
+			utils.ExportToJSON(got, "service", tt.name, false)
+			if found != tt.wantFound {
+				t.Fatalf("HandleRoutingRequest() found: %t, want %t (%s)", found, tt.wantFound, got.Message)
+			}
+			if !found {
+				return
+			}
+
+			if got.Corridor == nil {
+				t.Fatal("HandleRoutingRequest() returned no corridor")
+			}
+			if len(got.Route) == 2 {
+				t.Errorf("HandleRoutingRequest() = %v, want a detour keeping the corridor clear", got.Route)
+			}
+			clearance := utils.RouteClearance(got.Route, input.Constraints, 1)
+			if clearance < 25 {
+				t.Errorf("HandleRoutingRequest() route is %.1f mt from the obstacle, want at least 25 mt", clearance)
+			}
+		})
+	}
+}
+
+func TestRoutingService_HandleRoutingRequest_corridorReplan(t *testing.T) {
+	const first = `{
+		"request_id": "RR-Corridor-First",
+		"waypoints": [
+			{"type": "Feature", "geometry": {"type": "Point", "coordinates": [3.9985, 50.0]}, "properties": {"altitudeUnit": "mt", "altitudeValue": 100}},
+			{"type": "Feature", "geometry": {"type": "Point", "coordinates": [4.0045, 50.0]}, "properties": {"altitudeUnit": "mt", "altitudeValue": 100}}
+		],
+		"constraints": [
+			{"type": "Feature", "id": "old-zone", "geometry": {"type": "Polygon", "coordinates": [[[3.9995, 49.998], [4.002, 49.998], [4.002, 49.99991], [3.9995, 49.99991], [3.9995, 49.998]]]}, "properties": {}}
+		],
+		"search_volume": {"type": "Feature", "geometry": {"type": "Polygon", "coordinates": [[[3.996, 49.997], [4.007, 49.997], [4.007, 50.003], [3.996, 50.003], [3.996, 49.997]]]}, "properties": {}},
+		"parameters": {"algorithm": "rrt", "storage": "rtree", "corridor": {"lateral_half_width_mt": 25, "vertical_half_width_mt": 10}}
+	}`
+	// The new zone is across the straight line, ~70 mt before the last waypoint
+	const replan = `{
+		"request_id": "RR-Corridor-Replan",
+		"replan": {
+			"previous_request_id": "RR-Corridor-First",
+			"current_position": {"type": "Feature", "geometry": {"type": "Point", "coordinates": [3.9985, 50.0]}, "properties": {"altitudeUnit": "mt", "altitudeValue": 100}},
+			"added_constraints": [{"type": "Feature", "id": "new-zone", "geometry": {"type": "Polygon", "coordinates": [[[4.003, 49.9997], [4.0035, 49.9997], [4.0035, 50.0003], [4.003, 50.0003], [4.003, 49.9997]]]}, "properties": {}}]
+		}
+	}`
+
+	rs, _ := service.NewRoutingService()
+	previous, found := rs.HandleRoutingRequest(context.Background(), models.MustNewRoutingRequestFromJson(first), validator.NewDefaultValidator())
+	if !found {
+		t.Fatalf("HandleRoutingRequest() found no route for the first request: %s", previous.Message)
+	}
+
+	input := models.MustNewRoutingRequestFromJson(replan)
+	got, found := rs.HandleRoutingRequest(context.Background(), input, validator.NewDefaultValidator())
+	if !found {
+		t.Fatalf("HandleRoutingRequest() found no route for the replan: %s", got.Message)
+	}
+	utils.ExportToJSON(got, "service", "RR-Corridor-Replan", false)
+
+	if got.ReplannedSegments == 0 {
+		t.Errorf("HandleRoutingRequest() replanned no segment, want the ones blocked by the new zone")
+	}
+	if got.Corridor == nil {
+		t.Fatal("HandleRoutingRequest() returned no corridor for the replan")
+	}
+	// The old obstacles are not grown twice, and the added ones are grown too
+	constraints := append(models.MustNewRoutingRequestFromJson(first).Constraints, input.Replan.AddedConstraints...)
+	if clearance := utils.RouteClearance(got.Route, constraints, 1); clearance < 25 {
+		t.Errorf("HandleRoutingRequest() repaired route is %.1f mt from the constraints, want at least 25 mt", clearance)
+	}
+}
+
+func TestRoutingService_HandleRoutingRequest_corridorVehicles(t *testing.T) {
+	const request = `{
+		"request_id": "RR-Corridor-Vehicles",
+		"vehicles": [
+			{"id": "one", "waypoints": [
+				{"type": "Feature", "geometry": {"type": "Point", "coordinates": [3.9985, 50.0]}, "properties": {"altitudeUnit": "mt", "altitudeValue": 100}},
+				{"type": "Feature", "geometry": {"type": "Point", "coordinates": [4.0045, 50.0]}, "properties": {"altitudeUnit": "mt", "altitudeValue": 100}}
+			]}
+		],
+		"search_volume": {"type": "Feature", "geometry": {"type": "Polygon", "coordinates": [[[3.996, 49.997], [4.007, 49.997], [4.007, 50.003], [3.996, 50.003], [3.996, 49.997]]]}, "properties": {}},
+		"parameters": {"algorithm": "rrt", "storage": "rtree", "corridor": {}}
+	}`
+
+	rs, _ := service.NewRoutingService()
+	got, found := rs.HandleRoutingRequest(context.Background(), models.MustNewRoutingRequestFromJson(request), validator.NewDefaultValidator())
+	if found {
+		t.Fatalf("HandleRoutingRequest() found a route, want the corridor rejected with vehicles")
+	}
+	if !strings.Contains(got.Message, "corridor") {
+		t.Errorf("HandleRoutingRequest() message = %s, want it to be about the corridor", got.Message)
+	}
+}
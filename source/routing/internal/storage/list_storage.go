@@ -6,6 +6,7 @@ import (
 	"geopathplanner/routing/internal/models"
 	"geopathplanner/routing/internal/utils"
 	"slices"
+	"time"
 )
 
 // ListStorage stores everything in-memory using lists data structure.
@@ -13,7 +14,9 @@ type ListStorage struct {
 	// TODO: Duplicate of waypoints, probably we can use just the map and it will be ok. Or use just list but list of nodes
 	waypoints  []*models.Waypoint
 	constraints []*models.Feature3D
+	softConstraints []*models.Feature3D // Not obstacles, they only make the cost grow
 	waypointsMap map[*models.Waypoint]*models.PointDist
+	costFunction utils.CostFunction
 }
 
 // ---------------------------------------------------------------- CONSTRUCTORS
@@ -22,7 +25,9 @@ func NewEmptyListStorage() (*ListStorage, error) {
 	return &ListStorage{
 		waypoints: make([]*models.Waypoint, 0),
 		constraints: make([]*models.Feature3D, 0),
+		softConstraints: make([]*models.Feature3D, 0),
 		waypointsMap: make(map[*models.Waypoint]*models.PointDist),
+		costFunction: utils.DistanceCost{},
 	}, nil
 }
 
@@ -58,6 +63,7 @@ func (m *ListStorage) Clear() error {
 
 func (m *ListStorage) ClearConstraints() error {
 	m.constraints = make([]*models.Feature3D, 0)
+	m.softConstraints = make([]*models.Feature3D, 0)
 	return nil
 }
 
@@ -76,10 +82,11 @@ func (m *ListStorage) ConstraintsLen() int {
 }
 
 func (m *ListStorage) Clone() Storage {
-	mClone, err := NewListStorage(m.MustGetWaypoints(), m.MustGetConstraints())
+	mClone, err := NewListStorage(m.MustGetWaypoints(), slices.Concat(m.MustGetConstraints(), m.GetSoftConstraints()))
 	if err != nil {
 		panic(err)
 	}
+	mClone.SetCostFunction(m.GetCostFunction())
 	return mClone
 }
 
@@ -124,6 +131,10 @@ func (m *ListStorage) MustGetWaypoints() []*models.Waypoint {
 func (m *ListStorage) AddConstraint(c *models.Feature3D) error {
 	// m.mu.Lock()
 	// defer m.mu.Unlock()
+	if c.IsSoft() {
+		m.softConstraints = append(m.softConstraints, c)
+		return nil
+	}
 	m.constraints = append(m.constraints, c)
 	return nil
 }
@@ -155,6 +166,11 @@ func (m *ListStorage) MustGetConstraints() []*models.Feature3D {
 	return c
 }
 
+// Soft constraints are kept apart: they are not returned by GetConstraints and never checked for collisions
+func (m *ListStorage) GetSoftConstraints() []*models.Feature3D {
+	return m.softConstraints
+}
+
 // ================================================================= RRT
 
 func (m *ListStorage) AddWaypointWithPrevious(prev *models.Waypoint, w *models.Waypoint) error {
@@ -169,7 +185,7 @@ func (m *ListStorage) AddWaypointWithPrevious(prev *models.Waypoint, w *models.W
 func (m *ListStorage) ChangePrevious(new_prev *models.Waypoint, w *models.Waypoint) error {
 	distance := 0.0
 	if new_prev != nil {
-		distance = utils.HaversineDistance3D(new_prev, w)
+		distance = m.costFunction.Cost(new_prev, w)
 	}
 	
 	// Just add it to the map
@@ -223,6 +239,14 @@ func (m *ListStorage) GetPathToRoot(w *models.Waypoint) ([]*models.Waypoint, err
 	}
 }
 
+func (m *ListStorage) SetCostFunction(f utils.CostFunction) {
+	m.costFunction = f
+}
+
+func (m *ListStorage) GetCostFunction() utils.CostFunction {
+	return m.costFunction
+}
+
 func (m *ListStorage) GetCostToRoot(w *models.Waypoint) (float64, error) {
 	// Iteratively do GetPrevious and search for the cost
 	current := w
@@ -422,6 +446,18 @@ func (m *ListStorage) IsPointInObstacles(p *models.Waypoint) (bool, *models.Feat
 	return false, nil, nil
 }
 
+// Scan list of obstacle until you find someone that intersect at t
+// O(#obstacles)
+func (m *ListStorage) IsPointInObstaclesAt(p *models.Waypoint, t time.Time) (bool, *models.Feature3D, error) {
+	for _, obstacle := range m.constraints {
+		if utils.PointInPolygonAt(p, obstacle, t) {
+			return true, obstacle, nil
+		}
+	}
+
+	return false, nil, nil
+}
+
 // Scan list of obstacle and return every obstacle that collide with point
 // O(#obstacles)
 func (m *ListStorage) GetAllObstaclesContainingPoint(p *models.Waypoint) ([]*models.Feature3D, error) {
@@ -472,6 +508,13 @@ func (m *ListStorage) IsLineInObstacles(p1, p2 *models.Waypoint) (bool, []*model
 	return in, line, nil
 }
 
+// Scan list of obstacle until you find someone that intersect line while flown
+// O(#obstacles)
+func (m *ListStorage) IsLineInObstaclesAt(p1, p2 *models.Waypoint, t1, t2 time.Time) (bool, []*models.Waypoint, error) {
+	in, line := utils.LineInPolygonAt(p1, p2, t1, t2, m.constraints...)
+	return in, line, nil
+}
+
 // Get intersection points (useful for AntPath)
 func (m *ListStorage) GetIntersectionPoints(p1, p2 *models.Waypoint) ([]*models.LinePolygonIntersection, error) {
 	// Divide line into point and then check if any individual point lies in polygon
@@ -544,4 +587,29 @@ func (m *ListStorage) SampleFree(sampler utils.Sampler, sampleVolume *models.Fea
 	}
 	
 	return sampled, nil
-}
\ No newline at end of file
+}
+
+func (m *ListStorage) Sample3D(sampler utils.Sampler, sampleVolume *models.Feature3D) (*models.Waypoint, error) {
+	sampled, err := utils.Sample3D(sampler, sampleVolume)
+	if err != nil {
+		return nil, fmt.Errorf("unexpected error during ListStorage Sample3D: %w", err)
+	}
+
+	return sampled, nil
+}
+
+func (m *ListStorage) SampleFree3D(sampler utils.Sampler, sampleVolume *models.Feature3D) (*models.Waypoint, error) {
+	isInObstacle := true
+	var sampled *models.Waypoint
+	var err error
+	// sample until you found a point that is not in an obstacle, at its altitude
+	for isInObstacle {
+		sampled, err = m.Sample3D(sampler, sampleVolume)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected error during ListStorage SampleFree3D: %w", err)
+		}
+		isInObstacle, _, _ = m.IsPointInObstacles(sampled)
+	}
+
+	return sampled, nil
+}
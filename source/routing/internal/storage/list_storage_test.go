@@ -6,6 +6,7 @@ import (
 	"geopathplanner/routing/internal/storage"
 	"geopathplanner/routing/internal/utils"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -1289,4 +1290,129 @@ func TestListStorage_SampleFree(t *testing.T) {
       utils.ExportToGeoJSON("storage", gotList, append(tt.c_list, tt.sampleVolume), tt.name, false)
 		})
 	}
-}
\ No newline at end of file
+}
+
+func TestListStorage_SoftConstraints(t *testing.T) {
+	a, _ := models.NewAltitude(100, models.MT)
+	start, end := models.MustNewWaypoint(0, 50.0, 3.9985, a), models.MustNewWaypoint(1, 50.0, 4.0045, a)
+	soft := models.MustNewFeatureFromGeojson(`{"type": "Feature", "properties": {"constraint_type": "soft", "cost_multiplier": 3}, "geometry": {"type": "Polygon", "coordinates": [[[4.0, 49.999], [4.002, 49.999], [4.002, 50.001], [4.0, 50.001], [4.0, 49.999]]]}}`)
+	hard := models.MustNewFeatureFromGeojson(`{"type": "Feature", "properties": {"constraint_type": "hard"}, "geometry": {"type": "Polygon", "coordinates": [[[4.0, 50.002], [4.002, 50.002], [4.002, 50.003], [4.0, 50.003], [4.0, 50.002]]]}}`)
+
+	for _, storageType := range []models.StorageType{models.List, models.RTree} {
+		t.Run(string(storageType), func(t *testing.T) {
+			s, err := storage.NewStorage(nil, []*models.Feature3D{soft, hard}, storageType)
+			if err != nil {
+				t.Fatalf("could not construct storage: %v", err)
+			}
+
+			for _, s := range []storage.Storage{s, s.Clone()} {
+				assert.Equal(t, 1, s.ConstraintsLen())
+				assert.Equal(t, []*models.Feature3D{hard}, s.MustGetConstraints())
+				assert.Equal(t, []*models.Feature3D{soft}, s.GetSoftConstraints())
+
+				blocked, _, err := s.IsLineInObstacles(start, end)
+				assert.NoError(t, err)
+				assert.False(t, blocked, "soft constraint blocks the line")
+			}
+		})
+	}
+}
+
+func TestListStorage_IsLineInObstaclesAt(t *testing.T) {
+	a, _ := models.NewAltitude(100, models.MT)
+	// ~430 mt line, inside the zone from 25% to ~58% of it
+	start, end := models.MustNewWaypoint(0, 50.0, 3.9985, a), models.MustNewWaypoint(1, 50.0, 4.0045, a)
+	inside := models.MustNewWaypoint(2, 50.0, 4.001, a)
+	temporary := models.MustNewFeatureFromGeojson(`{"type": "Feature", "properties": {"active_from": "2026-10-17T10:00:00Z", "active_until": "2026-10-17T11:00:00Z"}, "geometry": {"type": "Polygon", "coordinates": [[[4.0, 49.999], [4.002, 49.999], [4.002, 50.001], [4.0, 50.001], [4.0, 49.999]]]}}`)
+	at := func(clock string) time.Time {
+		t, _ := time.Parse(time.RFC3339, "2026-10-17T"+clock+"Z")
+		return t
+	}
+
+	tests := []struct {
+		name        string // description of this test case
+		t1          time.Time
+		t2          time.Time
+		wantBlocked bool
+	}{
+		{name: "Before the window", t1: at("09:00:00"), t2: at("09:00:30"), wantBlocked: false},
+		{name: "Within the window", t1: at("10:30:00"), t2: at("10:30:30"), wantBlocked: true},
+		{name: "After the window", t1: at("11:00:00"), t2: at("11:00:30"), wantBlocked: false},
+		{name: "Opening after the zone is left", t1: at("09:59:20"), t2: at("09:59:50"), wantBlocked: false},
+		{name: "Opening while inside the zone", t1: at("09:59:45"), t2: at("10:00:15"), wantBlocked: true},
+		{name: "Closing before the zone is reached", t1: at("10:59:59"), t2: at("11:00:29"), wantBlocked: false},
+	}
+	for _, storageType := range []models.StorageType{models.List, models.RTree} {
+		s, err := storage.NewStorage(nil, []*models.Feature3D{temporary}, storageType)
+		if err != nil {
+			t.Fatalf("could not construct storage: %v", err)
+		}
+
+		// Time-unaware checks always count temporary constraints
+		blocked, _, err := s.IsLineInObstacles(start, end)
+		assert.NoError(t, err)
+		assert.True(t, blocked, "temporary constraint doesn't block the line without time")
+
+		for _, tt := range tests {
+			t.Run(string(storageType)+" - "+tt.name, func(t *testing.T) {
+				blocked, _, err := s.IsLineInObstaclesAt(start, end, tt.t1, tt.t2)
+				assert.NoError(t, err)
+				assert.Equal(t, tt.wantBlocked, blocked)
+
+				// A point in the zone is blocked if it is reached while active
+				blocked, _, err = s.IsPointInObstaclesAt(inside, tt.t1)
+				assert.NoError(t, err)
+				assert.Equal(t, temporary.IsActiveAt(tt.t1), blocked)
+			})
+		}
+	}
+}
+
+func TestListStorage_IsLineInObstaclesAt_moving(t *testing.T) {
+	a, _ := models.NewAltitude(100, models.MT)
+	// ~430 mt line (~29 s at 15 m/s), below the cell from 25% to ~58% of it
+	start, end := models.MustNewWaypoint(0, 50.0, 3.9985, a), models.MustNewWaypoint(1, 50.0, 4.0045, a)
+	// Cell ~222 mt south of the line at 10:00:00, moving north at 10 m/s: it covers the line from ~10:00:22 to ~10:00:44
+	cell := models.MustNewFeatureFromGeojson(`{"type": "Feature", "properties": {"speed_ms": 10, "heading_deg": 0, "reference_time": "2026-10-17T10:00:00Z"}, "geometry": {"type": "Polygon", "coordinates": [[[4.0, 49.996], [4.002, 49.996], [4.002, 49.998], [4.0, 49.998], [4.0, 49.996]]]}}`)
+	at := func(clock string) time.Time {
+		t, _ := time.Parse(time.RFC3339, "2026-10-17T"+clock+"Z")
+		return t
+	}
+
+	tests := []struct {
+		name        string // description of this test case
+		t1          time.Time
+		wantBlocked bool
+	}{
+		{name: "Passing before the cell", t1: at("10:00:00"), wantBlocked: false},
+		{name: "Passing through the cell", t1: at("10:00:20"), wantBlocked: true},
+		{name: "Passing after the cell", t1: at("10:01:00"), wantBlocked: false},
+	}
+	for _, storageType := range []models.StorageType{models.List, models.RTree} {
+		s, err := storage.NewStorage(nil, []*models.Feature3D{cell}, storageType)
+		if err != nil {
+			t.Fatalf("could not construct storage: %v", err)
+		}
+
+		// Time-unaware checks see the cell where it is at its reference time
+		blocked, _, err := s.IsLineInObstacles(start, end)
+		assert.NoError(t, err)
+		assert.False(t, blocked, "moving constraint blocks the line at its reference time")
+
+		for _, tt := range tests {
+			t.Run(string(storageType)+" - "+tt.name, func(t *testing.T) {
+				blocked, _, err := s.IsLineInObstaclesAt(start, end, tt.t1, tt.t1.Add(29*time.Second))
+				assert.NoError(t, err)
+				assert.Equal(t, tt.wantBlocked, blocked)
+			})
+		}
+
+		// A point on the line is in the cell only while the cell goes through it
+		inside := models.MustNewWaypoint(2, 50.0, 4.001, a)
+		for clock, want := range map[string]bool{"10:00:00": false, "10:00:30": true, "10:01:00": false} {
+			blocked, _, err := s.IsPointInObstaclesAt(inside, at(clock))
+			assert.NoError(t, err)
+			assert.Equal(t, want, blocked, "%s point at %s", storageType, clock)
+		}
+	}
+}
@@ -1,10 +1,14 @@
 package storage
 
 import (
+	"cmp"
 	"errors"
 	"fmt"
 	"geopathplanner/routing/internal/models"
 	"geopathplanner/routing/internal/utils"
+	"math"
+	"slices"
+	"time"
 
 	"github.com/dhconnelly/rtreego"
 )
@@ -21,6 +25,7 @@ type RTreeStorage struct {
 	*ListStorage
 	waypointsTree *rtreego.Rtree
 	constraintsTree *rtreego.Rtree
+	movingConstraints []*models.Feature3D // Also in the tree, where they are at their reference time
 }
 
 // ---------------------------------------------------------------- CONSTRUCTORS
@@ -29,6 +34,7 @@ func NewEmptyRTreeStorage() (*RTreeStorage, error) {
 	rs := &RTreeStorage{
 		waypointsTree: rtreego.NewTree(SPATIAL_DIMENSION, MINIMUM_BRANCHING_FACTOR, MAXIMUM_BRANCHING_FACTOR),
 		constraintsTree: rtreego.NewTree(SPATIAL_DIMENSION, MINIMUM_BRANCHING_FACTOR, MAXIMUM_BRANCHING_FACTOR),
+		movingConstraints: make([]*models.Feature3D, 0),
 	}
 	
 	var err error
@@ -65,6 +71,7 @@ func (r *RTreeStorage) Clear() error {
 
 func (r *RTreeStorage) ClearConstraints() error {
 	r.constraintsTree = rtreego.NewTree(SPATIAL_DIMENSION, MINIMUM_BRANCHING_FACTOR, MAXIMUM_BRANCHING_FACTOR)
+	r.movingConstraints = make([]*models.Feature3D, 0)
 	return r.ListStorage.ClearConstraints()
 }
 
@@ -82,10 +89,11 @@ func (r *RTreeStorage) ConstraintsLen() int {
 }
 
 func (r *RTreeStorage) Clone() Storage {
-	rClone, err := NewRTreeStorage(r.MustGetWaypoints(), r.MustGetConstraints())
+	rClone, err := NewRTreeStorage(r.MustGetWaypoints(), slices.Concat(r.MustGetConstraints(), r.GetSoftConstraints()))
 	if err != nil {
 		panic(err)
 	}
+	rClone.SetCostFunction(r.GetCostFunction())
 	return rClone
 }
 
@@ -126,7 +134,12 @@ func (r *RTreeStorage) MustGetWaypoints() []*models.Waypoint {
 // ---------------------------------------------------------------- CONSTRAINTS
 
 func (r *RTreeStorage) AddConstraint(c *models.Feature3D) error {
-	r.constraintsTree.Insert(c)
+	if !c.IsSoft() {
+		r.constraintsTree.Insert(c)
+	}
+	if !c.IsSoft() && c.IsMoving() {
+		r.movingConstraints = append(r.movingConstraints, c)
+	}
 	return r.ListStorage.AddConstraint(c)
 }
 
@@ -155,6 +168,10 @@ func (r *RTreeStorage) MustGetConstraints() []*models.Feature3D {
 	return wps
 }
 
+func (r *RTreeStorage) GetSoftConstraints() []*models.Feature3D {
+	return r.ListStorage.GetSoftConstraints()
+}
+
 // ================================================================= RRT
 
 func (r *RTreeStorage) AddWaypointWithPrevious(prev *models.Waypoint, w *models.Waypoint) error {
@@ -184,6 +201,14 @@ func (r *RTreeStorage) GetCostToRoot(w *models.Waypoint) (float64, error) {
 	return r.ListStorage.GetCostToRoot(w)
 }
 
+func (r *RTreeStorage) SetCostFunction(f utils.CostFunction) {
+	r.ListStorage.SetCostFunction(f)
+}
+
+func (r *RTreeStorage) GetCostFunction() utils.CostFunction {
+	return r.ListStorage.GetCostFunction()
+}
+
 // ================================================================= Geometric helpers
 
 // TODO: Make sure it's using the right distance function when doing so
@@ -210,7 +235,7 @@ func (r *RTreeStorage) NearestPoint(p *models.Waypoint) (*models.Waypoint, float
 	// }
 
 	// Use rtree functionalities to improve 1-nn search
-	nearest := r.waypointsTree.NearestNeighbor(p.RTreePoint()).(*models.Waypoint)
+	nearest := r.nearestNeighbors(p, 1)[0]
 	minDist := utils.HaversineDistance3D(p, nearest)
 
 	// TODO: Just for visual debug
@@ -243,19 +268,13 @@ func (r *RTreeStorage) KNearestPoints(p *models.Waypoint, k int) ([]*models.Wayp
 	}
 
 	// Use r-tree k-nn
-	points := r.waypointsTree.NearestNeighbors(k, p.RTreePoint())
-
-	// Create list for points
-	result := make([]*models.Waypoint, 0, len(points))
+	result := r.nearestNeighbors(p, k)
 	// And list for distances
-	distances := make([]float64, 0, len(points))
+	distances := make([]float64, 0, len(result))
 
-	// Convert from rtreego.Spatial to *Waypoint and compute dist
-	for _, ps := range points {
-		wp := ps.(*models.Waypoint)
+	// Compute dist
+	for _, wp := range result {
 		wp.Feature.Properties["near"] = true
-
-		result = append(result, wp)
 		distances = append(distances, utils.HaversineDistance3D(p, wp))
 	}
 
@@ -267,6 +286,38 @@ func (r *RTreeStorage) KNearestPoints(p *models.Waypoint, k int) ([]*models.Wayp
 	return result, distances, nil
 }
 
+// nearestNeighbors returns the k nearest waypoints to p, nearest first. The r-tree k-nn only bounds the search:
+// its distances are in degrees, and a degree of lon is shorter than one of lat.
+// The k points it finds are at most radius mt away, so the k nearest ones in mt are all in the box of that radius around p.
+func (r *RTreeStorage) nearestNeighbors(p *models.Waypoint, k int) []*models.Waypoint {
+	radius := 0.0
+	for _, ps := range r.waypointsTree.NearestNeighbors(k, p.RTreePoint()) {
+		radius = max(radius, utils.HaversineDistance3D(p, ps.(*models.Waypoint)))
+	}
+	points := r.waypointsTree.SearchIntersect(boxAround(p, radius))
+
+	result := make([]*models.Waypoint, 0, len(points))
+	for _, ps := range points {
+		result = append(result, ps.(*models.Waypoint))
+	}
+	slices.SortStableFunc(result, func(a, b *models.Waypoint) int {
+		return cmp.Compare(utils.HaversineDistance3D(p, a), utils.HaversineDistance3D(p, b))
+	})
+	return result[:min(k, len(result))]
+}
+
+// boxAround returns the rtree rect with every point up to radius mt away from p, with some margin
+func boxAround(p *models.Waypoint, radius float64) rtreego.Rect {
+	deg := 1.01 * radius / models.METERS_PER_DEGREE
+	degLon := deg / max(math.Cos(p.Lat*math.Pi/180), 0.01)
+	center := p.RTreePoint()
+	rect, _ := rtreego.NewRectFromPoints(
+		rtreego.Point{center[0] - degLon, center[1] - deg, center[2] - deg},
+		rtreego.Point{center[0] + degLon, center[1] + deg, center[2] + deg},
+	)
+	return rect
+}
+
 // Find points that intersects with circle bbox using rtree. Then keep only the ones that actually intersects with it, not just the bbox.
 // O(logN)
 func (r *RTreeStorage) NearestPointsInRadius(p *models.Waypoint, radius float64) ([]*models.Waypoint, []float64, error) {
@@ -334,6 +385,31 @@ func (r *RTreeStorage) IsPointInObstacles(p *models.Waypoint) (bool, *models.Fea
 	return false, nil, nil
 }
 
+// Same as IsPointInObstacles, checking the constraints as they are at t.
+// The bbox in the tree of a moving constraint is the one at its reference time, so moving ones are scanned apart.
+// O(logM + #moving)
+func (r *RTreeStorage) IsPointInObstaclesAt(p *models.Waypoint, t time.Time) (bool, *models.Feature3D, error) {
+	intersectedConstraintsBBox := r.constraintsTree.SearchIntersect(p.Bounds(), func(results []rtreego.Spatial, object rtreego.Spatial) (refuse bool, abort bool) {
+		obstacle := object.(*models.Feature3D)
+		if !obstacle.IsMoving() && utils.PointInPolygonAt(p, obstacle, t) {
+			return false, true
+		}
+		return true, false
+	})
+
+	if len(intersectedConstraintsBBox) >= 1 {
+		return true, intersectedConstraintsBBox[0].(*models.Feature3D), nil
+	}
+
+	for _, obstacle := range r.movingConstraints {
+		if utils.PointInPolygonAt(p, obstacle, t) {
+			return true, obstacle, nil
+		}
+	}
+
+	return false, nil, nil
+}
+
 // Use Rtree to efficiently get constraints whose bbox intersects with point. Then check if the point actually intersect the constraint, and not just its bbox.
 // O(logM)
 func (r *RTreeStorage) GetAllObstaclesContainingPoint(p *models.Waypoint) ([]*models.Feature3D, error) {
@@ -370,6 +446,22 @@ func (r *RTreeStorage) IsLineInObstacles(p1, p2 *models.Waypoint) (bool, []*mode
 	return in, line, nil
 }
 
+// Use line bounding box to have the constraints in advance, plus the moving ones, then check the points of the line against them as they are when flown
+// O(logM + #moving)
+func (r *RTreeStorage) IsLineInObstaclesAt(p1, p2 *models.Waypoint, t1, t2 time.Time) (bool, []*models.Waypoint, error) {
+	intersectedConstraintsBBox := r.constraintsTree.SearchIntersect(p1.GetLineStringFeature3D(p2).Bounds())
+	constraints := make([]*models.Feature3D, 0, len(intersectedConstraintsBBox)+len(r.movingConstraints))
+	for _, c := range intersectedConstraintsBBox {
+		if !c.(*models.Feature3D).IsMoving() {
+			constraints = append(constraints, c.(*models.Feature3D))
+		}
+	}
+	constraints = append(constraints, r.movingConstraints...)
+
+	in, line := utils.LineInPolygonAt(p1, p2, t1, t2, constraints...)
+	return in, line, nil
+}
+
 // =================================================================
 
 // Use Rtree to efficiently get constraints whose bbox intersects with search volume.
@@ -467,5 +559,21 @@ func (r *RTreeStorage) SampleFree(sampler utils.Sampler, sampleVolume *models.Fe
 		isInObstacle, _, _ = r.IsPointInObstacles(sampled)
 	}
 	
+	return sampled, nil
+}
+
+func (r *RTreeStorage) SampleFree3D(sampler utils.Sampler, sampleVolume *models.Feature3D) (*models.Waypoint, error) {
+	isInObstacle := true
+	var sampled *models.Waypoint
+	var err error
+	// sample until you found a point that is not in an obstacle, at its altitude
+	for isInObstacle {
+		sampled, err = r.Sample3D(sampler, sampleVolume)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected error during RTreeStorage SampleFree3D: %w", err)
+		}
+		isInObstacle, _, _ = r.IsPointInObstacles(sampled)
+	}
+	
 	return sampled, nil
 }
\ No newline at end of file
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"geopathplanner/routing/internal/models"
 	"geopathplanner/routing/internal/utils"
+	"time"
 )
 
 // Define common interface for storing and querying geospatial data
@@ -17,6 +18,7 @@ type Storage interface {
 	AddConstraints(c_list []*models.Feature3D) error
 	GetConstraints() ([]*models.Feature3D, error)
 	MustGetConstraints() ([]*models.Feature3D)
+	GetSoftConstraints() []*models.Feature3D // Soft constraints are skipped by every collision check
 
 	WaypointsLen() int
 	
@@ -33,6 +35,8 @@ type Storage interface {
 	GetPrevious(p *models.Waypoint) (*models.Waypoint, error)
 	GetPathToRoot(w *models.Waypoint) ([]*models.Waypoint, error)
 	GetCostToRoot(w *models.Waypoint) (float64, error)
+	SetCostFunction(f utils.CostFunction) // Cost of the connections added from now on, distance by default
+	GetCostFunction() utils.CostFunction
 
 	NearestPoint(p *models.Waypoint) (*models.Waypoint, float64, error)
     KNearestPoints(p *models.Waypoint, k int) ([]*models.Waypoint, []float64, error)
@@ -40,6 +44,8 @@ type Storage interface {
     
 	IsPointInObstacles(p *models.Waypoint) (bool, *models.Feature3D, error)
     IsLineInObstacles(p1, p2 *models.Waypoint) (bool, []*models.Waypoint, error)
+	IsPointInObstaclesAt(p *models.Waypoint, t time.Time) (bool, *models.Feature3D, error) // Obstacles as they are at t. Otherwise temporary ones always block and moving ones are at their reference time
+	IsLineInObstaclesAt(p1, p2 *models.Waypoint, t1, t2 time.Time) (bool, []*models.Waypoint, error) // Leaving p1 at t1 and reaching p2 at t2
 	
 	GetIntersectionPoints(p1, p2 *models.Waypoint) ([]*models.LinePolygonIntersection, error)
 	GetAllObstaclesContainingPoint(p *models.Waypoint) ([]*models.Feature3D, error)
@@ -49,6 +55,8 @@ type Storage interface {
 	
 	Sample(sampler utils.Sampler, sampleVolume *models.Feature3D, alt models.Altitude) (*models.Waypoint, error)
 	SampleFree(sampler utils.Sampler, sampleVolume *models.Feature3D, alt models.Altitude) (*models.Waypoint, error)
+	Sample3D(sampler utils.Sampler, sampleVolume *models.Feature3D) (*models.Waypoint, error) // Altitude between sampleVolume MinAltitude and MaxAltitude
+	SampleFree3D(sampler utils.Sampler, sampleVolume *models.Feature3D) (*models.Waypoint, error)
 }
 
 func NewEmptyStorage(storageType models.StorageType) (Storage, error) {
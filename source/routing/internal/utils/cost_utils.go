@@ -0,0 +1,314 @@
+package utils
+
+import (
+	"fmt"
+	"geopathplanner/routing/internal/models"
+	"math"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geo"
+)
+
+const (
+	// Lines are checked for proximity to constraints on points this far apart
+	PROXIMITY_STEP_MT float64 = 10.0
+	// Lines are checked for being inside soft constraints on points this far apart
+	SOFT_CONSTRAINT_STEP_MT float64 = 10.0
+	// Lines are split in steps this long, each one flown with the wind at its middle
+	WIND_STEP_MT float64 = 50.0
+	// Ground speed when the wind is as strong as the airspeed, so that the time stays finite
+	MIN_GROUND_SPEED_MS float64 = 0.5
+	DEFAULT_AIRSPEED_MS float64 = 15.0
+)
+
+// CostFunction gives the cost of flying the straight line from p1 to p2.
+// The same one drives the planners (tree and graph costs) and the cost of the route in the response.
+type CostFunction interface {
+	Cost(p1, p2 *models.Waypoint) float64
+	// Heuristic never exceeds the cost of any route from p1 to p2, so A* searches can use it
+	Heuristic(p1, p2 *models.Waypoint) float64
+}
+
+// NewCostFunctionFromParameters reads parameters.cost, either "distance" (the default), "time" or an object of weights:
+//
+//	"cost": {
+//		"distance_weight": 1,
+//		"altitude_change_weight": 0,
+//		"climb_weight": 0,
+//		"proximity_weight": 0,
+//		"proximity_mt": 50
+//	}
+//
+// With "time" the cost is the flight time (s) at parameters.airspeed_ms, in the wind field of the request if there is one.
+// The proximity penalty uses constraints, so it must be the same ones the route is planned around.
+// If some constraints are soft, the cost of flying inside them is multiplied by their cost_multiplier, and they are ignored by the proximity penalty.
+func NewCostFunctionFromParameters(parameters map[string]any, constraints []*models.Feature3D) (CostFunction, error) {
+	hard, soft := models.SplitConstraints(constraints)
+	base, err := newBaseCostFunction(parameters, hard)
+	if err != nil || len(soft) == 0 {
+		return base, err
+	}
+
+	fmt.Printf("SOFT CONSTRAINTS\n")
+	for i, c := range soft {
+		fmt.Printf("[%d]: cost_multiplier: %f\n", i, c.CostMultiplier())
+	}
+	fmt.Printf("--------------------------------------------------------\n")
+
+	return &SoftConstraintCost{Base: base, Zones: soft}, nil
+}
+
+func newBaseCostFunction(parameters map[string]any, constraints []*models.Feature3D) (CostFunction, error) {
+	var config map[string]any
+	switch v := parameters["cost"].(type) {
+	case nil:
+		return DistanceCost{}, nil
+	case string:
+		switch v {
+		case "distance":
+			return DistanceCost{}, nil
+		case "time":
+			return NewTimeCostFromParameters(parameters)
+		default:
+			return nil, fmt.Errorf("cost not recognized: %s (use distance, time or an object of weights)", v)
+		}
+	case map[string]any:
+		config = v
+	default:
+		return nil, fmt.Errorf("cost must be a string or an object, got %T", v)
+	}
+
+	c := &WeightedCost{
+		DistanceWeight:       GetOrDefault(config, "distance_weight", 1.0),
+		AltitudeChangeWeight: GetOrDefault(config, "altitude_change_weight", 0.0),
+		ClimbWeight:          GetOrDefault(config, "climb_weight", 0.0),
+		ProximityWeight:      GetOrDefault(config, "proximity_weight", 0.0),
+		ProximityMt:          GetOrDefault(config, "proximity_mt", 50.0),
+		Constraints:          constraints,
+	}
+	if c.DistanceWeight <= 0 {
+		return nil, fmt.Errorf("cost.distance_weight must be positive, got %f", c.DistanceWeight)
+	}
+	if c.AltitudeChangeWeight < 0 || c.ClimbWeight < 0 || c.ProximityWeight < 0 || c.ProximityMt < 0 {
+		return nil, fmt.Errorf("cost weights and proximity_mt can't be negative")
+	}
+
+	fmt.Printf("COST\n")
+	fmt.Printf("distance_weight: %f\n", c.DistanceWeight)
+	fmt.Printf("altitude_change_weight: %f\n", c.AltitudeChangeWeight)
+	fmt.Printf("climb_weight: %f\n", c.ClimbWeight)
+	fmt.Printf("proximity_weight: %f\n", c.ProximityWeight)
+	fmt.Printf("proximity_mt: %f\n", c.ProximityMt)
+	fmt.Printf("--------------------------------------------------------\n")
+
+	return c, nil
+}
+
+// DistanceCost is the 3D haversine distance (mt).
+type DistanceCost struct{}
+
+func (DistanceCost) Cost(p1, p2 *models.Waypoint) float64 {
+	return HaversineDistance3D(p1, p2)
+}
+
+func (DistanceCost) Heuristic(p1, p2 *models.Waypoint) float64 {
+	return HaversineDistance3D(p1, p2)
+}
+
+// WeightedCost adds penalties to the distance:
+//   - AltitudeChangeWeight for every mt climbed or descended,
+//   - ClimbWeight for every mt climbed (on top of the previous one),
+//   - ProximityWeight for every mt flown within ProximityMt of a constraint, growing linearly from 0 at ProximityMt to 1 on the border.
+type WeightedCost struct {
+	DistanceWeight       float64
+	AltitudeChangeWeight float64
+	ClimbWeight          float64
+	ProximityWeight      float64
+	ProximityMt          float64
+	Constraints          []*models.Feature3D
+}
+
+func (c *WeightedCost) Cost(p1, p2 *models.Waypoint) float64 {
+	cost := c.Heuristic(p1, p2)
+	if c.ProximityWeight > 0 && c.ProximityMt > 0 {
+		cost += c.ProximityWeight * c.proximity(p1, p2)
+	}
+	return cost
+}
+
+// Heuristic is the cost without proximity: any route between p1 and p2 is at least as long and climbs at least as much
+func (c *WeightedCost) Heuristic(p1, p2 *models.Waypoint) float64 {
+	climb := p2.Alt.Normalize().Value - p1.Alt.Normalize().Value
+	return c.DistanceWeight*HaversineDistance3D(p1, p2) + c.AltitudeChangeWeight*math.Abs(climb) + c.ClimbWeight*math.Max(climb, 0)
+}
+
+// proximity integrates, along p1 -> p2, how close the line gets to the constraints at its altitude
+func (c *WeightedCost) proximity(p1, p2 *models.Waypoint) float64 {
+	points := ResampleLineToInterval(p1, p2, PROXIMITY_STEP_MT)
+	stepMt := HaversineDistance3D(p1, p2) / float64(len(points)-1)
+
+	penalty := 0.0
+	for i, p := range points {
+		closeness := 0.0
+		for _, constraint := range c.Constraints {
+			if !p.Alt.IsWithin(constraint.MinAltitude, constraint.MaxAltitude) || !c.isNearBound(p, constraint) {
+				continue
+			}
+			closeness = math.Max(closeness, 1-DistanceToPolygon(p, constraint)/c.ProximityMt)
+		}
+
+		// Trapezoidal rule: ends count half
+		if i == 0 || i == len(points)-1 {
+			closeness /= 2
+		}
+		penalty += closeness * stepMt
+	}
+	return penalty
+}
+
+// isNearBound discards quickly the constraints whose bounding box is farther than ProximityMt from p
+func (c *WeightedCost) isNearBound(p *models.Waypoint, constraint *models.Feature3D) bool {
+	bound := constraint.Bound()
+	nearest := orb.Point{
+		math.Max(bound.Min.Lon(), math.Min(p.Lon, bound.Max.Lon())),
+		math.Max(bound.Min.Lat(), math.Min(p.Lat, bound.Max.Lat())),
+	}
+	return geo.Distance(p.Point2D(), nearest) <= c.ProximityMt
+}
+
+// TimeCost is the time (s) to fly from p1 to p2 at AirspeedMs, with the ground speed changed by Wind (if not nil).
+// The drone flies straight on the line, heading into the wind as much as needed to stay on it.
+type TimeCost struct {
+	AirspeedMs float64
+	Wind       *models.WindField
+	maxWindMs  float64
+}
+
+func NewTimeCost(airspeedMs float64, wind *models.WindField) (*TimeCost, error) {
+	if airspeedMs <= 0 {
+		return nil, fmt.Errorf("airspeed_ms must be positive, got %f", airspeedMs)
+	}
+	c := &TimeCost{AirspeedMs: airspeedMs, Wind: wind}
+	if wind != nil {
+		c.maxWindMs = wind.MaxSpeed()
+	}
+	return c, nil
+}
+
+// NewTimeCostFromParameters reads parameters.airspeed_ms and the wind field the service puts in the parameters
+func NewTimeCostFromParameters(parameters map[string]any) (*TimeCost, error) {
+	c, err := NewTimeCost(
+		GetOrDefault(parameters, "airspeed_ms", DEFAULT_AIRSPEED_MS),
+		GetOrDefault[*models.WindField](parameters, models.WIND_FIELD_PARAMETER, nil),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("COST\n")
+	fmt.Printf("time with airspeed_ms: %f\n", c.AirspeedMs)
+	fmt.Printf("max wind (m/s): %f\n", c.maxWindMs)
+	fmt.Printf("--------------------------------------------------------\n")
+
+	return c, nil
+}
+
+func (c *TimeCost) Cost(p1, p2 *models.Waypoint) float64 {
+	if c.Wind == nil {
+		return HaversineDistance3D(p1, p2) / c.AirspeedMs
+	}
+
+	// Heading of the line in a local frame (x east, y north), the same for all the steps
+	cosLat := math.Cos((p1.Lat + p2.Lat) / 2 * math.Pi / 180)
+	dx, dy := (p2.Lon-p1.Lon)*cosLat, p2.Lat-p1.Lat
+	if norm := math.Hypot(dx, dy); norm > 0 {
+		dx, dy = dx/norm, dy/norm
+	}
+
+	points := ResampleLineToInterval(p1, p2, WIND_STEP_MT)
+	time := 0.0
+	for i := 1; i < len(points); i++ {
+		a, b := points[i-1], points[i]
+		u, v := c.Wind.At((a.Lat+b.Lat)/2, (a.Lon+b.Lon)/2, (a.Alt.Normalize().Value+b.Alt.Normalize().Value)/2)
+		time += HaversineDistance3D(a, b) / c.groundSpeed(dx, dy, u, v)
+	}
+	return time
+}
+
+// Heuristic flies the straight line with the strongest wind of the grid always in the back
+func (c *TimeCost) Heuristic(p1, p2 *models.Waypoint) float64 {
+	return HaversineDistance3D(p1, p2) / (c.AirspeedMs + c.maxWindMs)
+}
+
+// groundSpeed along the unit direction (dx, dy) with wind (u, v): the crosswind is compensated, the rest adds to the airspeed
+func (c *TimeCost) groundSpeed(dx, dy, u, v float64) float64 {
+	along := u*dx + v*dy
+	cross := u*dy - v*dx
+	if c.AirspeedMs <= math.Abs(cross) {
+		return MIN_GROUND_SPEED_MS
+	}
+	return math.Max(along+math.Sqrt(c.AirspeedMs*c.AirspeedMs-cross*cross), MIN_GROUND_SPEED_MS)
+}
+
+// SoftConstraintCost multiplies the cost of Base by the cost_multiplier of the soft constraints the line is inside of.
+// Where zones overlap the highest multiplier is used, so the cost grows with the distance flown inside them.
+type SoftConstraintCost struct {
+	Base  CostFunction
+	Zones []*models.Feature3D
+}
+
+func (c *SoftConstraintCost) Cost(p1, p2 *models.Waypoint) float64 {
+	return c.Base.Cost(p1, p2) * c.multiplier(p1, p2)
+}
+
+// Heuristic is the one of Base: multipliers are at least 1, so it's still a lower bound
+func (c *SoftConstraintCost) Heuristic(p1, p2 *models.Waypoint) float64 {
+	return c.Base.Heuristic(p1, p2)
+}
+
+// multiplier is the average, along p1 -> p2, of the multiplier of the zones containing each point (1 outside all of them)
+func (c *SoftConstraintCost) multiplier(p1, p2 *models.Waypoint) float64 {
+	lineBound := p1.GetLineStringBound(p2)
+	zones := make([]*models.Feature3D, 0)
+	for _, zone := range c.Zones {
+		if lineBound.Intersects(zone.Bound()) {
+			zones = append(zones, zone)
+		}
+	}
+	if len(zones) == 0 {
+		return 1
+	}
+
+	points := ResampleLineToInterval(p1, p2, SOFT_CONSTRAINT_STEP_MT)
+	multipliers := make([]float64, len(points))
+	for i, p := range points {
+		multipliers[i] = 1.0
+		for _, zone := range zones {
+			// Not PointInPolygon: it writes on p, which can be a wp shared with other goroutines
+			if p.Alt.IsWithin(zone.MinAltitude, zone.MaxAltitude) && zone.Bound().Contains(p.Point2D()) && PointInGeometry2D(p.Point2D(), zone.Geometry) {
+				multipliers[i] = math.Max(multipliers[i], zone.CostMultiplier())
+			}
+		}
+	}
+
+	// Trapezoidal rule, weighting every step by its length since the last one can be shorter
+	total, length := 0.0, 0.0
+	for i := 1; i < len(points); i++ {
+		stepMt := HaversineDistance3D(points[i-1], points[i])
+		total += stepMt * (multipliers[i-1] + multipliers[i]) / 2
+		length += stepMt
+	}
+	if length == 0 {
+		return multipliers[0]
+	}
+	return total / length
+}
+
+// TotalCost is the cost of flying the whole route with f.
+func TotalCost(f CostFunction, route []*models.Waypoint) float64 {
+	cost := 0.0
+	for i := 1; i < len(route); i++ {
+		cost += f.Cost(route[i-1], route[i])
+	}
+	return cost
+}
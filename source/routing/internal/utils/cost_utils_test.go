@@ -0,0 +1,168 @@
+package utils
+
+import (
+	"geopathplanner/routing/internal/models"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestWeightedCost_Cost(t *testing.T) {
+	low, _ := models.NewAltitude(100, models.MT)
+	high, _ := models.NewAltitude(150, models.MT)
+	// Square of ~111 mt side, and a line of ~111 mt along its south edge or 500 mt south of it
+	square := models.MustNewFeatureFromGeojson(`{"type": "Feature", "properties": {}, "geometry": {"type": "Polygon", "coordinates": [[[4.0, 50.0], [4.001568, 50.0], [4.001568, 50.001], [4.0, 50.001], [4.0, 50.0]]]}}`)
+	onEdgeA, onEdgeB := models.MustNewWaypoint(0, 50.0, 4.0, low), models.MustNewWaypoint(1, 50.0, 4.001568, low)
+	farA, farB := models.MustNewWaypoint(2, 49.9955, 4.0, low), models.MustNewWaypoint(3, 49.9955, 4.001568, low)
+	climbA, climbB := models.MustNewWaypoint(4, 49.9955, 4.0, low), models.MustNewWaypoint(5, 49.9955, 4.001568, high)
+
+	tests := []struct {
+		name string // description of this test case
+		cost *WeightedCost
+		p1   *models.Waypoint
+		p2   *models.Waypoint
+		want float64
+	}{
+		{name: "Distance only", cost: &WeightedCost{DistanceWeight: 1}, p1: onEdgeA, p2: onEdgeB, want: HaversineDistance3D(onEdgeA, onEdgeB)},
+		{name: "Altitude change climbing", cost: &WeightedCost{DistanceWeight: 1, AltitudeChangeWeight: 2}, p1: climbA, p2: climbB, want: HaversineDistance3D(climbA, climbB) + 2*50},
+		{name: "Altitude change descending", cost: &WeightedCost{DistanceWeight: 1, AltitudeChangeWeight: 2}, p1: climbB, p2: climbA, want: HaversineDistance3D(climbA, climbB) + 2*50},
+		{name: "Climb only when climbing", cost: &WeightedCost{DistanceWeight: 1, ClimbWeight: 3}, p1: climbA, p2: climbB, want: HaversineDistance3D(climbA, climbB) + 3*50},
+		{name: "No climb when descending", cost: &WeightedCost{DistanceWeight: 1, ClimbWeight: 3}, p1: climbB, p2: climbA, want: HaversineDistance3D(climbA, climbB)},
+		{name: "Proximity along the border", cost: &WeightedCost{DistanceWeight: 1, ProximityWeight: 2, ProximityMt: 50, Constraints: []*models.Feature3D{square}}, p1: onEdgeA, p2: onEdgeB, want: 3 * HaversineDistance3D(onEdgeA, onEdgeB)},
+		{name: "Proximity far from the constraint", cost: &WeightedCost{DistanceWeight: 1, ProximityWeight: 2, ProximityMt: 50, Constraints: []*models.Feature3D{square}}, p1: farA, p2: farB, want: HaversineDistance3D(farA, farB)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.cost.Cost(tt.p1, tt.p2)
+			// Proximity is sampled every PROXIMITY_STEP_MT, and distances are planar around each point
+			if math.Abs(got-tt.want) > 0.01*tt.want {
+				t.Errorf("Cost() = %.3f, want %.3f", got, tt.want)
+			}
+			if h := tt.cost.Heuristic(tt.p1, tt.p2); h > got+1e-9 {
+				t.Errorf("Heuristic() = %.3f is more than Cost() = %.3f", h, got)
+			}
+		})
+	}
+}
+
+func TestNewCostFunctionFromParameters(t *testing.T) {
+	hard := models.MustNewFeatureFromGeojson(`{"type": "Feature", "properties": {}, "geometry": {"type": "Polygon", "coordinates": [[[4.0, 50.0], [4.001, 50.0], [4.001, 50.001], [4.0, 50.0]]]}}`)
+	soft := models.MustNewFeatureFromGeojson(`{"type": "Feature", "properties": {"constraint_type": "soft"}, "geometry": {"type": "Polygon", "coordinates": [[[4.0, 50.0], [4.001, 50.0], [4.001, 50.001], [4.0, 50.0]]]}}`)
+
+	tests := []struct {
+		name        string // description of this test case
+		parameters  map[string]any
+		constraints []*models.Feature3D
+		want        CostFunction
+		wantErr     bool
+	}{
+		{name: "Default", parameters: nil, want: DistanceCost{}},
+		{name: "Distance", parameters: map[string]any{"cost": "distance"}, want: DistanceCost{}},
+		{name: "Weights", parameters: map[string]any{"cost": map[string]any{"climb_weight": 2.0}}, want: &WeightedCost{DistanceWeight: 1, ClimbWeight: 2, ProximityMt: 50}},
+		{name: "Time", parameters: map[string]any{"cost": "time", "airspeed_ms": 12.0}, want: &TimeCost{AirspeedMs: 12}},
+		{name: "Non-positive airspeed", parameters: map[string]any{"cost": "time", "airspeed_ms": 0.0}, wantErr: true},
+		{name: "Unknown name", parameters: map[string]any{"cost": "fastest"}, wantErr: true},
+		{name: "Negative weight", parameters: map[string]any{"cost": map[string]any{"proximity_weight": -1.0}}, wantErr: true},
+		{name: "Soft constraints", parameters: nil, constraints: []*models.Feature3D{hard, soft}, want: &SoftConstraintCost{Base: DistanceCost{}, Zones: []*models.Feature3D{soft}}},
+		{name: "Proximity to hard constraints only", parameters: map[string]any{"cost": map[string]any{"proximity_weight": 1.0}}, constraints: []*models.Feature3D{hard, soft}, want: &SoftConstraintCost{Base: &WeightedCost{DistanceWeight: 1, ProximityWeight: 1, ProximityMt: 50, Constraints: []*models.Feature3D{hard}}, Zones: []*models.Feature3D{soft}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, gotErr := NewCostFunctionFromParameters(tt.parameters, tt.constraints)
+			if gotErr != nil {
+				if !tt.wantErr {
+					t.Errorf("NewCostFunctionFromParameters() failed: %v", gotErr)
+				}
+				return
+			}
+			if tt.wantErr {
+				t.Fatal("NewCostFunctionFromParameters() succeeded unexpectedly")
+			}
+
+			switch want := tt.want.(type) {
+			case DistanceCost:
+				if _, ok := got.(DistanceCost); !ok {
+					t.Errorf("NewCostFunctionFromParameters() = %T, want DistanceCost", got)
+				}
+			case *WeightedCost, *TimeCost, *SoftConstraintCost:
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("NewCostFunctionFromParameters() = %+v, want %+v", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSoftConstraintCost_Cost(t *testing.T) {
+	a, _ := models.NewAltitude(100, models.MT)
+	// Soft square of ~143x222 mt, crossed in the middle by a line of ~430 mt, 1/3 of which inside it
+	zone := models.MustNewFeatureFromGeojson(`{"type": "Feature", "properties": {"constraint_type": "soft", "cost_multiplier": 4}, "geometry": {"type": "Polygon", "coordinates": [[[4.0, 49.999], [4.002, 49.999], [4.002, 50.001], [4.0, 50.001], [4.0, 49.999]]]}}`)
+	start, end := models.MustNewWaypoint(0, 50.0, 3.9985, a), models.MustNewWaypoint(1, 50.0, 4.0045, a)
+	inA, inB := models.MustNewWaypoint(2, 50.0, 4.0005, a), models.MustNewWaypoint(3, 50.0, 4.0015, a)
+	outA, outB := models.MustNewWaypoint(4, 50.002, 3.9985, a), models.MustNewWaypoint(5, 50.002, 4.0045, a)
+
+	tests := []struct {
+		name string // description of this test case
+		base CostFunction
+		p1   *models.Waypoint
+		p2   *models.Waypoint
+		want float64
+	}{
+		{name: "Outside", base: DistanceCost{}, p1: outA, p2: outB, want: HaversineDistance3D(outA, outB)},
+		{name: "Inside", base: DistanceCost{}, p1: inA, p2: inB, want: 4 * HaversineDistance3D(inA, inB)},
+		{name: "Crossing", base: DistanceCost{}, p1: start, p2: end, want: HaversineDistance3D(start, end) * (2.0/3 + 4.0/3)},
+		{name: "Crossing with weights", base: &WeightedCost{DistanceWeight: 2}, p1: start, p2: end, want: 2 * HaversineDistance3D(start, end) * (2.0/3 + 4.0/3)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cost := &SoftConstraintCost{Base: tt.base, Zones: []*models.Feature3D{zone}}
+			got := cost.Cost(tt.p1, tt.p2)
+			// The border is found within SOFT_CONSTRAINT_STEP_MT
+			if math.Abs(got-tt.want) > 0.03*tt.want {
+				t.Errorf("Cost() = %.3f, want %.3f", got, tt.want)
+			}
+			if h := cost.Heuristic(tt.p1, tt.p2); h > got+1e-9 {
+				t.Errorf("Heuristic() = %.3f is more than Cost() = %.3f", h, got)
+			}
+		})
+	}
+}
+
+func TestTimeCost_Cost(t *testing.T) {
+	a, _ := models.NewAltitude(100, models.MT)
+	// Line of ~430 mt toward east
+	west, east := models.MustNewWaypoint(0, 50.0, 3.9985, a), models.MustNewWaypoint(1, 50.0, 4.0045, a)
+	dist := HaversineDistance3D(west, east)
+	uniformWind := func(u, v float64) *models.WindField {
+		return &models.WindField{LatStep: 1, LonStep: 1, U: [][][]float64{{{u}}}, V: [][][]float64{{{v}}}}
+	}
+
+	tests := []struct {
+		name string // description of this test case
+		wind *models.WindField
+		p1   *models.Waypoint
+		p2   *models.Waypoint
+		want float64
+	}{
+		{name: "No wind", wind: nil, p1: west, p2: east, want: dist / 15},
+		{name: "Tailwind", wind: uniformWind(5, 0), p1: west, p2: east, want: dist / 20},
+		{name: "Headwind", wind: uniformWind(5, 0), p1: east, p2: west, want: dist / 10},
+		{name: "Crosswind", wind: uniformWind(0, 9), p1: west, p2: east, want: dist / 12},
+		{name: "Headwind stronger than airspeed", wind: uniformWind(-20, 0), p1: west, p2: east, want: dist / MIN_GROUND_SPEED_MS},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cost, err := NewTimeCost(15, tt.wind)
+			if err != nil {
+				t.Fatalf("could not construct cost function: %v", err)
+			}
+			got := cost.Cost(tt.p1, tt.p2)
+			if math.Abs(got-tt.want) > 1e-6*tt.want {
+				t.Errorf("Cost() = %.3f, want %.3f", got, tt.want)
+			}
+			if h := cost.Heuristic(tt.p1, tt.p2); h > got+1e-9 {
+				t.Errorf("Heuristic() = %.3f is more than Cost() = %.3f", h, got)
+			}
+		})
+	}
+}
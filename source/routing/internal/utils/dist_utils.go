@@ -52,4 +52,39 @@ func TotalHaversineDistance(wps []*models.Waypoint) float64 {
 	}
 
 	return distance
-}
\ No newline at end of file
+}
+
+// Gradient returns how many mt p1 -> p2 climbs (positive) or descends (negative) for each mt of horizontal distance.
+// A vertical line has infinite gradient.
+func Gradient(p1, p2 *models.Waypoint) float64 {
+	horizontal := geo.DistanceHaversine(p1.Point2D(), p2.Point2D())
+	vertical := p2.Alt.Normalize().Value - p1.Alt.Normalize().Value
+	if vertical == 0 {
+		return 0
+	}
+	return vertical / horizontal
+}
+
+// IsWithinGradient checks if p1 -> p2 climbs and descends at most maxGradient. A maxGradient <= 0 means no limit.
+func IsWithinGradient(p1, p2 *models.Waypoint, maxGradient float64) bool {
+	return maxGradient <= 0 || math.Abs(Gradient(p1, p2)) <= maxGradient
+}
+
+// HausdorffDistance is the largest distance (mt) from a point of one route to the other route, so two routes are at least that far apart somewhere.
+// Routes are resampled every stepMt, which bounds the error.
+func HausdorffDistance(r1, r2 []*models.Waypoint, stepMt float64) float64 {
+	p1, p2 := ResampleRouteToInterval(r1, stepMt), ResampleRouteToInterval(r2, stepMt)
+	return math.Max(directedHausdorffDistance(p1, p2), directedHausdorffDistance(p2, p1))
+}
+
+func directedHausdorffDistance(from, to []*models.Waypoint) float64 {
+	maxDist := 0.0
+	for _, p := range from {
+		minDist := math.Inf(1)
+		for _, q := range to {
+			minDist = math.Min(minDist, HaversineDistance3D(p, q))
+		}
+		maxDist = math.Max(maxDist, minDist)
+	}
+	return maxDist
+}
@@ -0,0 +1,180 @@
+package utils
+
+import (
+	"math"
+	"sort"
+)
+
+// Rounding tolerance for the paths lying on the boundary of a word (e.g. LSL with a zero-length straight segment)
+const DUBINS_TOLERANCE float64 = 1e-9
+
+// Pose is a position (mt) in a local planar frame, with a heading in radians counterclockwise from the x axis.
+type Pose struct {
+	X       float64
+	Y       float64
+	Heading float64
+}
+
+// DubinsPath is the shortest path of a given word (e.g. "LSR") between two poses for a vehicle that can't turn tighter than Radius.
+// Lengths are the lengths of the 3 segments normalized by Radius: angles for L and R, distances for S.
+type DubinsPath struct {
+	Start   Pose
+	Radius  float64
+	Type    string
+	Lengths [3]float64
+}
+
+// DubinsPaths returns every feasible Dubins path from q0 to q1, sorted from the shortest one.
+// Callers can go through them in order until one is collision-free.
+func DubinsPaths(q0, q1 Pose, radius float64) []*DubinsPath {
+	dx, dy := q1.X-q0.X, q1.Y-q0.Y
+	d := math.Hypot(dx, dy) / radius
+	theta := mod2Pi(math.Atan2(dy, dx))
+	alpha := mod2Pi(q0.Heading - theta)
+	beta := mod2Pi(q1.Heading - theta)
+
+	words := map[string]func(alpha, beta, d float64) (float64, float64, float64, bool){
+		"LSL": dubinsLSL,
+		"RSR": dubinsRSR,
+		"LSR": dubinsLSR,
+		"RSL": dubinsRSL,
+		"RLR": dubinsRLR,
+		"LRL": dubinsLRL,
+	}
+
+	paths := make([]*DubinsPath, 0, len(words))
+	for word, solve := range words {
+		t, p, q, ok := solve(alpha, beta, d)
+		if !ok {
+			continue
+		}
+		paths = append(paths, &DubinsPath{Start: q0, Radius: radius, Type: word, Lengths: [3]float64{t, p, q}})
+	}
+
+	sort.Slice(paths, func(i, j int) bool {
+		if paths[i].Length() != paths[j].Length() {
+			return paths[i].Length() < paths[j].Length()
+		}
+		return paths[i].Type < paths[j].Type
+	})
+	return paths
+}
+
+// Length of the path in mt
+func (p *DubinsPath) Length() float64 {
+	return (p.Lengths[0] + p.Lengths[1] + p.Lengths[2]) * p.Radius
+}
+
+// Sample returns the poses along the path every stepMt, always including start and end.
+func (p *DubinsPath) Sample(stepMt float64) []Pose {
+	length := p.Length()
+	poses := []Pose{p.Start}
+	for s := stepMt; s < length; s += stepMt {
+		poses = append(poses, p.At(s))
+	}
+	return append(poses, p.At(length))
+}
+
+// At returns the pose after travelling distMt along the path.
+func (p *DubinsPath) At(distMt float64) Pose {
+	// Work normalized by radius, starting from origin
+	remaining := distMt / p.Radius
+	x, y, h := 0.0, 0.0, p.Start.Heading
+
+	for i, segment := range p.Type {
+		l := math.Min(remaining, p.Lengths[i])
+		switch segment {
+		case 'L':
+			x, y = x+math.Sin(h+l)-math.Sin(h), y-math.Cos(h+l)+math.Cos(h)
+			h += l
+		case 'R':
+			x, y = x-math.Sin(h-l)+math.Sin(h), y+math.Cos(h-l)-math.Cos(h)
+			h -= l
+		case 'S':
+			x, y = x+l*math.Cos(h), y+l*math.Sin(h)
+		}
+		remaining -= l
+		if remaining <= 0 {
+			break
+		}
+	}
+
+	return Pose{X: p.Start.X + x*p.Radius, Y: p.Start.Y + y*p.Radius, Heading: mod2Pi(h)}
+}
+
+func mod2Pi(theta float64) float64 {
+	return theta - 2*math.Pi*math.Floor(theta/(2*math.Pi))
+}
+
+// ---------------------------------------------------------------- WORDS
+// Closed form solutions of every word, in the frame where start and goal lie on the x axis (see Shkel and Lumelsky, 2001).
+
+func dubinsLSL(alpha, beta, d float64) (float64, float64, float64, bool) {
+	sa, sb, ca, cb := math.Sin(alpha), math.Sin(beta), math.Cos(alpha), math.Cos(beta)
+	pSquared := 2 + d*d - 2*math.Cos(alpha-beta) + 2*d*(sa-sb)
+	if pSquared < -DUBINS_TOLERANCE {
+		return 0, 0, 0, false
+	}
+	pSquared = math.Max(pSquared, 0)
+	tmp := math.Atan2(cb-ca, d+sa-sb)
+	return mod2Pi(tmp - alpha), math.Sqrt(pSquared), mod2Pi(beta - tmp), true
+}
+
+func dubinsRSR(alpha, beta, d float64) (float64, float64, float64, bool) {
+	sa, sb, ca, cb := math.Sin(alpha), math.Sin(beta), math.Cos(alpha), math.Cos(beta)
+	pSquared := 2 + d*d - 2*math.Cos(alpha-beta) + 2*d*(sb-sa)
+	if pSquared < -DUBINS_TOLERANCE {
+		return 0, 0, 0, false
+	}
+	pSquared = math.Max(pSquared, 0)
+	tmp := math.Atan2(ca-cb, d-sa+sb)
+	return mod2Pi(alpha - tmp), math.Sqrt(pSquared), mod2Pi(tmp - beta), true
+}
+
+func dubinsLSR(alpha, beta, d float64) (float64, float64, float64, bool) {
+	sa, sb, ca, cb := math.Sin(alpha), math.Sin(beta), math.Cos(alpha), math.Cos(beta)
+	pSquared := -2 + d*d + 2*math.Cos(alpha-beta) + 2*d*(sa+sb)
+	if pSquared < -DUBINS_TOLERANCE {
+		return 0, 0, 0, false
+	}
+	pSquared = math.Max(pSquared, 0)
+	p := math.Sqrt(pSquared)
+	tmp := math.Atan2(-ca-cb, d+sa+sb) - math.Atan2(-2, p)
+	return mod2Pi(tmp - alpha), p, mod2Pi(tmp - beta), true
+}
+
+func dubinsRSL(alpha, beta, d float64) (float64, float64, float64, bool) {
+	sa, sb, ca, cb := math.Sin(alpha), math.Sin(beta), math.Cos(alpha), math.Cos(beta)
+	pSquared := -2 + d*d + 2*math.Cos(alpha-beta) - 2*d*(sa+sb)
+	if pSquared < -DUBINS_TOLERANCE {
+		return 0, 0, 0, false
+	}
+	pSquared = math.Max(pSquared, 0)
+	p := math.Sqrt(pSquared)
+	tmp := math.Atan2(ca+cb, d-sa-sb) - math.Atan2(2, p)
+	return mod2Pi(alpha - tmp), p, mod2Pi(beta - tmp), true
+}
+
+func dubinsRLR(alpha, beta, d float64) (float64, float64, float64, bool) {
+	sa, sb, ca, cb := math.Sin(alpha), math.Sin(beta), math.Cos(alpha), math.Cos(beta)
+	tmp := (6 - d*d + 2*math.Cos(alpha-beta) + 2*d*(sa-sb)) / 8
+	if math.Abs(tmp) > 1+DUBINS_TOLERANCE {
+		return 0, 0, 0, false
+	}
+	tmp = math.Max(-1, math.Min(1, tmp))
+	p := mod2Pi(2*math.Pi - math.Acos(tmp))
+	t := mod2Pi(alpha - math.Atan2(ca-cb, d-sa+sb) + p/2)
+	return t, p, mod2Pi(alpha - beta - t + p), true
+}
+
+func dubinsLRL(alpha, beta, d float64) (float64, float64, float64, bool) {
+	sa, sb, ca, cb := math.Sin(alpha), math.Sin(beta), math.Cos(alpha), math.Cos(beta)
+	tmp := (6 - d*d + 2*math.Cos(alpha-beta) + 2*d*(sb-sa)) / 8
+	if math.Abs(tmp) > 1+DUBINS_TOLERANCE {
+		return 0, 0, 0, false
+	}
+	tmp = math.Max(-1, math.Min(1, tmp))
+	p := mod2Pi(2*math.Pi - math.Acos(tmp))
+	t := mod2Pi(-alpha - math.Atan2(ca-cb, d+sa-sb) + p/2)
+	return t, p, mod2Pi(beta - alpha - t + p), true
+}
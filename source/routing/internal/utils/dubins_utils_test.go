@@ -0,0 +1,65 @@
+package utils
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestDubinsPaths(t *testing.T) {
+	tests := []struct {
+		name string // description of this test case
+		// Named input parameters for target function.
+		q0         Pose
+		q1         Pose
+		radius     float64
+		wantLength float64
+	}{
+		{name: "Straight ahead", q0: Pose{0, 0, 0}, q1: Pose{100, 0, 0}, radius: 10, wantLength: 100},
+		{name: "Quarter turn left", q0: Pose{0, 0, 0}, q1: Pose{10, 10, math.Pi / 2}, radius: 10, wantLength: 10 * math.Pi / 2},
+		{name: "Quarter turn right", q0: Pose{0, 0, 0}, q1: Pose{10, -10, 3 * math.Pi / 2}, radius: 10, wantLength: 10 * math.Pi / 2},
+		{name: "U-turn", q0: Pose{0, 0, 0}, q1: Pose{0, 20, math.Pi}, radius: 10, wantLength: 10 * math.Pi},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := DubinsPaths(tt.q0, tt.q1, tt.radius)
+			if len(got) == 0 {
+				t.Fatalf("DubinsPaths() found no path")
+			}
+			if math.Abs(got[0].Length()-tt.wantLength) > 1e-6 {
+				t.Errorf("DubinsPaths() shortest is %s of %.3f mt, want %.3f mt", got[0].Type, got[0].Length(), tt.wantLength)
+			}
+		})
+	}
+}
+
+func TestDubinsPath_Sample(t *testing.T) {
+	r := rand.New(rand.NewSource(945))
+
+	// Every word must end in the goal pose, whatever the poses are
+	for range 200 {
+		q0 := Pose{r.Float64()*200 - 100, r.Float64()*200 - 100, r.Float64() * 2 * math.Pi}
+		q1 := Pose{r.Float64()*200 - 100, r.Float64()*200 - 100, r.Float64() * 2 * math.Pi}
+		radius := 5 + r.Float64()*20
+
+		for _, path := range DubinsPaths(q0, q1, radius) {
+			samples := path.Sample(radius / 4)
+			if samples[0] != q0 {
+				t.Fatalf("%s: first sample %+v is not start %+v", path.Type, samples[0], q0)
+			}
+
+			end := samples[len(samples)-1]
+			headingDiff := math.Abs(math.Remainder(end.Heading-q1.Heading, 2*math.Pi))
+			if math.Hypot(end.X-q1.X, end.Y-q1.Y) > 1e-6 || headingDiff > 1e-6 {
+				t.Fatalf("%s from %+v: ends in %+v, want %+v", path.Type, q0, end, q1)
+			}
+
+			// Consecutive samples can't be further than the step
+			for i := 1; i < len(samples); i++ {
+				if step := math.Hypot(samples[i].X-samples[i-1].X, samples[i].Y-samples[i-1].Y); step > radius/4+1e-6 {
+					t.Fatalf("%s: samples %d and %d are %.3f mt apart", path.Type, i-1, i, step)
+				}
+			}
+		}
+	}
+}
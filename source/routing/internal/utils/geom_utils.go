@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"geopathplanner/routing/internal/models"
 	"math"
+	"time"
 
 	"github.com/engelsjk/polygol"
 	"github.com/paulmach/orb"
@@ -48,7 +49,7 @@ func PointInPolygon(p *models.Waypoint, poly *models.Feature3D) bool {
 
 	// 3. Here you have to check exactly if it insersects: run PiP algorithm (PnPoly, uses RayTracing) algorithm to do that
 	// Add "inside" property if it's inside the polygon
-	isInside := PointInPolygon2D(p.Point2D(), poly.ToPolygon())
+	isInside := PointInGeometry2D(p.Point2D(), poly.Geometry)
 	// TODO: For now just for testing
 	p.Feature.Properties["inside"] = isInside
 	return isInside
@@ -58,6 +59,18 @@ func PointInPolygon2D(p orb.Point, poly orb.Polygon) bool {
 	return planar.PolygonContains(poly, p);
 }
 
+// PointInGeometry2D tells if the Polygon or MultiPolygon g contains p, false for any other geometry
+func PointInGeometry2D(p orb.Point, g orb.Geometry) bool {
+	switch g := g.(type) {
+	case orb.Polygon:
+		return planar.PolygonContains(g, p)
+	case orb.MultiPolygon:
+		return planar.MultiPolygonContains(g, p)
+	default:
+		return false
+	}
+}
+
 // Implement LINE-POLYGON intersection
 func LineInPolygon(p1, p2 *models.Waypoint, polygons ...*models.Feature3D) (bool, []*models.Waypoint) {
 	// Use linebound to rapidly check if it's inside polygons or not
@@ -88,6 +101,35 @@ func LineInPolygon(p1, p2 *models.Waypoint, polygons ...*models.Feature3D) (bool
 	return inside, quantizedLine
 }
 
+// PointInPolygonAt tells if poly contains p at time t: it must be active, and moving polygons are where they moved to at t.
+// Unlike PointInPolygon, it doesn't write on p, that can be shared by planners running at once.
+func PointInPolygonAt(p *models.Waypoint, poly *models.Feature3D, t time.Time) bool {
+	if !poly.IsActiveAt(t) {
+		return false
+	}
+	p = poly.Rewind(p, t)
+	return p.Alt.IsWithin(poly.MinAltitude, poly.MaxAltitude) && poly.Bound().Contains(p.Point2D()) && PointInGeometry2D(p.Point2D(), poly.Geometry)
+}
+
+// LineInPolygonAt is LineInPolygon for a vehicle leaving p1 at t1 and reaching p2 at t2: every point of the line is checked
+// against the polygons as they are when the vehicle is there, assuming a constant speed along the line.
+func LineInPolygonAt(p1, p2 *models.Waypoint, t1, t2 time.Time, polygons ...*models.Feature3D) (bool, []*models.Waypoint) {
+	quantizedLine := DefaultResampleLineToInterval(p1, p2)
+	duration := t2.Sub(t1)
+	for i, p := range quantizedLine {
+		t := t1
+		if len(quantizedLine) > 1 {
+			t = t1.Add(time.Duration(float64(duration) * float64(i) / float64(len(quantizedLine)-1)))
+		}
+		for _, poly := range polygons {
+			if PointInPolygonAt(p, poly, t) {
+				return true, quantizedLine
+			}
+		}
+	}
+	return false, quantizedLine
+}
+
 func LineInPolygonRemoveLast(p1, p2 *models.Waypoint, polygons ...*models.Feature3D) (bool, []*models.Waypoint) {
 	// Divide line into point and then check if any individual point lies in polygon
 	quantizedLine := DefaultResampleLineToInterval(p1, p2)
@@ -176,13 +218,22 @@ func ResampleLineToInterval(p1, p2 *models.Waypoint, distMt float64) []*models.W
 
 	// 2D resample line	
 	resampledLine := resample.ToInterval(p1.GetLineString(p2), geo.DistanceHaversine, stepSizeMt)
+	// (Almost) vertical lines are too short to be resampled in 2D, but they still need points every distMt along the altitude
+	if len(resampledLine) < 2 {
+		resampledLine = make(orb.LineString, int(numStep)+1)
+		for i := range resampledLine {
+			fraction := float64(i) / numStep
+			resampledLine[i] = orb.Point{p1.Lon + (p2.Lon-p1.Lon)*fraction, p1.Lat + (p2.Lat-p1.Lat)*fraction}
+		}
+	}
 	
 	// For each point in resampleLine, add the altitude interpolated
 	quantizedPoints := make([]*models.Waypoint, 0, int(numStep))
 	startingAltVal := p1.Alt.ConvertTo(models.MT).Value
+	endingAltVal := p2.Alt.ConvertTo(models.MT).Value
 	for i, p := range resampledLine {
-		// For altitude linearly interpolate
-		altVal := startingAltVal + float64(i)*altStepSizeMt
+		// For altitude linearly interpolate (points are evenly spaced), climbing or descending
+		altVal := startingAltVal + (endingAltVal-startingAltVal)*float64(i)/float64(len(resampledLine)-1)
         alt, _ := models.NewAltitude(altVal, models.MT)
 		// TODO: Debug error in case
 		wp, _ := models.NewWaypoint(p.Lat(), p.Lon(), alt)
@@ -263,6 +314,70 @@ func getWayToGoAroundPolygon(c *models.Feature3D, enteringPoint, exitingPoint *m
 	return bestWay
 }
 
+// GetConvexVerticesWithOffset returns the convex vertices of the outer ring of c at altitude alt, each one pushed outward by offsetMt along its bisector.
+// Reflex vertices are skipped, as a shortest path never bends around them. The vertices of a MultiPolygon are the ones of all its polygons.
+func GetConvexVerticesWithOffset(c *models.Feature3D, alt models.Altitude, offsetMt float64) []*models.Waypoint {
+	switch g := c.Geometry.(type) {
+	case orb.Polygon:
+		return convexVerticesWithOffset(g, alt, offsetMt)
+	case orb.MultiPolygon:
+		vertices := make([]*models.Waypoint, 0)
+		for _, polygon := range g {
+			vertices = append(vertices, convexVerticesWithOffset(polygon, alt, offsetMt)...)
+		}
+		return vertices
+	default:
+		return nil
+	}
+}
+
+func convexVerticesWithOffset(polygon orb.Polygon, alt models.Altitude, offsetMt float64) []*models.Waypoint {
+	if len(polygon) == 0 || len(polygon[0]) < 4 {
+		return nil
+	}
+
+	ring := polygon[0][:len(polygon[0])-1]
+	vertices := make([]*models.Waypoint, 0, len(ring))
+	for i, v := range ring {
+		prev := ring[(i-1+len(ring))%len(ring)]
+		next := ring[(i+1)%len(ring)]
+
+		// Work in a local planar frame (mt) around v
+		metersPerDegLon := models.METERS_PER_DEGREE * math.Cos(v.Lat()*math.Pi/180)
+		toLocal := func(p orb.Point) (float64, float64) {
+			return (p.Lon() - v.Lon()) * metersPerDegLon, (p.Lat() - v.Lat()) * models.METERS_PER_DEGREE
+		}
+		px, py := toLocal(prev)
+		nx, ny := toLocal(next)
+		pLen, nLen := math.Hypot(px, py), math.Hypot(nx, ny)
+		if pLen == 0 || nLen == 0 {
+			continue
+		}
+
+		// Sum of unit vectors going from neighbors to v
+		bx, by := -px/pLen-nx/nLen, -py/pLen-ny/nLen
+		bLen := math.Hypot(bx, by)
+		if bLen == 0 {
+			// Collinear vertex, not needed
+			continue
+		}
+
+		offset := orb.Point{v.Lon() + offsetMt*bx/bLen/metersPerDegLon, v.Lat() + offsetMt*by/bLen/models.METERS_PER_DEGREE}
+		if PointInPolygon2D(offset, polygon) {
+			// Bisector goes inside the polygon: reflex vertex
+			continue
+		}
+
+		wp, err := models.NewWaypoint(offset.Lat(), offset.Lon(), alt)
+		if err != nil {
+			continue
+		}
+		vertices = append(vertices, wp)
+	}
+
+	return vertices
+}
+
 func FindMinMaxAltitude(features []*models.Feature3D) (models.Altitude, models.Altitude) {
 	// Find min and max altitude first
 	var minAlt, maxAlt models.Altitude
@@ -339,4 +454,95 @@ func PolygolToListOfFeature(p [][][][]float64, minAltitude, maxAltitude models.A
 	}
 
 	return feature_list, nil
-}
\ No newline at end of file
+}
+
+// ResampleRouteToInterval returns the points of route every distMt along each of its lines, keeping all its wps.
+func ResampleRouteToInterval(route []*models.Waypoint, distMt float64) []*models.Waypoint {
+	if len(route) < 2 {
+		return route
+	}
+
+	points := []*models.Waypoint{route[0]}
+	for i := 1; i < len(route); i++ {
+		line := ResampleLineToInterval(route[i-1], route[i], distMt)
+		points = append(points, line[1:len(line)-1]...)
+		points = append(points, route[i])
+	}
+	return points
+}
+
+// DistanceToPolygon returns the horizontal distance (mt) from p to the outer ring of c, 0 if p is inside.
+// The distance to a MultiPolygon is the one to the closest of its polygons.
+func DistanceToPolygon(p *models.Waypoint, c *models.Feature3D) float64 {
+	switch g := c.Geometry.(type) {
+	case orb.Polygon:
+		return distanceToPolygon(p, g)
+	case orb.MultiPolygon:
+		minDist := math.Inf(1)
+		for _, polygon := range g {
+			minDist = math.Min(minDist, distanceToPolygon(p, polygon))
+		}
+		return minDist
+	default:
+		return math.Inf(1)
+	}
+}
+
+func distanceToPolygon(p *models.Waypoint, polygon orb.Polygon) float64 {
+	if len(polygon) == 0 {
+		return math.Inf(1)
+	}
+	if PointInPolygon2D(p.Point2D(), polygon) {
+		return 0
+	}
+
+	// Work in a local planar frame (mt) around p
+	metersPerDegLon := models.METERS_PER_DEGREE * math.Cos(p.Lat*math.Pi/180)
+	toLocal := func(q orb.Point) (float64, float64) {
+		return (q.Lon() - p.Lon) * metersPerDegLon, (q.Lat() - p.Lat) * models.METERS_PER_DEGREE
+	}
+
+	minDist := math.Inf(1)
+	ring := polygon[0]
+	for i := 1; i < len(ring); i++ {
+		ax, ay := toLocal(ring[i-1])
+		bx, by := toLocal(ring[i])
+		// Closest point of the edge to the origin (p)
+		dx, dy := bx-ax, by-ay
+		t := 0.0
+		if l2 := dx*dx + dy*dy; l2 > 0 {
+			t = math.Max(0, math.Min(1, -(ax*dx+ay*dy)/l2))
+		}
+		minDist = math.Min(minDist, math.Hypot(ax+t*dx, ay+t*dy))
+	}
+	return minDist
+}
+
+// RouteClearance returns the smallest horizontal distance (mt) between route, resampled every stepMt, and the constraints at the altitude of each point.
+// Returns +Inf if no constraint is ever at the altitude of the route.
+func RouteClearance(route []*models.Waypoint, constraints []*models.Feature3D, stepMt float64) float64 {
+	clearance := math.Inf(1)
+	for _, p := range ResampleRouteToInterval(route, stepMt) {
+		for _, c := range constraints {
+			if p.Alt.IsWithin(c.MinAltitude, c.MaxAltitude) {
+				clearance = math.Min(clearance, DistanceToPolygon(p, c))
+			}
+		}
+	}
+	return clearance
+}
+
+// AcceptanceEntryPoint returns where the line p1 -> p2 enters the acceptance radius of goal, within 1 mt, as an entry point standing for goal.
+// Returns nil if goal has no acceptance radius or the line doesn't get close enough.
+func AcceptanceEntryPoint(p1, p2, goal *models.Waypoint) *models.Waypoint {
+	radius := goal.AcceptanceRadiusMt()
+	if radius <= 0 || HaversineDistance3D(p1, goal)-HaversineDistance3D(p1, p2) > radius {
+		return nil
+	}
+	for _, p := range ResampleLineToInterval(p1, p2, 1) {
+		if HaversineDistance3D(p, goal) <= radius {
+			return models.NewEntryPoint(p, goal)
+		}
+	}
+	return nil
+}
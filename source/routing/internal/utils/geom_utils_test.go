@@ -2,7 +2,9 @@ package utils
 
 import (
 	"geopathplanner/routing/internal/models"
+	"math"
 	"testing"
+	"time"
 )
 
 func TestLineInPolygon(t *testing.T) {
@@ -197,4 +199,64 @@ func TestLineInPolygon(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+func TestPointInPolygonAt(t *testing.T) {
+	feature := func(properties string) *models.Feature3D {
+		return models.MustNewFeatureFromGeojson(`{"type": "Feature", "properties": {"altitudeUnit": "mt", "minAltitudeValue": 0, "maxAltitudeValue": 200` + properties + `}, "geometry": {"type": "Polygon", "coordinates": [[[4.0, 49.999], [4.002, 49.999], [4.002, 50.001], [4.0, 50.001], [4.0, 49.999]]]}}`)
+	}
+	at, _ := time.Parse(time.RFC3339, "2026-10-17T10:00:30Z")
+	low, _ := models.NewAltitude(100, models.MT)
+	high, _ := models.NewAltitude(300, models.MT)
+
+	tests := []struct {
+		name string // description of this test case
+		p    *models.Waypoint
+		poly *models.Feature3D
+		want bool
+	}{
+		{name: "Inside", p: models.MustNewWaypoint(0, 50.0, 4.001, low), poly: feature(``), want: true},
+		{name: "Above", p: models.MustNewWaypoint(0, 50.0, 4.001, high), poly: feature(``), want: false},
+		{name: "Outside", p: models.MustNewWaypoint(0, 50.0, 4.003, low), poly: feature(``), want: false},
+		{name: "Not active yet", p: models.MustNewWaypoint(0, 50.0, 4.001, low), poly: feature(`, "active_from": "2026-10-17T11:00:00Z"`), want: false},
+		{name: "Moved away", p: models.MustNewWaypoint(0, 50.0, 4.001, low), poly: feature(`, "speed_ms": 10, "heading_deg": 90, "reference_time": "2026-10-17T10:00:00Z"`), want: false},
+		{name: "Moved over", p: models.MustNewWaypoint(0, 50.0, 4.0052, low), poly: feature(`, "speed_ms": 10, "heading_deg": 90, "reference_time": "2026-10-17T10:00:00Z"`), want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PointInPolygonAt(tt.p, tt.poly, at); got != tt.want {
+				t.Errorf("PointInPolygonAt() = %t, want %t", got, tt.want)
+			}
+			// p may be shared by planners running at once, it's never written
+			if _, ok := tt.p.Feature.Properties["inside"]; ok {
+				t.Errorf("PointInPolygonAt() wrote on p: %v", tt.p.Feature.Properties)
+			}
+		})
+	}
+}
+
+func TestDistanceToPolygon(t *testing.T) {
+	polygon := models.MustNewFeatureFromGeojson(`{"type": "Feature", "properties": {}, "geometry": {"type": "Polygon", "coordinates": [[[4.0, 49.999], [4.002, 49.999], [4.002, 50.001], [4.0, 50.001], [4.0, 49.999]]]}}`)
+	multiPolygon := models.MustNewFeatureFromGeojson(`{"type": "Feature", "properties": {}, "geometry": {"type": "MultiPolygon", "coordinates": [[[[4.0, 49.999], [4.002, 49.999], [4.002, 50.001], [4.0, 50.001], [4.0, 49.999]]], [[[4.004, 49.999], [4.006, 49.999], [4.006, 50.001], [4.004, 50.001], [4.004, 49.999]]]]}}`)
+	alt, _ := models.NewAltitude(100, models.MT)
+	metersPerDegLon := models.METERS_PER_DEGREE * math.Cos(50.0*math.Pi/180)
+
+	tests := []struct {
+		name string // description of this test case
+		p    *models.Waypoint
+		poly *models.Feature3D
+		want float64
+	}{
+		{name: "Inside", p: models.MustNewWaypoint(0, 50.0, 4.001, alt), poly: polygon, want: 0},
+		{name: "East of the polygon", p: models.MustNewWaypoint(0, 50.0, 4.003, alt), poly: polygon, want: 0.001 * metersPerDegLon},
+		{name: "Closer to the second polygon", p: models.MustNewWaypoint(0, 50.0, 4.0035, alt), poly: multiPolygon, want: 0.0005 * metersPerDegLon},
+		{name: "Inside the second polygon", p: models.MustNewWaypoint(0, 50.0, 4.005, alt), poly: multiPolygon, want: 0},
+		{name: "East of both polygons", p: models.MustNewWaypoint(0, 50.0, 4.007, alt), poly: multiPolygon, want: 0.001 * metersPerDegLon},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DistanceToPolygon(tt.p, tt.poly); math.Abs(got-tt.want) > 1e-6 {
+				t.Errorf("DistanceToPolygon() = %f, want %f", got, tt.want)
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package utils
 import (
 	"fmt"
 	"geopathplanner/routing/internal/models"
+	"math"
 	"math/rand"
 	"time"
 
@@ -166,7 +167,7 @@ func (s *GoalBiasSampler) SampleXY(minX, maxX, minY, maxY float64) (float64, flo
 
 func (s *GoalBiasSampler) SampleXYZ(minX, maxX, minY, maxY, minZ, maxZ float64) (float64, float64, float64) {
 	if s.useGoal() {
-		return s.Goal.Lon, s.Goal.Lat, s.Goal.Alt.Value
+		return s.Goal.Lon, s.Goal.Lat, s.Goal.Alt.Normalize().Value
 	}
 	return s.InternalSampler.SampleXYZ(minX, maxX, minY, maxY, minZ, maxZ)
 }
@@ -174,13 +175,97 @@ func (s *GoalBiasSampler) SampleXYZ(minX, maxX, minY, maxY, minZ, maxZ float64)
 func (s *GoalBiasSampler) SampleZ(minZ, maxZ float64) (float64) {
 	// Here do not check again if we have to use goal or no, we assume the choice was already been done
 	if s.last_chosen_goal {
-		return s.Goal.Alt.Value
+		return s.Goal.Alt.Normalize().Value
 	}
 	return s.InternalSampler.SampleZ(minZ, maxZ)
 }
 
 // -------------------------------------------------------------------------------------------
 
+// InformedSampler restricts the samples to the prolate ellipsoid having start and goal as focal points and the best cost found so far as transverse diameter.
+// Every point outside of it cannot improve the current route. Until a best cost is set, it behaves like the internal sampler.
+type InformedSampler struct {
+	InternalSampler Sampler
+	Start *models.Waypoint
+	Goal *models.Waypoint
+	BestCost float64
+}
+
+func NewInformedSampler(sampler Sampler, start, goal *models.Waypoint) *InformedSampler {
+	return &InformedSampler{
+		InternalSampler: sampler,
+		Start: start,
+		Goal: goal,
+		BestCost: math.Inf(1),
+	}
+}
+
+// SetBestCost shrinks the ellipsoid, it's ignored if cost is not better than the current one.
+func (s *InformedSampler) SetBestCost(cost float64) {
+	if cost < s.BestCost {
+		s.BestCost = cost
+	}
+}
+
+func (s *InformedSampler) IsInformed() bool {
+	return !math.IsInf(s.BestCost, 1)
+}
+
+func (s *InformedSampler) SampleXY(minX, maxX, minY, maxY float64) (float64, float64) {
+	if !s.IsInformed() {
+		return s.InternalSampler.SampleXY(minX, maxX, minY, maxY)
+	}
+
+	// Work in a local planar frame (mt) centered in the middle point between start and goal
+	lon0, lat0 := (s.Start.Lon+s.Goal.Lon)/2, (s.Start.Lat+s.Goal.Lat)/2
+	metersPerDegLon := models.METERS_PER_DEGREE * math.Cos(lat0*math.Pi/180)
+	dx := (s.Goal.Lon - s.Start.Lon) * metersPerDegLon
+	dy := (s.Goal.Lat - s.Start.Lat) * models.METERS_PER_DEGREE
+
+	// Horizontal distance between the foci is <= than the 3D one, so this ellipse always contains the informed set at any altitude
+	cMin := math.Hypot(dx, dy)
+	r1 := s.BestCost / 2
+	r2 := math.Sqrt(math.Max(s.BestCost*s.BestCost-cMin*cMin, 0)) / 2
+	theta := math.Atan2(dy, dx)
+
+	// Sample the unit disk with the internal sampler (rejection), then scale and rotate it
+	var u, v float64
+	for {
+		u, v = s.InternalSampler.SampleXY(-1, 1, -1, 1)
+		if u*u+v*v <= 1 {
+			break
+		}
+	}
+	x := r1*u*math.Cos(theta) - r2*v*math.Sin(theta)
+	y := r1*u*math.Sin(theta) + r2*v*math.Cos(theta)
+
+	return lon0 + x/metersPerDegLon, lat0 + y/models.METERS_PER_DEGREE
+}
+
+func (s *InformedSampler) SampleXYZ(minX, maxX, minY, maxY, minZ, maxZ float64) (float64, float64, float64) {
+	if !s.IsInformed() {
+		return s.InternalSampler.SampleXYZ(minX, maxX, minY, maxY, minZ, maxZ)
+	}
+
+	x, y := s.SampleXY(minX, maxX, minY, maxY)
+	return x, y, s.SampleZ(minZ, maxZ)
+}
+
+func (s *InformedSampler) SampleZ(minZ, maxZ float64) float64 {
+	if !s.IsInformed() {
+		return s.InternalSampler.SampleZ(minZ, maxZ)
+	}
+
+	// Altitude is bounded by the semi-minor axis of the ellipsoid around the middle altitude
+	cMin := HaversineDistance3D(s.Start, s.Goal)
+	r2 := math.Sqrt(math.Max(s.BestCost*s.BestCost-cMin*cMin, 0)) / 2
+	z0 := (s.Start.Alt.Normalize().Value + s.Goal.Alt.Normalize().Value) / 2
+
+	return s.InternalSampler.SampleZ(math.Max(minZ, z0-r2), math.Min(maxZ, z0+r2))
+}
+
+// -------------------------------------------------------------------------------------------
+
 func Sample2D(sampler Sampler, geometry orb.Geometry) (orb.Point, error) {
 	// 1. Retrieve bounding box to sample there
 	bound := geometry.Bound()
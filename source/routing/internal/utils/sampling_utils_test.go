@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"testing"
+)
+
+func TestInformedSampler_SampleXY(t *testing.T) {
+	_, w_list, _, _ := SetupTestScenario()
+	start, goal := w_list[0], w_list[1]
+	cMin := HaversineDistance3D(start, goal)
+
+	tests := []struct {
+		name     string // description of this test case
+		bestCost float64
+	}{
+		{name: "Informed - tight ellipse", bestCost: cMin * 1.05},
+		{name: "Informed - wide ellipse", bestCost: cMin * 1.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewInformedSampler(NewUniformSampler(945), start, goal)
+			s.SetBestCost(tt.bestCost)
+
+			for range 1000 {
+				lon, lat := s.SampleXY(-180, 180, -90, 90)
+				wp := *start
+				wp.Lon, wp.Lat = lon, lat
+
+				// Every sample must be able to improve the current best cost (small tolerance for the planar approximation)
+				if d := HaversineDistance3D(start, &wp) + HaversineDistance3D(&wp, goal); d > tt.bestCost*1.01 {
+					t.Fatalf("SampleXY() = (%f, %f) outside of informed set: %.3f mt > %.3f mt", lon, lat, d, tt.bestCost)
+				}
+			}
+		})
+	}
+}
+
+func TestInformedSampler_NotInformed(t *testing.T) {
+	_, w_list, _, _ := SetupTestScenario()
+	s := NewInformedSampler(NewUniformSampler(945), w_list[0], w_list[1])
+	reference := NewUniformSampler(945)
+
+	// Without a best cost it must behave exactly like the internal sampler
+	for range 100 {
+		x, y := s.SampleXY(0, 1, 0, 1)
+		wantX, wantY := reference.SampleXY(0, 1, 0, 1)
+		if x != wantX || y != wantY {
+			t.Fatalf("SampleXY() = (%f, %f), want (%f, %f)", x, y, wantX, wantY)
+		}
+	}
+}
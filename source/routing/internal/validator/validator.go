@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"geopathplanner/routing/internal/models"
 	"geopathplanner/routing/internal/storage"
+	"slices"
 )
 
 type Validator interface {
@@ -51,6 +52,18 @@ func (v *DefaultValidator) ValidateInput(searchVolume *models.Feature3D, waypoin
 	if err != nil {
 		return nil, nil, err
 	}
+	// Soft constraints are not in the rtree, keep the ones whose bbox intersects the search volume like the hard ones
+	for _, c := range s.GetSoftConstraints() {
+		if searchVolume.Bound().Intersects(c.Bound()) {
+			validatedConstraints = append(validatedConstraints, c)
+		}
+	}
+	// Moving constraints may enter the search volume later, keep them all
+	for _, c := range s.MustGetConstraints() {
+		if c.IsMoving() && !slices.Contains(validatedConstraints, c) {
+			validatedConstraints = append(validatedConstraints, c)
+		}
+	}
 	fmt.Printf("%d/%d constraints are in search volume\n", len(validatedConstraints), len(constraints))
 
 	// 3. Check waypoints, discard ones that are not in search volume